@@ -10,6 +10,7 @@ import (
 
 	_ "github.com/TangSengDaoDao/TangSengDaoDaoServer/internal"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/module"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
@@ -89,6 +90,7 @@ func runAPI(ctx *config.Context) {
 		}
 		gin.Logger()(c)
 	})
+	s.GetRoute().Use(user.SessionMiddleware(ctx)) // 拒绝已注销的登录会话 需要放在模块安装的前面
 	// 模块安装
 	err := module.Setup(ctx)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"embed"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/register"
 )
@@ -11,6 +12,9 @@ import (
 //go:embed sql
 var sqlFS embed.FS
 
+//go:embed swagger/api.yaml
+var swaggerContent string
+
 func init() {
 
 	register.AddModule(func(ctx interface{}) register.Module {
@@ -22,4 +26,14 @@ func init() {
 			SQLDir: register.NewSQLFS(sqlFS),
 		}
 	})
+
+	register.AddModule(func(ctx interface{}) register.Module {
+		return register.Module{
+			Name: "audit",
+			SetupAPI: func() register.APIRouter {
+				return audit.NewManager(ctx.(*config.Context))
+			},
+			Swagger: swaggerContent,
+		}
+	})
 }
@@ -1,5 +1,8 @@
 package app
 
+// DefaultScopes 新建app默认允许申请的scope
+const DefaultScopes = "openid profile"
+
 // Status app状态
 type Status int
 
@@ -29,16 +29,44 @@ func (d *DB) existWithAppID(appID string) (bool, error) {
 	return count > 0, err
 }
 
+func (d *DB) queryAll() ([]*model, error) {
+	var models []*model
+	_, err := d.session.Select("*").From("app").OrderDir("created_at", true).Load(&models)
+	return models, err
+}
+
+func (d *DB) update(m *model) error {
+	_, err := d.session.Update("app").SetMap(map[string]interface{}{
+		"app_name":      m.AppName,
+		"app_logo":      m.AppLogo,
+		"redirect_uris": m.RedirectUris,
+		"scopes":        m.Scopes,
+		"confidential":  m.Confidential,
+		"rate_limit":    m.RateLimit,
+		"status":        m.Status,
+	}).Where("app_id=?", m.AppID).Exec()
+	return err
+}
+
+func (d *DB) updateAppKey(appID string, appKey string) error {
+	_, err := d.session.Update("app").Set("app_key", appKey).Where("app_id=?", appID).Exec()
+	return err
+}
+
 func (d *DB) insert(m *model) error {
 	_, err := d.session.InsertInto("app").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
 	return err
 }
 
 type model struct {
-	AppID   string
-	AppKey  string
-	AppName string
-	AppLogo string
-	Status  int
+	AppID        string
+	AppKey       string
+	AppName      string
+	AppLogo      string
+	RedirectUris string
+	Scopes       string
+	Confidential int
+	RateLimit    int
+	Status       int
 	db.BaseModel
 }
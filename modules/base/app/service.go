@@ -15,6 +15,12 @@ type IService interface {
 	GetApp(appID string) (*Resp, error)
 	// 创建app
 	CreateApp(r Req) (*Resp, error)
+	// GetApps 获取所有app
+	GetApps() ([]*Resp, error)
+	// UpdateApp 修改app的资料和OAuth2客户端配置
+	UpdateApp(r UpdateReq) error
+	// ResetAppKey 重置app key
+	ResetAppKey(appID string) (string, error)
 }
 
 // Service app服务
@@ -40,13 +46,47 @@ func (s *Service) GetApp(appID string) (*Resp, error) {
 	if appM == nil {
 		return nil, fmt.Errorf("app[%s]不存在！", appID)
 	}
-	return &Resp{
-		AppID:   appM.AppID,
-		AppName: appM.AppName,
-		AppLogo: appM.AppLogo,
-		AppKey:  appM.AppKey,
-		Status:  Status(appM.Status),
-	}, nil
+	return newResp(appM), nil
+}
+
+// GetApps 获取所有app
+func (s *Service) GetApps() ([]*Resp, error) {
+	models, err := s.db.queryAll()
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]*Resp, 0, len(models))
+	for _, m := range models {
+		resps = append(resps, newResp(m))
+	}
+	return resps, nil
+}
+
+// UpdateApp 修改app
+func (s *Service) UpdateApp(r UpdateReq) error {
+	if err := r.Check(); err != nil {
+		return err
+	}
+	return s.db.update(&model{
+		AppID:        r.AppID,
+		AppName:      r.AppName,
+		AppLogo:      r.AppLogo,
+		RedirectUris: strings.Join(r.RedirectURIs, " "),
+		Scopes:       strings.Join(r.Scopes, " "),
+		Confidential: r.Confidential,
+		RateLimit:    r.RateLimit,
+		Status:       r.Status.Int(),
+	})
+}
+
+// ResetAppKey 重置app key 旧的key立即失效
+func (s *Service) ResetAppKey(appID string) (string, error) {
+	appKey := util.GenerUUID()
+	err := s.db.updateAppKey(appID, appKey)
+	if err != nil {
+		return "", err
+	}
+	return appKey, nil
 }
 
 // CreateApp 创建APP 幂等
@@ -65,9 +105,11 @@ func (s *Service) CreateApp(r Req) (*Resp, error) {
 		appKey = util.GenerUUID()
 		appID = r.AppID
 		err = s.db.insert(&model{
-			AppID:  r.AppID,
-			Status: StatusEnable.Int(),
-			AppKey: appKey,
+			AppID:        r.AppID,
+			Status:       StatusEnable.Int(),
+			AppKey:       appKey,
+			Scopes:       DefaultScopes,
+			Confidential: 1,
 		})
 		if err != nil {
 			return nil, err
@@ -86,11 +128,29 @@ func (s *Service) CreateApp(r Req) (*Resp, error) {
 }
 
 type Resp struct {
-	AppID   string
-	AppKey  string
-	AppName string
-	AppLogo string
-	Status  Status
+	AppID        string
+	AppKey       string
+	AppName      string
+	AppLogo      string
+	RedirectURIs []string // 登记的回调地址
+	Scopes       []string // 允许申请的scope
+	Confidential int      // 是否为机密客户端
+	RateLimit    int      // 每分钟允许调用开放平台接口的次数 0.使用默认值
+	Status       Status
+}
+
+func newResp(m *model) *Resp {
+	return &Resp{
+		AppID:        m.AppID,
+		AppName:      m.AppName,
+		AppLogo:      m.AppLogo,
+		AppKey:       m.AppKey,
+		RedirectURIs: strings.Fields(m.RedirectUris),
+		Scopes:       strings.Fields(m.Scopes),
+		Confidential: m.Confidential,
+		RateLimit:    m.RateLimit,
+		Status:       Status(m.Status),
+	}
 }
 
 type Req struct {
@@ -103,3 +163,32 @@ func (r Req) Check() error {
 	}
 	return nil
 }
+
+type UpdateReq struct {
+	AppID        string
+	AppName      string
+	AppLogo      string
+	RedirectURIs []string
+	Scopes       []string
+	Confidential int
+	RateLimit    int
+	Status       Status
+}
+
+func (r UpdateReq) Check() error {
+	if len(strings.TrimSpace(r.AppID)) <= 0 {
+		return errors.New("appID不能为空！")
+	}
+	for _, uri := range r.RedirectURIs {
+		if uri == "" || strings.ContainsAny(uri, " \t\n") {
+			return fmt.Errorf("回调地址[%s]格式有误！", uri)
+		}
+	}
+	if r.RateLimit < 0 {
+		return errors.New("频率限制不能小于0！")
+	}
+	if len(strings.Join(r.RedirectURIs, " ")) > 2000 {
+		return errors.New("回调地址太长！")
+	}
+	return nil
+}
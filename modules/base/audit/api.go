@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 单次最多导出的日志数量
+const maxExportCount = 10000
+
+// Manager 审计日志后台管理
+type Manager struct {
+	ctx *config.Context
+	log.Log
+	db *DB
+}
+
+// NewManager NewManager
+func NewManager(ctx *config.Context) *Manager {
+	return &Manager{
+		ctx: ctx,
+		Log: log.NewTLog("auditManager"),
+		db:  newDB(ctx.DB()),
+	}
+}
+
+// Route 配置路由规则
+func (m *Manager) Route(r *wkhttp.WKHttp) {
+	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r))
+	{
+		auth.GET("/audit/logs", m.list)          // 审计日志
+		auth.GET("/audit/logs/export", m.export) // 导出审计日志
+	}
+}
+
+// 审计日志列表
+func (m *Manager) list(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	f, err := newFilter(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := m.db.query(f, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询审计日志错误", zap.Error(err))
+		c.ResponseError(errors.New("查询审计日志错误"))
+		return
+	}
+	count, err := m.db.queryCount(f)
+	if err != nil {
+		m.Error("查询审计日志数量错误", zap.Error(err))
+		c.ResponseError(errors.New("查询审计日志数量错误"))
+		return
+	}
+	list := make([]*logResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newLogResp(model))
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+// 导出审计日志（csv）
+func (m *Manager) export(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	f, err := newFilter(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := m.db.queryCount(f)
+	if err != nil {
+		m.Error("查询审计日志数量错误", zap.Error(err))
+		c.ResponseError(errors.New("查询审计日志数量错误"))
+		return
+	}
+	if count > maxExportCount {
+		c.ResponseError(fmt.Errorf("单次最多导出%d条日志，请缩小查询范围", maxExportCount))
+		return
+	}
+	models, err := m.db.query(f, maxExportCount, 1)
+	if err != nil {
+		m.Error("查询审计日志错误", zap.Error(err))
+		c.ResponseError(errors.New("查询审计日志错误"))
+		return
+	}
+	data, err := toCSV(models)
+	if err != nil {
+		m.Error("生成审计日志文件错误", zap.Error(err))
+		c.ResponseError(errors.New("生成审计日志文件错误"))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv", time.Now().Format("20060102150405")))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+func newFilter(c *wkhttp.Context) (filter, error) {
+	f := filter{
+		ActorUID: c.Query("actor_uid"),
+		Action:   c.Query("action"),
+		Target:   c.Query("target"),
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, err := time.ParseInLocation("2006-01-02", startDate, time.Local)
+		if err != nil {
+			return f, errors.New("开始日期格式有误，格式为2006-01-02")
+		}
+		f.StartAt = start.Format("2006-01-02 15:04:05")
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		end, err := time.ParseInLocation("2006-01-02", endDate, time.Local)
+		if err != nil {
+			return f, errors.New("结束日期格式有误，格式为2006-01-02")
+		}
+		f.EndAt = end.AddDate(0, 0, 1).Format("2006-01-02 15:04:05")
+	}
+	return f, nil
+}
+
+func toCSV(models []*model) ([]byte, error) {
+	buff := bytes.NewBuffer(nil)
+	buff.WriteString("\xEF\xBB\xBF") // BOM，避免excel打开中文乱码
+	writer := csv.NewWriter(buff)
+	err := writer.Write([]string{"id", "time", "actor_uid", "actor_name", "actor_role", "action", "method", "path", "target", "ip", "status", "diff"})
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range models {
+		err = writer.Write([]string{
+			strconv.FormatInt(model.Id, 10),
+			model.CreatedAt.String(),
+			model.ActorUID,
+			model.ActorName,
+			model.ActorRole,
+			model.Action,
+			model.Method,
+			model.Path,
+			model.Target,
+			model.IP,
+			strconv.Itoa(model.Status),
+			util.ToJson(diff(model.BeforeData, model.AfterData)),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buff.Bytes(), writer.Error()
+}
+
+type logResp struct {
+	ID        int64       `json:"id"`
+	ActorUID  string      `json:"actor_uid"`
+	ActorName string      `json:"actor_name"`
+	ActorRole string      `json:"actor_role"`
+	Action    string      `json:"action"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Target    string      `json:"target"`
+	Before    interface{} `json:"before"` // 操作前的数据
+	After     interface{} `json:"after"`  // 操作后的数据
+	Diff      []*diffResp `json:"diff"`   // 变化的字段
+	IP        string      `json:"ip"`
+	Status    int         `json:"status"` // 响应状态码
+	CreatedAt string      `json:"created_at"`
+}
+
+func newLogResp(m *model) *logResp {
+	return &logResp{
+		ID:        m.Id,
+		ActorUID:  m.ActorUID,
+		ActorName: m.ActorName,
+		ActorRole: m.ActorRole,
+		Action:    m.Action,
+		Method:    m.Method,
+		Path:      m.Path,
+		Target:    m.Target,
+		Before:    decodeValue(m.BeforeData),
+		After:     decodeValue(m.AfterData),
+		Diff:      diff(m.BeforeData, m.AfterData),
+		IP:        m.IP,
+		Status:    m.Status,
+		CreatedAt: m.CreatedAt.String(),
+	}
+}
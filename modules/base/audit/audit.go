@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	entryKey   = "audit_entry"
+	maskedText = "******"
+)
+
+// 字段名包含以下内容时不保存原值
+var sensitiveKeys = []string{"password", "secret", "token", "app_key", "appkey"}
+
+// Middleware 审计中间件，放在登录认证之后。
+// 请求结束后记录后台的写操作（GET请求不记录），处理函数可以通过Record补充操作名称、对象和修改前后的数据
+func Middleware(ctx *config.Context) wkhttp.HandlerFunc {
+	auditDB := newDB(ctx.DB())
+	lg := log.NewTLog("audit")
+	return func(c *wkhttp.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		c.Next()
+
+		m := newModel(c)
+		if err := auditDB.insert(m); err != nil {
+			lg.Error("保存审计日志失败！", zap.Error(err), zap.String("action", m.Action), zap.String("actor", m.ActorUID), zap.String("target", m.Target))
+		}
+	}
+}
+
+// Record 记录本次操作的审计信息 action为空时使用请求路由，before和after为操作前后的数据
+func Record(c *wkhttp.Context, action string, target string, before interface{}, after interface{}) {
+	c.Set(entryKey, &entry{
+		action: action,
+		target: target,
+		before: before,
+		after:  after,
+	})
+}
+
+type entry struct {
+	action string
+	target string
+	before interface{}
+	after  interface{}
+}
+
+func newModel(c *wkhttp.Context) *model {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	m := &model{
+		ActorUID:  c.GetString("uid"),
+		ActorName: c.GetString("name"),
+		ActorRole: c.GetLoginRole(),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		IP:        util.GetClientPublicIP(c.Request),
+		Status:    c.Writer.Status(),
+	}
+	if m.IP == "" {
+		m.IP = c.ClientIP()
+	}
+	var e *entry
+	if value, ok := c.Get(entryKey); ok {
+		e, _ = value.(*entry)
+	}
+	if e != nil {
+		m.Action = e.action
+		m.Target = e.target
+		m.BeforeData = toJSON(e.before)
+		m.AfterData = toJSON(e.after)
+	}
+	if m.Action == "" {
+		m.Action = fmt.Sprintf("%s %s", c.Request.Method, route)
+	}
+	if m.Target == "" {
+		params := make([]string, 0, len(c.Params))
+		for _, param := range c.Params {
+			params = append(params, fmt.Sprintf("%s=%s", param.Key, param.Value))
+		}
+		m.Target = strings.Join(params, ",")
+	}
+	if len(m.Target) > 255 {
+		m.Target = m.Target[:255]
+	}
+	return m
+}
+
+// toJSON 转换为json，敏感字段会被隐藏
+func toJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return ""
+	}
+	data, err = json.Marshal(mask(value))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func mask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if isSensitive(key) {
+				if item != nil && item != "" {
+					v[key] = maskedText
+				}
+				continue
+			}
+			v[key] = mask(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mask(item)
+		}
+	}
+	return value
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(util.UnderscoreName(key))
+	for _, sensitiveKey := range sensitiveKeys {
+		if strings.Contains(key, sensitiveKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// diff 比较操作前后的数据，返回变化的字段
+func diff(before, after string) []*diffResp {
+	beforeMap, beforeOk := decodeObject(before)
+	afterMap, afterOk := decodeObject(after)
+	if !beforeOk || !afterOk {
+		if before == after {
+			return []*diffResp{}
+		}
+		return []*diffResp{{Before: decodeValue(before), After: decodeValue(after)}}
+	}
+	fields := make([]string, 0, len(beforeMap)+len(afterMap))
+	for field := range beforeMap {
+		fields = append(fields, field)
+	}
+	for field := range afterMap {
+		if _, ok := beforeMap[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	diffs := make([]*diffResp, 0)
+	for _, field := range fields {
+		if reflect.DeepEqual(beforeMap[field], afterMap[field]) {
+			continue
+		}
+		diffs = append(diffs, &diffResp{
+			Field:  field,
+			Before: beforeMap[field],
+			After:  afterMap[field],
+		})
+	}
+	return diffs
+}
+
+// decodeObject 解码json对象，空数据视为空对象
+func decodeObject(data string) (map[string]interface{}, bool) {
+	if data == "" {
+		return map[string]interface{}{}, true
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func decodeValue(data string) interface{} {
+	if data == "" {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return data
+	}
+	return value
+}
+
+type diffResp struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
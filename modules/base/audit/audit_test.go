@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToJSONMasksSensitiveFields(t *testing.T) {
+	type config struct {
+		SMTPPassword string
+		SMTPAddr     string
+		Nested       map[string]interface{}
+	}
+	data := toJSON(&config{
+		SMTPPassword: "123456",
+		SMTPAddr:     "smtp.example.com:465",
+		Nested:       map[string]interface{}{"app_key": "abc", "name": "test"},
+	})
+	assert.NotContains(t, data, "123456")
+	assert.NotContains(t, data, "abc")
+	assert.Contains(t, data, "smtp.example.com:465")
+	assert.Contains(t, data, "test")
+
+	assert.Equal(t, "", toJSON(nil))
+	var c *config
+	assert.Equal(t, "", toJSON(c))
+}
+
+func TestDiff(t *testing.T) {
+	diffs := diff(`{"status":1,"name":"a"}`, `{"status":0,"name":"a"}`)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, "status", diffs[0].Field)
+	assert.Equal(t, float64(1), diffs[0].Before)
+	assert.Equal(t, float64(0), diffs[0].After)
+
+	diffs = diff("", `{"name":"a","role":"admin"}`)
+	assert.Len(t, diffs, 2)
+	assert.Equal(t, "name", diffs[0].Field)
+	assert.Nil(t, diffs[0].Before)
+
+	diffs = diff(`{"name":"a"}`, "")
+	assert.Len(t, diffs, 1)
+	assert.Nil(t, diffs[0].After)
+
+	assert.Empty(t, diff("", ""))
+	assert.Empty(t, diff(`{"name":"a"}`, `{"name":"a"}`))
+}
+
+func TestToCSV(t *testing.T) {
+	data, err := toCSV([]*model{{
+		ActorUID:   "admin",
+		Action:     "user.status",
+		Target:     "u1",
+		BeforeData: `{"status":1}`,
+		AfterData:  `{"status":0}`,
+		Status:     200,
+	}})
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "user.status")
+	assert.Contains(t, lines[1], "u1")
+	assert.Contains(t, lines[1], "status")
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+// DB 审计日志只追加，不提供修改和删除
+type DB struct {
+	session *dbr.Session
+}
+
+func newDB(session *dbr.Session) *DB {
+	return &DB{
+		session: session,
+	}
+}
+
+func (d *DB) insert(m *model) error {
+	_, err := d.session.InsertInto("audit_log").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (d *DB) query(f filter, pageSize, page uint64) ([]*model, error) {
+	var models []*model
+	_, err := d.builder("*", f).OrderDir("id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+func (d *DB) queryCount(f filter) (int64, error) {
+	var count int64
+	_, err := d.builder("count(*)", f).Load(&count)
+	return count, err
+}
+
+func (d *DB) builder(column string, f filter) *dbr.SelectStmt {
+	builder := d.session.Select(column).From("audit_log")
+	if f.ActorUID != "" {
+		builder = builder.Where("actor_uid=?", f.ActorUID)
+	}
+	if f.Action != "" {
+		builder = builder.Where("action like ?", "%"+f.Action+"%")
+	}
+	if f.Target != "" {
+		builder = builder.Where("target=?", f.Target)
+	}
+	if f.StartAt != "" {
+		builder = builder.Where("created_at>=?", f.StartAt)
+	}
+	if f.EndAt != "" {
+		builder = builder.Where("created_at<?", f.EndAt)
+	}
+	return builder
+}
+
+type filter struct {
+	ActorUID string
+	Action   string
+	Target   string
+	StartAt  string // 开始时间（包含）
+	EndAt    string // 结束时间（不包含）
+}
+
+type model struct {
+	ActorUID   string
+	ActorName  string
+	ActorRole  string
+	Action     string
+	Method     string
+	Path       string
+	Target     string
+	BeforeData string
+	AfterData  string
+	IP         string
+	Status     int
+	db.BaseModel
+}
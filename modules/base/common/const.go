@@ -14,9 +14,13 @@ const (
 	CodeTypeCheckMobile
 	// DestroyAccount 注销账号
 	CodeTypeDestroyAccount
+	// CodeTypeBindEmail 绑定邮箱
+	CodeTypeBindEmail
 )
 
 const (
 	// CacheKeySMSCode 短信验证码的缓存key
 	CacheKeySMSCode string = "smscode:"
+	// CacheKeyEmailCode 邮箱验证码的缓存key
+	CacheKeyEmailCode string = "emailcode:"
 )
@@ -0,0 +1,248 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	emailCodeLength = 6
+	emailCodeExpire = time.Minute * 10
+	smtpDialTimeout = time.Second * 10
+)
+
+// IEmailProvider 邮件发送提供商
+type IEmailProvider interface {
+	SendEmail(ctx context.Context, to string, subject string, body string) error
+}
+
+// IEmailService 邮件验证码服务
+type IEmailService interface {
+	// 发送验证码
+	SendVerifyCode(ctx context.Context, email string, codeType CodeType) error
+	// 验证验证码(销毁缓存)
+	Verify(ctx context.Context, email, code string, codeType CodeType) error
+}
+
+// SMTPConfig SMTP配置
+type SMTPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	SSL      bool // true: 直接TLS连接（一般为465端口） false: 明文连接，服务端支持时升级STARTTLS
+}
+
+// SMTPProvider SMTP邮件发送
+type SMTPProvider struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPProvider 创建SMTP邮件发送
+func NewSMTPProvider(cfg SMTPConfig) *SMTPProvider {
+	return &SMTPProvider{
+		cfg: cfg,
+	}
+}
+
+// SendEmail 发送html邮件
+func (s *SMTPProvider) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	if s.cfg.Addr == "" || s.cfg.From == "" {
+		return errors.New("没有配置SMTP服务！")
+	}
+	host, _, err := net.SplitHostPort(s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	var conn net.Conn
+	if s.cfg.SSL {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.cfg.Addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(smtpDialTimeout * 3))
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !s.cfg.SSL {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+	}
+	if s.cfg.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err = client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)); err != nil {
+				return err
+			}
+		}
+	}
+	if err = client.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(buildEmailMessage(s.cfg.From, to, subject, body)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func buildEmailMessage(from, to, subject, body string) []byte {
+	var buff bytes.Buffer
+	buff.WriteString("From: " + from + "\r\n")
+	buff.WriteString("To: " + to + "\r\n")
+	buff.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	buff.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buff.WriteString("MIME-Version: 1.0\r\n")
+	buff.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buff.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 { // RFC 2045 每行不超过76个字符
+		buff.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buff.WriteString(encoded + "\r\n")
+	return buff.Bytes()
+}
+
+type emailTemplate struct {
+	subject string
+	body    *template.Template
+}
+
+var emailTemplates = map[CodeType]emailTemplate{
+	CodeTypeRegister:       newEmailTemplate("%s 注册验证码", "您正在注册{{.AppName}}账号"),
+	CodeTypeForgetLoginPWD: newEmailTemplate("%s 重置密码验证码", "您正在重置{{.AppName}}登录密码"),
+	CodeTypeCheckMobile:    newEmailTemplate("%s 登录验证码", "您正在新设备上登录{{.AppName}}"),
+	CodeTypeDestroyAccount: newEmailTemplate("%s 注销账号验证码", "您正在注销{{.AppName}}账号"),
+	CodeTypeBindEmail:      newEmailTemplate("%s 绑定邮箱验证码", "您正在为{{.AppName}}账号绑定邮箱"),
+}
+
+func newEmailTemplate(subject string, action string) emailTemplate {
+	return emailTemplate{
+		subject: subject,
+		body: template.Must(template.New("").Parse(`<div style="font-family:Arial,sans-serif;font-size:14px;color:#333">` +
+			`<p>` + action + `，验证码为：</p>` +
+			`<p style="font-size:28px;font-weight:bold;letter-spacing:6px">{{.Code}}</p>` +
+			`<p>验证码{{.Minutes}}分钟内有效，请勿泄露给他人。如非本人操作，请忽略本邮件。</p></div>`)),
+	}
+}
+
+// renderEmail 渲染验证码邮件 返回主题和内容
+func renderEmail(codeType CodeType, appName string, code string) (string, string, error) {
+	tpl, ok := emailTemplates[codeType]
+	if !ok {
+		return "", "", errors.New("不支持的验证码类型！")
+	}
+	data := map[string]interface{}{
+		"AppName": appName,
+		"Code":    code,
+		"Minutes": int(emailCodeExpire.Minutes()),
+	}
+	var body bytes.Buffer
+	if err := tpl.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf(tpl.subject, appName), body.String(), nil
+}
+
+// EmailService 邮件验证码服务
+type EmailService struct {
+	ctx      *config.Context
+	provider func() (IEmailProvider, error)
+	log.Log
+}
+
+// NewEmailService 创建邮件验证码服务 provider每次发送时调用（配置可能在后台被修改）
+func NewEmailService(ctx *config.Context, provider func() (IEmailProvider, error)) *EmailService {
+	return &EmailService{
+		ctx:      ctx,
+		provider: provider,
+		Log:      log.NewTLog("EmailService"),
+	}
+}
+
+// SendVerifyCode 发送验证码
+func (e *EmailService) SendVerifyCode(ctx context.Context, email string, codeType CodeType) error {
+	provider, err := e.provider()
+	if err != nil {
+		return err
+	}
+	verifyCode := ""
+	for i := 0; i < emailCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return err
+		}
+		verifyCode += n.String()
+	}
+	subject, body, err := renderEmail(codeType, e.ctx.GetConfig().AppName, verifyCode)
+	if err != nil {
+		return err
+	}
+	err = e.ctx.GetRedisConn().SetAndExpire(emailCodeCacheKey(email, codeType), verifyCode, emailCodeExpire)
+	if err != nil {
+		return err
+	}
+	return provider.SendEmail(ctx, email, subject, body)
+}
+
+// Verify 验证验证码
+func (e *EmailService) Verify(ctx context.Context, email, code string, codeType CodeType) error {
+	span, _ := e.ctx.Tracer().StartSpanFromContext(ctx, "emailService.Verify")
+	defer span.Finish()
+
+	cacheKey := emailCodeCacheKey(email, codeType)
+	sysCode, err := e.ctx.GetRedisConn().GetString(cacheKey)
+	if err != nil {
+		return err
+	}
+	if sysCode != "" && sysCode == code {
+		e.ctx.GetRedisConn().Del(cacheKey)
+		return nil
+	}
+	e.Info("邮箱验证码错误", zap.String("email", email), zap.String("code", code))
+	return errors.New("验证码无效！")
+}
+
+func emailCodeCacheKey(email string, codeType CodeType) string {
+	return fmt.Sprintf("%s%d@%s", CacheKeyEmailCode, codeType, strings.ToLower(email))
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSMTPMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// 本地模拟SMTP服务 只实现发信需要的最少命令
+func startFakeSMTP(t *testing.T) (string, chan *fakeSMTPMail) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan *fakeSMTPMail, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		write := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		write("220 localhost ESMTP")
+		mail := &fakeSMTPMail{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				mail.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+				write("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				mail.to = append(mail.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+				write("250 OK")
+			case cmd == "DATA":
+				write("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dl, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dl == ".\r\n" {
+						break
+					}
+					data.WriteString(dl)
+				}
+				mail.data = data.String()
+				write("250 OK")
+				mails <- mail
+			case cmd == "QUIT":
+				write("221 Bye")
+				return
+			default:
+				write("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestSMTPProviderSendEmail(t *testing.T) {
+	addr, mails := startFakeSMTP(t)
+	provider := NewSMTPProvider(SMTPConfig{
+		Addr: addr,
+		From: "noreply@example.com",
+	})
+	subject, body, err := renderEmail(CodeTypeRegister, "TestApp", "123456")
+	assert.NoError(t, err)
+
+	err = provider.SendEmail(context.Background(), "user@example.com", subject, body)
+	assert.NoError(t, err)
+
+	mail := <-mails
+	assert.Equal(t, "noreply@example.com", mail.from)
+	assert.Equal(t, []string{"user@example.com"}, mail.to)
+	assert.Contains(t, mail.data, "To: user@example.com\r\n")
+	assert.Contains(t, mail.data, "Subject: =?UTF-8?b?")
+
+	parts := strings.SplitN(mail.data, "\r\n\r\n", 2)
+	assert.Len(t, parts, 2)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(parts[1], "\r\n", ""))
+	assert.NoError(t, err)
+	assert.Contains(t, string(decoded), "123456")
+	assert.Contains(t, string(decoded), "TestApp")
+}
+
+func TestRenderEmail(t *testing.T) {
+	subject, body, err := renderEmail(CodeTypeForgetLoginPWD, "<App>", "654321")
+	assert.NoError(t, err)
+	assert.Equal(t, "<App> 重置密码验证码", subject)
+	assert.Contains(t, body, "654321")
+	assert.Contains(t, body, "&lt;App&gt;")
+
+	_, _, err = renderEmail(CodeTypePayPWD, "App", "000000")
+	assert.Error(t, err)
+}
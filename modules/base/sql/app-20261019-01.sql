@@ -0,0 +1,6 @@
+-- +migrate Up
+
+-- OAuth2客户端配置（app_id为client_id，app_key为client_secret）
+ALTER TABLE `app` ADD COLUMN redirect_uris VARCHAR(2000) NOT NULL DEFAULT '' COMMENT '登记的回调地址（空格分隔，必须完全匹配）';
+ALTER TABLE `app` ADD COLUMN scopes VARCHAR(255) NOT NULL DEFAULT 'openid profile' COMMENT '允许申请的scope（空格分隔）';
+ALTER TABLE `app` ADD COLUMN confidential smallint NOT NULL DEFAULT 1 COMMENT '是否为机密客户端 1.需要app_key认证 0.公开客户端（必须使用PKCE）';
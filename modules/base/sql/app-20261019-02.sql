@@ -0,0 +1,4 @@
+-- +migrate Up
+
+-- 开放平台接口频率限制
+ALTER TABLE `app` ADD COLUMN rate_limit integer NOT NULL DEFAULT 0 COMMENT '每分钟允许调用开放平台接口的次数 0.使用默认值';
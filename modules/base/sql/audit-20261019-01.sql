@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- 后台操作审计日志（只追加，不提供修改和删除）
+create table IF NOT EXISTS `audit_log`
+(
+    id integer PRIMARY KEY AUTO_INCREMENT,
+    actor_uid    VARCHAR(40)   not null DEFAULT '' comment '操作人uid',
+    actor_name   VARCHAR(100)  not null DEFAULT '' comment '操作人名称',
+    actor_role   VARCHAR(40)   not null DEFAULT '' comment '操作人角色 admin.管理员 superAdmin.超级管理员',
+    action       VARCHAR(100)  not null DEFAULT '' comment '操作',
+    method       VARCHAR(10)   not null DEFAULT '' comment '请求方法',
+    path         VARCHAR(255)  not null DEFAULT '' comment '请求路径',
+    target       VARCHAR(255)  not null DEFAULT '' comment '操作对象',
+    before_data  mediumtext    comment '操作前的数据（json）',
+    after_data   mediumtext    comment '操作后的数据（json）',
+    ip           VARCHAR(100)  not null DEFAULT '' comment '操作人IP',
+    status       integer       not null DEFAULT 0 comment '响应状态码',
+    created_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP,
+    updated_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX audit_log_actor_uid_idx on `audit_log` (actor_uid);
+CREATE INDEX audit_log_action_idx on `audit_log` (action);
+CREATE INDEX audit_log_target_idx on `audit_log` (target);
+CREATE INDEX audit_log_created_at_idx on `audit_log` (created_at);
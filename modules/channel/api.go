@@ -82,7 +82,7 @@ func (ch *Channel) clearChannelMessages(c *wkhttp.Context) {
 	if channelType == common.ChannelTypePerson.Uint8() {
 		fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
 	} else {
-		isCreatorOrManager, err := ch.groupService.IsCreatorOrManager(channelID, loginUID)
+		isCreatorOrManager, err := ch.groupService.HasPermission(channelID, loginUID, group.ManagerPermissionDeleteMessage)
 		if err != nil {
 			c.ResponseError(errors.New("查询群的创建者或管理员错误"))
 			ch.Error("查询群的创建者或管理员错误", zap.Error(err))
@@ -280,7 +280,7 @@ func (ch *Channel) setAutoDeleteForMessage(c *wkhttp.Context) {
 	if channelType == common.ChannelTypePerson.Uint8() {
 		fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
 	} else {
-		isCreatorOrManager, err := ch.groupService.IsCreatorOrManager(channelID, loginUID)
+		isCreatorOrManager, err := ch.groupService.HasPermission(channelID, loginUID, group.ManagerPermissionChangeInfo)
 		if err != nil {
 			c.ResponseError(errors.New("查询群的创建者或管理员错误"))
 			ch.Error("查询群的创建者或管理员错误", zap.Error(err))
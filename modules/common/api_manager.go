@@ -2,8 +2,11 @@ package common
 
 import (
 	"errors"
+	"os"
 	"strings"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/password"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
@@ -30,7 +33,7 @@ func NewManager(ctx *config.Context) *Manager {
 
 // Route 配置路由规则
 func (m *Manager) Route(r *wkhttp.WKHttp) {
-	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r))
+	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r), audit.Middleware(m.ctx))
 	{
 		auth.GET("/common/appconfig", m.appconfig)               // 获取app配置
 		auth.POST("/common/appconfig", m.updateConfig)           // 修改app配置
@@ -228,6 +231,17 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 		GroupMemberLimit                       int    `json:"group_member_limit"`                           // 群人数限制
 		UserAgreementContent                   string `json:"user_agreement_content"`                       // 用户协议内容
 		PrivacyPolicyContent                   string `json:"privacy_policy_content"`                       // 隐私政策内容                      // 好友分享是否可见
+		PasswordHasher                         string `json:"password_hasher"`                              // 登录密码hash算法
+		PasswordMinLength                      int    `json:"password_min_length"`                          // 登录密码最小长度
+		PasswordMinClasses                     int    `json:"password_min_classes"`                         // 登录密码至少包含几类字符
+		PasswordBreachedFile                   string `json:"password_breached_file"`                       // 泄露密码库文件路径
+		AdminTotpRequired                      int    `json:"admin_totp_required"`                          // 后台管理员是否必须开启两步验证
+		EmailOn                                int    `json:"email_on"`                                     // 是否开启邮箱注册登录
+		SMTPAddr                               string `json:"smtp_addr"`                                    // SMTP服务地址 host:port
+		SMTPUsername                           string `json:"smtp_username"`                                // SMTP用户名
+		SMTPPassword                           string `json:"smtp_password"`                                // SMTP密码（为空则不修改）
+		SMTPFrom                               string `json:"smtp_from"`                                    // 发件人地址
+		SMTPSSL                                int    `json:"smtp_ssl"`                                     // 是否使用SSL直连
 	}
 	var req reqVO
 	if err := c.BindJSON(&req); err != nil {
@@ -275,6 +289,41 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 	configMap["group_member_limit"] = req.GroupMemberLimit
 	configMap["user_agreement_content"] = req.UserAgreementContent
 	configMap["privacy_policy_content"] = req.PrivacyPolicyContent
+	if req.PasswordHasher != "" {
+		if req.PasswordHasher != password.Argon2id && req.PasswordHasher != password.Bcrypt {
+			c.ResponseError(errors.New("不支持的密码算法"))
+			return
+		}
+		configMap["password_hasher"] = req.PasswordHasher
+	}
+	if req.PasswordMinLength > 0 {
+		configMap["password_min_length"] = req.PasswordMinLength
+	}
+	if req.PasswordMinClasses < 0 || req.PasswordMinClasses > 4 {
+		c.ResponseError(errors.New("密码字符种类数必须在0-4之间"))
+		return
+	}
+	configMap["password_min_classes"] = req.PasswordMinClasses
+	if req.PasswordBreachedFile != "" {
+		if _, err := os.Stat(req.PasswordBreachedFile); err != nil {
+			c.ResponseError(errors.New("泄露密码库文件不存在"))
+			return
+		}
+	}
+	configMap["password_breached_file"] = req.PasswordBreachedFile
+	configMap["admin_totp_required"] = req.AdminTotpRequired
+	if req.EmailOn == 1 && (strings.TrimSpace(req.SMTPAddr) == "" || strings.TrimSpace(req.SMTPFrom) == "") {
+		c.ResponseError(errors.New("开启邮箱注册登录需要配置SMTP服务地址和发件人"))
+		return
+	}
+	configMap["email_on"] = req.EmailOn
+	configMap["smtp_addr"] = strings.TrimSpace(req.SMTPAddr)
+	configMap["smtp_username"] = req.SMTPUsername
+	if req.SMTPPassword != "" {
+		configMap["smtp_password"] = req.SMTPPassword
+	}
+	configMap["smtp_from"] = strings.TrimSpace(req.SMTPFrom)
+	configMap["smtp_ssl"] = req.SMTPSSL
 
 	err = m.appconfigDB.updateWithMap(configMap, appConfigM.Id)
 	if err != nil {
@@ -282,6 +331,13 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 		c.ResponseError(errors.New("修改app配置信息错误"))
 		return
 	}
+	newAppConfigM, err := m.appconfigDB.query()
+	if err != nil {
+		m.Warn("查询修改后的应用配置失败！", zap.Error(err))
+		audit.Record(c, "app_config.update", "", appConfigM, configMap)
+	} else {
+		audit.Record(c, "app_config.update", "", appConfigM, newAppConfigM)
+	}
 	c.ResponseOK()
 }
 func (m *Manager) appconfig(c *wkhttp.Context) {
@@ -330,6 +386,16 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 	var groupMemberLimit = 0
 	var userAgreementContent = ""
 	var privacyPolicyContent = ""
+	var passwordHasher = password.Argon2id
+	var passwordMinLength = 6
+	var passwordMinClasses = 0
+	var passwordBreachedFile = ""
+	var adminTotpRequired = 0
+	var emailOn = 0
+	var smtpAddr = ""
+	var smtpUsername = ""
+	var smtpFrom = ""
+	var smtpSSL = 0
 	if appconfig != nil {
 		revokeSecond = appconfig.RevokeSecond
 		welcomeMessage = appconfig.WelcomeMessage
@@ -365,6 +431,16 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 		groupMemberLimit = appconfig.GroupMemberLimit
 		userAgreementContent = appconfig.UserAgreementContent
 		privacyPolicyContent = appconfig.PrivacyPolicyContent
+		passwordHasher = appconfig.PasswordHasher
+		passwordMinLength = appconfig.PasswordMinLength
+		passwordMinClasses = appconfig.PasswordMinClasses
+		passwordBreachedFile = appconfig.PasswordBreachedFile
+		adminTotpRequired = appconfig.AdminTotpRequired
+		emailOn = appconfig.EmailOn
+		smtpAddr = appconfig.SMTPAddr
+		smtpUsername = appconfig.SMTPUsername
+		smtpFrom = appconfig.SMTPFrom
+		smtpSSL = appconfig.SMTPSSL
 	}
 	if revokeSecond == 0 {
 		revokeSecond = 120
@@ -407,6 +483,16 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 		GroupMemberLimit:                       groupMemberLimit,
 		UserAgreementContent:                   userAgreementContent,
 		PrivacyPolicyContent:                   privacyPolicyContent,
+		PasswordHasher:                         passwordHasher,
+		PasswordMinLength:                      passwordMinLength,
+		PasswordMinClasses:                     passwordMinClasses,
+		PasswordBreachedFile:                   passwordBreachedFile,
+		AdminTotpRequired:                      adminTotpRequired,
+		EmailOn:                                emailOn,
+		SMTPAddr:                               smtpAddr,
+		SMTPUsername:                           smtpUsername,
+		SMTPFrom:                               smtpFrom,
+		SMTPSSL:                                smtpSSL,
 	})
 }
 
@@ -76,6 +76,17 @@ type appConfigModel struct {
 	GroupMemberLimit                       int    // 群人数限制: 0 不限制
 	UserAgreementContent                   string // 用户协议内容
 	PrivacyPolicyContent                   string // 隐私政策内容
+	PasswordHasher                         string // 登录密码hash算法
+	PasswordMinLength                      int    // 登录密码最小长度
+	PasswordMinClasses                     int    // 登录密码至少包含几类字符
+	PasswordBreachedFile                   string // 泄露密码库文件路径
+	AdminTotpRequired                      int    // 后台管理员是否必须开启两步验证
+	EmailOn                                int    // 是否开启邮箱注册登录
+	SMTPAddr                               string // SMTP服务地址 host:port
+	SMTPUsername                           string // SMTP用户名
+	SMTPPassword                           string // SMTP密码
+	SMTPFrom                               string // 发件人地址
+	SMTPSSL                                int    // 是否使用SSL直连（否则尝试STARTTLS）
 
 	ldb.BaseModel
 }
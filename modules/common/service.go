@@ -94,6 +94,17 @@ func (s *service) GetAppConfig() (*AppConfigResp, error) {
 		GroupMemberLimit:                       appConfigM.GroupMemberLimit,
 		UserAgreementContent:                   appConfigM.UserAgreementContent,
 		PrivacyPolicyContent:                   appConfigM.PrivacyPolicyContent,
+		PasswordHasher:                         appConfigM.PasswordHasher,
+		PasswordMinLength:                      appConfigM.PasswordMinLength,
+		PasswordMinClasses:                     appConfigM.PasswordMinClasses,
+		PasswordBreachedFile:                   appConfigM.PasswordBreachedFile,
+		AdminTotpRequired:                      appConfigM.AdminTotpRequired,
+		EmailOn:                                appConfigM.EmailOn,
+		SMTPAddr:                               appConfigM.SMTPAddr,
+		SMTPUsername:                           appConfigM.SMTPUsername,
+		SMTPPassword:                           appConfigM.SMTPPassword,
+		SMTPFrom:                               appConfigM.SMTPFrom,
+		SMTPSSL:                                appConfigM.SMTPSSL,
 	}, nil
 }
 
@@ -208,4 +219,15 @@ type AppConfigResp struct {
 	UserAgreementContent                   string // 用户协议内容
 	PrivacyPolicyContent                   string // 隐私政策内容
 	MomentsVisible                         int    // 好友分享是否可见
+	PasswordHasher                         string // 登录密码hash算法
+	PasswordMinLength                      int    // 登录密码最小长度
+	PasswordMinClasses                     int    // 登录密码至少包含几类字符
+	PasswordBreachedFile                   string // 泄露密码库文件路径
+	AdminTotpRequired                      int    // 后台管理员是否必须开启两步验证
+	EmailOn                                int    // 是否开启邮箱注册登录
+	SMTPAddr                               string // SMTP服务地址
+	SMTPUsername                           string // SMTP用户名
+	SMTPPassword                           string // SMTP密码
+	SMTPFrom                               string // 发件人地址
+	SMTPSSL                                int    // 是否使用SSL直连
 }
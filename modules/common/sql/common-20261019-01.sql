@@ -0,0 +1,7 @@
+-- +migrate Up
+
+ALTER TABLE `app_config`
+    ADD COLUMN password_hasher VARCHAR(20) not null default 'argon2id' COMMENT '登录密码hash算法：argon2id、bcrypt',
+    ADD COLUMN password_min_length smallint not null default 6 COMMENT '登录密码最小长度',
+    ADD COLUMN password_min_classes smallint not null default 0 COMMENT '登录密码至少包含几类字符（大写字母、小写字母、数字、符号）, 0为不限制',
+    ADD COLUMN password_breached_file VARCHAR(255) not null default '' COMMENT '泄露密码库文件路径（每行一个明文密码或sha1值）, 为空不检查';
@@ -0,0 +1,4 @@
+-- +migrate Up
+
+ALTER TABLE `app_config`
+    ADD COLUMN admin_totp_required smallint not null default 0 COMMENT '后台管理员是否必须开启两步验证';
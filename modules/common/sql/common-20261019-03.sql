@@ -0,0 +1,9 @@
+-- +migrate Up
+
+ALTER TABLE `app_config`
+    ADD COLUMN email_on smallint not null default 0 COMMENT '是否开启邮箱注册登录',
+    ADD COLUMN smtp_addr VARCHAR(100) not null default '' COMMENT 'SMTP服务地址 host:port',
+    ADD COLUMN smtp_username VARCHAR(100) not null default '' COMMENT 'SMTP用户名',
+    ADD COLUMN smtp_password VARCHAR(200) not null default '' COMMENT 'SMTP密码',
+    ADD COLUMN smtp_from VARCHAR(100) not null default '' COMMENT '发件人地址',
+    ADD COLUMN smtp_ssl smallint not null default 0 COMMENT '是否使用SSL直连';
@@ -24,4 +24,6 @@ const (
 	TypeWorkplaceBanner Type = "workplacebanner"
 	// TypeWorkplaceAppIcon
 	TypeWorkplaceAppIcon Type = "workplaceappicon"
+	// TypeExport 聊天记录导出
+	TypeExport Type = "export"
 )
@@ -0,0 +1,485 @@
+package group
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/markdown"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	announcementTitleMaxLen   = 100   // 公告标题最大长度
+	announcementContentMaxLen = 10000 // 公告内容最大长度
+	groupNoticeMaxLen         = 400   // 群资料里公告字段的最大长度
+)
+
+// 群公告列表
+func (g *Group) announcementList(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkAnnouncementMember(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := g.db.queryAnnouncements(groupNo, uint64(pageIndex), uint64(pageSize))
+	if err != nil {
+		g.Error("查询群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告失败！"))
+		return
+	}
+	count, err := g.db.queryAnnouncementCount(groupNo)
+	if err != nil {
+		g.Error("查询群公告数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告数量失败！"))
+		return
+	}
+	announcementNos := make([]string, 0, len(models))
+	for _, model := range models {
+		announcementNos = append(announcementNos, model.AnnouncementNo)
+	}
+	confirmedNos, err := g.db.queryAnnouncementAckNos(announcementNos, loginUID)
+	if err != nil {
+		g.Error("查询群公告确认记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告确认记录失败！"))
+		return
+	}
+	confirmedMap := make(map[string]bool, len(confirmedNos))
+	for _, confirmedNo := range confirmedNos {
+		confirmedMap[confirmedNo] = true
+	}
+	list := make([]*announcementResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newAnnouncementResp(model, confirmedMap[model.AnnouncementNo]))
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+// 群公告详情
+func (g *Group) announcementGet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkAnnouncementMember(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.getAnnouncement(groupNo, c.Param("announcement_no"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	confirmedNos, err := g.db.queryAnnouncementAckNos([]string{model.AnnouncementNo}, loginUID)
+	if err != nil {
+		g.Error("查询群公告确认记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告确认记录失败！"))
+		return
+	}
+	c.Response(newAnnouncementResp(model, len(confirmedNos) > 0))
+}
+
+// 发布群公告
+func (g *Group) announcementAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	groupNo := c.Param("group_no")
+	var req announcementReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	group, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := g.checkAnnouncementManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model := &announcementModel{
+		AnnouncementNo: util.GenerUUID(),
+		GroupNo:        groupNo,
+		Author:         loginUID,
+		Title:          req.Title,
+		Content:        req.Content,
+		Pinned:         req.Pinned,
+		RequireConfirm: req.RequireConfirm,
+	}
+	// 同步更新群资料里的公告，兼容只读取群公告字段的客户端
+	group.Notice = announcementNotice(req.Title, req.Content)
+	group.Version = g.ctx.GenSeq(common.GroupSeqKey)
+
+	tx, err := g.ctx.DB().Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = g.db.insertAnnouncementTx(model, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("添加群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加群公告失败！"))
+		return
+	}
+	err = g.db.UpdateTx(group, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("更新群信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新群信息失败！"))
+		return
+	}
+	// 通过群更新消息推送给所有群成员
+	eventID, err := g.ctx.EventBegin(&wkevent.Data{
+		Event: event.GroupUpdate,
+		Type:  wkevent.Message,
+		Data: &config.MsgGroupUpdateReq{
+			GroupNo:      groupNo,
+			Operator:     loginUID,
+			OperatorName: loginName,
+			Attr:         common.GroupAttrKeyNotice,
+			Data: map[string]string{
+				common.GroupAttrKeyNotice: group.Notice,
+				"announcement_no":         model.AnnouncementNo,
+				"require_confirm":         strconv.Itoa(model.RequireConfirm),
+			},
+		},
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("开启事件失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事件失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	g.ctx.EventCommit(eventID)
+
+	c.Response(map[string]interface{}{
+		"announcement_no": model.AnnouncementNo,
+	})
+}
+
+// 修改群公告
+func (g *Group) announcementUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req announcementReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := g.checkAnnouncementManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.getAnnouncement(groupNo, c.Param("announcement_no"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model.Title = req.Title
+	model.Content = req.Content
+	model.RequireConfirm = req.RequireConfirm
+	err = g.db.updateAnnouncement(&model.announcementModel)
+	if err != nil {
+		g.Error("修改群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群公告失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 删除群公告
+func (g *Group) announcementDelete(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkAnnouncementManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.getAnnouncement(groupNo, c.Param("announcement_no"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = g.db.deleteAnnouncement(model.AnnouncementNo)
+	if err != nil {
+		g.Error("删除群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除群公告失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 置顶或取消置顶群公告
+func (g *Group) announcementPinned(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	on := c.Param("on")
+	if err := g.checkAnnouncementManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.getAnnouncement(groupNo, c.Param("announcement_no"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pinned := 0
+	if on == "1" {
+		pinned = 1
+	}
+	err = g.db.updateAnnouncementPinned(model.AnnouncementNo, pinned)
+	if err != nil {
+		g.Error("修改群公告置顶状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群公告置顶状态失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 确认已阅读群公告
+func (g *Group) announcementConfirm(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkAnnouncementMember(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.getAnnouncement(groupNo, c.Param("announcement_no"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if model.RequireConfirm != 1 {
+		c.ResponseError(errors.New("此公告不需要确认！"))
+		return
+	}
+	err = g.db.insertAnnouncementAck(&announcementAckModel{
+		AnnouncementNo: model.AnnouncementNo,
+		GroupNo:        groupNo,
+		UID:            loginUID,
+	})
+	if err != nil {
+		g.Error("确认群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("确认群公告失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 群公告的确认情况
+func (g *Group) announcementConfirms(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkAnnouncementManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.getAnnouncement(groupNo, c.Param("announcement_no"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	acks, err := g.db.queryAnnouncementAcks(model.AnnouncementNo)
+	if err != nil {
+		g.Error("查询群公告确认记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告确认记录失败！"))
+		return
+	}
+	members, err := g.db.queryMembersWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员失败！"))
+		return
+	}
+	confirmed, unconfirmed := splitAnnouncementConfirms(members, acks)
+	c.Response(map[string]interface{}{
+		"confirmed":   confirmed,
+		"unconfirmed": unconfirmed,
+	})
+}
+
+// checkAnnouncementMember 群成员才能查看和确认群公告
+func (g *Group) checkAnnouncementMember(groupNo string, loginUID string) error {
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		return err
+	}
+	exist, err := g.db.ExistMember(loginUID, groupNo)
+	if err != nil {
+		g.Error("查询是否存在群内失败！", zap.Error(err))
+		return errors.New("查询是否存在群内失败！")
+	}
+	if !exist {
+		return errors.New("不是群成员，不能查看群公告！")
+	}
+	return nil
+}
+
+// checkAnnouncementManager 群主或拥有修改群资料权限的管理员才能管理群公告
+func (g *Group) checkAnnouncementManager(groupNo string, loginUID string) error {
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		return err
+	}
+	hasPermission, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionChangeInfo)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		return errors.New("查询是否是群管理者失败！")
+	}
+	if !hasPermission {
+		return errors.New("没有管理群公告的权限！")
+	}
+	return nil
+}
+
+func (g *Group) getAnnouncement(groupNo string, announcementNo string) (*announcementDetailModel, error) {
+	model, err := g.db.queryAnnouncement(groupNo, announcementNo)
+	if err != nil {
+		g.Error("查询群公告失败！", zap.Error(err))
+		return nil, errors.New("查询群公告失败！")
+	}
+	if model == nil {
+		return nil, errors.New("群公告不存在！")
+	}
+	return model, nil
+}
+
+// announcementNotice 生成群资料里的公告内容
+func announcementNotice(title string, content string) string {
+	notice := strings.TrimSpace(content)
+	if title != "" {
+		notice = title + "\n" + notice
+	}
+	runes := []rune(notice)
+	if len(runes) > groupNoticeMaxLen {
+		return string(runes[:groupNoticeMaxLen-3]) + "..."
+	}
+	return notice
+}
+
+// splitAnnouncementConfirms 将群成员分为已确认和未确认
+func splitAnnouncementConfirms(members []*MemberDetailModel, acks []*announcementAckModel) ([]*announcementConfirmResp, []*announcementConfirmResp) {
+	ackMap := make(map[string]*announcementAckModel, len(acks))
+	for _, ack := range acks {
+		ackMap[ack.UID] = ack
+	}
+	confirmed := make([]*announcementConfirmResp, 0, len(acks))
+	unconfirmed := make([]*announcementConfirmResp, 0, len(members))
+	for _, member := range members {
+		if member.Robot == 1 {
+			continue
+		}
+		resp := &announcementConfirmResp{
+			UID:  member.UID,
+			Name: member.Name,
+		}
+		if ack := ackMap[member.UID]; ack != nil {
+			resp.ConfirmedAt = ack.CreatedAt.String()
+			confirmed = append(confirmed, resp)
+		} else {
+			unconfirmed = append(unconfirmed, resp)
+		}
+	}
+	return confirmed, unconfirmed
+}
+
+type announcementReq struct {
+	Title          string `json:"title"`           // 标题
+	Content        string `json:"content"`         // 内容（markdown）
+	Pinned         int    `json:"pinned"`          // 是否置顶 仅发布时有效
+	RequireConfirm int    `json:"require_confirm"` // 是否需要群成员确认
+}
+
+func (r announcementReq) check() error {
+	if len([]rune(r.Title)) > announcementTitleMaxLen {
+		return errors.New("公告标题不能超过100个字符！")
+	}
+	if strings.TrimSpace(r.Content) == "" {
+		return errors.New("公告内容不能为空！")
+	}
+	if len([]rune(r.Content)) > announcementContentMaxLen {
+		return errors.New("公告内容不能超过10000个字符！")
+	}
+	if r.Pinned != 0 && r.Pinned != 1 {
+		return errors.New("置顶设置有误！")
+	}
+	if r.RequireConfirm != 0 && r.RequireConfirm != 1 {
+		return errors.New("确认设置有误！")
+	}
+	return nil
+}
+
+type announcementResp struct {
+	AnnouncementNo string `json:"announcement_no"` // 公告唯一编号
+	GroupNo        string `json:"group_no"`        // 群唯一编号
+	Author         string `json:"author"`          // 发布者uid
+	AuthorName     string `json:"author_name"`     // 发布者名称
+	Title          string `json:"title"`           // 标题
+	Content        string `json:"content"`         // 内容（markdown）
+	ContentHTML    string `json:"content_html"`    // 内容（html）
+	Pinned         int    `json:"pinned"`          // 是否置顶
+	RequireConfirm int    `json:"require_confirm"` // 是否需要群成员确认
+	Confirmed      int    `json:"confirmed"`       // 当前用户是否已确认
+	ConfirmCount   int    `json:"confirm_count"`   // 已确认人数
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+func newAnnouncementResp(m *announcementDetailModel, confirmed bool) *announcementResp {
+	resp := &announcementResp{
+		AnnouncementNo: m.AnnouncementNo,
+		GroupNo:        m.GroupNo,
+		Author:         m.Author,
+		AuthorName:     m.AuthorName,
+		Title:          m.Title,
+		Content:        m.Content,
+		ContentHTML:    markdown.ToSafeHtml(m.Content),
+		Pinned:         m.Pinned,
+		RequireConfirm: m.RequireConfirm,
+		ConfirmCount:   m.ConfirmCount,
+		CreatedAt:      m.CreatedAt.String(),
+		UpdatedAt:      m.UpdatedAt.String(),
+	}
+	if confirmed {
+		resp.Confirmed = 1
+	}
+	return resp
+}
+
+type announcementConfirmResp struct {
+	UID         string `json:"uid"`          // 成员uid
+	Name        string `json:"name"`         // 成员名称
+	ConfirmedAt string `json:"confirmed_at"` // 确认时间
+}
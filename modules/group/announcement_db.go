@@ -0,0 +1,106 @@
+package group
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+const announcementDetailColumns = "group_announcement.*,IFNULL(user.name,'') author_name,(select count(*) from group_announcement_ack where group_announcement_ack.announcement_no=group_announcement.announcement_no) confirm_count"
+
+// insertAnnouncementTx 添加群公告
+func (d *DB) insertAnnouncementTx(model *announcementModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("group_announcement").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// queryAnnouncement 查询群公告
+func (d *DB) queryAnnouncement(groupNo string, announcementNo string) (*announcementDetailModel, error) {
+	var model *announcementDetailModel
+	_, err := d.session.Select(announcementDetailColumns).From("group_announcement").LeftJoin("user", "group_announcement.author=user.uid").Where("group_announcement.group_no=? and group_announcement.announcement_no=? and group_announcement.is_deleted=0", groupNo, announcementNo).Load(&model)
+	return model, err
+}
+
+// queryAnnouncements 分页查询群公告 置顶的在前
+func (d *DB) queryAnnouncements(groupNo string, pageIndex, pageSize uint64) ([]*announcementDetailModel, error) {
+	var models []*announcementDetailModel
+	_, err := d.session.Select(announcementDetailColumns).From("group_announcement").LeftJoin("user", "group_announcement.author=user.uid").Where("group_announcement.group_no=? and group_announcement.is_deleted=0", groupNo).OrderDir("group_announcement.pinned", false).OrderDir("group_announcement.id", false).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryAnnouncementCount 查询群公告数量
+func (d *DB) queryAnnouncementCount(groupNo string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_announcement").Where("group_no=? and is_deleted=0", groupNo).Load(&count)
+	return count, err
+}
+
+// updateAnnouncement 修改群公告
+func (d *DB) updateAnnouncement(model *announcementModel) error {
+	_, err := d.session.Update("group_announcement").SetMap(map[string]interface{}{
+		"title":           model.Title,
+		"content":         model.Content,
+		"require_confirm": model.RequireConfirm,
+	}).Where("announcement_no=?", model.AnnouncementNo).Exec()
+	return err
+}
+
+// updateAnnouncementPinned 置顶或取消置顶群公告
+func (d *DB) updateAnnouncementPinned(announcementNo string, pinned int) error {
+	_, err := d.session.Update("group_announcement").Set("pinned", pinned).Where("announcement_no=?", announcementNo).Exec()
+	return err
+}
+
+// deleteAnnouncement 删除群公告
+func (d *DB) deleteAnnouncement(announcementNo string) error {
+	_, err := d.session.Update("group_announcement").Set("is_deleted", 1).Where("announcement_no=?", announcementNo).Exec()
+	return err
+}
+
+// insertAnnouncementAck 添加群公告确认记录 重复确认忽略
+func (d *DB) insertAnnouncementAck(model *announcementAckModel) error {
+	_, err := d.session.InsertBySql("insert ignore into group_announcement_ack(announcement_no,group_no,uid) values(?,?,?)", model.AnnouncementNo, model.GroupNo, model.UID).Exec()
+	return err
+}
+
+// queryAnnouncementAckNos 查询用户已确认的公告编号
+func (d *DB) queryAnnouncementAckNos(announcementNos []string, uid string) ([]string, error) {
+	if len(announcementNos) == 0 {
+		return nil, nil
+	}
+	var nos []string
+	_, err := d.session.Select("announcement_no").From("group_announcement_ack").Where("announcement_no in ? and uid=?", announcementNos, uid).Load(&nos)
+	return nos, err
+}
+
+// queryAnnouncementAcks 查询群公告的确认记录
+func (d *DB) queryAnnouncementAcks(announcementNo string) ([]*announcementAckModel, error) {
+	var models []*announcementAckModel
+	_, err := d.session.Select("*").From("group_announcement_ack").Where("announcement_no=?", announcementNo).OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+type announcementModel struct {
+	AnnouncementNo string // 公告唯一编号
+	GroupNo        string // 群唯一编号
+	Author         string // 发布者
+	Title          string // 标题
+	Content        string // 内容（markdown）
+	Pinned         int    // 是否置顶
+	RequireConfirm int    // 是否需要群成员确认
+	IsDeleted      int    // 是否已删除
+	db.BaseModel
+}
+
+type announcementDetailModel struct {
+	announcementModel
+	AuthorName   string // 发布者名称
+	ConfirmCount int    // 已确认人数
+}
+
+type announcementAckModel struct {
+	AnnouncementNo string // 公告唯一编号
+	GroupNo        string // 群唯一编号
+	UID            string // 确认者
+	db.BaseModel
+}
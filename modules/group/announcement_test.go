@@ -0,0 +1,39 @@
+package group
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnouncementNotice(t *testing.T) {
+	assert.Equal(t, "内容", announcementNotice("", " 内容\n"))
+	assert.Equal(t, "标题\n内容", announcementNotice("标题", "内容"))
+
+	notice := announcementNotice("标题", strings.Repeat("公", 500))
+	assert.Equal(t, groupNoticeMaxLen, len([]rune(notice)))
+	assert.True(t, strings.HasSuffix(notice, "..."))
+}
+
+func TestAnnouncementReqCheck(t *testing.T) {
+	assert.NoError(t, announcementReq{Title: "标题", Content: "**内容**", Pinned: 1, RequireConfirm: 1}.check())
+	assert.Error(t, announcementReq{Content: " "}.check())
+	assert.Error(t, announcementReq{Title: strings.Repeat("a", 101), Content: "内容"}.check())
+	assert.Error(t, announcementReq{Content: strings.Repeat("a", 10001)}.check())
+	assert.Error(t, announcementReq{Content: "内容", RequireConfirm: 2}.check())
+}
+
+func TestSplitAnnouncementConfirms(t *testing.T) {
+	members := []*MemberDetailModel{
+		{UID: "u1", Name: "张三"},
+		{UID: "u2", Name: "李四"},
+		{UID: "robot", Robot: 1},
+	}
+	acks := []*announcementAckModel{{UID: "u2"}, {UID: "left"}}
+	confirmed, unconfirmed := splitAnnouncementConfirms(members, acks)
+	assert.Len(t, confirmed, 1)
+	assert.Equal(t, "u2", confirmed[0].UID)
+	assert.Len(t, unconfirmed, 1)
+	assert.Equal(t, "u1", unconfirmed[0].UID)
+}
@@ -60,6 +60,7 @@ func New(ctx *config.Context) *Group {
 	g.ctx.AddEventListener(event.OrgOrDeptCreate, g.handleOrgOrDeptCreateEvent)
 	g.ctx.AddEventListener(event.OrgOrDeptEmployeeUpdate, g.handleOrgOrDeptEmployeeUpdate)
 	g.ctx.AddEventListener(event.OrgEmployeeExit, g.handleOrgEmployeeExit)
+	g.ctx.AddMessagesListener(g.handleFloodControlMessages)
 	source.SetGroupMemberProvider(g)
 	return g
 }
@@ -69,32 +70,85 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 	group := r.Group("/v1/group", g.ctx.AuthMiddleware(r))
 	{
 		group.POST("/create", g.groupCreate)
-		group.GET("/my", g.list)                            //我保存的群
-		group.GET("/forbidden_times", g.forbiddenTimesList) // 获取禁言时常列表
+		group.GET("/my", g.list)                                    //我保存的群
+		group.GET("/forbidden_times", g.forbiddenTimesList)         // 获取禁言时常列表
+		group.GET("/invite_links/:link_no", g.inviteLinkGet)        // 通过邀请链接获取群预览
+		group.POST("/invite_links/:link_no/join", g.inviteLinkJoin) // 通过邀请链接加入群
+		group.GET("/directory", g.directoryList)                    // 公开群目录
+		group.POST("/directory/:group_no/join", g.directoryJoin)    // 通过公开群目录加入群
 	}
 	groups := r.Group("/v1/groups", g.ctx.AuthMiddleware(r))
 	{
-		groups.POST("/:group_no/members", g.memberAdd)                                     // 添加群成员
-		groups.DELETE("/:group_no/members", g.memberRemove)                                // 移除群成员
-		groups.GET("/:group_no/members", g.membersGet)                                     // 获取群成员
-		groups.POST("/:group_no/members_delete", g.memberRemove)                           // 移除群成员
-		groups.GET("/:group_no/membersync", g.syncMembers)                                 // 同步群成员
-		groups.GET("/:group_no", g.groupGet)                                               // 获取群信息
-		groups.PUT("/:group_no/setting", g.groupSettingUpdate)                             // 修改群设置
-		groups.PUT("/:group_no", g.groupUpdate)                                            // 修改群信息
-		groups.PUT("/:group_no/members/:uid", g.memberUpdate)                              // 修改群的群成员信息
-		groups.POST("/:group_no/exit", g.groupExit)                                        // 退出群聊
-		groups.POST("/:group_no/managers", g.managerAdd)                                   // 添加群管理员
-		groups.DELETE("/:group_no/managers", g.managerRemove)                              // 移除群管理员
-		groups.POST("/:group_no/forbidden/:on", g.groupForbidden)                          // 群全员禁言
-		groups.GET("/:group_no/qrcode", g.groupQRCode)                                     // 获取群二维码信息
-		groups.POST("/:group_no/transfer/:to_uid", g.transferGrouper)                      // 群主转让
-		groups.POST("/:group_no/member/invite", g.groupMemberInviteAdd)                    // 群成员邀请
-		groups.GET("/:group_no/member/h5confirm", g.getToGroupMemberConfirmInviteDetailH5) // 获取确认邀请的h5页面
-		groups.POST("/:group_no/blacklist/:action", g.blacklist)                           // 添加或移除黑名单
-		groups.POST("/:group_no/forbidden_with_member", g.forbiddenWithGroupMember)        // 禁言或解禁某个群成员
-		groups.POST("/:group_no/avatar", g.avatarUpload)                                   // 上传群头像
-		groups.DELETE("/:group_no/disband", g.disband)                                     // 解散群
+		groups.POST("/:group_no/members", g.memberAdd)                                            // 添加群成员
+		groups.DELETE("/:group_no/members", g.memberRemove)                                       // 移除群成员
+		groups.GET("/:group_no/members", g.membersGet)                                            // 获取群成员
+		groups.POST("/:group_no/members_delete", g.memberRemove)                                  // 移除群成员
+		groups.GET("/:group_no/membersync", g.syncMembers)                                        // 同步群成员
+		groups.GET("/:group_no", g.groupGet)                                                      // 获取群信息
+		groups.PUT("/:group_no/setting", g.groupSettingUpdate)                                    // 修改群设置
+		groups.PUT("/:group_no", g.groupUpdate)                                                   // 修改群信息
+		groups.PUT("/:group_no/members/:uid", g.memberUpdate)                                     // 修改群的群成员信息
+		groups.POST("/:group_no/exit", g.groupExit)                                               // 退出群聊
+		groups.POST("/:group_no/managers", g.managerAdd)                                          // 添加群管理员
+		groups.DELETE("/:group_no/managers", g.managerRemove)                                     // 移除群管理员
+		groups.PUT("/:group_no/managers/:uid/permissions", g.managerPermissionsUpdate)            // 修改管理员权限
+		groups.POST("/:group_no/forbidden/:on", g.groupForbidden)                                 // 群全员禁言
+		groups.GET("/:group_no/qrcode", g.groupQRCode)                                            // 获取群二维码信息
+		groups.POST("/:group_no/transfer/:to_uid", g.transferGrouper)                             // 群主转让
+		groups.POST("/:group_no/member/invite", g.groupMemberInviteAdd)                           // 群成员邀请
+		groups.GET("/:group_no/member/h5confirm", g.getToGroupMemberConfirmInviteDetailH5)        // 获取确认邀请的h5页面
+		groups.POST("/:group_no/blacklist/:action", g.blacklist)                                  // 添加或移除黑名单
+		groups.POST("/:group_no/forbidden_with_member", g.forbiddenWithGroupMember)               // 禁言或解禁某个群成员
+		groups.GET("/:group_no/flood_control", g.floodControlGet)                                 // 获取防刷屏设置
+		groups.PUT("/:group_no/flood_control", g.floodControlUpdate)                              // 修改防刷屏设置
+		groups.GET("/:group_no/newcomer_setting", g.newcomerSettingGet)                           // 获取新成员限制设置
+		groups.PUT("/:group_no/newcomer_setting", g.newcomerSettingUpdate)                        // 修改新成员限制设置
+		groups.GET("/:group_no/mute_schedules", g.muteScheduleList)                               // 定时禁言计划列表
+		groups.POST("/:group_no/mute_schedules", g.muteScheduleAdd)                               // 添加定时禁言计划
+		groups.PUT("/:group_no/mute_schedules/:schedule_no", g.muteScheduleUpdate)                // 修改定时禁言计划
+		groups.DELETE("/:group_no/mute_schedules/:schedule_no", g.muteScheduleDelete)             // 删除定时禁言计划
+		groups.GET("/:group_no/directory", g.directoryGet)                                        // 获取群公开目录设置
+		groups.PUT("/:group_no/directory", g.directoryUpdate)                                     // 修改群公开目录设置
+		groups.GET("/:group_no/verify", g.memberVerifyGet)                                        // 获取待完成的入群验证
+		groups.POST("/:group_no/verify", g.memberVerifySubmit)                                    // 提交入群验证
+		groups.POST("/:group_no/avatar", g.avatarUpload)                                          // 上传群头像
+		groups.DELETE("/:group_no/disband", g.disband)                                            // 解散群
+		groups.GET("/:group_no/invite_links", g.inviteLinkList)                                   // 邀请链接列表
+		groups.POST("/:group_no/invite_links", g.inviteLinkAdd)                                   // 创建邀请链接
+		groups.PUT("/:group_no/invite_links/:link_no", g.inviteLinkUpdate)                        // 修改邀请链接
+		groups.DELETE("/:group_no/invite_links/:link_no", g.inviteLinkRevoke)                     // 撤销邀请链接
+		groups.POST("/:group_no/invite_links/:link_no/regenerate", g.inviteLinkRegenerate)        // 重新生成邀请链接
+		groups.GET("/:group_no/announcements", g.announcementList)                                // 群公告列表
+		groups.POST("/:group_no/announcements", g.announcementAdd)                                // 发布群公告
+		groups.GET("/:group_no/announcements/:announcement_no", g.announcementGet)                // 群公告详情
+		groups.PUT("/:group_no/announcements/:announcement_no", g.announcementUpdate)             // 修改群公告
+		groups.DELETE("/:group_no/announcements/:announcement_no", g.announcementDelete)          // 删除群公告
+		groups.POST("/:group_no/announcements/:announcement_no/pinned/:on", g.announcementPinned) // 置顶或取消置顶群公告
+		groups.POST("/:group_no/announcements/:announcement_no/confirm", g.announcementConfirm)   // 确认已阅读群公告
+		groups.GET("/:group_no/announcements/:announcement_no/confirms", g.announcementConfirms)  // 群公告确认情况
+		groups.GET("/:group_no/member_tags", g.memberTagList)                                     // 群成员标签列表
+		groups.POST("/:group_no/member_tags", g.memberTagAdd)                                     // 添加群成员标签
+		groups.PUT("/:group_no/member_tags/:tag_no", g.memberTagUpdate)                           // 修改群成员标签
+		groups.DELETE("/:group_no/member_tags/:tag_no", g.memberTagDelete)                        // 删除群成员标签
+		groups.POST("/:group_no/member_tags/:tag_no/members", g.memberTagUsersAdd)                // 添加标签成员
+		groups.DELETE("/:group_no/member_tags/:tag_no/members", g.memberTagUsersRemove)           // 移除标签成员
+	}
+	communities := r.Group("/v1/communities", g.ctx.AuthMiddleware(r))
+	{
+		communities.POST("", g.communityCreate)                                                      // 创建社群
+		communities.GET("/my", g.communityMy)                                                        // 我所在的社群
+		communities.GET("/:community_no", g.communityGet)                                            // 社群详情
+		communities.PUT("/:community_no", g.communityUpdate)                                         // 修改社群信息
+		communities.DELETE("/:community_no", g.communityDisband)                                     // 解散社群
+		communities.POST("/:community_no/groups", g.communityGroupAdd)                               // 将群加入社群
+		communities.DELETE("/:community_no/groups/:group_no", g.communityGroupRemove)                // 将群移出社群
+		communities.PUT("/:community_no/announcement_group", g.communityAnnouncementGroupSet)        // 设置社群公告群
+		communities.POST("/:community_no/announcement_group/join", g.communityAnnouncementGroupJoin) // 加入社群公告群
+		communities.GET("/:community_no/members", g.communityMembers)                                // 社群成员列表
+		communities.PUT("/:community_no/admins/:uid/:on", g.communityAdminSet)                       // 设置或取消社群管理员
+		communities.GET("/:community_no/bans", g.communityBans)                                      // 社群封禁列表
+		communities.POST("/:community_no/bans", g.communityBan)                                      // 社群封禁用户
+		communities.DELETE("/:community_no/bans/:uid", g.communityUnban)                             // 解除社群封禁
 	}
 	openGroups := r.Group("/v1/groups")
 	{ // 获取群头像
@@ -109,6 +163,10 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 		openGroup.POST("invite/sure", g.groupMemberInviteSure)         // 确认邀请
 	}
 	go g.CheckForbiddenLoop()
+	go g.ReleaseFloodHoldLoop()
+	go g.CheckMemberVerifyLoop()
+	go g.CheckMuteScheduleLoop()
+	go g.RefreshDirectoryMemberCountLoop()
 }
 
 // 解散群
@@ -392,10 +450,36 @@ func (g *Group) syncMembers(c *wkhttp.Context) {
 		c.ResponseError(errors.New("同步成员信息失败！"))
 		return
 	}
+	communityAdmins, err := g.db.queryCommunityAdminsWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询社群管理员失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		c.ResponseError(errors.New("查询社群管理员失败！"))
+		return
+	}
+	communityRoleMap := make(map[string]int, len(communityAdmins))
+	for _, communityAdmin := range communityAdmins {
+		communityRoleMap[communityAdmin.UID] = communityAdmin.Role
+	}
+	memberUIDs := make([]string, 0, len(memberModels))
+	for _, memberModel := range memberModels {
+		memberUIDs = append(memberUIDs, memberModel.UID)
+	}
+	tagNosMap, err := g.memberTagNosMap(groupNo, memberUIDs)
+	if err != nil {
+		g.Error("查询成员标签失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		c.ResponseError(errors.New("查询成员标签失败！"))
+		return
+	}
 	resps := make([]memberDetailResp, 0)
 	for _, memberModel := range memberModels {
 		resp := memberDetailResp{}
-		resps = append(resps, resp.from(memberModel))
+		resp = resp.from(memberModel)
+		resp.CommunityRole = communityRoleMap[memberModel.UID]
+		resp.Tags = tagNosMap[memberModel.UID]
+		if resp.Tags == nil {
+			resp.Tags = make([]string, 0)
+		}
+		resps = append(resps, resp)
 	}
 	c.Response(resps)
 }
@@ -449,10 +533,29 @@ func (g *Group) list(c *wkhttp.Context) {
 		c.ResponseError(errors.New("查询我保存的群聊失败"))
 		return
 	}
+	groupNos := make([]string, 0, len(models))
+	for _, model := range models {
+		groupNos = append(groupNos, model.GroupNo)
+	}
+	communities, err := g.db.queryCommunitiesWithGroupNos(groupNos)
+	if err != nil {
+		g.Error("查询群所属社群失败", zap.Error(err))
+		c.ResponseError(errors.New("查询群所属社群失败"))
+		return
+	}
+	communityMap := make(map[string]*groupCommunityModel, len(communities))
+	for _, community := range communities {
+		communityMap[community.GroupNo] = community
+	}
 	resps := make([]*GroupResp, 0)
 	for _, model := range models {
 		groupResp := &GroupResp{}
-		resps = append(resps, groupResp.from(model))
+		groupResp = groupResp.from(model)
+		if community := communityMap[model.GroupNo]; community != nil {
+			groupResp.CommunityNo = community.CommunityNo
+			groupResp.CommunityName = community.Name
+		}
+		resps = append(resps, groupResp)
 	}
 	c.Response(resps)
 }
@@ -780,14 +883,14 @@ func (g *Group) groupUpdate(c *wkhttp.Context) {
 		return
 	}
 	// 查询是否是管理者
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	isManager, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionChangeInfo)
 	if err != nil {
 		g.Error("查询是否是群管理者失败！", zap.Error(err))
 		c.ResponseError(errors.New("查询是否是群管理者失败！"))
 		return
 	}
 	if !isManager {
-		c.ResponseError(errors.New("只有群管理者才能修改！"))
+		c.ResponseError(errors.New("没有修改群资料的权限！"))
 		return
 	}
 
@@ -903,7 +1006,7 @@ func (g *Group) memberAdd(c *wkhttp.Context) {
 	判断群是否开启了邀请模式 如果开启了 再判断邀请的人是否是群主或管理员 如果不是则不允许直接添加群成员
 	**/
 	if group.Invite == 1 {
-		creatorOrManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, operator)
+		creatorOrManager, err := g.db.QueryHasPermission(groupNo, operator, ManagerPermissionInvite)
 		if err != nil {
 			g.Error("查询是否是创建者和管理者失败！", zap.Error(err))
 			c.ResponseError(errors.New("查询是否是创建者和管理者失败！"))
@@ -1018,9 +1121,21 @@ func (g *Group) addMembersTx(members []string, groupNo string, operator, operato
 		g.Error("查询群黑名单成员错误", zap.Error(err))
 		return nil, errors.New("查询群黑名单成员错误")
 	}
+	// 查询在所属社群内被封禁的成员
+	communityBannedUIDs, err := g.db.queryCommunityBannedUIDs(groupNo, newMembers)
+	if err != nil {
+		g.Error("查询社群封禁成员错误", zap.Error(err))
+		return nil, errors.New("查询社群封禁成员错误")
+	}
 	realMembers := make([]string, 0, len(newMembers)) // 真正要添加的群成员
 	for _, memberUID := range newMembers {
 		exist := false
+		for _, bannedUID := range communityBannedUIDs {
+			if memberUID == bannedUID {
+				exist = true
+				break
+			}
+		}
 		for _, existMember := range existMembers {
 			if memberUID == existMember.UID {
 				exist = true
@@ -1057,8 +1172,12 @@ func (g *Group) addMembersTx(members []string, groupNo string, operator, operato
 	 将成员信息存到数据库
 	**/
 	userBaseVos := make([]*config.UserBaseVo, 0, len(realMembers))
+	verifyUIDs := make([]string, 0, len(realMembers)) // 需要入群验证的成员
 	for _, realMember := range realMemberModels {
 		version := g.ctx.GenSeq(common.GroupMemberSeqKey)
+		if realMember.Robot != 1 {
+			verifyUIDs = append(verifyUIDs, realMember.UID)
+		}
 
 		userBaseVos = append(userBaseVos, &config.UserBaseVo{
 			UID:  realMember.UID,
@@ -1176,6 +1295,10 @@ func (g *Group) addMembersTx(members []string, groupNo string, operator, operato
 		g.Error("调用IM的订阅接口失败！", zap.Error(err))
 		return nil, errors.New("调用IM的订阅接口失败！")
 	}
+	verifyCallback, err := g.startMemberVerifyTx(groupNo, verifyUIDs, tx)
+	if err != nil {
+		return nil, err
+	}
 
 	return func() {
 		// 提交事件
@@ -1186,6 +1309,7 @@ func (g *Group) addMembersTx(members []string, groupNo string, operator, operato
 		if unableAddDestroyAccount != 0 {
 			g.ctx.EventCommit(unableAddDestroyAccount)
 		}
+		verifyCallback()
 	}, nil
 }
 
@@ -1221,16 +1345,23 @@ func (g *Group) addMembers(members []string, groupNo string, operator, operatorN
 // 添加管理员
 func (g *Group) managerAdd(c *wkhttp.Context) {
 	loginUID := c.MustGet("uid").(string)
-	var memberUIDs []string
-	if err := c.BindJSON(&memberUIDs); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
+		g.Error("读取数据失败！", zap.Error(err))
+		c.ResponseError(errors.New("读取数据失败！"))
+		return
+	}
+	req, err := parseManagerAddReq(body)
+	if err != nil {
 		g.Error("数据格式有误！", zap.Error(err))
 		c.ResponseError(errors.New("数据格式有误！"))
 		return
 	}
-	if len(memberUIDs) <= 0 {
-		c.ResponseError(errors.New("请选择需要添加的成员！"))
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
 		return
 	}
+	memberUIDs := req.UIDs
 	for _, memberUID := range memberUIDs {
 		if memberUID == loginUID {
 			c.ResponseError(errors.New("不能将自己设置为管理员！"))
@@ -1238,16 +1369,35 @@ func (g *Group) managerAdd(c *wkhttp.Context) {
 		}
 	}
 	groupNo := c.Param("group_no")
-	isCreator, err := g.db.QueryIsGroupCreator(groupNo, loginUID)
+	loginMember, err := g.db.QueryMemberWithUID(loginUID, groupNo)
 	if err != nil {
-		g.Error("查询是否是创建者失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否是创建者失败！"))
+		g.Error("查询登录用户群内信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录用户群内信息失败！"))
 		return
 	}
-	if !isCreator {
-		c.ResponseError(errors.New("只有创建者才能设置管理员！"))
+	if loginMember == nil || !hasPermission(loginMember.Role, loginMember.Permissions, ManagerPermissionAddManager) {
+		c.ResponseError(errors.New("没有设置管理员的权限！"))
 		return
 	}
+	if loginMember.Role != MemberRoleCreator {
+		// 管理员只能授予自己拥有的权限，且不能修改已有管理员的权限
+		if !ManagerPermission(loginMember.Permissions).Contains(req.permissions()) {
+			c.ResponseError(errors.New("不能授予自己没有的权限！"))
+			return
+		}
+		members, err := g.db.QueryMembersWithUids(memberUIDs, groupNo)
+		if err != nil {
+			g.Error("查询成员信息失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询成员信息失败！"))
+			return
+		}
+		for _, member := range members {
+			if member.Role != MemberRoleCommon {
+				c.ResponseError(errors.New("只能将普通成员设置为管理员！"))
+				return
+			}
+		}
+	}
 
 	groupModel, err := g.getGroupInfo(groupNo)
 	if err != nil {
@@ -1257,7 +1407,7 @@ func (g *Group) managerAdd(c *wkhttp.Context) {
 
 	version := g.ctx.GenSeq(common.GroupMemberSeqKey)
 
-	err = g.db.UpdateMembersToManager(groupNo, memberUIDs, version)
+	err = g.db.UpdateMembersToManager(groupNo, memberUIDs, req.permissions(), version)
 	if err != nil {
 		g.Error("更新成员为管理员失败！", zap.Any("memberUIDs", memberUIDs), zap.Error(err))
 		c.ResponseError(errors.New("更新成员为管理员失败！"))
@@ -1272,39 +1422,100 @@ func (g *Group) managerAdd(c *wkhttp.Context) {
 			return
 		}
 	}
+	err = g.sendMemberUpdateCMD(groupModel, memberUIDs)
+	if err != nil {
+		g.Error("发送命令消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("发送命令消息失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 修改管理员权限
+func (g *Group) managerPermissionsUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	uid := c.Param("uid")
+	var req struct {
+		Permissions ManagerPermission `json:"permissions"` // 管理员权限位
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if !req.Permissions.Valid() {
+		c.ResponseError(errors.New("权限设置有误！"))
+		return
+	}
+	isCreator, err := g.db.QueryIsGroupCreator(groupNo, loginUID)
+	if err != nil {
+		g.Error("查询是否是创建者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是创建者失败！"))
+		return
+	}
+	if !isCreator {
+		c.ResponseError(errors.New("只有创建者才能修改管理员权限！"))
+		return
+	}
+	groupModel, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	member, err := g.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		g.Error("查询成员信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询成员信息失败！"))
+		return
+	}
+	if member == nil || member.Role != MemberRoleManager {
+		c.ResponseError(errors.New("该成员不是管理员！"))
+		return
+	}
+	version := g.ctx.GenSeq(common.GroupMemberSeqKey)
+	err = g.db.updateManagerPermissions(groupNo, uid, req.Permissions, version)
+	if err != nil {
+		g.Error("修改管理员权限失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改管理员权限失败！"))
+		return
+	}
+	err = g.sendMemberUpdateCMD(groupModel, []string{uid})
+	if err != nil {
+		g.Error("发送命令消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("发送命令消息失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// sendMemberUpdateCMD 通知客户端同步群成员 普通群同步全部成员，超大群只同步指定的成员
+func (g *Group) sendMemberUpdateCMD(groupModel *Model, uids []string) error {
 	if groupModel.GroupType == int(GroupTypeCommon) {
-		err = g.ctx.SendCMD(config.MsgCMDReq{
-			ChannelID:   groupNo,
+		return g.ctx.SendCMD(config.MsgCMDReq{
+			ChannelID:   groupModel.GroupNo,
 			ChannelType: common.ChannelTypeGroup.Uint8(),
 			CMD:         common.CMDGroupMemberUpdate,
 			Param: map[string]interface{}{
-				"group_no": groupNo,
+				"group_no": groupModel.GroupNo,
+			},
+		})
+	}
+	for _, uid := range uids {
+		err := g.ctx.SendCMD(config.MsgCMDReq{
+			ChannelID:   groupModel.GroupNo,
+			ChannelType: common.ChannelTypeGroup.Uint8(),
+			CMD:         common.CMDGroupMemberUpdate,
+			Param: map[string]interface{}{
+				"group_no": groupModel.GroupNo,
+				"uid":      uid,
 			},
 		})
 		if err != nil {
-			g.Error("发送命令消息失败！", zap.Error(err))
-			c.ResponseError(errors.New("发送命令消息失败！"))
-			return
-		}
-	} else {
-		for _, uid := range memberUIDs {
-			err = g.ctx.SendCMD(config.MsgCMDReq{
-				ChannelID:   groupNo,
-				ChannelType: common.ChannelTypeGroup.Uint8(),
-				CMD:         common.CMDGroupMemberUpdate,
-				Param: map[string]interface{}{
-					"group_no": groupNo,
-					"uid":      uid,
-				},
-			})
-			if err != nil {
-				g.Error("发送命令消息失败！", zap.Error(err))
-				c.ResponseError(errors.New("发送命令消息失败！"))
-				return
-			}
+			return err
 		}
 	}
-	c.ResponseOK()
+	return nil
 }
 
 // 移除管理员
@@ -1404,14 +1615,14 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 	loginName := c.MustGet("name").(string)
 	groupNo := c.Param("group_no")
 	on := c.Param("on")
-	isCreatorOrManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	isCreatorOrManager, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionBanMember)
 	if err != nil {
 		g.Error("查询是否是创建者失败！", zap.Error(err))
 		c.ResponseError(errors.New("查询是否是创建者失败！"))
 		return
 	}
 	if !isCreatorOrManager {
-		c.ResponseError(errors.New("只有创建者或管理员才能禁言！"))
+		c.ResponseError(errors.New("没有禁言的权限！"))
 		return
 	}
 	groupModel, err := g.getGroupInfo(groupNo)
@@ -1420,31 +1631,39 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 		return
 	}
 	forbidden, _ := strconv.ParseInt(on, 10, 64)
-	groupModel.Forbidden = int(forbidden)
+	err = g.updateGroupForbidden(groupModel, int(forbidden), loginUID, loginName)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
+// updateGroupForbidden 开启或关闭群全员禁言，群主及管理员不受限制
+func (g *Group) updateGroupForbidden(groupModel *Model, forbidden int, operator string, operatorName string) error {
+	groupNo := groupModel.GroupNo
+	groupModel.Forbidden = forbidden
 
 	whitelistUIDs := make([]string, 0)
 	if forbidden == 1 {
 		managerOrCreaterUIDs, err := g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
 		if err != nil {
-			c.ResponseErrorf("查询管理者们的uid失败！", err)
-			return
+			g.Error("查询管理者们的uid失败！", zap.Error(err))
+			return errors.New("查询管理者们的uid失败！")
 		}
 		whitelistUIDs = managerOrCreaterUIDs
 	}
 	// 重置白名单
-	err = g.resetIMWhitelist(whitelistUIDs, groupNo)
-
+	err := g.resetIMWhitelist(whitelistUIDs, groupNo)
 	if err != nil {
 		g.Error("设置禁言失败！", zap.Error(err))
-		c.ResponseError(errors.New(err.Error()))
-		return
+		return errors.New(err.Error())
 	}
 
 	tx, err := g.ctx.DB().Begin()
 	if err != nil {
 		g.Error("开启事务失败！", zap.Error(err))
-		c.ResponseError(errors.New("开启事务失败！"))
-		return
+		return errors.New("开启事务失败！")
 	}
 	defer func() {
 		if err := recover(); err != nil {
@@ -1457,8 +1676,7 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 	if err != nil {
 		tx.Rollback()
 		g.Error("更新群信息失败！", zap.Error(err), zap.String("group_no", groupModel.GroupNo))
-		c.ResponseError(errors.New("更新群信息失败！"))
-		return
+		return errors.New("更新群信息失败！")
 	}
 	// 发布群信息更新事件
 	eventID, err := g.ctx.EventBegin(&wkevent.Data{
@@ -1466,29 +1684,26 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 		Type:  wkevent.Message,
 		Data: &config.MsgGroupUpdateReq{
 			GroupNo:      groupNo,
-			Operator:     loginUID,
-			OperatorName: loginName,
+			Operator:     operator,
+			OperatorName: operatorName,
 			Attr:         common.GroupAttrKeyForbidden,
 			Data: map[string]string{
-				common.GroupAttrKeyForbidden: on,
+				common.GroupAttrKeyForbidden: strconv.Itoa(forbidden),
 			},
 		},
 	}, tx)
 	if err != nil {
 		tx.Rollback()
 		g.Error("开启群更新事件失败！", zap.Error(err))
-		c.ResponseError(errors.New("开启群更新事件失败！"))
-		return
+		return errors.New("开启群更新事件失败！")
 	}
 	if err := tx.Commit(); err != nil {
 		tx.RollbackUnlessCommitted()
 		g.Error("提交事务失败！", zap.Error(err))
-		c.ResponseError(errors.New("提交事务失败！"))
-		return
+		return errors.New("提交事务失败！")
 	}
 	g.ctx.EventCommit(eventID)
-
-	c.ResponseOK()
+	return nil
 }
 
 // 设置群管理员（包含创建者）列表作为群白名单
@@ -1643,11 +1858,49 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 		return
 	}
 
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	commitCallback, err := g.scanJoinTx(groupNo, generatorInfo.UID, generatorInfo.Name, scanerInfo.UID, scanerInfo.Name, tx)
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		c.ResponseError(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	commitCallback()
+
+	c.ResponseOK()
+}
+
+// scanJoinTx 通过生成者分享的二维码或邀请链接加入群
+func (g *Group) scanJoinTx(groupNo string, generator, generatorName string, scaner, scanerName string, tx *dbr.Tx) (func(), error) {
+	communityBannedUIDs, err := g.db.queryCommunityBannedUIDs(groupNo, []string{scaner})
+	if err != nil {
+		g.Error("查询社群封禁成员错误", zap.Error(err))
+		return nil, errors.New("查询社群封禁成员错误")
+	}
+	if len(communityBannedUIDs) > 0 {
+		return nil, errors.New("已被所属社群封禁，不能加入此群！")
+	}
 	memberCount, err := g.db.QueryMemberCount(groupNo)
 	if err != nil {
 		g.Error("查询成员数量！", zap.Error(err))
-		c.ResponseError(errors.New("查询成员数量！"))
-		return
+		return nil, errors.New("查询成员数量！")
 	}
 
 	version := g.ctx.GenSeq(common.GroupMemberSeqKey)
@@ -1662,34 +1915,20 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 		Vercode:   fmt.Sprintf("%s@%d", util.GenerUUID(), common.GroupMember),
 	}
 
-	tx, err := g.db.session.Begin()
-	if err != nil {
-		g.Error("开启事务失败！", zap.Error(err))
-		c.ResponseError(errors.New("开启事务失败！"))
-		return
-	}
-	defer func() {
-		if err := recover(); err != nil {
-			tx.RollbackUnlessCommitted()
-			panic(err)
-		}
-	}()
 	eventID, err := g.ctx.EventBegin(&wkevent.Data{
 		Event: event.GroupMemberScanJoin,
 		Type:  wkevent.Message,
 		Data: config.MsgGroupMemberScanJoin{
 			GroupNo:       groupNo,
-			Generator:     generatorInfo.UID,
-			GeneratorName: generatorInfo.Name,
-			Scaner:        scanerInfo.UID,
-			ScanerName:    scanerInfo.Name,
+			Generator:     generator,
+			GeneratorName: generatorName,
+			Scaner:        scaner,
+			ScanerName:    scanerName,
 		},
 	}, tx)
 	if err != nil {
-		tx.Rollback()
 		g.Error("开启事件事务失败！", zap.Error(err))
-		c.ResponseError(errors.New("开启事件事务失败！"))
-		return
+		return nil, errors.New("开启事件事务失败！")
 	}
 	var groupAvatarEventID int64
 
@@ -1701,16 +1940,14 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 	if memberCount < 9 && groupIsUploadAvatar != 1 {
 		oldMembers, err := g.db.QueryMembersFirstNine(groupNo)
 		if err != nil {
-			tx.Rollback()
 			g.Error("查询先存成员信息失败！", zap.String("group_no", groupNo), zap.Error(err))
-			c.ResponseError(errors.New("查询先存成员信息失败！"))
-			return
+			return nil, errors.New("查询先存成员信息失败！")
 		}
 		members := make([]string, 0, len(oldMembers)+1)
 		for _, oldMember := range oldMembers {
 			members = append(members, oldMember.UID)
 		}
-		members = append(members, scanerInfo.UID)
+		members = append(members, scaner)
 
 		groupAvatarEventID, err = g.ctx.EventBegin(&wkevent.Data{
 			Event: event.GroupAvatarUpdate,
@@ -1721,19 +1958,15 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 			},
 		}, tx)
 		if err != nil {
-			tx.Rollback()
 			g.Error("开启群成员头像更新事件失败！", zap.Error(err))
-			c.ResponseError(errors.New("开启群成员头像更新事件失败！"))
-			return
+			return nil, errors.New("开启群成员头像更新事件失败！")
 		}
 	}
 
 	existDelete, err := g.db.ExistMemberDelete(scaner, groupNo)
 	if err != nil {
-		tx.Rollback()
 		g.Error("查询是否存在删除成员失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否存在删除成员失败！"))
-		return
+		return nil, errors.New("查询是否存在删除成员失败！")
 	}
 	if existDelete {
 		err = g.db.recoverMemberTx(memberModel, tx)
@@ -1741,10 +1974,8 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 		err = g.db.InsertMemberTx(memberModel, tx)
 	}
 	if err != nil {
-		tx.Rollback()
 		g.Error("添加群成员失败！", zap.Error(err))
-		c.ResponseError(errors.New("添加群成员失败！"))
-		return
+		return nil, errors.New("添加群成员失败！")
 	}
 	// 调用IM的添加订阅者
 	err = g.ctx.IMAddSubscriber(&config.SubscriberAddReq{
@@ -1753,24 +1984,20 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 		Subscribers: []string{scaner},
 	})
 	if err != nil {
-		tx.RollbackUnlessCommitted()
 		g.Error("调用IM的订阅接口失败！", zap.Error(err))
-		c.ResponseError(errors.New("调用IM的订阅接口失败！"))
-		return
-	}
-
-	if err := tx.Commit(); err != nil {
-		tx.Rollback()
-		g.Error("提交事务失败！", zap.Error(err))
-		c.ResponseError(errors.New("提交事务失败！"))
-		return
+		return nil, errors.New("调用IM的订阅接口失败！")
 	}
-	g.ctx.EventCommit(eventID)
-	if groupAvatarEventID != 0 {
-		g.ctx.EventCommit(groupAvatarEventID)
+	verifyCallback, err := g.startMemberVerifyTx(groupNo, []string{scaner}, tx)
+	if err != nil {
+		return nil, err
 	}
-
-	c.ResponseOK()
+	return func() {
+		g.ctx.EventCommit(eventID)
+		if groupAvatarEventID != 0 {
+			g.ctx.EventCommit(groupAvatarEventID)
+		}
+		verifyCallback()
+	}, nil
 }
 
 // 群主转让
@@ -1946,7 +2173,7 @@ func (g *Group) memberUpdate(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	isManager, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionChangeInfo)
 	if err != nil {
 		g.Error("查询是否是群管理者失败！", zap.Error(err))
 		c.ResponseError(errors.New("查询是否是群管理者失败！"))
@@ -2022,6 +2249,7 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 		return
 	}
 	var loginMember *MemberModel
+	var communityAdmin bool
 	// 查询操作者身份
 	// 这里要兼容后台管理系统的删除操作
 	if c.CheckLoginRole() != nil {
@@ -2035,10 +2263,20 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 			c.ResponseError(errors.New("操作者不再此群"))
 			return
 		}
-		if loginMember.Role != int(common.GroupMemberRoleCreater) && loginMember.Role != int(common.GroupMemberRoleManager) {
+		communityAdmin, err = g.db.QueryIsCommunityAdmin(groupNo, operator)
+		if err != nil {
+			g.Error("查询操作者是否是社群管理员错误", zap.Error(err))
+			c.ResponseError(errors.New("查询操作者是否是社群管理员错误"))
+			return
+		}
+		if loginMember.Role != int(common.GroupMemberRoleCreater) && loginMember.Role != int(common.GroupMemberRoleManager) && !communityAdmin {
 			c.ResponseError(errors.New("普通成员无法删除群成员"))
 			return
 		}
+		if !communityAdmin && !hasPermission(loginMember.Role, loginMember.Permissions, ManagerPermissionBanMember) {
+			c.ResponseError(errors.New("没有移除群成员的权限"))
+			return
+		}
 	}
 	// 验证删除者是否包含自己
 	for _, uid := range req.Members {
@@ -2060,16 +2298,15 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 	if loginMember != nil {
 		// 验证权限
 		for _, member := range deleteMembers {
-			if loginMember.Role == int(common.GroupMemberRoleManager) {
-				if member.Role == int(common.GroupMemberRoleManager) {
-					c.ResponseError(errors.New("管理员不能删除管理员"))
-					return
-				}
-				if member.Role == int(common.GroupMemberRoleCreater) {
-					c.ResponseError(errors.New("管理员不能删除群主"))
-					return
-				}
+			if CanManageMember(loginMember.Role, loginMember.Permissions, communityAdmin, member.Role, ManagerPermissionBanMember) {
+				continue
+			}
+			if member.Role == int(common.GroupMemberRoleCreater) {
+				c.ResponseError(errors.New("管理员不能删除群主"))
+				return
 			}
+			c.ResponseError(errors.New("管理员不能删除管理员"))
+			return
 		}
 	}
 	realDeleteMemberModels, err := g.userDB.QueryByUIDs(req.Members)
@@ -2532,14 +2769,14 @@ func (g *Group) blacklist(c *wkhttp.Context) {
 		return
 	}
 	// 查询是否是管理者
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	isManager, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionBanMember)
 	if err != nil {
 		g.Error("查询是否是群管理者失败！", zap.Error(err))
 		c.ResponseError(errors.New("查询是否是群管理者失败！"))
 		return
 	}
 	if !isManager {
-		c.ResponseError(errors.New("只有群管理者才能修改！"))
+		c.ResponseError(errors.New("没有拉黑成员的权限！"))
 		return
 	}
 	status := 0
@@ -2714,7 +2951,13 @@ func (g *Group) forbiddenWithGroupMember(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该成员不在群内"))
 		return
 	}
-	if loginGroupMember.Role == MemberRoleCommon || member.Role == MemberRoleCreator || loginGroupMember.Role == member.Role {
+	communityAdmin, err := g.db.QueryIsCommunityAdmin(group.GroupNo, loginUID)
+	if err != nil {
+		g.Error("查询登录用户是否是社群管理员错误", zap.Error(err))
+		c.ResponseError(errors.New("查询登录用户是否是社群管理员错误"))
+		return
+	}
+	if loginUID == req.MemberUID || !CanManageMember(loginGroupMember.Role, loginGroupMember.Permissions, communityAdmin, member.Role, ManagerPermissionBanMember) {
 		c.ResponseError(errors.New("操作用户权限不够"))
 		return
 	}
@@ -2898,34 +3141,38 @@ func (g groupDetailResp) from(model *Model, memberCount int64) groupDetailResp {
 
 // 成员详情model
 type memberDetailResp struct {
-	ID                 uint64 `json:"id"`
-	UID                string `json:"uid"`                  // 成员uid
-	GroupNo            string `json:"group_no"`             // 群唯一编号
-	Name               string `json:"name"`                 // 群成员名称
-	Remark             string `json:"remark"`               // 成员备注
-	Role               int    `json:"role"`                 // 成员角色
-	Version            int64  `json:"version"`              // 版本号
-	IsDeleted          int    `json:"is_deleted"`           // 是否删除
-	Status             int    `json:"status"`               //成员状态0:正常，2:黑名单
-	Vercode            string `json:"vercode"`              // 验证码
-	InviteUID          string `json:"invite_uid"`           // 邀请人
-	Robot              int    `json:"robot"`                // 机器人
-	ForbiddenExpirTime int64  `json:"forbidden_expir_time"` // 禁言时长
-	CreatedAt          string `json:"created_at"`
-	UpdatedAt          string `json:"updated_at"`
+	ID                 uint64   `json:"id"`
+	UID                string   `json:"uid"`                  // 成员uid
+	GroupNo            string   `json:"group_no"`             // 群唯一编号
+	Name               string   `json:"name"`                 // 群成员名称
+	Remark             string   `json:"remark"`               // 成员备注
+	Role               int      `json:"role"`                 // 成员角色
+	Permissions        int      `json:"permissions"`          // 管理员权限位
+	Version            int64    `json:"version"`              // 版本号
+	IsDeleted          int      `json:"is_deleted"`           // 是否删除
+	Status             int      `json:"status"`               //成员状态0:正常，2:黑名单
+	Vercode            string   `json:"vercode"`              // 验证码
+	InviteUID          string   `json:"invite_uid"`           // 邀请人
+	Robot              int      `json:"robot"`                // 机器人
+	ForbiddenExpirTime int64    `json:"forbidden_expir_time"` // 禁言时长
+	CommunityRole      int      `json:"community_role"`       // 在所属社群的角色 0.普通成员 1.创建者 2.管理员
+	Tags               []string `json:"tags"`                 // 成员所在的标签编号
+	CreatedAt          string   `json:"created_at"`
+	UpdatedAt          string   `json:"updated_at"`
 }
 
 func (r memberDetailResp) from(model *MemberDetailModel) memberDetailResp {
 	return memberDetailResp{
-		ID:        uint64(model.Id),
-		UID:       model.UID,
-		GroupNo:   model.GroupNo,
-		Name:      model.Name,
-		Remark:    model.Remark,
-		Role:      model.Role,
-		Version:   model.Version,
-		IsDeleted: model.IsDeleted,
-		Status:    model.Status,
+		ID:          uint64(model.Id),
+		UID:         model.UID,
+		GroupNo:     model.GroupNo,
+		Name:        model.Name,
+		Remark:      model.Remark,
+		Role:        model.Role,
+		Permissions: model.Permissions,
+		Version:     model.Version,
+		IsDeleted:   model.IsDeleted,
+		Status:      model.Status,
 		// Vercode:            model.Vercode,
 		InviteUID:          model.InviteUID,
 		Robot:              model.Robot,
@@ -2962,6 +3209,37 @@ func (m memberAddReq) Check() error {
 	return nil
 }
 
+type managerAddReq struct {
+	UIDs        []string           `json:"uids"`        // 成员uid
+	Permissions *ManagerPermission `json:"permissions"` // 管理员权限位 不传则拥有全部权限
+}
+
+// parseManagerAddReq 兼容旧版本直接提交成员uid数组的格式
+func parseManagerAddReq(body []byte) (*managerAddReq, error) {
+	req := &managerAddReq{}
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		return req, util.ReadJsonByByte(body, &req.UIDs)
+	}
+	return req, util.ReadJsonByByte(body, req)
+}
+
+func (m managerAddReq) check() error {
+	if len(m.UIDs) <= 0 {
+		return errors.New("请选择需要添加的成员！")
+	}
+	if !m.permissions().Valid() {
+		return errors.New("权限设置有误！")
+	}
+	return nil
+}
+
+func (m managerAddReq) permissions() ManagerPermission {
+	if m.Permissions == nil {
+		return ManagerPermissionAll
+	}
+	return *m.Permissions
+}
+
 type memberRemoveReq struct {
 	Members []string `json:"members"` // 成员uid
 }
@@ -8,6 +8,7 @@ import (
 	"io"
 	"strconv"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
@@ -40,15 +41,18 @@ func NewManager(ctx *config.Context) *Manager {
 
 // Route 配置路由规则
 func (m *Manager) Route(r *wkhttp.WKHttp) {
-	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r))
+	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r), audit.Middleware(m.ctx))
 	{
-		auth.GET("/group/list", m.list)                              // 群列表
-		auth.GET("/group/disablelist", m.disablelist)                // 封禁群列表
-		auth.PUT("/group/liftban/:groupNo/:status", m.leftbangroup)  // 封禁或解禁某个群
-		auth.PUT("/groups/:group_no/forbidden/:on", m.forbidden)     // 群全员禁言
-		auth.GET("/groups/:group_no/members", m.members)             // 群成员
-		auth.GET("/groups/:group_no/members/blacklist", m.blacklist) // 群黑名单成员
-		auth.DELETE("/groups/:group_no/members", m.removeMember)     // 移除群成员
+		auth.GET("/group/list", m.list)                                           // 群列表
+		auth.GET("/group/disablelist", m.disablelist)                             // 封禁群列表
+		auth.PUT("/group/liftban/:groupNo/:status", m.leftbangroup)               // 封禁或解禁某个群
+		auth.PUT("/groups/:group_no/forbidden/:on", m.forbidden)                  // 群全员禁言
+		auth.GET("/groups/:group_no/members", m.members)                          // 群成员
+		auth.GET("/groups/:group_no/members/blacklist", m.blacklist)              // 群黑名单成员
+		auth.DELETE("/groups/:group_no/members", m.removeMember)                  // 移除群成员
+		auth.GET("/group/directory", m.directoryList)                             // 公开群目录
+		auth.PUT("/groups/:group_no/directory/featured/:on", m.directoryFeatured) // 推荐或取消推荐公开群
+		auth.PUT("/groups/:group_no/directory/hidden/:on", m.directoryHidden)     // 隐藏或显示公开群
 	}
 }
 
@@ -242,6 +246,7 @@ func (m *Manager) leftbangroup(c *wkhttp.Context) {
 		c.ResponseError(errors.New("调用IM修改channel信息服务失败！"))
 		return
 	}
+	oldStatus := group.Status
 	group.Status = groupStatus
 	//通知群成员更新群资料
 	// todo
@@ -285,6 +290,7 @@ func (m *Manager) leftbangroup(c *wkhttp.Context) {
 		return
 	}
 	m.ctx.EventCommit(eventID)
+	audit.Record(c, "group.status", groupNo, map[string]interface{}{"status": oldStatus}, map[string]interface{}{"status": groupStatus})
 
 	c.ResponseOK()
 }
@@ -560,3 +566,91 @@ type managerMemberResp struct {
 // 	}
 // 	return nil
 // }
+
+// 后台查询公开群目录（包含已隐藏的群）
+func (m *Manager) directoryList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	filter := &directoryFilter{
+		Keyword:       c.Query("keyword"),
+		Tag:           c.Query("tag"),
+		Category:      c.Query("category"),
+		IncludeHidden: true,
+	}
+	models, err := m.db.queryDirectoryGroups(filter, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询公开群列表失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询公开群列表失败！"))
+		return
+	}
+	count, err := m.db.queryDirectoryGroupCount(filter)
+	if err != nil {
+		m.Error("查询公开群数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询公开群数量失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  newDirectoryGroupResps(models),
+	})
+}
+
+// 推荐或取消推荐公开群
+func (m *Manager) directoryFeatured(c *wkhttp.Context) {
+	groupNo, on, err := m.directoryOperateParam(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = m.db.updateDirectoryFeatured(groupNo, on)
+	if err != nil {
+		m.Error("修改公开群推荐状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改公开群推荐状态失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 隐藏或显示公开群
+func (m *Manager) directoryHidden(c *wkhttp.Context) {
+	groupNo, on, err := m.directoryOperateParam(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = m.db.updateDirectoryHidden(groupNo, on)
+	if err != nil {
+		m.Error("修改公开群隐藏状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改公开群隐藏状态失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+func (m *Manager) directoryOperateParam(c *wkhttp.Context) (string, int, error) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		return "", 0, err
+	}
+	groupNo := c.Param("group_no")
+	if groupNo == "" {
+		return "", 0, errors.New("群编号不能为空")
+	}
+	on, _ := strconv.ParseInt(c.Param("on"), 10, 64)
+	if on != 0 && on != 1 {
+		return "", 0, errors.New("参数错误！")
+	}
+	directory, err := m.db.queryDirectory(groupNo)
+	if err != nil {
+		m.Error("查询群目录设置失败！", zap.Error(err))
+		return "", 0, errors.New("查询群目录设置失败！")
+	}
+	if directory == nil {
+		return "", 0, errors.New("该群未设置公开目录！")
+	}
+	return groupNo, int(on), nil
+}
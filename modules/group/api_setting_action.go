@@ -59,21 +59,13 @@ type groupUpdateContext struct {
 	g          *Group
 }
 
-func (g *groupUpdateContext) isManager() (bool, error) {
-	isManager, err := g.g.db.QueryIsGroupManagerOrCreator(g.groupModel.GroupNo, g.loginUID)
+func (g *groupUpdateContext) checkPermission(permission ManagerPermission) error {
+	hasPermission, err := g.g.db.QueryHasPermission(g.groupModel.GroupNo, g.loginUID, permission)
 	if err != nil {
 		g.g.Error("查询是否是群管理者失败！", zap.Error(err))
-		return false, err
-	}
-	return isManager, nil
-}
-
-func (g *groupUpdateContext) checkPermissions() error {
-	isManager, err := g.isManager()
-	if err != nil {
 		return err
 	}
-	if !isManager {
+	if !hasPermission {
 		return errors.New("没有权限！")
 	}
 	return nil
@@ -133,7 +125,7 @@ type groupSettingActionFnc func(ctx *settingContext, value interface{}) error
 
 // 设置action
 var settingActionMap = map[string]groupSettingActionFnc{
-	"mute": func(ctx *settingContext, value interface{}) error { // 免打扰
+	"mute": func(ctx *settingContext, value interface{}) error { // 免打扰 0.关闭 1.开启 2.仅@我时通知
 		ctx.groupSetting.Mute = int(value.(float64))
 		return ctx.updateSettingAndSendCMD()
 	},
@@ -185,7 +177,7 @@ var settingActionMap = map[string]groupSettingActionFnc{
 
 var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 	common.GroupAttrKeyForbidden: func(ctx *groupUpdateContext, value interface{}) error { // 群内禁言
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermission(ManagerPermissionBanMember); err != nil {
 			return err
 		}
 		ctx.groupModel.Forbidden = int(value.(float64))
@@ -222,7 +214,7 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		return nil
 	},
 	common.GroupAttrKeyForbiddenAddFriend: func(ctx *groupUpdateContext, value interface{}) error { // 群内禁止加好友
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermission(ManagerPermissionChangeInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.ForbiddenAddFriend = int(value.(float64))
@@ -237,7 +229,7 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		return err
 	},
 	common.GroupAttrKeyInvite: func(ctx *groupUpdateContext, value interface{}) error { // 邀请开关
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermission(ManagerPermissionChangeInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.Invite = int(value.(float64))
@@ -250,7 +242,7 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		return ctx.commmitGroupUpdateEvent(common.GroupAttrKeyInvite, fmt.Sprintf("%d", ctx.groupModel.Invite))
 	},
 	common.GroupAllowViewHistoryMsg: func(ctx *groupUpdateContext, value interface{}) error {
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermission(ManagerPermissionChangeInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.AllowViewHistoryMsg = int(value.(float64))
@@ -264,7 +256,7 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		return ctx.g.ctx.SendChannelUpdateToGroup(groupNo)
 	},
 	common.GroupAllowMemberPinnedMessage: func(ctx *groupUpdateContext, value interface{}) error {
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermission(ManagerPermissionChangeInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.AllowMemberPinnedMessage = int(value.(float64))
@@ -0,0 +1,934 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	communityMaxNameLength        = 40
+	communityMaxDescriptionLength = 500
+)
+
+// 创建社群
+func (g *Group) communityCreate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req communityReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model := &communityModel{
+		CommunityNo: util.GenerUUID(),
+		Name:        req.Name,
+		Description: req.Description,
+		Creator:     loginUID,
+		Status:      CommunityStatusNormal,
+		Version:     g.ctx.GenSeq(common.GroupSeqKey),
+	}
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = g.db.insertCommunityTx(model, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("添加社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加社群失败！"))
+		return
+	}
+	err = g.db.upsertCommunityMemberTx(&communityMemberModel{
+		CommunityNo: model.CommunityNo,
+		UID:         loginUID,
+		Role:        CommunityRoleCreator,
+		Status:      CommunityMemberStatusNormal,
+		Operator:    loginUID,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("添加社群创建者失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加社群创建者失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.Response(newCommunityResp(model, CommunityRoleCreator))
+}
+
+// 我所在的社群
+func (g *Group) communityMy(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	models, err := g.db.queryCommunitiesWithUID(loginUID)
+	if err != nil {
+		g.Error("查询我的社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询我的社群失败！"))
+		return
+	}
+	resps := make([]*communityResp, 0, len(models))
+	for _, model := range models {
+		role := CommunityRoleCommon
+		if model.Creator == loginUID {
+			role = CommunityRoleCreator
+		} else {
+			member, err := g.db.queryCommunityMember(model.CommunityNo, loginUID)
+			if err != nil {
+				g.Error("查询社群成员失败！", zap.Error(err))
+				c.ResponseError(errors.New("查询社群成员失败！"))
+				return
+			}
+			role = communityMemberRole(member)
+		}
+		resps = append(resps, newCommunityResp(model, role))
+	}
+	c.Response(resps)
+}
+
+// 社群详情
+func (g *Group) communityGet(c *wkhttp.Context) {
+	community, role, ok := g.getCommunityForMember(c)
+	if !ok {
+		return
+	}
+	groups, err := g.db.queryCommunityGroupDetails(community.CommunityNo)
+	if err != nil {
+		g.Error("查询社群的群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群的群失败！"))
+		return
+	}
+	memberCount, err := g.db.queryCommunityRosterCount(community.CommunityNo, "")
+	if err != nil {
+		g.Error("查询社群成员数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员数量失败！"))
+		return
+	}
+	resp := newCommunityResp(community, role)
+	resp.MemberCount = memberCount
+	resp.Groups = make([]*communityGroupResp, 0, len(groups))
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, &communityGroupResp{
+			GroupNo:      group.GroupNo,
+			Name:         group.Name,
+			Avatar:       fmt.Sprintf("groups/%s/avatar", group.GroupNo),
+			MemberCount:  group.MemberCount,
+			Announcement: boolToInt(group.GroupNo == community.AnnouncementGroupNo),
+		})
+	}
+	c.Response(resp)
+}
+
+// 修改社群信息
+func (g *Group) communityUpdate(c *wkhttp.Context) {
+	var req communityReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	community, role, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	community.Name = req.Name
+	community.Description = req.Description
+	community.Version = g.ctx.GenSeq(common.GroupSeqKey)
+	err := g.db.updateCommunity(community)
+	if err != nil {
+		g.Error("修改社群信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改社群信息失败！"))
+		return
+	}
+	g.sendCommunityGroupsUpdate(community.CommunityNo)
+	c.Response(newCommunityResp(community, role))
+}
+
+// 解散社群，社群下的群保留
+func (g *Group) communityDisband(c *wkhttp.Context) {
+	community, role, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	if role != CommunityRoleCreator {
+		c.ResponseError(errors.New("只有社群创建者才能解散社群！"))
+		return
+	}
+	groupNos, err := g.db.queryCommunityGroupNos(community.CommunityNo)
+	if err != nil {
+		g.Error("查询社群的群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群的群失败！"))
+		return
+	}
+	community.Status = CommunityStatusDisband
+	community.AnnouncementGroupNo = ""
+	community.Version = g.ctx.GenSeq(common.GroupSeqKey)
+	err = g.db.updateCommunity(community)
+	if err != nil {
+		g.Error("解散社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("解散社群失败！"))
+		return
+	}
+	err = g.db.deleteCommunityGroups(community.CommunityNo)
+	if err != nil {
+		g.Error("移除社群的群失败！", zap.Error(err))
+		c.ResponseError(errors.New("移除社群的群失败！"))
+		return
+	}
+	for _, groupNo := range groupNos {
+		g.sendCommunityGroupUpdate(groupNo)
+	}
+	c.ResponseOK()
+}
+
+// 将群加入社群，需要同时是社群管理员和群主
+func (g *Group) communityGroupAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		GroupNo string `json:"group_no"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.GroupNo) == "" {
+		c.ResponseError(errors.New("群编号不能为空！"))
+		return
+	}
+	community, _, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	if _, err := g.getGroupInfo(req.GroupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	isCreator, err := g.db.QueryIsGroupCreator(req.GroupNo, loginUID)
+	if err != nil {
+		g.Error("查询是否是群主失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群主失败！"))
+		return
+	}
+	if !isCreator {
+		c.ResponseError(errors.New("只有群主才能将群加入社群！"))
+		return
+	}
+	communityGroup, err := g.db.queryCommunityGroupWithGroupNo(req.GroupNo)
+	if err != nil {
+		g.Error("查询群所属社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群所属社群失败！"))
+		return
+	}
+	if communityGroup != nil {
+		c.ResponseError(errors.New("该群已属于其他社群！"))
+		return
+	}
+	err = g.db.insertCommunityGroup(&communityGroupModel{
+		CommunityNo: community.CommunityNo,
+		GroupNo:     req.GroupNo,
+		Operator:    loginUID,
+	})
+	if err != nil {
+		g.Error("将群加入社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("将群加入社群失败！"))
+		return
+	}
+	// 社群内已封禁的用户在新加入的群内同样拉黑
+	bannedMembers, err := g.db.queryCommunityMembersWithStatus(community.CommunityNo, CommunityMemberStatusBanned)
+	if err != nil {
+		g.Error("查询社群封禁成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群封禁成员失败！"))
+		return
+	}
+	for _, bannedMember := range bannedMembers {
+		err = g.setCommunityBanInGroup(req.GroupNo, bannedMember.UID, true)
+		if err != nil {
+			g.Warn("拉黑社群封禁成员失败！", zap.Error(err), zap.String("groupNo", req.GroupNo), zap.String("uid", bannedMember.UID))
+		}
+	}
+	g.sendCommunityGroupUpdate(req.GroupNo)
+	c.ResponseOK()
+}
+
+// 将群移出社群，社群管理员或群主可操作
+func (g *Group) communityGroupRemove(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	community, role, ok := g.getCommunityForMember(c)
+	if !ok {
+		return
+	}
+	communityGroup, err := g.db.queryCommunityGroupWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询群所属社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群所属社群失败！"))
+		return
+	}
+	if communityGroup == nil || communityGroup.CommunityNo != community.CommunityNo {
+		c.ResponseError(errors.New("该群不属于此社群！"))
+		return
+	}
+	if role != CommunityRoleCreator && role != CommunityRoleAdmin {
+		isCreator, err := g.db.QueryIsGroupCreator(groupNo, loginUID)
+		if err != nil {
+			g.Error("查询是否是群主失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是群主失败！"))
+			return
+		}
+		if !isCreator {
+			c.ResponseError(errors.New("没有将群移出社群的权限！"))
+			return
+		}
+	}
+	err = g.db.deleteCommunityGroup(community.CommunityNo, groupNo)
+	if err != nil {
+		g.Error("将群移出社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("将群移出社群失败！"))
+		return
+	}
+	if community.AnnouncementGroupNo == groupNo {
+		community.AnnouncementGroupNo = ""
+		community.Version = g.ctx.GenSeq(common.GroupSeqKey)
+		err = g.db.updateCommunity(community)
+		if err != nil {
+			g.Error("修改社群公告群失败！", zap.Error(err))
+			c.ResponseError(errors.New("修改社群公告群失败！"))
+			return
+		}
+	}
+	// 社群管理员在该群失去的管理权限需要同步给成员
+	err = g.refreshGroupManagers(groupNo)
+	if err != nil {
+		g.Warn("刷新群管理员失败！", zap.Error(err), zap.String("groupNo", groupNo))
+	}
+	g.sendCommunityGroupUpdate(groupNo)
+	c.ResponseOK()
+}
+
+// 设置社群公告群，公告群开启全员禁言，只有群主及管理员（包含社群管理员）可以发言
+func (g *Group) communityAnnouncementGroupSet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	var req struct {
+		GroupNo string `json:"group_no"` // 为空表示取消公告群
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	community, _, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	if req.GroupNo != "" {
+		communityGroup, err := g.db.queryCommunityGroupWithGroupNo(req.GroupNo)
+		if err != nil {
+			g.Error("查询群所属社群失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询群所属社群失败！"))
+			return
+		}
+		if communityGroup == nil || communityGroup.CommunityNo != community.CommunityNo {
+			c.ResponseError(errors.New("公告群必须是社群内的群！"))
+			return
+		}
+		groupModel, err := g.getGroupInfo(req.GroupNo)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		if groupModel.Forbidden != 1 {
+			err = g.updateGroupForbidden(groupModel, 1, loginUID, loginName)
+			if err != nil {
+				c.ResponseError(err)
+				return
+			}
+		}
+	}
+	community.AnnouncementGroupNo = req.GroupNo
+	community.Version = g.ctx.GenSeq(common.GroupSeqKey)
+	err := g.db.updateCommunity(community)
+	if err != nil {
+		g.Error("修改社群公告群失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改社群公告群失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 社群成员加入社群公告群
+func (g *Group) communityAnnouncementGroupJoin(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	community, _, ok := g.getCommunityForMember(c)
+	if !ok {
+		return
+	}
+	groupNo := community.AnnouncementGroupNo
+	if groupNo == "" {
+		c.ResponseError(errors.New("社群未设置公告群！"))
+		return
+	}
+	groupModel, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	exist, err := g.db.ExistMember(loginUID, groupNo)
+	if err != nil {
+		g.Error("查询是否在群内失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否在群内失败！"))
+		return
+	}
+	if exist {
+		c.ResponseError(errors.New("已经在公告群内！"))
+		return
+	}
+	creator, err := g.userDB.QueryByUID(groupModel.Creator)
+	if err != nil {
+		g.Error("查询群主信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群主信息失败！"))
+		return
+	}
+	if creator == nil {
+		c.ResponseError(errors.New("群主信息不存在！"))
+		return
+	}
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	commitCallback, err := g.scanJoinTx(groupNo, creator.UID, creator.Name, loginUID, loginName, tx)
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		c.ResponseError(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	commitCallback()
+	c.Response(map[string]interface{}{
+		"group_no": groupNo,
+	})
+}
+
+// 社群成员列表（所有子群成员的并集）
+func (g *Group) communityMembers(c *wkhttp.Context) {
+	community, _, ok := g.getCommunityForMember(c)
+	if !ok {
+		return
+	}
+	keyword := strings.TrimSpace(c.Query("keyword"))
+	pageIndex, pageSize := c.GetPage()
+	models, err := g.db.queryCommunityRoster(community.CommunityNo, keyword, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		g.Error("查询社群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员失败！"))
+		return
+	}
+	count, err := g.db.queryCommunityRosterCount(community.CommunityNo, keyword)
+	if err != nil {
+		g.Error("查询社群成员数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员数量失败！"))
+		return
+	}
+	list := make([]*communityMemberResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, &communityMemberResp{
+			UID:        model.UID,
+			Name:       model.Name,
+			Role:       model.Role,
+			GroupCount: model.GroupCount,
+		})
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+// 设置或取消社群管理员，社群管理员拥有所有子群的管理权限
+func (g *Group) communityAdminSet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	uid := c.Param("uid")
+	on, _ := strconv.Atoi(c.Param("on"))
+	community, role, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	if role != CommunityRoleCreator {
+		c.ResponseError(errors.New("只有社群创建者才能设置管理员！"))
+		return
+	}
+	if uid == community.Creator {
+		c.ResponseError(errors.New("不能修改社群创建者的角色！"))
+		return
+	}
+	member, err := g.db.queryCommunityMember(community.CommunityNo, uid)
+	if err != nil {
+		g.Error("查询社群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员失败！"))
+		return
+	}
+	if member != nil && member.Status == CommunityMemberStatusBanned {
+		c.ResponseError(errors.New("该用户已被社群封禁！"))
+		return
+	}
+	if on == 1 {
+		exist, err := g.db.existCommunityRosterMember(community.CommunityNo, uid)
+		if err != nil {
+			g.Error("查询是否是社群成员失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是社群成员失败！"))
+			return
+		}
+		if !exist {
+			c.ResponseError(errors.New("该用户不是社群成员！"))
+			return
+		}
+	}
+	newRole := CommunityRoleCommon
+	if on == 1 {
+		newRole = CommunityRoleAdmin
+	}
+	err = g.db.upsertCommunityMember(&communityMemberModel{
+		CommunityNo: community.CommunityNo,
+		UID:         uid,
+		Role:        newRole,
+		Status:      CommunityMemberStatusNormal,
+		Operator:    loginUID,
+	})
+	if err != nil {
+		g.Error("设置社群管理员失败！", zap.Error(err))
+		c.ResponseError(errors.New("设置社群管理员失败！"))
+		return
+	}
+	g.refreshCommunityMember(community.CommunityNo, uid)
+	c.ResponseOK()
+}
+
+// 社群封禁列表
+func (g *Group) communityBans(c *wkhttp.Context) {
+	community, _, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	models, err := g.db.queryCommunityMembersWithStatus(community.CommunityNo, CommunityMemberStatusBanned)
+	if err != nil {
+		g.Error("查询社群封禁成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群封禁成员失败！"))
+		return
+	}
+	uids := make([]string, 0, len(models))
+	for _, model := range models {
+		uids = append(uids, model.UID)
+	}
+	nameMap := map[string]string{}
+	if len(uids) > 0 {
+		users, err := g.userDB.QueryByUIDs(uids)
+		if err != nil {
+			g.Error("查询用户信息失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询用户信息失败！"))
+			return
+		}
+		for _, user := range users {
+			nameMap[user.UID] = user.Name
+		}
+	}
+	resps := make([]*communityBanResp, 0, len(models))
+	for _, model := range models {
+		resps = append(resps, &communityBanResp{
+			UID:      model.UID,
+			Name:     nameMap[model.UID],
+			Operator: model.Operator,
+			BannedAt: model.UpdatedAt.String(),
+		})
+	}
+	c.Response(resps)
+}
+
+// 在社群内封禁用户，用户将被所有子群拉黑且不能再加入社群下的群
+func (g *Group) communityBan(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		UID string `json:"uid"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.UID) == "" {
+		c.ResponseError(errors.New("用户uid不能为空！"))
+		return
+	}
+	if req.UID == loginUID {
+		c.ResponseError(errors.New("不能封禁自己！"))
+		return
+	}
+	community, _, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	member, err := g.db.queryCommunityMember(community.CommunityNo, req.UID)
+	if err != nil {
+		g.Error("查询社群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员失败！"))
+		return
+	}
+	if req.UID == community.Creator || communityMemberRole(member) != CommunityRoleCommon {
+		c.ResponseError(errors.New("不能封禁社群创建者或管理员！"))
+		return
+	}
+	g.setCommunityBan(c, community, req.UID, true)
+}
+
+// 解除社群封禁
+func (g *Group) communityUnban(c *wkhttp.Context) {
+	uid := c.Param("uid")
+	community, _, ok := g.getCommunityForAdmin(c)
+	if !ok {
+		return
+	}
+	member, err := g.db.queryCommunityMember(community.CommunityNo, uid)
+	if err != nil {
+		g.Error("查询社群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员失败！"))
+		return
+	}
+	if member == nil || member.Status != CommunityMemberStatusBanned {
+		c.ResponseError(errors.New("该用户未被封禁！"))
+		return
+	}
+	g.setCommunityBan(c, community, uid, false)
+}
+
+func (g *Group) setCommunityBan(c *wkhttp.Context, community *communityModel, uid string, ban bool) {
+	status := CommunityMemberStatusNormal
+	if ban {
+		status = CommunityMemberStatusBanned
+	}
+	err := g.db.upsertCommunityMember(&communityMemberModel{
+		CommunityNo: community.CommunityNo,
+		UID:         uid,
+		Role:        CommunityRoleCommon,
+		Status:      status,
+		Operator:    c.GetLoginUID(),
+	})
+	if err != nil {
+		g.Error("修改社群封禁状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改社群封禁状态失败！"))
+		return
+	}
+	groupNos, err := g.db.queryCommunityGroupNos(community.CommunityNo)
+	if err != nil {
+		g.Error("查询社群的群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群的群失败！"))
+		return
+	}
+	failCount := 0
+	for _, groupNo := range groupNos {
+		err = g.setCommunityBanInGroup(groupNo, uid, ban)
+		if err != nil {
+			failCount++
+			g.Warn("修改群内黑名单失败！", zap.Error(err), zap.String("groupNo", groupNo), zap.String("uid", uid))
+		}
+	}
+	c.Response(map[string]interface{}{
+		"group_count": len(groupNos), // 社群下群的数量
+		"fail_count":  failCount,     // 处理失败的群数量
+	})
+}
+
+// setCommunityBanInGroup 将用户在群内拉黑或移出黑名单（群主不受影响）
+func (g *Group) setCommunityBanInGroup(groupNo string, uid string, ban bool) error {
+	member, err := g.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		return err
+	}
+	if member == nil || member.Role == MemberRoleCreator {
+		return nil
+	}
+	status := int(common.GroupMemberStatusNormal)
+	if ban {
+		status = int(common.GroupMemberStatusBlacklist)
+	}
+	if member.Status == status {
+		return nil
+	}
+	version := g.ctx.GenSeq(common.GroupMemberSeqKey)
+	err = g.db.updateMembersStatus(version, groupNo, status, []string{uid})
+	if err != nil {
+		return err
+	}
+	if ban || member.ForbiddenExpirTime == 0 {
+		err = g.setGroupBlacklist(groupNo, []string{uid}, ban)
+		if err != nil {
+			return err
+		}
+	}
+	return g.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         common.CMDGroupMemberUpdate,
+		Param: map[string]interface{}{
+			"group_no": groupNo,
+			"uid":      uid,
+		},
+	})
+}
+
+// refreshCommunityMember 社群角色变化后，更新成员在各子群的数据版本及禁言白名单
+func (g *Group) refreshCommunityMember(communityNo string, uid string) {
+	groupNos, err := g.db.queryCommunityGroupNos(communityNo)
+	if err != nil {
+		g.Warn("查询社群的群失败！", zap.Error(err), zap.String("communityNo", communityNo))
+		return
+	}
+	for _, groupNo := range groupNos {
+		exist, err := g.db.ExistMember(uid, groupNo)
+		if err != nil {
+			g.Warn("查询是否在群内失败！", zap.Error(err), zap.String("groupNo", groupNo))
+			continue
+		}
+		if !exist {
+			continue
+		}
+		err = g.db.updateMemberVersion(groupNo, uid, g.ctx.GenSeq(common.GroupMemberSeqKey))
+		if err != nil {
+			g.Warn("更新成员版本失败！", zap.Error(err), zap.String("groupNo", groupNo))
+			continue
+		}
+		err = g.refreshGroupManagers(groupNo)
+		if err != nil {
+			g.Warn("刷新群管理员失败！", zap.Error(err), zap.String("groupNo", groupNo))
+			continue
+		}
+		err = g.ctx.SendCMD(config.MsgCMDReq{
+			ChannelID:   groupNo,
+			ChannelType: common.ChannelTypeGroup.Uint8(),
+			CMD:         common.CMDGroupMemberUpdate,
+			Param: map[string]interface{}{
+				"group_no": groupNo,
+				"uid":      uid,
+			},
+		})
+		if err != nil {
+			g.Warn("发送更新群成员命令失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		}
+	}
+}
+
+// refreshGroupManagers 全员禁言的群需要重新设置管理员白名单
+func (g *Group) refreshGroupManagers(groupNo string) error {
+	groupModel, err := g.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		return err
+	}
+	if groupModel == nil || groupModel.Forbidden != 1 {
+		return nil
+	}
+	return g.setIMWhitelistForGroupManager(groupNo)
+}
+
+func (g *Group) sendCommunityGroupsUpdate(communityNo string) {
+	groupNos, err := g.db.queryCommunityGroupNos(communityNo)
+	if err != nil {
+		g.Warn("查询社群的群失败！", zap.Error(err), zap.String("communityNo", communityNo))
+		return
+	}
+	for _, groupNo := range groupNos {
+		g.sendCommunityGroupUpdate(groupNo)
+	}
+}
+
+func (g *Group) sendCommunityGroupUpdate(groupNo string) {
+	err := g.ctx.SendChannelUpdateToGroup(groupNo)
+	if err != nil {
+		g.Warn("发送频道更新命令失败！", zap.Error(err), zap.String("groupNo", groupNo))
+	}
+}
+
+// getCommunityForMember 获取社群及登录用户的角色，需要是社群成员
+func (g *Group) getCommunityForMember(c *wkhttp.Context) (*communityModel, int, bool) {
+	loginUID := c.GetLoginUID()
+	community, member, ok := g.getCommunityAndMember(c)
+	if !ok {
+		return nil, 0, false
+	}
+	if member != nil && member.Status == CommunityMemberStatusBanned {
+		c.ResponseError(errors.New("已被社群封禁！"))
+		return nil, 0, false
+	}
+	role := communityMemberRole(member)
+	if role == CommunityRoleCommon {
+		exist, err := g.db.existCommunityRosterMember(community.CommunityNo, loginUID)
+		if err != nil {
+			g.Error("查询是否是社群成员失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是社群成员失败！"))
+			return nil, 0, false
+		}
+		if !exist {
+			c.ResponseError(errors.New("不是社群成员，无法操作！"))
+			return nil, 0, false
+		}
+	}
+	return community, role, true
+}
+
+// getCommunityForAdmin 获取社群及登录用户的角色，需要是社群创建者或管理员
+func (g *Group) getCommunityForAdmin(c *wkhttp.Context) (*communityModel, int, bool) {
+	community, member, ok := g.getCommunityAndMember(c)
+	if !ok {
+		return nil, 0, false
+	}
+	role := communityMemberRole(member)
+	if role != CommunityRoleCreator && role != CommunityRoleAdmin {
+		c.ResponseError(errors.New("没有社群管理权限！"))
+		return nil, 0, false
+	}
+	return community, role, true
+}
+
+func (g *Group) getCommunityAndMember(c *wkhttp.Context) (*communityModel, *communityMemberModel, bool) {
+	communityNo := c.Param("community_no")
+	community, err := g.db.queryCommunity(communityNo)
+	if err != nil {
+		g.Error("查询社群失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群失败！"))
+		return nil, nil, false
+	}
+	if community == nil || community.Status != CommunityStatusNormal {
+		c.ResponseError(errors.New("社群不存在或已解散！"))
+		return nil, nil, false
+	}
+	member, err := g.db.queryCommunityMember(communityNo, c.GetLoginUID())
+	if err != nil {
+		g.Error("查询社群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询社群成员失败！"))
+		return nil, nil, false
+	}
+	return community, member, true
+}
+
+// communityMemberRole 社群成员的有效角色，被封禁的成员没有管理权限
+func communityMemberRole(member *communityMemberModel) int {
+	if member == nil || member.Status != CommunityMemberStatusNormal {
+		return CommunityRoleCommon
+	}
+	return member.Role
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type communityReq struct {
+	Name        string `json:"name"`        // 社群名称
+	Description string `json:"description"` // 社群简介
+}
+
+func (r *communityReq) check() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Description = strings.TrimSpace(r.Description)
+	if r.Name == "" {
+		return errors.New("社群名称不能为空！")
+	}
+	if utf8.RuneCountInString(r.Name) > communityMaxNameLength {
+		return fmt.Errorf("社群名称不能超过%d个字！", communityMaxNameLength)
+	}
+	if utf8.RuneCountInString(r.Description) > communityMaxDescriptionLength {
+		return fmt.Errorf("社群简介不能超过%d个字！", communityMaxDescriptionLength)
+	}
+	return nil
+}
+
+type communityResp struct {
+	CommunityNo         string                `json:"community_no"`
+	Name                string                `json:"name"`                  // 社群名称
+	Description         string                `json:"description"`           // 社群简介
+	Creator             string                `json:"creator"`               // 创建者uid
+	AnnouncementGroupNo string                `json:"announcement_group_no"` // 公告群编号
+	Role                int                   `json:"role"`                  // 我在社群的角色 0.普通成员 1.创建者 2.管理员
+	MemberCount         int64                 `json:"member_count"`          // 成员数量
+	Groups              []*communityGroupResp `json:"groups,omitempty"`      // 社群下的群
+	Version             int64                 `json:"version"`               // 数据版本
+	CreatedAt           string                `json:"created_at"`
+}
+
+func newCommunityResp(m *communityModel, role int) *communityResp {
+	return &communityResp{
+		CommunityNo:         m.CommunityNo,
+		Name:                m.Name,
+		Description:         m.Description,
+		Creator:             m.Creator,
+		AnnouncementGroupNo: m.AnnouncementGroupNo,
+		Role:                role,
+		Version:             m.Version,
+		CreatedAt:           m.CreatedAt.String(),
+	}
+}
+
+type communityGroupResp struct {
+	GroupNo      string `json:"group_no"`
+	Name         string `json:"name"`         // 群名称
+	Avatar       string `json:"avatar"`       // 群头像
+	MemberCount  int64  `json:"member_count"` // 成员数量
+	Announcement int    `json:"announcement"` // 是否是公告群
+}
+
+type communityMemberResp struct {
+	UID        string `json:"uid"`
+	Name       string `json:"name"`        // 成员名称
+	Role       int    `json:"role"`        // 社群角色 0.普通成员 1.创建者 2.管理员
+	GroupCount int    `json:"group_count"` // 所在子群数量
+}
+
+type communityBanResp struct {
+	UID      string `json:"uid"`
+	Name     string `json:"name"`      // 用户名称
+	Operator string `json:"operator"`  // 操作人uid
+	BannedAt string `json:"banned_at"` // 封禁时间
+}
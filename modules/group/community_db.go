@@ -0,0 +1,222 @@
+package group
+
+import (
+	"fmt"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+// communityAdminCondition 群成员是否是所在社群的创建者或管理员（社群管理权限下放到所有子群）
+var communityAdminCondition = fmt.Sprintf("exists (select 1 from community_group join community_member on community_member.community_no=community_group.community_no where community_group.group_no=group_member.group_no and community_member.uid=group_member.uid and community_member.role in (%d,%d) and community_member.status=%d)", CommunityRoleCreator, CommunityRoleAdmin, CommunityMemberStatusNormal)
+
+// insertCommunityTx 添加社群
+func (d *DB) insertCommunityTx(model *communityModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("community").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// updateCommunity 修改社群信息
+func (d *DB) updateCommunity(model *communityModel) error {
+	_, err := d.session.Update("community").SetMap(map[string]interface{}{
+		"name":                  model.Name,
+		"description":           model.Description,
+		"announcement_group_no": model.AnnouncementGroupNo,
+		"status":                model.Status,
+		"version":               model.Version,
+	}).Where("community_no=?", model.CommunityNo).Exec()
+	return err
+}
+
+// queryCommunity 查询社群
+func (d *DB) queryCommunity(communityNo string) (*communityModel, error) {
+	var model *communityModel
+	_, err := d.session.Select("*").From("community").Where("community_no=?", communityNo).Load(&model)
+	return model, err
+}
+
+// queryCommunitiesWithUID 查询用户所在的社群（社群管理员或子群成员）
+func (d *DB) queryCommunitiesWithUID(uid string) ([]*communityModel, error) {
+	var models []*communityModel
+	_, err := d.session.Select("*").From("community").Where("status=? and community_no in (select community_no from community_member where uid=? and role in ? and status=? union select community_group.community_no from community_group join group_member on group_member.group_no=community_group.group_no where group_member.uid=? and group_member.is_deleted=0)", CommunityStatusNormal, uid, []int{CommunityRoleCreator, CommunityRoleAdmin}, CommunityMemberStatusNormal, uid).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+// upsertCommunityMemberTx 添加或修改社群成员的角色及状态
+func (d *DB) upsertCommunityMemberTx(model *communityMemberModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("insert into community_member(community_no,uid,role,status,operator) values(?,?,?,?,?) ON DUPLICATE KEY UPDATE role=VALUES(role),status=VALUES(status),operator=VALUES(operator)", model.CommunityNo, model.UID, model.Role, model.Status, model.Operator).Exec()
+	return err
+}
+
+// upsertCommunityMember 添加或修改社群成员的角色及状态
+func (d *DB) upsertCommunityMember(model *communityMemberModel) error {
+	_, err := d.session.InsertBySql("insert into community_member(community_no,uid,role,status,operator) values(?,?,?,?,?) ON DUPLICATE KEY UPDATE role=VALUES(role),status=VALUES(status),operator=VALUES(operator)", model.CommunityNo, model.UID, model.Role, model.Status, model.Operator).Exec()
+	return err
+}
+
+// queryCommunityMember 查询社群成员的角色及状态
+func (d *DB) queryCommunityMember(communityNo string, uid string) (*communityMemberModel, error) {
+	var model *communityMemberModel
+	_, err := d.session.Select("*").From("community_member").Where("community_no=? and uid=?", communityNo, uid).Load(&model)
+	return model, err
+}
+
+// queryCommunityMembersWithStatus 查询指定状态的社群成员
+func (d *DB) queryCommunityMembersWithStatus(communityNo string, status int) ([]*communityMemberModel, error) {
+	var models []*communityMemberModel
+	_, err := d.session.Select("*").From("community_member").Where("community_no=? and status=?", communityNo, status).OrderDir("updated_at", false).Load(&models)
+	return models, err
+}
+
+// queryCommunityAdminsWithGroupNo 查询群所属社群的创建者及管理员
+func (d *DB) queryCommunityAdminsWithGroupNo(groupNo string) ([]*communityMemberModel, error) {
+	var models []*communityMemberModel
+	_, err := d.session.Select("community_member.*").From("community_member").Join("community_group", "community_group.community_no=community_member.community_no").Where("community_group.group_no=? and community_member.role in ? and community_member.status=?", groupNo, []int{CommunityRoleCreator, CommunityRoleAdmin}, CommunityMemberStatusNormal).Load(&models)
+	return models, err
+}
+
+// queryCommunityBannedUIDs 查询在群所属社群内被封禁的用户
+func (d *DB) queryCommunityBannedUIDs(groupNo string, uids []string) ([]string, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	var bannedUIDs []string
+	_, err := d.session.Select("community_member.uid").From("community_member").Join("community_group", "community_group.community_no=community_member.community_no").Where("community_group.group_no=? and community_member.status=? and community_member.uid in ?", groupNo, CommunityMemberStatusBanned, uids).Load(&bannedUIDs)
+	return bannedUIDs, err
+}
+
+// insertCommunityGroup 将群加入社群
+func (d *DB) insertCommunityGroup(model *communityGroupModel) error {
+	_, err := d.session.InsertInto("community_group").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// deleteCommunityGroup 将群移出社群
+func (d *DB) deleteCommunityGroup(communityNo string, groupNo string) error {
+	_, err := d.session.DeleteFrom("community_group").Where("community_no=? and group_no=?", communityNo, groupNo).Exec()
+	return err
+}
+
+// deleteCommunityGroups 移除社群下的所有群
+func (d *DB) deleteCommunityGroups(communityNo string) error {
+	_, err := d.session.DeleteFrom("community_group").Where("community_no=?", communityNo).Exec()
+	return err
+}
+
+// queryCommunityGroupWithGroupNo 查询群所属的社群
+func (d *DB) queryCommunityGroupWithGroupNo(groupNo string) (*communityGroupModel, error) {
+	var model *communityGroupModel
+	_, err := d.session.Select("*").From("community_group").Where("group_no=?", groupNo).Load(&model)
+	return model, err
+}
+
+// queryCommunityGroupNos 查询社群下的群编号
+func (d *DB) queryCommunityGroupNos(communityNo string) ([]string, error) {
+	var groupNos []string
+	_, err := d.session.Select("group_no").From("community_group").Where("community_no=?", communityNo).OrderAsc("id").Load(&groupNos)
+	return groupNos, err
+}
+
+// queryCommunityGroupDetails 查询社群下的群及成员数量
+func (d *DB) queryCommunityGroupDetails(communityNo string) ([]*communityGroupDetailModel, error) {
+	var models []*communityGroupDetailModel
+	_, err := d.session.Select("community_group.group_no,`group`.name,(select count(*) from group_member where group_member.group_no=community_group.group_no and group_member.is_deleted=0) member_count").From("community_group").Join("`group`", "`group`.group_no=community_group.group_no").Where("community_group.community_no=? and `group`.status=?", communityNo, GroupStatusNormal).OrderAsc("community_group.id").Load(&models)
+	return models, err
+}
+
+// queryCommunitiesWithGroupNos 查询群所属的社群
+func (d *DB) queryCommunitiesWithGroupNos(groupNos []string) ([]*groupCommunityModel, error) {
+	if len(groupNos) == 0 {
+		return nil, nil
+	}
+	var models []*groupCommunityModel
+	_, err := d.session.Select("community_group.group_no,community.community_no,community.name").From("community_group").Join("community", "community.community_no=community_group.community_no").Where("community_group.group_no in ? and community.status=?", groupNos, CommunityStatusNormal).Load(&models)
+	return models, err
+}
+
+// queryCommunityRoster 分页查询社群成员（所有子群成员的并集）
+func (d *DB) queryCommunityRoster(communityNo string, keyword string, pageSize, pageIndex uint64) ([]*communityRosterModel, error) {
+	var models []*communityRosterModel
+	_, err := d.communityRosterBuilder("group_member.uid,max(IFNULL(`user`.name,'')) name,max(IFNULL(community_member.role,0)) role,count(distinct group_member.group_no) group_count", communityNo, keyword).GroupBy("group_member.uid").OrderDir("group_count", false).OrderAsc("group_member.uid").Offset((pageIndex - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryCommunityRosterCount 查询社群成员数量
+func (d *DB) queryCommunityRosterCount(communityNo string, keyword string) (int64, error) {
+	var count int64
+	_, err := d.communityRosterBuilder("count(distinct group_member.uid)", communityNo, keyword).Load(&count)
+	return count, err
+}
+
+func (d *DB) communityRosterBuilder(column string, communityNo string, keyword string) *dbr.SelectStmt {
+	builder := d.session.Select(column).From("group_member").
+		Join("community_group", "community_group.group_no=group_member.group_no").
+		LeftJoin("`user`", "`user`.uid=group_member.uid").
+		LeftJoin("community_member", "community_member.community_no=community_group.community_no and community_member.uid=group_member.uid").
+		Where("community_group.community_no=? and group_member.is_deleted=0 and group_member.status=?", communityNo, int(common.GroupMemberStatusNormal))
+	if keyword != "" {
+		builder = builder.Where("`user`.name like ?", "%"+keyword+"%")
+	}
+	return builder
+}
+
+// existCommunityRosterMember 是否是社群成员（任一子群的成员）
+func (d *DB) existCommunityRosterMember(communityNo string, uid string) (bool, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_member").Join("community_group", "community_group.group_no=group_member.group_no").Where("community_group.community_no=? and group_member.uid=? and group_member.is_deleted=0", communityNo, uid).Load(&count)
+	return count > 0, err
+}
+
+// updateMemberVersion 更新成员数据版本，使客户端重新同步该成员
+func (d *DB) updateMemberVersion(groupNo string, uid string, version int64) error {
+	_, err := d.session.Update("group_member").Set("version", version).Where("group_no=? and uid=? and is_deleted=0", groupNo, uid).Exec()
+	return err
+}
+
+type communityModel struct {
+	CommunityNo         string // 社群编号
+	Name                string // 社群名称
+	Description         string // 社群简介
+	Creator             string // 创建者
+	AnnouncementGroupNo string // 公告群编号
+	Status              int    // 状态
+	Version             int64  // 数据版本
+	db.BaseModel
+}
+
+type communityGroupModel struct {
+	CommunityNo string // 社群编号
+	GroupNo     string // 群编号
+	Operator    string // 添加人
+	db.BaseModel
+}
+
+type communityMemberModel struct {
+	CommunityNo string // 社群编号
+	UID         string // 成员uid
+	Role        int    // 角色
+	Status      int    // 状态
+	Operator    string // 最后操作人
+	db.BaseModel
+}
+
+type communityGroupDetailModel struct {
+	GroupNo     string // 群编号
+	Name        string // 群名称
+	MemberCount int64  // 成员数量
+}
+
+type groupCommunityModel struct {
+	GroupNo     string // 群编号
+	CommunityNo string // 社群编号
+	Name        string // 社群名称
+}
+
+type communityRosterModel struct {
+	UID        string // 成员uid
+	Name       string // 成员名称
+	Role       int    // 社群角色
+	GroupCount int    // 所在子群数量
+}
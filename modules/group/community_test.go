@@ -0,0 +1,34 @@
+package group
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommunityReqCheck(t *testing.T) {
+	req := &communityReq{Name: "  读书会  ", Description: " 每周一本书 "}
+	assert.NoError(t, req.check())
+	assert.Equal(t, "读书会", req.Name)
+	assert.Equal(t, "每周一本书", req.Description)
+
+	req = &communityReq{Name: "   "}
+	assert.Error(t, req.check())
+
+	req = &communityReq{Name: strings.Repeat("社", communityMaxNameLength)}
+	assert.NoError(t, req.check())
+	req = &communityReq{Name: strings.Repeat("社", communityMaxNameLength+1)}
+	assert.Error(t, req.check())
+
+	req = &communityReq{Name: "读书会", Description: strings.Repeat("简", communityMaxDescriptionLength+1)}
+	assert.Error(t, req.check())
+}
+
+func TestCommunityMemberRole(t *testing.T) {
+	assert.Equal(t, CommunityRoleCommon, communityMemberRole(nil))
+	assert.Equal(t, CommunityRoleAdmin, communityMemberRole(&communityMemberModel{Role: CommunityRoleAdmin, Status: CommunityMemberStatusNormal}))
+	assert.Equal(t, CommunityRoleCreator, communityMemberRole(&communityMemberModel{Role: CommunityRoleCreator, Status: CommunityMemberStatusNormal}))
+	// 被封禁的成员没有管理权限
+	assert.Equal(t, CommunityRoleCommon, communityMemberRole(&communityMemberModel{Role: CommunityRoleAdmin, Status: CommunityMemberStatusBanned}))
+}
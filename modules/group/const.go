@@ -10,6 +10,22 @@ const (
 	GroupStatusDisband = 2
 )
 
+// CMDGroupFloodControlUpdate 群防刷屏设置更新
+const CMDGroupFloodControlUpdate = "groupFloodControlUpdate"
+
+// CMDGroupMemberTagUpdate 群成员标签更新
+const CMDGroupMemberTagUpdate = "groupMemberTagUpdate"
+
+// 群免打扰设置
+const (
+	// MuteOff 正常通知
+	MuteOff = 0
+	// MuteOn 免打扰
+	MuteOn = 1
+	// MuteMentionOnly 仅@我（包含@所有人及@我所在的标签）时通知
+	MuteMentionOnly = 2
+)
+
 // 群成员角色
 const (
 	// MemberRoleCommon 普通成员
@@ -20,6 +36,67 @@ const (
 	MemberRoleManager = 2
 )
 
+// ManagerPermission 管理员权限位，群主默认拥有全部权限
+type ManagerPermission int
+
+const (
+	// ManagerPermissionChangeInfo 修改群资料及群设置（包括成员标签）
+	ManagerPermissionChangeInfo ManagerPermission = 1 << iota
+	// ManagerPermissionDeleteMessage 删除或撤回成员消息、清空群消息
+	ManagerPermissionDeleteMessage
+	// ManagerPermissionBanMember 禁言、移除成员及拉黑
+	ManagerPermissionBanMember
+	// ManagerPermissionInvite 邀请成员及审核入群邀请
+	ManagerPermissionInvite
+	// ManagerPermissionPinMessage 置顶消息
+	ManagerPermissionPinMessage
+	// ManagerPermissionManageLink 管理邀请链接
+	ManagerPermissionManageLink
+	// ManagerPermissionAddManager 添加管理员
+	ManagerPermissionAddManager
+
+	// ManagerPermissionAll 全部权限
+	ManagerPermissionAll = ManagerPermissionChangeInfo | ManagerPermissionDeleteMessage | ManagerPermissionBanMember | ManagerPermissionInvite | ManagerPermissionPinMessage | ManagerPermissionManageLink | ManagerPermissionAddManager
+)
+
+// Int Int
+func (p ManagerPermission) Int() int {
+	return int(p)
+}
+
+// Contains 是否包含指定的全部权限
+func (p ManagerPermission) Contains(permission ManagerPermission) bool {
+	return p&permission == permission
+}
+
+// Valid 是否是有效的权限组合
+func (p ManagerPermission) Valid() bool {
+	return p >= 0 && p&^ManagerPermissionAll == 0
+}
+
+// hasPermission 群主拥有全部权限，管理员需拥有对应的权限位
+func hasPermission(role int, permissions int, permission ManagerPermission) bool {
+	if role == MemberRoleCreator {
+		return true
+	}
+	if role == MemberRoleManager {
+		return ManagerPermission(permissions).Contains(permission)
+	}
+	return false
+}
+
+// CanManageMember 操作者能否对目标成员执行需要指定权限的管理操作（如移除、禁言、撤回消息）
+// communityAdmin为操作者是否是群所属社群的创建者或管理员，社群管理员在子群内拥有全部权限，但不能管理群主
+func CanManageMember(operatorRole int, operatorPermissions int, communityAdmin bool, targetRole int, permission ManagerPermission) bool {
+	if targetRole == MemberRoleCreator {
+		return false
+	}
+	if operatorRole == MemberRoleCreator || communityAdmin {
+		return true
+	}
+	return operatorRole == MemberRoleManager && targetRole == MemberRoleCommon && hasPermission(operatorRole, operatorPermissions, permission)
+}
+
 const (
 	// InviteStatusWait 等待确认
 	InviteStatusWait = 0
@@ -38,3 +115,68 @@ const (
 const (
 	ChannelServiceName = "channel"
 )
+
+// 邀请链接状态
+const (
+	// InviteLinkStatusRevoked 已撤销
+	InviteLinkStatusRevoked = 0
+	// InviteLinkStatusValid 有效
+	InviteLinkStatusValid = 1
+)
+
+// InviteLinkCodePrefix 邀请链接二维码内容前缀 格式： grouplink_xxxx
+const InviteLinkCodePrefix = "grouplink_"
+
+// 入群验证方式
+const (
+	// NewcomerVerifyTypeNone 不验证
+	NewcomerVerifyTypeNone = 0
+	// NewcomerVerifyTypeRules 同意群规
+	NewcomerVerifyTypeRules = 1
+	// NewcomerVerifyTypeCaptcha 回答验证问题
+	NewcomerVerifyTypeCaptcha = 2
+)
+
+// 入群验证状态
+const (
+	// MemberVerifyStatusPending 待验证
+	MemberVerifyStatusPending = 0
+	// MemberVerifyStatusPassed 已通过
+	MemberVerifyStatusPassed = 1
+	// MemberVerifyStatusFailed 超时未通过
+	MemberVerifyStatusFailed = 2
+)
+
+// 定时禁言计划类型
+const (
+	// MuteScheduleKindDaily 每天重复
+	MuteScheduleKindDaily = 1
+	// MuteScheduleKindOnce 单次
+	MuteScheduleKindOnce = 2
+)
+
+// 社群状态
+const (
+	// CommunityStatusNormal 正常
+	CommunityStatusNormal = 1
+	// CommunityStatusDisband 已解散
+	CommunityStatusDisband = 2
+)
+
+// 社群角色
+const (
+	// CommunityRoleCommon 普通成员
+	CommunityRoleCommon = 0
+	// CommunityRoleCreator 创建者
+	CommunityRoleCreator = 1
+	// CommunityRoleAdmin 管理员（拥有所有子群的管理权限）
+	CommunityRoleAdmin = 2
+)
+
+// 社群成员状态
+const (
+	// CommunityMemberStatusNormal 正常
+	CommunityMemberStatusNormal = 0
+	// CommunityMemberStatusBanned 已封禁（不能加入社群下的任何群）
+	CommunityMemberStatusBanned = 2
+)
@@ -102,7 +102,21 @@ func (d *DB) queryMemberWithVercodes(vercodes []string) ([]*MemberGroupDetailMod
 // QueryIsGroupManagerOrCreator 是否是群管理者或创建者
 func (d *DB) QueryIsGroupManagerOrCreator(groupNo string, uid string) (bool, error) {
 	var count int64
-	_, err := d.session.Select("count(*)").From("group_member").Where("group_no=? and uid=? and is_deleted=0 and (role=? or role=?)", groupNo, uid, MemberRoleCreator, MemberRoleManager).Load(&count)
+	_, err := d.session.Select("count(*)").From("group_member").Where("group_no=? and uid=? and is_deleted=0 and (role=? or role=? or "+communityAdminCondition+")", groupNo, uid, MemberRoleCreator, MemberRoleManager).Load(&count)
+	return count > 0, err
+}
+
+// QueryHasPermission 是否拥有指定的群管理权限（群主及所属社群的管理员拥有全部权限）
+func (d *DB) QueryHasPermission(groupNo string, uid string, permission ManagerPermission) (bool, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_member").Where("group_no=? and uid=? and is_deleted=0 and (role=? or (role=? and permissions&?=?) or "+communityAdminCondition+")", groupNo, uid, MemberRoleCreator, MemberRoleManager, permission.Int(), permission.Int()).Load(&count)
+	return count > 0, err
+}
+
+// QueryIsCommunityAdmin 群成员是否是群所属社群的创建者或管理员
+func (d *DB) QueryIsCommunityAdmin(groupNo string, uid string) (bool, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_member").Where("group_no=? and uid=? and is_deleted=0 and "+communityAdminCondition, groupNo, uid).Load(&count)
 	return count > 0, err
 }
 
@@ -113,10 +127,10 @@ func (d *DB) QueryIsGroupCreator(groupNo string, uid string) (bool, error) {
 	return count > 0, err
 }
 
-// QueryGroupManagerOrCreatorUIDS 查询管理者或创建者的uid
+// QueryGroupManagerOrCreatorUIDS 查询管理者或创建者的uid（包含在群内的社群管理员）
 func (d *DB) QueryGroupManagerOrCreatorUIDS(groupNo string) ([]string, error) {
 	var uids []string
-	_, err := d.session.Select("uid").From("group_member").Where("group_no=? and is_deleted=0 and (role=? or role=?)", groupNo, MemberRoleCreator, MemberRoleManager).Load(&uids)
+	_, err := d.session.Select("uid").From("group_member").Where("group_no=? and is_deleted=0 and (role=? or role=? or "+communityAdminCondition+")", groupNo, MemberRoleCreator, MemberRoleManager).Load(&uids)
 	return uids, err
 }
 
@@ -139,11 +153,11 @@ func (d *DB) updateMemberForbiddenExpirTimeTx(groupNo string, uid string, time i
 }
 
 // UpdateMembersToManager 更新指定群成员为管理员
-func (d *DB) UpdateMembersToManager(groupNo string, members []string, version int64) error {
+func (d *DB) UpdateMembersToManager(groupNo string, members []string, permissions ManagerPermission, version int64) error {
 	if len(members) <= 0 {
 		return nil
 	}
-	_, err := d.session.Update("group_member").Set("role", MemberRoleManager).Set("version", version).Where("group_no=? and uid in ? and is_deleted=0", groupNo, members).Exec()
+	_, err := d.session.Update("group_member").Set("role", MemberRoleManager).Set("permissions", permissions.Int()).Set("version", version).Where("group_no=? and uid in ? and is_deleted=0 and role<>?", groupNo, members, MemberRoleCreator).Exec()
 	return err
 }
 
@@ -152,7 +166,13 @@ func (d *DB) UpdateManagersToMember(groupNo string, members []string, version in
 	if len(members) <= 0 {
 		return nil
 	}
-	_, err := d.session.Update("group_member").Set("role", MemberRoleCommon).Set("version", version).Where("group_no=? and uid in ? and is_deleted=0", groupNo, members).Exec()
+	_, err := d.session.Update("group_member").Set("role", MemberRoleCommon).Set("permissions", 0).Set("version", version).Where("group_no=? and uid in ? and is_deleted=0", groupNo, members).Exec()
+	return err
+}
+
+// updateManagerPermissions 修改管理员的权限
+func (d *DB) updateManagerPermissions(groupNo string, uid string, permissions ManagerPermission, version int64) error {
+	_, err := d.session.Update("group_member").Set("permissions", permissions.Int()).Set("version", version).Where("group_no=? and uid=? and role=? and is_deleted=0", groupNo, uid, MemberRoleManager).Exec()
 	return err
 }
 
@@ -179,11 +199,12 @@ func (d *DB) ExistMemberDelete(uid string, groupNo string) (bool, error) {
 // UpdateMemberTx 更新成员信息
 func (d *DB) UpdateMemberTx(member *MemberModel, tx *dbr.Tx) error {
 	_, err := tx.Update("group_member").SetMap(map[string]interface{}{
-		"remark":     member.Remark,
-		"role":       member.Role,
-		"version":    member.Version,
-		"is_deleted": member.IsDeleted,
-		"invite_uid": member.InviteUID,
+		"remark":      member.Remark,
+		"role":        member.Role,
+		"permissions": member.Permissions,
+		"version":     member.Version,
+		"is_deleted":  member.IsDeleted,
+		"invite_uid":  member.InviteUID,
 	}).Where("group_no=? and uid=?", member.GroupNo, member.UID).Exec()
 	return err
 }
@@ -191,12 +212,13 @@ func (d *DB) UpdateMemberTx(member *MemberModel, tx *dbr.Tx) error {
 // recoverMemberTx 恢复成员信息
 func (d *DB) recoverMemberTx(member *MemberModel, tx *dbr.Tx) error {
 	_, err := tx.Update("group_member").SetMap(map[string]interface{}{
-		"remark":     member.Remark,
-		"role":       member.Role,
-		"version":    member.Version,
-		"is_deleted": 0,
-		"invite_uid": member.InviteUID,
-		"created_at": dbr.Expr("Now()"),
+		"remark":      member.Remark,
+		"role":        member.Role,
+		"permissions": member.Permissions,
+		"version":     member.Version,
+		"is_deleted":  0,
+		"invite_uid":  member.InviteUID,
+		"created_at":  dbr.Expr("Now()"),
 	}).Where("group_no=? and uid=?", member.GroupNo, member.UID).Exec()
 	return err
 }
@@ -270,6 +292,7 @@ func (d *DB) Update(model *Model) error {
 		"forbidden_add_friend":        model.ForbiddenAddFriend,
 		"allow_view_history_msg":      model.AllowViewHistoryMsg,
 		"allow_member_pinned_message": model.AllowMemberPinnedMessage,
+		"category":                    model.Category,
 	}).Where("id=?", model.Id).Exec()
 	return err
 }
@@ -344,7 +367,7 @@ func (d *DB) QueryMemberWithUIDAndGroupNos(uid string, groupNos []string) ([]*Me
 func (d *DB) SyncMembers(groupNo string, version int64, limit uint64) ([]*MemberDetailModel, error) {
 
 	var details []*MemberDetailModel
-	builder := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=?", groupNo).OrderDir("group_member.version", true)
+	builder := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.permissions,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=?", groupNo).OrderDir("group_member.version", true)
 	var err error
 	if version <= 0 {
 		_, err = builder.Limit(limit).Load(&details)
@@ -360,9 +383,9 @@ func (d *DB) queryMembersWithKeyword(groupNo string, loginUID string, keyword st
 	var details []*MemberDetailModel
 	var builder *dbr.SelectStmt
 	if keyword != "" {
-		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").LeftJoin("user_setting", fmt.Sprintf("user_setting.uid='%s' and user_setting.to_uid=group_member.uid", loginUID)).Where("group_member.group_no=? and group_member.is_deleted=0 and group_member.status=1 and (group_member.remark like ? or user.name like ? or user_setting.remark like ?)", groupNo, "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%").OrderAsc("group_member.created_at")
+		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.permissions,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").LeftJoin("user_setting", fmt.Sprintf("user_setting.uid='%s' and user_setting.to_uid=group_member.uid", loginUID)).Where("group_member.group_no=? and group_member.is_deleted=0 and group_member.status=1 and (group_member.remark like ? or user.name like ? or user_setting.remark like ?)", groupNo, "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%").OrderAsc("group_member.created_at")
 	} else {
-		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.is_deleted=0 and group_member.status=1", groupNo).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleCreator)).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleManager)).OrderAsc("group_member.created_at")
+		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.permissions,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.is_deleted=0 and group_member.status=1", groupNo).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleCreator)).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleManager)).OrderAsc("group_member.created_at")
 	}
 	var err error
 	_, err = builder.Offset((page - 1) * limit).Limit(limit).Load(&details)
@@ -372,19 +395,19 @@ func (d *DB) queryMembersWithKeyword(groupNo string, loginUID string, keyword st
 
 func (d *DB) queryManagersWithGroupNos(groupNos []string) ([]*MemberDetailModel, error) {
 	var memberModels []*MemberDetailModel
-	_, err := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,group_member.is_deleted,group_member.version,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no in ? and group_member.is_deleted=0 and group_member.role<>0", groupNos).Load(&memberModels)
+	_, err := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.permissions,IFNULL(user.name,'') name,group_member.is_deleted,group_member.version,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no in ? and group_member.is_deleted=0 and group_member.role<>0", groupNos).Load(&memberModels)
 	return memberModels, err
 }
 
 func (d *DB) queryMembersWithGroupNo(groupNo string) ([]*MemberDetailModel, error) {
 	var details []*MemberDetailModel
-	_, err := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,group_member.is_deleted,group_member.version,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.is_deleted=0", groupNo).Load(&details)
+	_, err := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.permissions,IFNULL(user.name,'') name,group_member.is_deleted,group_member.robot,group_member.version,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.is_deleted=0", groupNo).Load(&details)
 	return details, err
 }
 
 func (d *DB) queryMemberWithGroupNoAndUID(groupNo, uid string) (*MemberDetailModel, error) {
 	var detail *MemberDetailModel
-	_, err := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.invite_uid,IFNULL(user.name,'') name,group_member.is_deleted,group_member.version,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.uid=? and group_member.is_deleted=0", groupNo, uid).Load(&detail)
+	_, err := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,group_member.permissions,group_member.invite_uid,IFNULL(user.name,'') name,group_member.is_deleted,group_member.version,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.uid=? and group_member.is_deleted=0", groupNo, uid).Load(&detail)
 	return detail, err
 }
 func (d *DB) queryBlacklistMemberUIDsWithGroupNo(groupNo string) ([]string, error) {
@@ -527,6 +550,7 @@ type MemberModel struct {
 	UID                string // 成员uid
 	Remark             string // 成员备注
 	Role               int    // 成员角色 1. 创建者	 2.管理员
+	Permissions        int    // 管理员权限位
 	Version            int64
 	Status             int    // 1.正常 2.黑名单
 	Vercode            string //验证码
@@ -544,6 +568,7 @@ type MemberDetailModel struct {
 	Name               string // 群成员名称
 	Remark             string // 成员备注
 	Role               int    // 成员角色
+	Permissions        int    // 管理员权限位
 	Version            int64
 	Vercode            string //验证码
 	InviteUID          string // 邀请人
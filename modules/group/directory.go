@@ -0,0 +1,411 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	directoryMaxDescriptionLength = 500
+	directoryMaxTags              = 5
+	directoryMaxTagLength         = 10
+	directoryMaxCategoryLength    = 20
+
+	directoryMemberCountInterval = time.Minute * 5 // 公开群成员数量的刷新间隔
+)
+
+// 公开群目录列表，支持按名称、标签及分类搜索
+func (g *Group) directoryList(c *wkhttp.Context) {
+	pageIndex, pageSize := c.GetPage()
+	filter := &directoryFilter{
+		Keyword:  strings.TrimSpace(c.Query("keyword")),
+		Tag:      strings.TrimSpace(c.Query("tag")),
+		Category: strings.TrimSpace(c.Query("category")),
+	}
+	models, err := g.db.queryDirectoryGroups(filter, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		g.Error("查询公开群列表失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询公开群列表失败！"))
+		return
+	}
+	count, err := g.db.queryDirectoryGroupCount(filter)
+	if err != nil {
+		g.Error("查询公开群数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询公开群数量失败！"))
+		return
+	}
+	c.Response(gin.H{
+		"count": count,
+		"list":  newDirectoryGroupResps(models),
+	})
+}
+
+// 通过公开群目录加入群，群开启了邀请确认时提交入群申请
+func (g *Group) directoryJoin(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	groupNo := c.Param("group_no")
+	group, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	directory, err := g.db.queryDirectory(groupNo)
+	if err != nil {
+		g.Error("查询群目录设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群目录设置失败！"))
+		return
+	}
+	if directory == nil || directory.Public != 1 || directory.Hidden == 1 {
+		c.ResponseError(errors.New("该群未公开，不能直接加入！"))
+		return
+	}
+	existMember, err := g.db.ExistMember(loginUID, groupNo)
+	if err != nil {
+		g.Error("查询是否存在群内时失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内时失败！"))
+		return
+	}
+	if existMember {
+		c.ResponseError(errors.New("已经在群内，不能再加入！"))
+		return
+	}
+	needApproval := group.Invite == 1
+	var creatorOrManagerUIDS []string
+	var creatorInfo *config.UserBaseVo
+	if needApproval {
+		existWait, err := g.db.existWaitSelfApply(groupNo, loginUID)
+		if err != nil {
+			g.Error("查询入群申请失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询入群申请失败！"))
+			return
+		}
+		if existWait {
+			c.ResponseError(errors.New("已提交入群申请，请等待管理员审核！"))
+			return
+		}
+		creatorOrManagerUIDS, err = g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+		if err != nil {
+			g.Error("查询创建者或管理员的uid失败！", zap.String("group_no", groupNo), zap.Error(err))
+			c.ResponseError(errors.New("查询创建者或管理员的uid失败！"))
+			return
+		}
+	} else {
+		creator, err := g.userDB.QueryByUID(group.Creator)
+		if err != nil {
+			g.Error("查询群主信息失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询群主信息失败！"))
+			return
+		}
+		if creator == nil {
+			c.ResponseError(errors.New("群主信息不存在！"))
+			return
+		}
+		creatorInfo = &config.UserBaseVo{UID: creator.UID, Name: creator.Name}
+	}
+
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	var commitCallback func()
+	if needApproval {
+		commitCallback, err = g.directoryApplyTx(groupNo, loginUID, loginName, creatorOrManagerUIDS, tx)
+	} else {
+		commitCallback, err = g.scanJoinTx(groupNo, creatorInfo.UID, creatorInfo.Name, loginUID, loginName, tx)
+	}
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		c.ResponseError(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	commitCallback()
+
+	waitApproval := 0
+	if needApproval {
+		waitApproval = 1
+	}
+	c.Response(gin.H{
+		"group_no":      groupNo,
+		"wait_approval": waitApproval, // 1.已提交申请，等待管理员审核 0.已加入群
+	})
+}
+
+// directoryApplyTx 通过公开群目录提交入群申请，由群主或管理员通过群邀请确认
+func (g *Group) directoryApplyTx(groupNo string, applicant string, applicantName string, subscribers []string, tx *dbr.Tx) (func(), error) {
+	inviteNo := util.GenerUUID()
+	eventID, err := g.ctx.EventBegin(&wkevent.Data{
+		Event: event.GroupMemberInviteRequest,
+		Type:  wkevent.Message,
+		Data: config.MsgGroupMemberInviteReq{
+			GroupNo:     groupNo,
+			InviteNo:    inviteNo,
+			Inviter:     applicant,
+			InviterName: applicantName,
+			Num:         1,
+			Subscribers: subscribers,
+		},
+	}, tx)
+	if err != nil {
+		g.Error("开启事件失败！", zap.Error(err))
+		return nil, errors.New("开启事件失败！")
+	}
+	err = g.db.InsertInviteTx(&InviteModel{
+		InviteNo:  inviteNo,
+		GroupNo:   groupNo,
+		Inviter:   applicant,
+		Remark:    "通过公开群目录申请入群",
+		Status:    InviteStatusWait,
+		SelfApply: 1,
+	}, tx)
+	if err != nil {
+		g.Error("添加邀请数据失败！", zap.Error(err))
+		return nil, errors.New("添加邀请数据失败！")
+	}
+	err = g.db.InsertInviteItemTx(&InviteItemModel{
+		InviteNo: inviteNo,
+		GroupNo:  groupNo,
+		Inviter:  applicant,
+		UID:      applicant,
+		Status:   InviteStatusWait,
+	}, tx)
+	if err != nil {
+		g.Error("添加邀请项失败！", zap.Error(err))
+		return nil, errors.New("添加邀请项失败！")
+	}
+	return func() {
+		g.ctx.EventCommit(eventID)
+	}, nil
+}
+
+// 获取群的公开目录设置
+func (g *Group) directoryGet(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	_, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	exist, err := g.db.ExistMember(c.GetLoginUID(), groupNo)
+	if err != nil {
+		g.Error("查询是否是群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员，无法查看！"))
+		return
+	}
+	directory, err := g.db.queryDirectory(groupNo)
+	if err != nil {
+		g.Error("查询群目录设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群目录设置失败！"))
+		return
+	}
+	if directory == nil {
+		directory = &directoryModel{GroupNo: groupNo}
+	}
+	c.Response(newDirectoryResp(directory))
+}
+
+// 修改群的公开目录设置
+func (g *Group) directoryUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req directoryReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	tags, err := req.check()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	_, err = g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	hasPermission, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionChangeInfo)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群管理者失败！"))
+		return
+	}
+	if !hasPermission {
+		c.ResponseError(errors.New("没有修改群公开设置的权限！"))
+		return
+	}
+	memberCount, err := g.db.QueryMemberCount(groupNo)
+	if err != nil {
+		g.Error("查询群成员数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员数量失败！"))
+		return
+	}
+	directory := &directoryModel{
+		GroupNo:     groupNo,
+		Public:      req.Public,
+		Description: req.Description,
+		Tags:        strings.Join(tags, ","),
+		Category:    req.Category,
+		MemberCount: memberCount,
+		Operator:    loginUID,
+	}
+	err = g.db.upsertDirectory(directory)
+	if err != nil {
+		g.Error("修改群目录设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群目录设置失败！"))
+		return
+	}
+	c.Response(newDirectoryResp(directory))
+}
+
+// RefreshDirectoryMemberCountLoop 定时刷新公开群的成员数量
+func (g *Group) RefreshDirectoryMemberCountLoop() {
+	for {
+		err := g.db.refreshDirectoryMemberCounts()
+		if err != nil {
+			g.Warn("刷新公开群成员数量失败", zap.Error(err))
+		}
+		time.Sleep(directoryMemberCountInterval)
+	}
+}
+
+type directoryReq struct {
+	Public      int      `json:"public"`      // 是否公开到群目录 0.否 1.是
+	Description string   `json:"description"` // 群简介
+	Tags        []string `json:"tags"`        // 群标签
+	Category    string   `json:"category"`    // 群分类
+}
+
+// check 校验参数并返回去重后的标签
+func (r *directoryReq) check() ([]string, error) {
+	if r.Public != 0 && r.Public != 1 {
+		return nil, errors.New("公开参数错误！")
+	}
+	r.Description = strings.TrimSpace(r.Description)
+	r.Category = strings.TrimSpace(r.Category)
+	if utf8.RuneCountInString(r.Description) > directoryMaxDescriptionLength {
+		return nil, fmt.Errorf("群简介不能超过%d个字！", directoryMaxDescriptionLength)
+	}
+	if utf8.RuneCountInString(r.Category) > directoryMaxCategoryLength {
+		return nil, fmt.Errorf("群分类不能超过%d个字！", directoryMaxCategoryLength)
+	}
+	if r.Public == 1 && r.Description == "" {
+		return nil, errors.New("公开群需要填写群简介！")
+	}
+	return normalizeDirectoryTags(r.Tags)
+}
+
+// normalizeDirectoryTags 去掉空白及重复的标签
+func normalizeDirectoryTags(tags []string) ([]string, error) {
+	results := make([]string, 0, len(tags))
+	exists := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || exists[tag] {
+			continue
+		}
+		if strings.Contains(tag, ",") {
+			return nil, errors.New("群标签不能包含逗号！")
+		}
+		if utf8.RuneCountInString(tag) > directoryMaxTagLength {
+			return nil, fmt.Errorf("群标签不能超过%d个字！", directoryMaxTagLength)
+		}
+		exists[tag] = true
+		results = append(results, tag)
+	}
+	if len(results) > directoryMaxTags {
+		return nil, fmt.Errorf("群标签不能超过%d个！", directoryMaxTags)
+	}
+	return results, nil
+}
+
+func splitDirectoryTags(tags string) []string {
+	if tags == "" {
+		return []string{}
+	}
+	return strings.Split(tags, ",")
+}
+
+type directoryResp struct {
+	GroupNo     string   `json:"group_no"`
+	Public      int      `json:"public"`      // 是否公开到群目录 0.否 1.是
+	Description string   `json:"description"` // 群简介
+	Tags        []string `json:"tags"`        // 群标签
+	Category    string   `json:"category"`    // 群分类
+	Featured    int      `json:"featured"`    // 是否由后台推荐
+	Hidden      int      `json:"hidden"`      // 是否被后台隐藏
+}
+
+func newDirectoryResp(m *directoryModel) *directoryResp {
+	return &directoryResp{
+		GroupNo:     m.GroupNo,
+		Public:      m.Public,
+		Description: m.Description,
+		Tags:        splitDirectoryTags(m.Tags),
+		Category:    m.Category,
+		Featured:    m.Featured,
+		Hidden:      m.Hidden,
+	}
+}
+
+type directoryGroupResp struct {
+	GroupNo     string   `json:"group_no"`
+	Name        string   `json:"name"`         // 群名称
+	Avatar      string   `json:"avatar"`       // 群头像
+	Description string   `json:"description"`  // 群简介
+	Tags        []string `json:"tags"`         // 群标签
+	Category    string   `json:"category"`     // 群分类
+	MemberCount int64    `json:"member_count"` // 成员数量
+	Invite      int      `json:"invite"`       // 是否需要审核才能加入 0.否 1.是
+	Featured    int      `json:"featured"`     // 是否由后台推荐
+	Hidden      int      `json:"hidden"`       // 是否被后台隐藏
+}
+
+func newDirectoryGroupResps(models []*directoryGroupModel) []*directoryGroupResp {
+	resps := make([]*directoryGroupResp, 0, len(models))
+	for _, m := range models {
+		resps = append(resps, &directoryGroupResp{
+			GroupNo:     m.GroupNo,
+			Name:        m.Name,
+			Avatar:      fmt.Sprintf("groups/%s/avatar", m.GroupNo),
+			Description: m.Description,
+			Tags:        splitDirectoryTags(m.Tags),
+			Category:    m.Category,
+			MemberCount: m.MemberCount,
+			Invite:      m.Invite,
+			Featured:    m.Featured,
+			Hidden:      m.Hidden,
+		})
+	}
+	return resps
+}
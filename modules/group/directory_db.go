@@ -0,0 +1,104 @@
+package group
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// queryDirectory 查询群的公开目录设置
+func (d *DB) queryDirectory(groupNo string) (*directoryModel, error) {
+	var model *directoryModel
+	_, err := d.session.Select("*").From("group_directory").Where("group_no=?", groupNo).Load(&model)
+	return model, err
+}
+
+// upsertDirectory 添加或修改群的公开目录设置（不修改后台的推荐及隐藏状态）
+func (d *DB) upsertDirectory(model *directoryModel) error {
+	_, err := d.session.InsertBySql("insert into group_directory(group_no,public,description,tags,category,member_count,operator) values(?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE public=VALUES(public),description=VALUES(description),tags=VALUES(tags),category=VALUES(category),member_count=VALUES(member_count),operator=VALUES(operator)", model.GroupNo, model.Public, model.Description, model.Tags, model.Category, model.MemberCount, model.Operator).Exec()
+	return err
+}
+
+// refreshDirectoryMemberCounts 刷新公开群的成员数量（列表按成员数量排序）
+func (d *DB) refreshDirectoryMemberCounts() error {
+	_, err := d.session.UpdateBySql("update group_directory set member_count=(select count(*) from group_member where group_member.group_no=group_directory.group_no and group_member.is_deleted=0) where public=1").Exec()
+	return err
+}
+
+// updateDirectoryFeatured 修改群的推荐状态
+func (d *DB) updateDirectoryFeatured(groupNo string, featured int) error {
+	_, err := d.session.Update("group_directory").Set("featured", featured).Where("group_no=?", groupNo).Exec()
+	return err
+}
+
+// updateDirectoryHidden 修改群的隐藏状态
+func (d *DB) updateDirectoryHidden(groupNo string, hidden int) error {
+	_, err := d.session.Update("group_directory").Set("hidden", hidden).Where("group_no=?", groupNo).Exec()
+	return err
+}
+
+// queryDirectoryGroups 分页查询公开群，推荐的群排在前面，其次按成员数量排序
+func (d *DB) queryDirectoryGroups(filter *directoryFilter, pageSize, pageIndex uint64) ([]*directoryGroupModel, error) {
+	var models []*directoryGroupModel
+	builder := d.session.Select("group_directory.*,`group`.name,`group`.invite").From("group_directory").Join("`group`", "`group`.group_no=group_directory.group_no")
+	_, err := filter.apply(builder).OrderBy("group_directory.featured desc,group_directory.member_count desc,group_directory.updated_at desc").Offset((pageIndex - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryDirectoryGroupCount 查询公开群数量
+func (d *DB) queryDirectoryGroupCount(filter *directoryFilter) (int64, error) {
+	var count int64
+	builder := d.session.Select("count(*)").From("group_directory").Join("`group`", "`group`.group_no=group_directory.group_no")
+	_, err := filter.apply(builder).Load(&count)
+	return count, err
+}
+
+// existWaitSelfApply 是否存在待审核的群目录入群申请
+func (d *DB) existWaitSelfApply(groupNo string, uid string) (bool, error) {
+	var count int
+	_, err := d.session.Select("count(*)").From("group_invite").Join("invite_item", "group_invite.invite_no=invite_item.invite_no").Where("group_invite.group_no=? and group_invite.self_apply=1 and group_invite.status=? and invite_item.uid=?", groupNo, InviteStatusWait, uid).Load(&count)
+	return count > 0, err
+}
+
+// directoryFilter 群目录查询条件
+type directoryFilter struct {
+	Keyword       string // 群名称或简介关键字
+	Tag           string // 群标签
+	Category      string // 群分类
+	IncludeHidden bool   // 是否包含后台隐藏的群
+}
+
+func (f *directoryFilter) apply(builder *dbr.SelectStmt) *dbr.SelectStmt {
+	builder = builder.Where("group_directory.public=1 and `group`.status=?", GroupStatusNormal)
+	if !f.IncludeHidden {
+		builder = builder.Where("group_directory.hidden=0")
+	}
+	if f.Keyword != "" {
+		builder = builder.Where("(`group`.name like ? or group_directory.description like ?)", "%"+f.Keyword+"%", "%"+f.Keyword+"%")
+	}
+	if f.Tag != "" {
+		builder = builder.Where("FIND_IN_SET(?,group_directory.tags)>0", f.Tag)
+	}
+	if f.Category != "" {
+		builder = builder.Where("group_directory.category=?", f.Category)
+	}
+	return builder
+}
+
+type directoryModel struct {
+	GroupNo     string // 群编号
+	Public      int    // 是否公开
+	Description string // 群简介
+	Tags        string // 群标签，多个以英文逗号分隔
+	Category    string // 群目录分类（与群创建时系统设置的分类无关）
+	MemberCount int64  // 成员数量（定时刷新）
+	Featured    int    // 是否由后台推荐
+	Hidden      int    // 是否被后台隐藏
+	Operator    string // 最后修改人
+	db.BaseModel
+}
+
+type directoryGroupModel struct {
+	directoryModel
+	Name   string // 群名称
+	Invite int    // 是否开启邀请确认
+}
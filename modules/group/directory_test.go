@@ -0,0 +1,41 @@
+package group
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDirectoryTags(t *testing.T) {
+	tags, err := normalizeDirectoryTags([]string{" 游戏 ", "", "游戏", "读书"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"游戏", "读书"}, tags)
+
+	_, err = normalizeDirectoryTags([]string{"a,b"})
+	assert.Error(t, err)
+	_, err = normalizeDirectoryTags([]string{strings.Repeat("长", directoryMaxTagLength+1)})
+	assert.Error(t, err)
+	_, err = normalizeDirectoryTags([]string{"1", "2", "3", "4", "5", "6"})
+	assert.Error(t, err)
+}
+
+func TestDirectoryReqCheck(t *testing.T) {
+	req := &directoryReq{Public: 1, Description: " 技术交流 ", Tags: []string{"go"}, Category: "技术"}
+	tags, err := req.check()
+	assert.NoError(t, err)
+	assert.Equal(t, "技术交流", req.Description)
+	assert.Equal(t, []string{"go"}, tags)
+
+	_, err = (&directoryReq{Public: 2}).check()
+	assert.Error(t, err)
+	_, err = (&directoryReq{Public: 1}).check()
+	assert.Error(t, err)
+	_, err = (&directoryReq{Description: strings.Repeat("长", directoryMaxDescriptionLength+1)}).check()
+	assert.Error(t, err)
+	_, err = (&directoryReq{Category: strings.Repeat("长", directoryMaxCategoryLength+1)}).check()
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{}, splitDirectoryTags(""))
+	assert.Equal(t, []string{"go", "读书"}, splitDirectoryTags("go,读书"))
+}
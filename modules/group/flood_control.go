@@ -0,0 +1,408 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	floodControlCachePrefix  = "groupFloodControl:"   // 群防刷屏设置缓存
+	floodLastSendPrefix      = "groupFloodLastSend:"  // 成员最后发言时间
+	floodBurstPrefix         = "groupFloodBurst:"     // 成员突发窗口内的发言数
+	floodViolationPrefix     = "groupFloodViolation:" // 成员违规次数
+	floodHoldKey             = "groupFloodHold"       // 因慢速模式或刷屏被临时拉黑的成员，score为解除时间
+	floodControlCacheExpire  = time.Minute * 5
+	floodViolationExpire     = time.Hour
+	floodMaxSlowMode         = 60 * 60
+	floodMaxBurstLimit       = 100
+	floodMaxBurstWindow      = 60 * 60
+	floodMaxMuteViolations   = 100
+	floodMaxMuteDuration     = 60 * 60 * 24 * 30
+	floodReleaseLimit        = 100
+	floodReleaseNoDataSleep  = time.Second
+	floodHoldMemberSeparator = "@"
+)
+
+// 获取群防刷屏设置
+func (g *Group) floodControlGet(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	exist, err := g.db.ExistMember(c.GetLoginUID(), groupNo)
+	if err != nil {
+		g.Error("查询是否是群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员，无法查看！"))
+		return
+	}
+	model, err := g.db.queryFloodControl(groupNo)
+	if err != nil {
+		g.Error("查询群防刷屏设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群防刷屏设置失败！"))
+		return
+	}
+	if model == nil {
+		model = &floodControlModel{GroupNo: groupNo}
+	}
+	c.Response(newFloodControlResp(model))
+}
+
+// 修改群防刷屏设置
+func (g *Group) floodControlUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req floodControlReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	hasPermission, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionBanMember)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群管理者失败！"))
+		return
+	}
+	if !hasPermission {
+		c.ResponseError(errors.New("没有修改防刷屏设置的权限！"))
+		return
+	}
+	model := &floodControlModel{
+		GroupNo:        groupNo,
+		SlowMode:       req.SlowMode,
+		BurstLimit:     req.BurstLimit,
+		BurstWindow:    req.BurstWindow,
+		MuteViolations: req.MuteViolations,
+		MuteDuration:   req.MuteDuration,
+		Operator:       loginUID,
+	}
+	err = g.db.upsertFloodControl(model)
+	if err != nil {
+		g.Error("修改群防刷屏设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群防刷屏设置失败！"))
+		return
+	}
+	err = g.ctx.GetRedisConn().Del(fmt.Sprintf("%s%s", floodControlCachePrefix, groupNo))
+	if err != nil {
+		g.Warn("删除群防刷屏设置缓存失败！", zap.Error(err))
+	}
+	err = g.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         CMDGroupFloodControlUpdate,
+		Param: map[string]interface{}{
+			"group_no":      groupNo,
+			"flood_control": newFloodControlResp(model),
+		},
+	})
+	if err != nil {
+		g.Error("发送命令消息失败！", zap.Error(err))
+	}
+	c.Response(newFloodControlResp(model))
+}
+
+// 监听群消息，对开启了慢速模式或突发限制的群执行限流
+func (g *Group) handleFloodControlMessages(messages []*config.MessageResp) {
+	for _, message := range messages {
+		if message.ChannelType != common.ChannelTypeGroup.Uint8() || message.FromUID == "" || message.FromUID == g.ctx.GetConfig().Account.SystemUID || message.Header.SyncOnce == 1 {
+			continue
+		}
+		err := g.checkFlood(message.ChannelID, message.FromUID, int64(message.Timestamp))
+		if err != nil {
+			g.Warn("群消息限流处理失败！", zap.Error(err), zap.String("groupNo", message.ChannelID), zap.String("uid", message.FromUID))
+		}
+	}
+}
+
+func (g *Group) checkFlood(groupNo string, uid string, sendAt int64) error {
+	rule, err := g.getFloodControl(groupNo)
+	if err != nil {
+		return err
+	}
+	if rule == nil || !rule.enabled() {
+		return nil
+	}
+	member, err := g.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if member == nil || member.Role != MemberRoleCommon || member.Robot == 1 || member.ForbiddenExpirTime > now {
+		return nil
+	}
+	if sendAt <= 0 {
+		sendAt = now
+	}
+	redisConn := g.ctx.GetRedisConn()
+	key := fmt.Sprintf("%s:%s", groupNo, uid)
+
+	var lastSendAt int64
+	if rule.SlowMode > 0 {
+		lastSendAtStr, err := redisConn.GetString(fmt.Sprintf("%s%s", floodLastSendPrefix, key))
+		if err != nil {
+			return err
+		}
+		if lastSendAtStr != "" {
+			lastSendAt, _ = strconv.ParseInt(lastSendAtStr, 10, 64)
+		}
+		err = redisConn.SetAndExpire(fmt.Sprintf("%s%s", floodLastSendPrefix, key), sendAt, time.Duration(rule.SlowMode)*time.Second)
+		if err != nil {
+			return err
+		}
+	}
+	var burstCount int64
+	if rule.BurstLimit > 0 {
+		burstKey := fmt.Sprintf("%s%s", floodBurstPrefix, key)
+		burstCount, err = redisConn.Incr(burstKey)
+		if err != nil {
+			return err
+		}
+		if burstCount == 1 {
+			err = redisConn.Expire(burstKey, time.Duration(rule.BurstWindow)*time.Second)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if rule.violated(lastSendAt, burstCount, sendAt) {
+		violationKey := fmt.Sprintf("%s%s", floodViolationPrefix, key)
+		violations, err := redisConn.Incr(violationKey)
+		if err != nil {
+			return err
+		}
+		if violations == 1 {
+			err = redisConn.Expire(violationKey, floodViolationExpire)
+			if err != nil {
+				return err
+			}
+		}
+		if rule.shouldMute(violations) {
+			_ = redisConn.Del(violationKey)
+			return g.floodAutoMute(member, now+int64(rule.MuteDuration))
+		}
+	}
+
+	holdSeconds := rule.holdSeconds(burstCount)
+	if holdSeconds <= 0 {
+		return nil
+	}
+	err = g.setGroupBlacklist(groupNo, []string{uid}, true)
+	if err != nil {
+		return err
+	}
+	return redisConn.ZAdd(floodHoldKey, float64(now+holdSeconds), groupNo+floodHoldMemberSeparator+uid)
+}
+
+// 多次违规后自动禁言，到期后由CheckForbiddenLoop解除
+func (g *Group) floodAutoMute(member *MemberModel, expirTime int64) error {
+	member.Version = g.ctx.GenSeq(common.GroupMemberSeqKey)
+	member.ForbiddenExpirTime = expirTime
+	err := g.db.UpdateMember(member)
+	if err != nil {
+		return err
+	}
+	err = g.setGroupBlacklist(member.GroupNo, []string{member.UID}, true)
+	if err != nil {
+		return err
+	}
+	return g.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   member.GroupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         common.CMDGroupMemberUpdate,
+		Param: map[string]interface{}{
+			"group_no": member.GroupNo,
+			"uid":      member.UID,
+		},
+	})
+}
+
+// ReleaseFloodHoldLoop 解除慢速模式及刷屏产生的临时黑名单
+func (g *Group) ReleaseFloodHoldLoop() {
+	var errSleep = time.Second * 1
+	for {
+		holds, err := g.ctx.GetRedisConn().ZRangeByScore(floodHoldKey, redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(time.Now().Unix(), 10),
+			Count: floodReleaseLimit,
+		})
+		if err != nil {
+			g.Warn("查询待解除的限流成员失败", zap.Error(err))
+			time.Sleep(errSleep)
+			continue
+		}
+		if len(holds) <= 0 {
+			time.Sleep(floodReleaseNoDataSleep)
+			continue
+		}
+		for _, hold := range holds {
+			err = g.ctx.GetRedisConn().ZRem(floodHoldKey, hold)
+			if err != nil {
+				g.Warn("移除限流成员失败", zap.Error(err))
+				continue
+			}
+			groupNo, uid, ok := parseFloodHoldMember(hold)
+			if !ok {
+				continue
+			}
+			member, err := g.db.QueryMemberWithUID(uid, groupNo)
+			if err != nil {
+				g.Warn("查询限流成员信息失败", zap.Error(err))
+				continue
+			}
+			// 被禁言或拉黑的成员不能解除黑名单
+			if member != nil && (member.ForbiddenExpirTime > time.Now().Unix() || member.Status == int(common.GroupMemberStatusBlacklist)) {
+				continue
+			}
+			err = g.setGroupBlacklist(groupNo, []string{uid}, false)
+			if err != nil {
+				g.Warn("解除限流成员黑名单失败", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (g *Group) getFloodControl(groupNo string) (*floodControlModel, error) {
+	cacheKey := fmt.Sprintf("%s%s", floodControlCachePrefix, groupNo)
+	cache, err := g.ctx.GetRedisConn().GetString(cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	if cache != "" {
+		var resp *floodControlResp
+		err = util.ReadJsonByByte([]byte(cache), &resp)
+		if err == nil && resp != nil {
+			return resp.toModel(), nil
+		}
+	}
+	model, err := g.db.queryFloodControl(groupNo)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		model = &floodControlModel{GroupNo: groupNo}
+	}
+	err = g.ctx.GetRedisConn().SetAndExpire(cacheKey, util.ToJson(newFloodControlResp(model)), floodControlCacheExpire)
+	if err != nil {
+		g.Warn("缓存群防刷屏设置失败！", zap.Error(err))
+	}
+	return model, nil
+}
+
+func parseFloodHoldMember(hold string) (string, string, bool) {
+	index := strings.LastIndex(hold, floodHoldMemberSeparator)
+	if index <= 0 || index == len(hold)-1 {
+		return "", "", false
+	}
+	return hold[:index], hold[index+1:], true
+}
+
+// 是否开启了限流
+func (m *floodControlModel) enabled() bool {
+	return m.SlowMode > 0 || (m.BurstLimit > 0 && m.BurstWindow > 0)
+}
+
+// violated 本次发言是否违规，lastSendAt为上次发言时间，burstCount为突发窗口内（含本次）的发言数
+func (m *floodControlModel) violated(lastSendAt int64, burstCount int64, sendAt int64) bool {
+	if m.SlowMode > 0 && lastSendAt > 0 && sendAt-lastSendAt < int64(m.SlowMode) {
+		return true
+	}
+	if m.BurstLimit > 0 && burstCount > int64(m.BurstLimit) {
+		return true
+	}
+	return false
+}
+
+// shouldMute 违规次数是否达到自动禁言阈值
+func (m *floodControlModel) shouldMute(violations int64) bool {
+	return m.MuteViolations > 0 && m.MuteDuration > 0 && violations >= int64(m.MuteViolations)
+}
+
+// holdSeconds 本次发言后需要临时禁止发言的秒数
+func (m *floodControlModel) holdSeconds(burstCount int64) int64 {
+	var seconds int64
+	if m.SlowMode > 0 {
+		seconds = int64(m.SlowMode)
+	}
+	if m.BurstLimit > 0 && burstCount >= int64(m.BurstLimit) && int64(m.BurstWindow) > seconds {
+		seconds = int64(m.BurstWindow)
+	}
+	return seconds
+}
+
+type floodControlReq struct {
+	SlowMode       int `json:"slow_mode"`       // 慢速模式间隔（秒） 0.关闭
+	BurstLimit     int `json:"burst_limit"`     // 突发窗口内最多发送的消息数 0.不限制
+	BurstWindow    int `json:"burst_window"`    // 突发窗口时长（秒）
+	MuteViolations int `json:"mute_violations"` // 违规多少次后自动禁言 0.不自动禁言
+	MuteDuration   int `json:"mute_duration"`   // 自动禁言时长（秒）
+}
+
+func (r floodControlReq) check() error {
+	if r.SlowMode < 0 || r.SlowMode > floodMaxSlowMode {
+		return fmt.Errorf("慢速模式间隔需在0到%d秒之间！", floodMaxSlowMode)
+	}
+	if r.BurstLimit < 0 || r.BurstLimit > floodMaxBurstLimit {
+		return fmt.Errorf("突发消息数需在0到%d之间！", floodMaxBurstLimit)
+	}
+	if r.BurstLimit > 0 && (r.BurstWindow <= 0 || r.BurstWindow > floodMaxBurstWindow) {
+		return fmt.Errorf("突发窗口时长需在1到%d秒之间！", floodMaxBurstWindow)
+	}
+	if r.MuteViolations < 0 || r.MuteViolations > floodMaxMuteViolations {
+		return fmt.Errorf("自动禁言违规次数需在0到%d之间！", floodMaxMuteViolations)
+	}
+	if r.MuteViolations > 0 && (r.MuteDuration <= 0 || r.MuteDuration > floodMaxMuteDuration) {
+		return fmt.Errorf("自动禁言时长需在1到%d秒之间！", floodMaxMuteDuration)
+	}
+	return nil
+}
+
+type floodControlResp struct {
+	GroupNo        string `json:"group_no"`
+	SlowMode       int    `json:"slow_mode"`       // 慢速模式间隔（秒） 0.关闭
+	BurstLimit     int    `json:"burst_limit"`     // 突发窗口内最多发送的消息数 0.不限制
+	BurstWindow    int    `json:"burst_window"`    // 突发窗口时长（秒）
+	MuteViolations int    `json:"mute_violations"` // 违规多少次后自动禁言 0.不自动禁言
+	MuteDuration   int    `json:"mute_duration"`   // 自动禁言时长（秒）
+}
+
+func newFloodControlResp(m *floodControlModel) *floodControlResp {
+	return &floodControlResp{
+		GroupNo:        m.GroupNo,
+		SlowMode:       m.SlowMode,
+		BurstLimit:     m.BurstLimit,
+		BurstWindow:    m.BurstWindow,
+		MuteViolations: m.MuteViolations,
+		MuteDuration:   m.MuteDuration,
+	}
+}
+
+func (r *floodControlResp) toModel() *floodControlModel {
+	return &floodControlModel{
+		GroupNo:        r.GroupNo,
+		SlowMode:       r.SlowMode,
+		BurstLimit:     r.BurstLimit,
+		BurstWindow:    r.BurstWindow,
+		MuteViolations: r.MuteViolations,
+		MuteDuration:   r.MuteDuration,
+	}
+}
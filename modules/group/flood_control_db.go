@@ -0,0 +1,29 @@
+package group
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+)
+
+// queryFloodControl 查询群防刷屏设置
+func (d *DB) queryFloodControl(groupNo string) (*floodControlModel, error) {
+	var model *floodControlModel
+	_, err := d.session.Select("*").From("group_flood_control").Where("group_no=?", groupNo).Load(&model)
+	return model, err
+}
+
+// upsertFloodControl 添加或修改群防刷屏设置
+func (d *DB) upsertFloodControl(model *floodControlModel) error {
+	_, err := d.session.InsertBySql("insert into group_flood_control(group_no,slow_mode,burst_limit,burst_window,mute_violations,mute_duration,operator) values(?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE slow_mode=VALUES(slow_mode),burst_limit=VALUES(burst_limit),burst_window=VALUES(burst_window),mute_violations=VALUES(mute_violations),mute_duration=VALUES(mute_duration),operator=VALUES(operator)", model.GroupNo, model.SlowMode, model.BurstLimit, model.BurstWindow, model.MuteViolations, model.MuteDuration, model.Operator).Exec()
+	return err
+}
+
+type floodControlModel struct {
+	GroupNo        string // 群编号
+	SlowMode       int    // 慢速模式间隔（秒） 0.关闭
+	BurstLimit     int    // 突发窗口内最多发送的消息数 0.不限制
+	BurstWindow    int    // 突发窗口时长（秒）
+	MuteViolations int    // 违规多少次后自动禁言 0.不自动禁言
+	MuteDuration   int    // 自动禁言时长（秒）
+	Operator       string // 最后修改人
+	db.BaseModel
+}
@@ -0,0 +1,61 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloodControlViolated(t *testing.T) {
+	m := &floodControlModel{SlowMode: 10}
+	assert.True(t, m.enabled())
+	assert.False(t, m.violated(0, 0, 100))
+	assert.True(t, m.violated(95, 0, 100))
+	assert.False(t, m.violated(90, 0, 100))
+
+	m = &floodControlModel{BurstLimit: 3, BurstWindow: 10}
+	assert.True(t, m.enabled())
+	assert.False(t, m.violated(0, 3, 100))
+	assert.True(t, m.violated(0, 4, 100))
+
+	assert.False(t, (&floodControlModel{BurstLimit: 3}).enabled())
+	assert.False(t, (&floodControlModel{}).enabled())
+}
+
+func TestFloodControlShouldMute(t *testing.T) {
+	m := &floodControlModel{MuteViolations: 3, MuteDuration: 600}
+	assert.False(t, m.shouldMute(2))
+	assert.True(t, m.shouldMute(3))
+	m.MuteDuration = 0
+	assert.False(t, m.shouldMute(3))
+	assert.False(t, (&floodControlModel{}).shouldMute(100))
+}
+
+func TestFloodControlHoldSeconds(t *testing.T) {
+	m := &floodControlModel{SlowMode: 10, BurstLimit: 3, BurstWindow: 60}
+	assert.Equal(t, int64(10), m.holdSeconds(1))
+	assert.Equal(t, int64(60), m.holdSeconds(3))
+	m.SlowMode = 0
+	assert.Equal(t, int64(0), m.holdSeconds(2))
+	assert.Equal(t, int64(60), m.holdSeconds(3))
+}
+
+func TestFloodControlReqCheck(t *testing.T) {
+	assert.NoError(t, floodControlReq{}.check())
+	assert.NoError(t, floodControlReq{SlowMode: 30, BurstLimit: 5, BurstWindow: 10, MuteViolations: 3, MuteDuration: 600}.check())
+	assert.Error(t, floodControlReq{SlowMode: -1}.check())
+	assert.Error(t, floodControlReq{BurstLimit: 5}.check())
+	assert.Error(t, floodControlReq{MuteViolations: 3}.check())
+	assert.Error(t, floodControlReq{MuteViolations: 3, MuteDuration: floodMaxMuteDuration + 1}.check())
+}
+
+func TestParseFloodHoldMember(t *testing.T) {
+	groupNo, uid, ok := parseFloodHoldMember("g1@u1")
+	assert.True(t, ok)
+	assert.Equal(t, "g1", groupNo)
+	assert.Equal(t, "u1", uid)
+	_, _, ok = parseFloodHoldMember("g1@")
+	assert.False(t, ok)
+	_, _, ok = parseFloodHoldMember("g1")
+	assert.False(t, ok)
+}
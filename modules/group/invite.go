@@ -133,14 +133,14 @@ func (g *Group) getToGroupMemberConfirmInviteDetailH5(c *wkhttp.Context) {
 		return
 	}
 
-	managerOrCreator, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	managerOrCreator, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionInvite)
 	if err != nil {
 		g.Error("查询是否管理者或创建者失败！")
 		c.ResponseError(errors.New("查询是否管理者或创建者失败！"))
 		return
 	}
 	if !managerOrCreator {
-		c.ResponseError(errors.New("你不是群主或管理员！"))
+		c.ResponseError(errors.New("没有审核入群邀请的权限！"))
 		return
 	}
 	authCode := util.GenerUUID()
@@ -224,10 +224,15 @@ func (g *Group) groupMemberInviteSure(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	allower := authMap["allower"].(string)
 	/**
 	添加成员
 	**/
-	inviterUser, err := g.userDB.QueryByUID(inviter)
+	operator := inviter
+	if inviteDetailModel.LinkNo != "" || inviteDetailModel.SelfApply == 1 { // 通过邀请链接或公开群目录申请的入群，申请者不在群内，由审核者作为操作者
+		operator = allower
+	}
+	inviterUser, err := g.userDB.QueryByUID(operator)
 	if err != nil {
 		g.Error("查询邀请者的用户信息失败！", zap.Error(err))
 		c.ResponseError(errors.New("查询邀请者的用户信息失败！"))
@@ -239,7 +244,6 @@ func (g *Group) groupMemberInviteSure(c *wkhttp.Context) {
 		return
 
 	}
-	allower := authMap["allower"].(string)
 	tx, err := g.ctx.DB().Begin()
 	if err != nil {
 		g.Error("开启事务失败！", zap.Error(err))
@@ -47,12 +47,14 @@ func (d *DB) UpdateInviteItemStatusTx(status int, inviteNo string, tx *dbr.Tx) e
 
 // InviteModel InviteModel
 type InviteModel struct {
-	InviteNo string `json:"invite_no"` // 邀请唯一编号
-	GroupNo  string `json:"group_no"`  // 群唯一编号
-	Inviter  string `json:"inviter"`   // 邀请者
-	Remark   string `json:"remark"`    // 邀请备注
-	Status   int    `json:"status"`    // 状态 0.未确认 1.已确认
-	Allower  string `json:"allower"`   // 确认者
+	InviteNo  string `json:"invite_no"`  // 邀请唯一编号
+	GroupNo   string `json:"group_no"`   // 群唯一编号
+	Inviter   string `json:"inviter"`    // 邀请者
+	Remark    string `json:"remark"`     // 邀请备注
+	Status    int    `json:"status"`     // 状态 0.未确认 1.已确认
+	Allower   string `json:"allower"`    // 确认者
+	LinkNo    string `json:"link_no"`    // 通过邀请链接申请时的链接编号
+	SelfApply int    `json:"self_apply"` // 是否为用户通过公开群目录主动申请入群
 	db.BaseModel
 }
 
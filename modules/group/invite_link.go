@@ -0,0 +1,526 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+)
+
+// 群邀请链接列表
+func (g *Group) inviteLinkList(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	if err := g.checkInviteLinkManager(groupNo, c.GetLoginUID()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	links, err := g.db.queryInviteLinks(groupNo)
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	resps := make([]*inviteLinkResp, 0, len(links))
+	for _, link := range links {
+		resps = append(resps, g.newInviteLinkResp(link))
+	}
+	c.Response(resps)
+}
+
+// 创建群邀请链接
+func (g *Group) inviteLinkAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req inviteLinkReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(time.Now()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := g.checkInviteLinkManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	link := &InviteLinkModel{
+		LinkNo:          util.GenerUUID(),
+		GroupNo:         groupNo,
+		Creator:         loginUID,
+		Name:            req.Name,
+		ExpireAt:        req.ExpireAt,
+		MaxUses:         req.MaxUses,
+		RequireApproval: req.RequireApproval,
+		Status:          InviteLinkStatusValid,
+	}
+	err := g.db.insertInviteLink(link)
+	if err != nil {
+		g.Error("添加邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加邀请链接失败！"))
+		return
+	}
+	c.Response(g.newInviteLinkResp(link))
+}
+
+// 修改群邀请链接
+func (g *Group) inviteLinkUpdate(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req inviteLinkReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(time.Now()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	link, err := g.getManagedInviteLink(groupNo, c.Param("link_no"), c.GetLoginUID())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	link.Name = req.Name
+	link.ExpireAt = req.ExpireAt
+	link.MaxUses = req.MaxUses
+	link.RequireApproval = req.RequireApproval
+	err = g.db.updateInviteLink(link)
+	if err != nil {
+		g.Error("修改邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改邀请链接失败！"))
+		return
+	}
+	c.Response(g.newInviteLinkResp(link))
+}
+
+// 撤销群邀请链接
+func (g *Group) inviteLinkRevoke(c *wkhttp.Context) {
+	link, err := g.getManagedInviteLink(c.Param("group_no"), c.Param("link_no"), c.GetLoginUID())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = g.db.revokeInviteLinkTx(link.LinkNo, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("撤销邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销邀请链接失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 重新生成群邀请链接（撤销旧链接并以相同的设置生成新链接）
+func (g *Group) inviteLinkRegenerate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	link, err := g.getManagedInviteLink(c.Param("group_no"), c.Param("link_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	newLink := &InviteLinkModel{
+		LinkNo:          util.GenerUUID(),
+		GroupNo:         link.GroupNo,
+		Creator:         loginUID,
+		Name:            link.Name,
+		ExpireAt:        link.ExpireAt,
+		MaxUses:         link.MaxUses,
+		RequireApproval: link.RequireApproval,
+		Status:          InviteLinkStatusValid,
+	}
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = g.db.revokeInviteLinkTx(link.LinkNo, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("撤销邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销邀请链接失败！"))
+		return
+	}
+	err = g.db.insertInviteLinkTx(newLink, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("添加邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加邀请链接失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.Response(g.newInviteLinkResp(newLink))
+}
+
+// 通过邀请链接获取群预览信息
+func (g *Group) inviteLinkGet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	link, err := g.db.QueryInviteLink(c.Param("link_no"))
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	if link == nil {
+		c.ResponseError(errors.New("邀请链接不存在！"))
+		return
+	}
+	group, err := g.getGroupInfo(link.GroupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	memberCount, err := g.db.QueryMemberCount(link.GroupNo)
+	if err != nil {
+		g.Error("查询成员数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询成员数量失败！"))
+		return
+	}
+	existMember, err := g.db.ExistMember(loginUID, link.GroupNo)
+	if err != nil {
+		g.Error("查询是否存在群内失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内失败！"))
+		return
+	}
+	resp := inviteLinkPreviewResp{
+		groupDetailResp: groupDetailResp{}.from(group, memberCount),
+		LinkNo:          link.LinkNo,
+		RequireApproval: link.needApproval(group),
+		Valid:           1,
+	}
+	if link.check(time.Now()) != nil {
+		resp.Valid = 0
+	}
+	if existMember {
+		resp.IsMember = 1
+	}
+	c.Response(resp)
+}
+
+// 通过邀请链接加入群
+func (g *Group) inviteLinkJoin(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	link, err := g.db.QueryInviteLink(c.Param("link_no"))
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	if link == nil {
+		c.ResponseError(errors.New("邀请链接不存在！"))
+		return
+	}
+	if err := link.check(time.Now()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	groupNo := link.GroupNo
+	group, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	existMember, err := g.db.ExistMember(loginUID, groupNo)
+	if err != nil {
+		g.Error("查询是否存在群内时失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内时失败！"))
+		return
+	}
+	if existMember {
+		c.ResponseError(errors.New("已经在群内，不能再加入！"))
+		return
+	}
+	creatorInfo, err := g.userDB.QueryByUID(link.Creator)
+	if err != nil {
+		g.Error("获取链接创建者的用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("获取链接创建者的用户信息失败！"))
+		return
+	}
+	if creatorInfo == nil {
+		c.ResponseError(errors.New("链接创建者的用户信息不存在！"))
+		return
+	}
+	needApproval := link.needApproval(group) == 1
+	var creatorOrManagerUIDS []string
+	if needApproval {
+		existWait, err := g.db.existWaitInviteWithLink(link.LinkNo, loginUID)
+		if err != nil {
+			g.Error("查询入群申请失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询入群申请失败！"))
+			return
+		}
+		if existWait {
+			c.ResponseError(errors.New("已提交入群申请，请等待管理员审核！"))
+			return
+		}
+		creatorOrManagerUIDS, err = g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+		if err != nil {
+			g.Error("查询创建者或管理员的uid失败！", zap.String("group_no", groupNo), zap.Error(err))
+			c.ResponseError(errors.New("查询创建者或管理员的uid失败！"))
+			return
+		}
+	}
+
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	// 提交申请或加入时即占用一次使用次数
+	claimed, err := g.db.claimInviteLinkTx(link.LinkNo, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("更新邀请链接使用次数失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新邀请链接使用次数失败！"))
+		return
+	}
+	if !claimed {
+		tx.Rollback()
+		c.ResponseError(errors.New("邀请链接已失效！"))
+		return
+	}
+	var commitCallback func()
+	if needApproval {
+		commitCallback, err = g.inviteLinkApplyTx(link, creatorInfo.Name, loginUID, creatorOrManagerUIDS, tx)
+	} else {
+		commitCallback, err = g.scanJoinTx(groupNo, creatorInfo.UID, creatorInfo.Name, loginUID, loginName, tx)
+	}
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		c.ResponseError(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	commitCallback()
+
+	waitApproval := 0
+	if needApproval {
+		waitApproval = 1
+	}
+	c.Response(gin.H{
+		"group_no":      groupNo,
+		"wait_approval": waitApproval, // 1.已提交申请，等待管理员审核 0.已加入群
+	})
+}
+
+// inviteLinkApplyTx 通过邀请链接提交入群申请，由群主或管理员通过群邀请确认
+func (g *Group) inviteLinkApplyTx(link *InviteLinkModel, creatorName string, applicant string, subscribers []string, tx *dbr.Tx) (func(), error) {
+	inviteNo := util.GenerUUID()
+	eventID, err := g.ctx.EventBegin(&wkevent.Data{
+		Event: event.GroupMemberInviteRequest,
+		Type:  wkevent.Message,
+		Data: config.MsgGroupMemberInviteReq{
+			GroupNo:     link.GroupNo,
+			InviteNo:    inviteNo,
+			Inviter:     link.Creator,
+			InviterName: creatorName,
+			Num:         1,
+			Subscribers: subscribers,
+		},
+	}, tx)
+	if err != nil {
+		g.Error("开启事件失败！", zap.Error(err))
+		return nil, errors.New("开启事件失败！")
+	}
+	err = g.db.InsertInviteTx(&InviteModel{
+		InviteNo: inviteNo,
+		GroupNo:  link.GroupNo,
+		Inviter:  link.Creator,
+		Remark:   fmt.Sprintf("通过邀请链接「%s」申请入群", link.Name),
+		Status:   InviteStatusWait,
+		LinkNo:   link.LinkNo,
+	}, tx)
+	if err != nil {
+		g.Error("添加邀请数据失败！", zap.Error(err))
+		return nil, errors.New("添加邀请数据失败！")
+	}
+	err = g.db.InsertInviteItemTx(&InviteItemModel{
+		InviteNo: inviteNo,
+		GroupNo:  link.GroupNo,
+		Inviter:  link.Creator,
+		UID:      applicant,
+		Status:   InviteStatusWait,
+	}, tx)
+	if err != nil {
+		g.Error("添加邀请项失败！", zap.Error(err))
+		return nil, errors.New("添加邀请项失败！")
+	}
+	return func() {
+		g.ctx.EventCommit(eventID)
+	}, nil
+}
+
+// checkInviteLinkManager 只有群主或拥有管理邀请链接权限的管理员才能管理邀请链接
+func (g *Group) checkInviteLinkManager(groupNo string, loginUID string) error {
+	if groupNo == "" {
+		return errors.New("群编号不能为空")
+	}
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		return err
+	}
+	managerOrCreator, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionManageLink)
+	if err != nil {
+		g.Error("查询是否管理者或创建者失败！", zap.Error(err))
+		return errors.New("查询是否管理者或创建者失败！")
+	}
+	if !managerOrCreator {
+		return errors.New("没有管理邀请链接的权限！")
+	}
+	return nil
+}
+
+// getManagedInviteLink 获取当前用户可管理的有效邀请链接
+func (g *Group) getManagedInviteLink(groupNo string, linkNo string, loginUID string) (*InviteLinkModel, error) {
+	if err := g.checkInviteLinkManager(groupNo, loginUID); err != nil {
+		return nil, err
+	}
+	link, err := g.db.QueryInviteLink(linkNo)
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		return nil, errors.New("查询邀请链接失败！")
+	}
+	if link == nil || link.GroupNo != groupNo {
+		return nil, errors.New("邀请链接不存在！")
+	}
+	if link.Status != InviteLinkStatusValid {
+		return nil, errors.New("邀请链接已撤销！")
+	}
+	return link, nil
+}
+
+func (g *Group) newInviteLinkResp(link *InviteLinkModel) *inviteLinkResp {
+	code := fmt.Sprintf("%s%s", InviteLinkCodePrefix, link.LinkNo)
+	return &inviteLinkResp{
+		LinkNo:          link.LinkNo,
+		GroupNo:         link.GroupNo,
+		Creator:         link.Creator,
+		Name:            link.Name,
+		ExpireAt:        link.ExpireAt,
+		MaxUses:         link.MaxUses,
+		Uses:            link.Uses,
+		RequireApproval: link.RequireApproval,
+		Status:          link.Status,
+		URL:             fmt.Sprintf("%s/%s", g.ctx.GetConfig().External.BaseURL, strings.ReplaceAll(g.ctx.GetConfig().QRCodeInfoURL, ":code", code)),
+		CreatedAt:       link.CreatedAt.String(),
+	}
+}
+
+// check 校验链接是否可用
+func (m *InviteLinkModel) check(now time.Time) error {
+	if m.Status != InviteLinkStatusValid {
+		return errors.New("邀请链接已撤销！")
+	}
+	if m.ExpireAt > 0 && m.ExpireAt <= now.Unix() {
+		return errors.New("邀请链接已过期！")
+	}
+	if m.MaxUses > 0 && m.Uses >= m.MaxUses {
+		return errors.New("邀请链接使用次数已达上限！")
+	}
+	return nil
+}
+
+// needApproval 链接要求审核或群开启了邀请模式时需要管理员审核
+func (m *InviteLinkModel) needApproval(group *Model) int {
+	if m.RequireApproval == 1 || group.Invite == 1 {
+		return 1
+	}
+	return 0
+}
+
+type inviteLinkReq struct {
+	Name            string `json:"name"`             // 链接名称
+	ExpireAt        int64  `json:"expire_at"`        // 过期时间（秒级时间戳） 0.永不过期
+	MaxUses         int    `json:"max_uses"`         // 最大使用次数 0.不限制
+	RequireApproval int    `json:"require_approval"` // 是否需要管理员审核 0.否 1.是
+}
+
+func (r inviteLinkReq) check(now time.Time) error {
+	if len([]rune(r.Name)) > 100 {
+		return errors.New("链接名称不能超过100个字符！")
+	}
+	if r.ExpireAt < 0 || (r.ExpireAt > 0 && r.ExpireAt <= now.Unix()) {
+		return errors.New("过期时间必须晚于当前时间！")
+	}
+	if r.MaxUses < 0 {
+		return errors.New("最大使用次数不能小于0！")
+	}
+	if r.RequireApproval != 0 && r.RequireApproval != 1 {
+		return errors.New("审核设置有误！")
+	}
+	return nil
+}
+
+type inviteLinkResp struct {
+	LinkNo          string `json:"link_no"`          // 链接唯一编号
+	GroupNo         string `json:"group_no"`         // 群唯一编号
+	Creator         string `json:"creator"`          // 创建者
+	Name            string `json:"name"`             // 链接名称
+	ExpireAt        int64  `json:"expire_at"`        // 过期时间（秒级时间戳） 0.永不过期
+	MaxUses         int    `json:"max_uses"`         // 最大使用次数 0.不限制
+	Uses            int    `json:"uses"`             // 已使用次数
+	RequireApproval int    `json:"require_approval"` // 是否需要管理员审核
+	Status          int    `json:"status"`           // 状态 1.有效 0.已撤销
+	URL             string `json:"url"`              // 链接地址（可生成二维码）
+	CreatedAt       string `json:"created_at"`
+}
+
+type inviteLinkPreviewResp struct {
+	groupDetailResp
+	LinkNo          string `json:"link_no"`          // 链接唯一编号
+	RequireApproval int    `json:"require_approval"` // 加入是否需要管理员审核
+	Valid           int    `json:"valid"`            // 链接是否可用
+	IsMember        int    `json:"is_member"`        // 是否已在群内
+}
@@ -0,0 +1,86 @@
+package group
+
+import (
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+// insertInviteLink 添加邀请链接
+func (d *DB) insertInviteLink(model *InviteLinkModel) error {
+	_, err := d.session.InsertInto("group_invite_link").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// insertInviteLinkTx 添加邀请链接
+func (d *DB) insertInviteLinkTx(model *InviteLinkModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("group_invite_link").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// QueryInviteLink 查询邀请链接
+func (d *DB) QueryInviteLink(linkNo string) (*InviteLinkModel, error) {
+	var model *InviteLinkModel
+	_, err := d.session.Select("*").From("group_invite_link").Where("link_no=?", linkNo).Load(&model)
+	return model, err
+}
+
+// queryInviteLinks 查询群内有效的邀请链接
+func (d *DB) queryInviteLinks(groupNo string) ([]*InviteLinkModel, error) {
+	var models []*InviteLinkModel
+	_, err := d.session.Select("*").From("group_invite_link").Where("group_no=? and status=?", groupNo, InviteLinkStatusValid).OrderDir("created_at", false).Load(&models)
+	return models, err
+}
+
+// updateInviteLink 修改邀请链接设置
+func (d *DB) updateInviteLink(model *InviteLinkModel) error {
+	_, err := d.session.Update("group_invite_link").SetMap(map[string]interface{}{
+		"name":             model.Name,
+		"expire_at":        model.ExpireAt,
+		"max_uses":         model.MaxUses,
+		"require_approval": model.RequireApproval,
+	}).Where("link_no=?", model.LinkNo).Exec()
+	return err
+}
+
+// revokeInviteLinkTx 撤销邀请链接
+func (d *DB) revokeInviteLinkTx(linkNo string, tx *dbr.Tx) error {
+	_, err := tx.Update("group_invite_link").Set("status", InviteLinkStatusRevoked).Where("link_no=?", linkNo).Exec()
+	return err
+}
+
+// claimInviteLinkTx 占用一次邀请链接的使用次数，链接已失效或次数已用完时返回false
+func (d *DB) claimInviteLinkTx(linkNo string, tx *dbr.Tx) (bool, error) {
+	result, err := tx.UpdateBySql("update group_invite_link set uses=uses+1 where link_no=? and status=? and (max_uses=0 or uses<max_uses) and (expire_at=0 or expire_at>?)", linkNo, InviteLinkStatusValid, time.Now().Unix()).Exec()
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// existWaitInviteWithLink 是否存在通过此链接且待审核的入群申请
+func (d *DB) existWaitInviteWithLink(linkNo string, uid string) (bool, error) {
+	var count int
+	_, err := d.session.Select("count(*)").From("group_invite").Join("invite_item", "group_invite.invite_no=invite_item.invite_no").Where("group_invite.link_no=? and group_invite.status=? and invite_item.uid=?", linkNo, InviteStatusWait, uid).Load(&count)
+	return count > 0, err
+}
+
+// InviteLinkModel 群邀请链接
+type InviteLinkModel struct {
+	LinkNo          string // 链接唯一编号
+	GroupNo         string // 群唯一编号
+	Creator         string // 创建者
+	Name            string // 链接名称
+	ExpireAt        int64  // 过期时间（秒级时间戳） 0.永不过期
+	MaxUses         int    // 最大使用次数 0.不限制
+	Uses            int    // 已使用次数
+	RequireApproval int    // 是否需要管理员审核 0.否 1.是
+	Status          int    // 状态 1.有效 0.已撤销
+	db.BaseModel
+}
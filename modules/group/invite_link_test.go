@@ -0,0 +1,49 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInviteLinkCheck(t *testing.T) {
+	now := time.Now()
+	link := &InviteLinkModel{Status: InviteLinkStatusValid}
+	assert.NoError(t, link.check(now))
+
+	link.ExpireAt = now.Add(time.Hour).Unix()
+	assert.NoError(t, link.check(now))
+	link.ExpireAt = now.Unix()
+	assert.Error(t, link.check(now))
+	link.ExpireAt = 0
+
+	link.MaxUses = 2
+	link.Uses = 1
+	assert.NoError(t, link.check(now))
+	link.Uses = 2
+	assert.Error(t, link.check(now))
+	link.MaxUses = 0
+	assert.NoError(t, link.check(now))
+
+	link.Status = InviteLinkStatusRevoked
+	assert.Error(t, link.check(now))
+}
+
+func TestInviteLinkNeedApproval(t *testing.T) {
+	link := &InviteLinkModel{}
+	assert.Equal(t, 0, link.needApproval(&Model{}))
+	assert.Equal(t, 1, link.needApproval(&Model{Invite: 1}))
+	link.RequireApproval = 1
+	assert.Equal(t, 1, link.needApproval(&Model{}))
+}
+
+func TestInviteLinkReqCheck(t *testing.T) {
+	now := time.Now()
+	assert.NoError(t, inviteLinkReq{}.check(now))
+	assert.NoError(t, inviteLinkReq{Name: "运营", ExpireAt: now.Add(time.Hour).Unix(), MaxUses: 10, RequireApproval: 1}.check(now))
+	assert.Error(t, inviteLinkReq{ExpireAt: now.Add(-time.Hour).Unix()}.check(now))
+	assert.Error(t, inviteLinkReq{ExpireAt: -1}.check(now))
+	assert.Error(t, inviteLinkReq{MaxUses: -1}.check(now))
+	assert.Error(t, inviteLinkReq{RequireApproval: 2}.check(now))
+}
@@ -0,0 +1,69 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPermission(t *testing.T) {
+	assert.True(t, hasPermission(MemberRoleCreator, 0, ManagerPermissionAddManager))
+	assert.False(t, hasPermission(MemberRoleCommon, ManagerPermissionAll.Int(), ManagerPermissionChangeInfo))
+
+	permissions := (ManagerPermissionDeleteMessage | ManagerPermissionPinMessage).Int()
+	assert.True(t, hasPermission(MemberRoleManager, permissions, ManagerPermissionDeleteMessage))
+	assert.True(t, hasPermission(MemberRoleManager, permissions, ManagerPermissionPinMessage))
+	assert.False(t, hasPermission(MemberRoleManager, permissions, ManagerPermissionBanMember))
+	assert.False(t, hasPermission(MemberRoleManager, permissions, ManagerPermissionDeleteMessage|ManagerPermissionBanMember))
+	assert.True(t, hasPermission(MemberRoleManager, ManagerPermissionAll.Int(), ManagerPermissionAddManager))
+}
+
+func TestCanManageMember(t *testing.T) {
+	assert.True(t, CanManageMember(MemberRoleCreator, 0, false, MemberRoleManager, ManagerPermissionBanMember))
+	assert.False(t, CanManageMember(MemberRoleCreator, 0, false, MemberRoleCreator, ManagerPermissionBanMember))
+
+	permissions := ManagerPermissionBanMember.Int()
+	assert.True(t, CanManageMember(MemberRoleManager, permissions, false, MemberRoleCommon, ManagerPermissionBanMember))
+	assert.False(t, CanManageMember(MemberRoleManager, permissions, false, MemberRoleManager, ManagerPermissionBanMember))
+	assert.False(t, CanManageMember(MemberRoleManager, permissions, false, MemberRoleCommon, ManagerPermissionDeleteMessage))
+	assert.False(t, CanManageMember(MemberRoleCommon, ManagerPermissionAll.Int(), false, MemberRoleCommon, ManagerPermissionBanMember))
+
+	// 社群管理员在子群内是普通成员，依然可以管理子群的成员和管理员，但不能管理群主
+	assert.True(t, CanManageMember(MemberRoleCommon, 0, true, MemberRoleCommon, ManagerPermissionBanMember))
+	assert.True(t, CanManageMember(MemberRoleCommon, 0, true, MemberRoleManager, ManagerPermissionDeleteMessage))
+	assert.True(t, CanManageMember(MemberRoleManager, 0, true, MemberRoleManager, ManagerPermissionBanMember))
+	assert.False(t, CanManageMember(MemberRoleCommon, 0, true, MemberRoleCreator, ManagerPermissionBanMember))
+}
+
+func TestManagerPermissionValid(t *testing.T) {
+	assert.True(t, ManagerPermission(0).Valid())
+	assert.True(t, ManagerPermissionAll.Valid())
+	assert.Equal(t, 127, ManagerPermissionAll.Int())
+	assert.False(t, ManagerPermission(128).Valid())
+	assert.False(t, ManagerPermission(-1).Valid())
+}
+
+func TestParseManagerAddReq(t *testing.T) {
+	req, err := parseManagerAddReq([]byte(` ["u1","u2"]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, req.UIDs)
+	assert.Equal(t, ManagerPermissionAll, req.permissions())
+	assert.NoError(t, req.check())
+
+	req, err = parseManagerAddReq([]byte(`{"uids":["u1"],"permissions":3}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, req.UIDs)
+	assert.Equal(t, ManagerPermissionChangeInfo|ManagerPermissionDeleteMessage, req.permissions())
+
+	req, err = parseManagerAddReq([]byte(`{"uids":["u1"],"permissions":0}`))
+	assert.NoError(t, err)
+	assert.Equal(t, ManagerPermission(0), req.permissions())
+
+	req, err = parseManagerAddReq([]byte(`{"uids":["u1"],"permissions":256}`))
+	assert.NoError(t, err)
+	assert.Error(t, req.check())
+
+	req, err = parseManagerAddReq([]byte(`[]`))
+	assert.NoError(t, err)
+	assert.Error(t, req.check())
+}
@@ -0,0 +1,425 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	memberTagMaxCount      = 50  // 每个群最多的标签数量
+	memberTagMaxNameLength = 20  // 标签名称最大长度
+	memberTagMaxUIDCount   = 200 // 单次最多添加或移除的成员数量
+)
+
+// 群成员标签列表
+func (g *Group) memberTagList(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	exist, err := g.db.ExistMember(c.GetLoginUID(), groupNo)
+	if err != nil {
+		g.Error("查询是否是群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员，无法查看！"))
+		return
+	}
+	models, err := g.db.queryMemberTags(groupNo)
+	if err != nil {
+		g.Error("查询群成员标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员标签失败！"))
+		return
+	}
+	resps := make([]*memberTagResp, 0, len(models))
+	for _, model := range models {
+		resp := newMemberTagResp(&model.memberTagModel)
+		resp.MemberCount = model.MemberCount
+		resps = append(resps, resp)
+	}
+	c.Response(resps)
+}
+
+// 添加群成员标签
+func (g *Group) memberTagAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req memberTagReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if len(req.UIDs) > memberTagMaxUIDCount {
+		c.ResponseError(fmt.Errorf("单次最多添加%d个成员！", memberTagMaxUIDCount))
+		return
+	}
+	groupModel, ok := g.checkMemberTagPermission(c, groupNo)
+	if !ok {
+		return
+	}
+	count, err := g.db.queryMemberTagCount(groupNo)
+	if err != nil {
+		g.Error("查询群成员标签数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员标签数量失败！"))
+		return
+	}
+	if count >= memberTagMaxCount {
+		c.ResponseError(fmt.Errorf("每个群最多创建%d个标签！", memberTagMaxCount))
+		return
+	}
+	if !g.checkMemberTagNameUnique(c, groupNo, req.Name, "") {
+		return
+	}
+	uids, ok := g.filterMemberTagUIDs(c, groupNo, req.UIDs)
+	if !ok {
+		return
+	}
+	model := &memberTagModel{
+		TagNo:   util.GenerUUID(),
+		GroupNo: groupNo,
+		Name:    req.Name,
+		Creator: loginUID,
+	}
+	err = g.db.insertMemberTag(model)
+	if err != nil {
+		g.Error("添加群成员标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加群成员标签失败！"))
+		return
+	}
+	if len(uids) > 0 {
+		err = g.updateMemberTagUsers(groupModel, model.TagNo, uids, loginUID, true)
+		if err != nil {
+			g.Error("添加标签成员失败！", zap.Error(err))
+			c.ResponseError(errors.New("添加标签成员失败！"))
+			return
+		}
+	}
+	g.sendMemberTagUpdateCMD(groupNo)
+	resp := newMemberTagResp(model)
+	resp.MemberCount = int64(len(uids))
+	c.Response(resp)
+}
+
+// 修改群成员标签名称
+func (g *Group) memberTagUpdate(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req memberTagReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	_, model, ok := g.getMemberTagForUpdate(c, groupNo)
+	if !ok {
+		return
+	}
+	if !g.checkMemberTagNameUnique(c, groupNo, req.Name, model.TagNo) {
+		return
+	}
+	err := g.db.updateMemberTagName(model.TagNo, req.Name)
+	if err != nil {
+		g.Error("修改群成员标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群成员标签失败！"))
+		return
+	}
+	model.Name = req.Name
+	g.sendMemberTagUpdateCMD(groupNo)
+	c.Response(newMemberTagResp(model))
+}
+
+// 删除群成员标签
+func (g *Group) memberTagDelete(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	groupModel, model, ok := g.getMemberTagForUpdate(c, groupNo)
+	if !ok {
+		return
+	}
+	uids, err := g.db.queryMemberTagUserUIDs(model.TagNo)
+	if err != nil {
+		g.Error("查询标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询标签成员失败！"))
+		return
+	}
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = g.db.deleteMemberTagTx(model.TagNo, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("删除群成员标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除群成员标签失败！"))
+		return
+	}
+	if len(uids) > 0 {
+		err = g.db.updateMembersVersionTx(groupNo, uids, g.ctx.GenSeq(common.GroupMemberSeqKey), tx)
+		if err != nil {
+			tx.Rollback()
+			g.Error("更新成员版本失败！", zap.Error(err))
+			c.ResponseError(errors.New("更新成员版本失败！"))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	if len(uids) > 0 {
+		err = g.sendMemberUpdateCMD(groupModel, uids)
+		if err != nil {
+			g.Warn("发送命令消息失败！", zap.Error(err))
+		}
+	}
+	g.sendMemberTagUpdateCMD(groupNo)
+	c.ResponseOK()
+}
+
+// 添加标签成员
+func (g *Group) memberTagUsersAdd(c *wkhttp.Context) {
+	g.memberTagUsersChange(c, true)
+}
+
+// 移除标签成员
+func (g *Group) memberTagUsersRemove(c *wkhttp.Context) {
+	g.memberTagUsersChange(c, false)
+}
+
+func (g *Group) memberTagUsersChange(c *wkhttp.Context, add bool) {
+	groupNo := c.Param("group_no")
+	var req struct {
+		UIDs []string `json:"uids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if len(req.UIDs) == 0 {
+		c.ResponseError(errors.New("成员不能为空！"))
+		return
+	}
+	if len(req.UIDs) > memberTagMaxUIDCount {
+		c.ResponseError(fmt.Errorf("单次最多操作%d个成员！", memberTagMaxUIDCount))
+		return
+	}
+	groupModel, model, ok := g.getMemberTagForUpdate(c, groupNo)
+	if !ok {
+		return
+	}
+	uids := req.UIDs
+	if add {
+		uids, ok = g.filterMemberTagUIDs(c, groupNo, req.UIDs)
+		if !ok {
+			return
+		}
+		if len(uids) == 0 {
+			c.ResponseError(errors.New("成员不在群内！"))
+			return
+		}
+	}
+	err := g.updateMemberTagUsers(groupModel, model.TagNo, uids, c.GetLoginUID(), add)
+	if err != nil {
+		g.Error("修改标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改标签成员失败！"))
+		return
+	}
+	g.sendMemberTagUpdateCMD(groupNo)
+	c.ResponseOK()
+}
+
+// updateMemberTagUsers 添加或移除标签成员，并通知客户端同步这些成员
+func (g *Group) updateMemberTagUsers(groupModel *Model, tagNo string, uids []string, operator string, add bool) error {
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	if add {
+		err = g.db.insertMemberTagUsersTx(tagNo, groupModel.GroupNo, uids, operator, tx)
+	} else {
+		err = g.db.deleteMemberTagUsersTx(tagNo, uids, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = g.db.updateMembersVersionTx(groupModel.GroupNo, uids, g.ctx.GenSeq(common.GroupMemberSeqKey), tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return g.sendMemberUpdateCMD(groupModel, uids)
+}
+
+func (g *Group) checkMemberTagPermission(c *wkhttp.Context, groupNo string) (*Model, bool) {
+	groupModel, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return nil, false
+	}
+	hasPermission, err := g.db.QueryHasPermission(groupNo, c.GetLoginUID(), ManagerPermissionChangeInfo)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群管理者失败！"))
+		return nil, false
+	}
+	if !hasPermission {
+		c.ResponseError(errors.New("没有管理成员标签的权限！"))
+		return nil, false
+	}
+	return groupModel, true
+}
+
+func (g *Group) getMemberTagForUpdate(c *wkhttp.Context, groupNo string) (*Model, *memberTagModel, bool) {
+	groupModel, ok := g.checkMemberTagPermission(c, groupNo)
+	if !ok {
+		return nil, nil, false
+	}
+	model, err := g.db.queryMemberTag(c.Param("tag_no"))
+	if err != nil {
+		g.Error("查询群成员标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员标签失败！"))
+		return nil, nil, false
+	}
+	if model == nil || model.GroupNo != groupNo {
+		c.ResponseError(errors.New("群成员标签不存在！"))
+		return nil, nil, false
+	}
+	return groupModel, model, true
+}
+
+func (g *Group) checkMemberTagNameUnique(c *wkhttp.Context, groupNo string, name string, tagNo string) bool {
+	existTag, err := g.db.queryMemberTagWithName(groupNo, name)
+	if err != nil {
+		g.Error("查询群成员标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员标签失败！"))
+		return false
+	}
+	if existTag != nil && existTag.TagNo != tagNo {
+		c.ResponseError(errors.New("标签名称已存在！"))
+		return false
+	}
+	return true
+}
+
+// filterMemberTagUIDs 过滤掉不在群内的成员
+func (g *Group) filterMemberTagUIDs(c *wkhttp.Context, groupNo string, uids []string) ([]string, bool) {
+	if len(uids) == 0 {
+		return nil, true
+	}
+	members, err := g.db.QueryMembersWithUids(uids, groupNo)
+	if err != nil {
+		g.Error("查询群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员失败！"))
+		return nil, false
+	}
+	memberUIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		memberUIDs = append(memberUIDs, member.UID)
+	}
+	return memberUIDs, true
+}
+
+func (g *Group) sendMemberTagUpdateCMD(groupNo string) {
+	err := g.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         CMDGroupMemberTagUpdate,
+		Param: map[string]interface{}{
+			"group_no": groupNo,
+		},
+	})
+	if err != nil {
+		g.Warn("发送命令消息失败！", zap.Error(err))
+	}
+}
+
+// memberTagNosMap 查询成员所在的标签编号，key为成员uid
+func (g *Group) memberTagNosMap(groupNo string, uids []string) (map[string][]string, error) {
+	models, err := g.db.queryMemberTagUsersWithUIDs(groupNo, uids)
+	if err != nil {
+		return nil, err
+	}
+	tagNosMap := make(map[string][]string, len(models))
+	for _, model := range models {
+		tagNosMap[model.UID] = append(tagNosMap[model.UID], model.TagNo)
+	}
+	return tagNosMap, nil
+}
+
+type memberTagReq struct {
+	Name string   `json:"name"` // 标签名称
+	UIDs []string `json:"uids"` // 标签成员（仅创建时有效）
+}
+
+func (r *memberTagReq) check() error {
+	r.Name = strings.TrimPrefix(strings.TrimSpace(r.Name), "@")
+	if r.Name == "" {
+		return errors.New("标签名称不能为空！")
+	}
+	if utf8.RuneCountInString(r.Name) > memberTagMaxNameLength {
+		return fmt.Errorf("标签名称不能超过%d个字！", memberTagMaxNameLength)
+	}
+	if strings.IndexFunc(r.Name, unicode.IsSpace) != -1 || strings.Contains(r.Name, "@") {
+		return errors.New("标签名称不能包含空格或@！")
+	}
+	if strings.EqualFold(r.Name, "all") || r.Name == "所有人" {
+		return errors.New("标签名称不能与@所有人重复！")
+	}
+	return nil
+}
+
+type memberTagResp struct {
+	TagNo       string `json:"tag_no"`
+	GroupNo     string `json:"group_no"`
+	Name        string `json:"name"`         // 标签名称
+	Creator     string `json:"creator"`      // 创建者uid
+	MemberCount int64  `json:"member_count"` // 标签下的成员数量
+	CreatedAt   string `json:"created_at"`
+}
+
+func newMemberTagResp(m *memberTagModel) *memberTagResp {
+	return &memberTagResp{
+		TagNo:     m.TagNo,
+		GroupNo:   m.GroupNo,
+		Name:      m.Name,
+		Creator:   m.Creator,
+		CreatedAt: m.CreatedAt.String(),
+	}
+}
@@ -0,0 +1,129 @@
+package group
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+// insertMemberTag 添加成员标签
+func (d *DB) insertMemberTag(model *memberTagModel) error {
+	_, err := d.session.InsertInto("group_member_tag").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// updateMemberTagName 修改成员标签名称
+func (d *DB) updateMemberTagName(tagNo string, name string) error {
+	_, err := d.session.Update("group_member_tag").Set("name", name).Where("tag_no=?", tagNo).Exec()
+	return err
+}
+
+// deleteMemberTagTx 删除成员标签及标签下的成员
+func (d *DB) deleteMemberTagTx(tagNo string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("group_member_tag").Where("tag_no=?", tagNo).Exec()
+	if err != nil {
+		return err
+	}
+	_, err = tx.DeleteFrom("group_member_tag_user").Where("tag_no=?", tagNo).Exec()
+	return err
+}
+
+// queryMemberTag 查询成员标签
+func (d *DB) queryMemberTag(tagNo string) (*memberTagModel, error) {
+	var model *memberTagModel
+	_, err := d.session.Select("*").From("group_member_tag").Where("tag_no=?", tagNo).Load(&model)
+	return model, err
+}
+
+// queryMemberTagWithName 通过名称查询群内的成员标签
+func (d *DB) queryMemberTagWithName(groupNo string, name string) (*memberTagModel, error) {
+	var model *memberTagModel
+	_, err := d.session.Select("*").From("group_member_tag").Where("group_no=? and name=?", groupNo, name).Load(&model)
+	return model, err
+}
+
+// queryMemberTagCount 查询群的成员标签数量
+func (d *DB) queryMemberTagCount(groupNo string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_member_tag").Where("group_no=?", groupNo).Load(&count)
+	return count, err
+}
+
+// queryMemberTags 查询群的成员标签及标签下的成员数量
+func (d *DB) queryMemberTags(groupNo string) ([]*memberTagDetailModel, error) {
+	var models []*memberTagDetailModel
+	_, err := d.session.Select("group_member_tag.*,(select count(*) from group_member_tag_user join group_member on group_member.group_no=group_member_tag_user.group_no and group_member.uid=group_member_tag_user.uid where group_member_tag_user.tag_no=group_member_tag.tag_no and group_member.is_deleted=0) member_count").From("group_member_tag").Where("group_member_tag.group_no=?", groupNo).OrderAsc("group_member_tag.id").Load(&models)
+	return models, err
+}
+
+// insertMemberTagUsersTx 将成员加入标签（已在标签内的忽略）
+func (d *DB) insertMemberTagUsersTx(tagNo string, groupNo string, uids []string, operator string, tx *dbr.Tx) error {
+	for _, uid := range uids {
+		_, err := tx.InsertBySql("insert ignore into group_member_tag_user(tag_no,group_no,uid,operator) values(?,?,?,?)", tagNo, groupNo, uid, operator).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMemberTagUsersTx 将成员移出标签
+func (d *DB) deleteMemberTagUsersTx(tagNo string, uids []string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("group_member_tag_user").Where("tag_no=? and uid in ?", tagNo, uids).Exec()
+	return err
+}
+
+// queryMemberTagUserUIDs 查询标签下的成员uid（包含已退群的成员）
+func (d *DB) queryMemberTagUserUIDs(tagNo string) ([]string, error) {
+	var uids []string
+	_, err := d.session.Select("uid").From("group_member_tag_user").Where("tag_no=?", tagNo).Load(&uids)
+	return uids, err
+}
+
+// queryMemberTagUsersWithUIDs 查询群内指定成员所在的标签
+func (d *DB) queryMemberTagUsersWithUIDs(groupNo string, uids []string) ([]*memberTagUserModel, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	var models []*memberTagUserModel
+	_, err := d.session.Select("*").From("group_member_tag_user").Where("group_no=? and uid in ?", groupNo, uids).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+// queryTagMemberUIDs 查询一批标签下当前在群内的正常成员uid
+func (d *DB) queryTagMemberUIDs(groupNo string, tagNos []string) ([]string, error) {
+	if len(tagNos) == 0 {
+		return nil, nil
+	}
+	var uids []string
+	_, err := d.session.Select("distinct group_member_tag_user.uid").From("group_member_tag_user").Join("group_member", "group_member.group_no=group_member_tag_user.group_no and group_member.uid=group_member_tag_user.uid").Where("group_member_tag_user.group_no=? and group_member_tag_user.tag_no in ? and group_member.is_deleted=0 and group_member.status=?", groupNo, tagNos, int(common.GroupMemberStatusNormal)).Load(&uids)
+	return uids, err
+}
+
+// updateMembersVersionTx 更新一批成员的数据版本，使客户端重新同步这些成员
+func (d *DB) updateMembersVersionTx(groupNo string, uids []string, version int64, tx *dbr.Tx) error {
+	_, err := tx.Update("group_member").Set("version", version).Where("group_no=? and uid in ? and is_deleted=0", groupNo, uids).Exec()
+	return err
+}
+
+type memberTagModel struct {
+	TagNo   string // 标签编号
+	GroupNo string // 群编号
+	Name    string // 标签名称
+	Creator string // 创建者
+	db.BaseModel
+}
+
+type memberTagDetailModel struct {
+	memberTagModel
+	MemberCount int64 // 标签下的成员数量
+}
+
+type memberTagUserModel struct {
+	TagNo    string // 标签编号
+	GroupNo  string // 群编号
+	UID      string // 成员uid
+	Operator string // 操作人
+	db.BaseModel
+}
@@ -0,0 +1,22 @@
+package group
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberTagReqCheck(t *testing.T) {
+	req := &memberTagReq{Name: " @frontend "}
+	assert.NoError(t, req.check())
+	assert.Equal(t, "frontend", req.Name)
+
+	req = &memberTagReq{Name: "值班"}
+	assert.NoError(t, req.check())
+
+	for _, name := range []string{"", "  ", "front end", "a@b", "all", "ALL", "所有人", strings.Repeat("标", memberTagMaxNameLength+1)} {
+		req = &memberTagReq{Name: name}
+		assert.Error(t, req.check(), name)
+	}
+}
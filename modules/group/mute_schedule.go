@@ -0,0 +1,496 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	muteScheduleMaxCount        = 10
+	muteScheduleMaxRemarkLength = 100
+	muteScheduleMaxOnceDuration = 60 * 60 * 24 * 30
+	muteScheduleLoopInterval    = time.Second * 30
+)
+
+// 群定时禁言计划列表
+func (g *Group) muteScheduleList(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	exist, err := g.db.ExistMember(c.GetLoginUID(), groupNo)
+	if err != nil {
+		g.Error("查询是否是群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员，无法查看！"))
+		return
+	}
+	models, err := g.db.queryMuteSchedules(groupNo)
+	if err != nil {
+		g.Error("查询定时禁言计划失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询定时禁言计划失败！"))
+		return
+	}
+	now := time.Now()
+	resps := make([]*muteScheduleResp, 0, len(models))
+	for _, model := range models {
+		resps = append(resps, newMuteScheduleResp(model, now))
+	}
+	c.Response(resps)
+}
+
+// 添加群定时禁言计划
+func (g *Group) muteScheduleAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req muteScheduleReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	model, err := req.toModel(time.Now())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if _, err = g.getGroupInfo(groupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !g.checkMuteSchedulePermission(c, groupNo) {
+		return
+	}
+	count, err := g.db.queryMuteScheduleCount(groupNo)
+	if err != nil {
+		g.Error("查询定时禁言计划数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询定时禁言计划数量失败！"))
+		return
+	}
+	if count >= muteScheduleMaxCount {
+		c.ResponseError(fmt.Errorf("每个群最多只能添加%d个定时禁言计划！", muteScheduleMaxCount))
+		return
+	}
+	model.ScheduleNo = util.GenerUUID()
+	model.GroupNo = groupNo
+	model.Operator = loginUID
+	err = g.db.insertMuteSchedule(model)
+	if err != nil {
+		g.Error("添加定时禁言计划失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加定时禁言计划失败！"))
+		return
+	}
+	g.evaluateMuteSchedulesAsync(groupNo)
+	c.Response(newMuteScheduleResp(model, time.Now()))
+}
+
+// 修改群定时禁言计划
+func (g *Group) muteScheduleUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req muteScheduleReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	newModel, err := req.toModel(time.Now())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, ok := g.getMuteScheduleForUpdate(c, groupNo)
+	if !ok {
+		return
+	}
+	model.Kind = newModel.Kind
+	model.StartMinute = newModel.StartMinute
+	model.EndMinute = newModel.EndMinute
+	model.Weekdays = newModel.Weekdays
+	model.StartAt = newModel.StartAt
+	model.EndAt = newModel.EndAt
+	model.Timezone = newModel.Timezone
+	model.Remark = newModel.Remark
+	model.Enabled = newModel.Enabled
+	model.Operator = loginUID
+	err = g.db.updateMuteSchedule(model)
+	if err != nil {
+		g.Error("修改定时禁言计划失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改定时禁言计划失败！"))
+		return
+	}
+	g.evaluateMuteSchedulesAsync(groupNo)
+	c.Response(newMuteScheduleResp(model, time.Now()))
+}
+
+// 删除群定时禁言计划，计划开启的全员禁言将被解除
+func (g *Group) muteScheduleDelete(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	model, ok := g.getMuteScheduleForUpdate(c, groupNo)
+	if !ok {
+		return
+	}
+	if model.Muted == 1 {
+		// 先停用计划并解除由此计划开启的禁言，再删除计划
+		model.Enabled = 0
+		err := g.db.updateMuteSchedule(model)
+		if err != nil {
+			g.Error("停用定时禁言计划失败！", zap.Error(err))
+			c.ResponseError(errors.New("停用定时禁言计划失败！"))
+			return
+		}
+		err = g.evaluateMuteSchedules(groupNo, time.Now())
+		if err != nil {
+			g.Error("解除定时禁言失败！", zap.Error(err))
+			c.ResponseError(errors.New("解除定时禁言失败！"))
+			return
+		}
+	}
+	err := g.db.deleteMuteSchedule(model.ScheduleNo)
+	if err != nil {
+		g.Error("删除定时禁言计划失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除定时禁言计划失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+func (g *Group) checkMuteSchedulePermission(c *wkhttp.Context, groupNo string) bool {
+	hasPermission, err := g.db.QueryHasPermission(groupNo, c.GetLoginUID(), ManagerPermissionBanMember)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群管理者失败！"))
+		return false
+	}
+	if !hasPermission {
+		c.ResponseError(errors.New("没有禁言的权限！"))
+		return false
+	}
+	return true
+}
+
+func (g *Group) getMuteScheduleForUpdate(c *wkhttp.Context, groupNo string) (*muteScheduleModel, bool) {
+	if !g.checkMuteSchedulePermission(c, groupNo) {
+		return nil, false
+	}
+	model, err := g.db.queryMuteSchedule(c.Param("schedule_no"))
+	if err != nil {
+		g.Error("查询定时禁言计划失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询定时禁言计划失败！"))
+		return nil, false
+	}
+	if model == nil || model.GroupNo != groupNo {
+		c.ResponseError(errors.New("定时禁言计划不存在！"))
+		return nil, false
+	}
+	return model, true
+}
+
+func (g *Group) evaluateMuteSchedulesAsync(groupNo string) {
+	go func() {
+		err := g.evaluateMuteSchedules(groupNo, time.Now())
+		if err != nil {
+			g.Warn("执行定时禁言计划失败", zap.Error(err), zap.String("groupNo", groupNo))
+		}
+	}()
+}
+
+// CheckMuteScheduleLoop 定时检查群的定时禁言计划并开启或解除全员禁言
+func (g *Group) CheckMuteScheduleLoop() {
+	for {
+		groupNos, err := g.db.queryMuteScheduleGroupNos()
+		if err != nil {
+			g.Warn("查询定时禁言计划失败", zap.Error(err))
+		}
+		now := time.Now()
+		for _, groupNo := range groupNos {
+			err = g.evaluateMuteSchedules(groupNo, now)
+			if err != nil {
+				g.Warn("执行定时禁言计划失败", zap.Error(err), zap.String("groupNo", groupNo))
+			}
+		}
+		time.Sleep(muteScheduleLoopInterval)
+	}
+}
+
+// evaluateMuteSchedules 根据群的定时禁言计划开启或解除全员禁言
+// 每个时间窗口只执行一次，窗口内管理员手动解除禁言后不会再次开启；群原本已开启的全员禁言不会被计划解除
+func (g *Group) evaluateMuteSchedules(groupNo string, now time.Time) error {
+	schedules, err := g.db.queryMuteSchedules(groupNo)
+	if err != nil {
+		return err
+	}
+	groupModel, err := g.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		return err
+	}
+	if groupModel == nil || groupModel.Status != GroupStatusNormal {
+		return nil
+	}
+	plan := planMuteSchedules(schedules, groupModel.Forbidden == 1, now)
+	if plan.forbidden != nil {
+		systemUID := g.ctx.GetConfig().Account.SystemUID
+		err = g.updateGroupForbidden(groupModel, *plan.forbidden, systemUID, "系统")
+		if err != nil {
+			return err
+		}
+	}
+	for _, state := range plan.states {
+		err = g.db.updateMuteScheduleState(state.ScheduleNo, state.LastWindowStart, state.Muted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type muteSchedulePlan struct {
+	forbidden *int                 // 需要修改的群全员禁言状态 nil.不修改
+	states    []*muteScheduleModel // 执行状态有变化的计划
+}
+
+// planMuteSchedules 计算群当前应处的禁言状态及各计划的执行状态
+func planMuteSchedules(schedules []*muteScheduleModel, groupForbidden bool, now time.Time) *muteSchedulePlan {
+	plan := &muteSchedulePlan{}
+	holding := false       // 当前禁言是否由计划开启
+	activeHolding := false // 仍在窗口内的计划是否持有禁言
+	newWindows := make([]*muteScheduleModel, 0)
+	windowStarts := make(map[string]int64)
+	for _, schedule := range schedules {
+		if schedule.Muted == 1 {
+			holding = true
+		}
+		if schedule.Enabled != 1 {
+			continue
+		}
+		windowStart, active := schedule.activeWindow(now)
+		if !active {
+			continue
+		}
+		if schedule.Muted == 1 {
+			activeHolding = true
+		}
+		if schedule.LastWindowStart != windowStart {
+			newWindows = append(newWindows, schedule)
+			windowStarts[schedule.ScheduleNo] = windowStart
+		}
+	}
+	if len(newWindows) > 0 {
+		muted := 0
+		if !groupForbidden {
+			muted = 1
+			on := 1
+			plan.forbidden = &on
+		} else if holding {
+			muted = 1
+		}
+		for _, schedule := range newWindows {
+			schedule.LastWindowStart = windowStarts[schedule.ScheduleNo]
+			schedule.Muted = muted
+			plan.states = append(plan.states, schedule)
+		}
+		if muted == 1 {
+			activeHolding = true
+		}
+	}
+	for _, schedule := range schedules {
+		if schedule.Muted != 1 {
+			continue
+		}
+		if _, ok := windowStarts[schedule.ScheduleNo]; ok {
+			continue
+		}
+		if schedule.Enabled == 1 {
+			if _, active := schedule.activeWindow(now); active {
+				continue
+			}
+		}
+		schedule.Muted = 0
+		plan.states = append(plan.states, schedule)
+	}
+	if holding && !activeHolding && groupForbidden && plan.forbidden == nil {
+		off := 0
+		plan.forbidden = &off
+	}
+	return plan
+}
+
+// activeWindow 返回当前所处禁言时间窗口的开始时间
+func (m *muteScheduleModel) activeWindow(now time.Time) (int64, bool) {
+	switch m.Kind {
+	case MuteScheduleKindOnce:
+		if now.Unix() >= m.StartAt && now.Unix() < m.EndAt {
+			return m.StartAt, true
+		}
+	case MuteScheduleKindDaily:
+		local := now.In(muteScheduleLocation(m.Timezone))
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		minute := local.Hour()*60 + local.Minute()
+		if m.StartMinute < m.EndMinute {
+			if minute >= m.StartMinute && minute < m.EndMinute && m.onWeekday(today.Weekday()) {
+				return today.Add(time.Duration(m.StartMinute) * time.Minute).Unix(), true
+			}
+			return 0, false
+		}
+		// 跨天的时间窗口，以开始的那一天作为生效日
+		if minute >= m.StartMinute && m.onWeekday(today.Weekday()) {
+			return today.Add(time.Duration(m.StartMinute) * time.Minute).Unix(), true
+		}
+		yesterday := today.AddDate(0, 0, -1)
+		if minute < m.EndMinute && m.onWeekday(yesterday.Weekday()) {
+			return yesterday.Add(time.Duration(m.StartMinute) * time.Minute).Unix(), true
+		}
+	}
+	return 0, false
+}
+
+func (m *muteScheduleModel) onWeekday(weekday time.Weekday) bool {
+	return m.Weekdays == 0 || m.Weekdays&(1<<uint(weekday)) != 0
+}
+
+func muteScheduleLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+type muteScheduleReq struct {
+	Kind      int    `json:"kind"`       // 计划类型 1.每天重复 2.单次
+	StartTime string `json:"start_time"` // 每天开始时间 格式：23:00
+	EndTime   string `json:"end_time"`   // 每天结束时间 格式：08:00，早于开始时间表示跨天
+	Weekdays  []int  `json:"weekdays"`   // 生效的星期 0.周日 1-6.周一至周六，为空表示每天
+	StartAt   int64  `json:"start_at"`   // 单次计划开始时间（10位时间戳）
+	EndAt     int64  `json:"end_at"`     // 单次计划结束时间（10位时间戳）
+	Timezone  string `json:"timezone"`   // 时区 例如：Asia/Shanghai，为空使用服务器时区
+	Remark    string `json:"remark"`     // 备注
+	Enabled   *int   `json:"enabled"`    // 是否启用，默认启用
+}
+
+func (r *muteScheduleReq) toModel(now time.Time) (*muteScheduleModel, error) {
+	model := &muteScheduleModel{
+		Kind:     r.Kind,
+		Timezone: strings.TrimSpace(r.Timezone),
+		Remark:   strings.TrimSpace(r.Remark),
+		Enabled:  1,
+	}
+	if r.Enabled != nil {
+		if *r.Enabled != 0 && *r.Enabled != 1 {
+			return nil, errors.New("启用参数错误！")
+		}
+		model.Enabled = *r.Enabled
+	}
+	if utf8.RuneCountInString(model.Remark) > muteScheduleMaxRemarkLength {
+		return nil, fmt.Errorf("备注不能超过%d个字！", muteScheduleMaxRemarkLength)
+	}
+	if model.Timezone != "" {
+		if _, err := time.LoadLocation(model.Timezone); err != nil {
+			return nil, errors.New("时区格式有误！")
+		}
+	}
+	switch r.Kind {
+	case MuteScheduleKindDaily:
+		startMinute, err := parseMuteScheduleTime(r.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		endMinute, err := parseMuteScheduleTime(r.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if startMinute == endMinute {
+			return nil, errors.New("开始时间和结束时间不能相同！")
+		}
+		model.StartMinute = startMinute
+		model.EndMinute = endMinute
+		for _, weekday := range r.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return nil, errors.New("星期参数错误！")
+			}
+			model.Weekdays |= 1 << uint(weekday)
+		}
+	case MuteScheduleKindOnce:
+		if r.StartAt <= 0 || r.EndAt <= r.StartAt {
+			return nil, errors.New("结束时间必须晚于开始时间！")
+		}
+		if r.EndAt <= now.Unix() {
+			return nil, errors.New("结束时间必须晚于当前时间！")
+		}
+		if r.EndAt-r.StartAt > muteScheduleMaxOnceDuration {
+			return nil, errors.New("单次禁言时长不能超过30天！")
+		}
+		model.StartAt = r.StartAt
+		model.EndAt = r.EndAt
+	default:
+		return nil, errors.New("计划类型错误！")
+	}
+	return model, nil
+}
+
+// parseMuteScheduleTime 解析 HH:MM 格式的时间，返回当天第几分钟
+func parseMuteScheduleTime(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.New("时间格式有误，格式为HH:MM！")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatMuteScheduleTime(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+type muteScheduleResp struct {
+	ScheduleNo string `json:"schedule_no"`
+	GroupNo    string `json:"group_no"`
+	Kind       int    `json:"kind"`       // 计划类型 1.每天重复 2.单次
+	StartTime  string `json:"start_time"` // 每天开始时间
+	EndTime    string `json:"end_time"`   // 每天结束时间
+	Weekdays   []int  `json:"weekdays"`   // 生效的星期，为空表示每天
+	StartAt    int64  `json:"start_at"`   // 单次计划开始时间
+	EndAt      int64  `json:"end_at"`     // 单次计划结束时间
+	Timezone   string `json:"timezone"`   // 时区
+	Remark     string `json:"remark"`     // 备注
+	Enabled    int    `json:"enabled"`    // 是否启用
+	Active     int    `json:"active"`     // 当前是否处于禁言时间段内
+}
+
+func newMuteScheduleResp(m *muteScheduleModel, now time.Time) *muteScheduleResp {
+	resp := &muteScheduleResp{
+		ScheduleNo: m.ScheduleNo,
+		GroupNo:    m.GroupNo,
+		Kind:       m.Kind,
+		Weekdays:   make([]int, 0),
+		StartAt:    m.StartAt,
+		EndAt:      m.EndAt,
+		Timezone:   m.Timezone,
+		Remark:     m.Remark,
+		Enabled:    m.Enabled,
+	}
+	if m.Kind == MuteScheduleKindDaily {
+		resp.StartTime = formatMuteScheduleTime(m.StartMinute)
+		resp.EndTime = formatMuteScheduleTime(m.EndMinute)
+		for weekday := 0; weekday <= 6; weekday++ {
+			if m.Weekdays&(1<<uint(weekday)) != 0 {
+				resp.Weekdays = append(resp.Weekdays, weekday)
+			}
+		}
+	}
+	if m.Enabled == 1 {
+		if _, active := m.activeWindow(now); active {
+			resp.Active = 1
+		}
+	}
+	return resp
+}
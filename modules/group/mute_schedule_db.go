@@ -0,0 +1,90 @@
+package group
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// insertMuteSchedule 添加定时禁言计划
+func (d *DB) insertMuteSchedule(model *muteScheduleModel) error {
+	_, err := d.session.InsertInto("group_mute_schedule").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// updateMuteSchedule 修改定时禁言计划的设置（不修改执行状态）
+func (d *DB) updateMuteSchedule(model *muteScheduleModel) error {
+	_, err := d.session.Update("group_mute_schedule").SetMap(map[string]interface{}{
+		"kind":         model.Kind,
+		"start_minute": model.StartMinute,
+		"end_minute":   model.EndMinute,
+		"weekdays":     model.Weekdays,
+		"start_at":     model.StartAt,
+		"end_at":       model.EndAt,
+		"timezone":     model.Timezone,
+		"remark":       model.Remark,
+		"enabled":      model.Enabled,
+		"operator":     model.Operator,
+	}).Where("schedule_no=?", model.ScheduleNo).Exec()
+	return err
+}
+
+// updateMuteScheduleState 修改定时禁言计划的执行状态
+func (d *DB) updateMuteScheduleState(scheduleNo string, lastWindowStart int64, muted int) error {
+	_, err := d.session.Update("group_mute_schedule").SetMap(map[string]interface{}{
+		"last_window_start": lastWindowStart,
+		"muted":             muted,
+	}).Where("schedule_no=?", scheduleNo).Exec()
+	return err
+}
+
+// deleteMuteSchedule 删除定时禁言计划
+func (d *DB) deleteMuteSchedule(scheduleNo string) error {
+	_, err := d.session.DeleteFrom("group_mute_schedule").Where("schedule_no=?", scheduleNo).Exec()
+	return err
+}
+
+// queryMuteSchedule 查询定时禁言计划
+func (d *DB) queryMuteSchedule(scheduleNo string) (*muteScheduleModel, error) {
+	var model *muteScheduleModel
+	_, err := d.session.Select("*").From("group_mute_schedule").Where("schedule_no=?", scheduleNo).Load(&model)
+	return model, err
+}
+
+// queryMuteSchedules 查询群的定时禁言计划
+func (d *DB) queryMuteSchedules(groupNo string) ([]*muteScheduleModel, error) {
+	var models []*muteScheduleModel
+	_, err := d.session.Select("*").From("group_mute_schedule").Where("group_no=?", groupNo).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+// queryMuteScheduleCount 查询群的定时禁言计划数量
+func (d *DB) queryMuteScheduleCount(groupNo string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_mute_schedule").Where("group_no=?", groupNo).Load(&count)
+	return count, err
+}
+
+// queryMuteScheduleGroupNos 查询需要检查定时禁言的群（存在启用的计划或计划开启的禁言还未解除）
+func (d *DB) queryMuteScheduleGroupNos() ([]string, error) {
+	var groupNos []string
+	_, err := d.session.Select("distinct group_no").From("group_mute_schedule").Where("enabled=1 or muted=1").Load(&groupNos)
+	return groupNos, err
+}
+
+type muteScheduleModel struct {
+	ScheduleNo      string // 计划编号
+	GroupNo         string // 群编号
+	Kind            int    // 计划类型
+	StartMinute     int    // 每天开始时间（当天第几分钟）
+	EndMinute       int    // 每天结束时间（当天第几分钟）
+	Weekdays        int    // 生效的星期（位掩码，bit0为周日） 0.每天
+	StartAt         int64  // 单次计划开始时间
+	EndAt           int64  // 单次计划结束时间
+	Timezone        string // 时区
+	Remark          string // 备注
+	Enabled         int    // 是否启用
+	LastWindowStart int64  // 最近一次执行禁言的时间窗口开始时间
+	Muted           int    // 当前全员禁言是否由此计划开启
+	Operator        string // 最后修改人
+	db.BaseModel
+}
@@ -0,0 +1,124 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuteScheduleActiveWindow(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, loc) // 2026-10-19 为周一
+	}
+	schedule := &muteScheduleModel{Kind: MuteScheduleKindDaily, StartMinute: 23 * 60, EndMinute: 8 * 60, Timezone: "Asia/Shanghai"}
+
+	windowStart, active := schedule.activeWindow(at(19, 23, 30))
+	assert.True(t, active)
+	assert.Equal(t, at(19, 23, 0).Unix(), windowStart)
+
+	windowStart, active = schedule.activeWindow(at(20, 7, 59))
+	assert.True(t, active)
+	assert.Equal(t, at(19, 23, 0).Unix(), windowStart)
+
+	_, active = schedule.activeWindow(at(20, 8, 0))
+	assert.False(t, active)
+
+	// 只在周一生效，周一晚上开始的窗口持续到周二早上
+	schedule.Weekdays = 1 << uint(time.Monday)
+	_, active = schedule.activeWindow(at(20, 7, 0))
+	assert.True(t, active)
+	_, active = schedule.activeWindow(at(20, 23, 30))
+	assert.False(t, active)
+
+	schedule = &muteScheduleModel{Kind: MuteScheduleKindDaily, StartMinute: 12 * 60, EndMinute: 14 * 60, Timezone: "Asia/Shanghai"}
+	_, active = schedule.activeWindow(at(19, 13, 0))
+	assert.True(t, active)
+	_, active = schedule.activeWindow(at(19, 14, 0))
+	assert.False(t, active)
+
+	schedule = &muteScheduleModel{Kind: MuteScheduleKindOnce, StartAt: at(19, 10, 0).Unix(), EndAt: at(19, 11, 0).Unix()}
+	windowStart, active = schedule.activeWindow(at(19, 10, 30))
+	assert.True(t, active)
+	assert.Equal(t, schedule.StartAt, windowStart)
+	_, active = schedule.activeWindow(at(19, 11, 0))
+	assert.False(t, active)
+}
+
+func TestPlanMuteSchedules(t *testing.T) {
+	now := time.Unix(1000, 0)
+	newSchedule := func() *muteScheduleModel {
+		return &muteScheduleModel{ScheduleNo: "s1", Kind: MuteScheduleKindOnce, StartAt: 900, EndAt: 1100, Enabled: 1}
+	}
+
+	// 进入窗口时开启禁言
+	schedule := newSchedule()
+	plan := planMuteSchedules([]*muteScheduleModel{schedule}, false, now)
+	assert.Equal(t, 1, *plan.forbidden)
+	assert.Equal(t, 1, schedule.Muted)
+	assert.Equal(t, int64(900), schedule.LastWindowStart)
+
+	// 同一窗口内手动解除后不会再次开启
+	plan = planMuteSchedules([]*muteScheduleModel{schedule}, false, now)
+	assert.Nil(t, plan.forbidden)
+	assert.Len(t, plan.states, 0)
+
+	// 窗口结束时解除禁言
+	plan = planMuteSchedules([]*muteScheduleModel{schedule}, true, time.Unix(1100, 0))
+	assert.Equal(t, 0, *plan.forbidden)
+	assert.Equal(t, 0, schedule.Muted)
+
+	// 群原本已开启禁言时，计划不接管也不解除
+	schedule = newSchedule()
+	plan = planMuteSchedules([]*muteScheduleModel{schedule}, true, now)
+	assert.Nil(t, plan.forbidden)
+	assert.Equal(t, 0, schedule.Muted)
+	plan = planMuteSchedules([]*muteScheduleModel{schedule}, true, time.Unix(1100, 0))
+	assert.Nil(t, plan.forbidden)
+
+	// 停用计划时解除由计划开启的禁言
+	schedule = newSchedule()
+	planMuteSchedules([]*muteScheduleModel{schedule}, false, now)
+	schedule.Enabled = 0
+	plan = planMuteSchedules([]*muteScheduleModel{schedule}, true, now)
+	assert.Equal(t, 0, *plan.forbidden)
+
+	// 相邻的计划交接时保持禁言
+	first := newSchedule()
+	planMuteSchedules([]*muteScheduleModel{first}, false, now)
+	second := &muteScheduleModel{ScheduleNo: "s2", Kind: MuteScheduleKindOnce, StartAt: 1100, EndAt: 1200, Enabled: 1}
+	plan = planMuteSchedules([]*muteScheduleModel{first, second}, true, time.Unix(1100, 0))
+	assert.Nil(t, plan.forbidden)
+	assert.Equal(t, 0, first.Muted)
+	assert.Equal(t, 1, second.Muted)
+}
+
+func TestMuteScheduleReqToModel(t *testing.T) {
+	now := time.Now()
+	model, err := (&muteScheduleReq{Kind: MuteScheduleKindDaily, StartTime: "23:00", EndTime: "08:00", Weekdays: []int{0, 6}}).toModel(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 23*60, model.StartMinute)
+	assert.Equal(t, 8*60, model.EndMinute)
+	assert.Equal(t, 1|1<<6, model.Weekdays)
+	assert.Equal(t, 1, model.Enabled)
+	assert.Equal(t, []int{0, 6}, newMuteScheduleResp(model, now).Weekdays)
+
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindDaily, StartTime: "23:00", EndTime: "23:00"}).toModel(now)
+	assert.Error(t, err)
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindDaily, StartTime: "25:00", EndTime: "08:00"}).toModel(now)
+	assert.Error(t, err)
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindDaily, StartTime: "23:00", EndTime: "08:00", Weekdays: []int{7}}).toModel(now)
+	assert.Error(t, err)
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindDaily, StartTime: "23:00", EndTime: "08:00", Timezone: "Mars/Base"}).toModel(now)
+	assert.Error(t, err)
+
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindOnce, StartAt: now.Unix(), EndAt: now.Unix() + 3600}).toModel(now)
+	assert.NoError(t, err)
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindOnce, StartAt: now.Unix() - 7200, EndAt: now.Unix() - 3600}).toModel(now)
+	assert.Error(t, err)
+	_, err = (&muteScheduleReq{Kind: MuteScheduleKindOnce, StartAt: now.Unix(), EndAt: now.Unix() + muteScheduleMaxOnceDuration + 1}).toModel(now)
+	assert.Error(t, err)
+	_, err = (&muteScheduleReq{Kind: 3}).toModel(now)
+	assert.Error(t, err)
+}
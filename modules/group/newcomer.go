@@ -0,0 +1,515 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	newcomerMaxProbation     = 60 * 60 * 24 * 30
+	newcomerMaxRulesLength   = 2000
+	newcomerMinVerifyTimeout = 60
+	newcomerMaxVerifyTimeout = 60 * 60 * 24
+	memberVerifyLoopLimit    = 100
+	memberVerifyMaxFails     = 5 // 验证问题最多答错次数，超过后移出群聊
+
+	memberVerifySubmitPrefix   = "groupMemberVerifySubmit:" // 成员提交入群验证的间隔
+	memberVerifySubmitInterval = time.Second * 2
+)
+
+var newcomerLinkRegexp = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// 获取群新成员限制设置
+func (g *Group) newcomerSettingGet(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	exist, err := g.db.ExistMember(c.GetLoginUID(), groupNo)
+	if err != nil {
+		g.Error("查询是否是群成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员，无法查看！"))
+		return
+	}
+	model, err := g.db.queryNewcomerSetting(groupNo)
+	if err != nil {
+		g.Error("查询群新成员限制设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群新成员限制设置失败！"))
+		return
+	}
+	if model == nil {
+		model = &newcomerSettingModel{GroupNo: groupNo}
+	}
+	c.Response(newNewcomerSettingResp(model))
+}
+
+// 修改群新成员限制设置
+func (g *Group) newcomerSettingUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req newcomerSettingReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	req.Rules = strings.TrimSpace(req.Rules)
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	hasPermission, err := g.db.QueryHasPermission(groupNo, loginUID, ManagerPermissionBanMember)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群管理者失败！"))
+		return
+	}
+	if !hasPermission {
+		c.ResponseError(errors.New("没有修改新成员限制的权限！"))
+		return
+	}
+	model := &newcomerSettingModel{
+		GroupNo:       groupNo,
+		Probation:     req.Probation,
+		VerifyType:    req.VerifyType,
+		Rules:         req.Rules,
+		VerifyTimeout: req.VerifyTimeout,
+		Operator:      loginUID,
+	}
+	err = g.db.upsertNewcomerSetting(model)
+	if err != nil {
+		g.Error("修改群新成员限制设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群新成员限制设置失败！"))
+		return
+	}
+	c.Response(newNewcomerSettingResp(model))
+}
+
+// 获取登录用户待完成的入群验证
+func (g *Group) memberVerifyGet(c *wkhttp.Context) {
+	model, err := g.db.queryPendingMemberVerify(c.Param("group_no"), c.GetLoginUID())
+	if err != nil {
+		g.Error("查询入群验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群验证失败！"))
+		return
+	}
+	if model == nil {
+		c.ResponseError(errors.New("没有待完成的入群验证！"))
+		return
+	}
+	c.Response(newMemberVerifyResp(model))
+}
+
+// 提交入群验证
+func (g *Group) memberVerifySubmit(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req struct {
+		Answer string `json:"answer"` // 验证问题的答案，同意群规时不需要
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	model, err := g.db.queryPendingMemberVerify(groupNo, loginUID)
+	if err != nil {
+		g.Error("查询入群验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群验证失败！"))
+		return
+	}
+	if model == nil {
+		c.ResponseError(errors.New("没有待完成的入群验证！"))
+		return
+	}
+	if model.ExpireAt <= time.Now().Unix() {
+		c.ResponseError(errors.New("入群验证已超时！"))
+		return
+	}
+	// 同一成员的提交串行处理，避免并发提交所有可能的答案
+	submitKey := fmt.Sprintf("%s%s:%s", memberVerifySubmitPrefix, groupNo, loginUID)
+	submitCount, err := g.ctx.GetRedisConn().Incr(submitKey)
+	if err != nil {
+		g.Error("记录入群验证提交次数失败！", zap.Error(err))
+		c.ResponseError(errors.New("记录入群验证提交次数失败！"))
+		return
+	}
+	if submitCount > 1 {
+		c.ResponseError(errors.New("提交过于频繁，请稍后再试！"))
+		return
+	}
+	if err = g.ctx.GetRedisConn().Expire(submitKey, memberVerifySubmitInterval); err != nil {
+		g.Error("设置入群验证提交间隔失败！", zap.Error(err))
+		c.ResponseError(errors.New("设置入群验证提交间隔失败！"))
+		return
+	}
+	if !model.check(req.Answer) {
+		g.memberVerifyFailed(model, c)
+		return
+	}
+	ok, err := g.db.finishMemberVerify(groupNo, loginUID, MemberVerifyStatusPassed)
+	if err != nil {
+		g.Error("修改入群验证状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改入群验证状态失败！"))
+		return
+	}
+	if !ok {
+		c.ResponseError(errors.New("入群验证已失效！"))
+		return
+	}
+	member, err := g.db.QueryMemberWithUID(loginUID, groupNo)
+	if err != nil {
+		g.Error("查询成员信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询成员信息错误"))
+		return
+	}
+	if member == nil {
+		c.ResponseError(errors.New("该成员不在群内"))
+		return
+	}
+	// 被禁言或拉黑的成员通过验证后依然不能发言
+	if member.ForbiddenExpirTime <= time.Now().Unix() && member.Status != int(common.GroupMemberStatusBlacklist) {
+		err = g.setGroupBlacklist(groupNo, []string{loginUID}, false)
+		if err != nil {
+			c.ResponseError(errors.New("设置IM黑名单错误"))
+			return
+		}
+	}
+	c.ResponseOK()
+}
+
+// memberVerifyFailed 答错验证问题 换一道新的问题，答错次数过多时移出群聊
+func (g *Group) memberVerifyFailed(model *memberVerifyModel, c *wkhttp.Context) {
+	if model.FailCount+1 >= memberVerifyMaxFails {
+		err := g.removeUnverifiedMember(model)
+		if err != nil {
+			g.Error("移除未通过入群验证的成员失败", zap.Error(err), zap.String("groupNo", model.GroupNo), zap.String("uid", model.UID))
+			c.ResponseError(errors.New("移除未通过入群验证的成员失败"))
+			return
+		}
+		c.ResponseError(errors.New("答错次数过多，已被移出群聊！"))
+		return
+	}
+	question, answer := newCaptcha()
+	_, err := g.db.failMemberVerify(model.GroupNo, model.UID, model.Answer, question, answer)
+	if err != nil {
+		g.Error("修改入群验证问题失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改入群验证问题失败！"))
+		return
+	}
+	c.ResponseError(errors.New("答案错误，请回答新的验证问题！"))
+}
+
+// startMemberVerifyTx 按群设置为新成员生成入群验证，返回事务提交后需要执行的函数（加入IM黑名单并发送验证提示）
+func (g *Group) startMemberVerifyTx(groupNo string, uids []string, tx *dbr.Tx) (func(), error) {
+	if len(uids) == 0 {
+		return func() {}, nil
+	}
+	setting, err := g.db.queryNewcomerSettingTx(groupNo, tx)
+	if err != nil {
+		g.Error("查询群新成员限制设置失败！", zap.Error(err))
+		return nil, errors.New("查询群新成员限制设置失败！")
+	}
+	if setting == nil || setting.VerifyType == NewcomerVerifyTypeNone {
+		return func() {}, nil
+	}
+	verifies := make([]*memberVerifyModel, 0, len(uids))
+	for _, uid := range uids {
+		verify := setting.newMemberVerify(uid, time.Now())
+		err = g.db.upsertMemberVerifyTx(verify, tx)
+		if err != nil {
+			g.Error("添加入群验证失败！", zap.Error(err))
+			return nil, errors.New("添加入群验证失败！")
+		}
+		verifies = append(verifies, verify)
+	}
+	return func() {
+		err := g.setGroupBlacklist(groupNo, uids, true)
+		if err != nil {
+			g.Error("待验证成员加入IM黑名单失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		}
+		for _, verify := range verifies {
+			err = g.ctx.SendMessage(&config.MsgSendReq{
+				Header: config.MsgHeader{
+					RedDot: 1,
+				},
+				FromUID:     g.ctx.GetConfig().Account.SystemUID,
+				ChannelID:   groupNo,
+				ChannelType: common.ChannelTypeGroup.Uint8(),
+				Subscribers: []string{verify.UID},
+				Payload: []byte(util.ToJson(map[string]interface{}{
+					"type":         common.Tip,
+					"content":      setting.verifyPrompt(verify),
+					"group_verify": newMemberVerifyResp(verify),
+				})),
+			})
+			if err != nil {
+				g.Warn("发送入群验证提示失败！", zap.Error(err), zap.String("uid", verify.UID))
+			}
+		}
+	}, nil
+}
+
+// CheckMemberVerifyLoop 将超时未完成入群验证的成员移出群聊
+func (g *Group) CheckMemberVerifyLoop() {
+	var errSleep = time.Second * 1
+	var noDataSleep = time.Second * 10
+	for {
+		models, err := g.db.queryExpiredMemberVerifies(memberVerifyLoopLimit)
+		if err != nil {
+			g.Warn("查询超时的入群验证失败", zap.Error(err))
+			time.Sleep(errSleep)
+			continue
+		}
+		if len(models) <= 0 {
+			time.Sleep(noDataSleep)
+			continue
+		}
+		for _, model := range models {
+			err = g.removeUnverifiedMember(model)
+			if err != nil {
+				g.Warn("移除未通过入群验证的成员失败", zap.Error(err), zap.String("groupNo", model.GroupNo), zap.String("uid", model.UID))
+			}
+		}
+	}
+}
+
+func (g *Group) removeUnverifiedMember(model *memberVerifyModel) error {
+	ok, err := g.db.finishMemberVerify(model.GroupNo, model.UID, MemberVerifyStatusFailed)
+	if err != nil || !ok {
+		return err
+	}
+	member, err := g.db.QueryMemberWithUID(model.UID, model.GroupNo)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return g.setGroupBlacklist(model.GroupNo, []string{model.UID}, false)
+	}
+	userModel, err := g.userDB.QueryByUID(model.UID)
+	if err != nil {
+		return err
+	}
+	memberName := model.UID
+	if userModel != nil {
+		memberName = userModel.Name
+	}
+	removeReq := &config.MsgGroupMemberRemoveReq{
+		GroupNo:      model.GroupNo,
+		Operator:     g.ctx.GetConfig().Account.SystemUID,
+		OperatorName: "系统",
+		Members: []*config.UserBaseVo{
+			{
+				UID:  model.UID,
+				Name: memberName,
+			},
+		},
+	}
+	tx, err := g.db.session.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = g.db.DeleteMemberTx(model.GroupNo, model.UID, g.ctx.GenSeq(common.GroupMemberSeqKey), tx)
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		return err
+	}
+	eventID, err := g.ctx.EventBegin(&wkevent.Data{
+		Event: event.GroupMemberRemove,
+		Type:  wkevent.Message,
+		Data:  removeReq,
+	}, tx)
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		return err
+	}
+	g.ctx.EventCommit(eventID)
+
+	err = g.ctx.IMRemoveSubscriber(&config.SubscriberRemoveReq{
+		ChannelID:   model.GroupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		Subscribers: []string{model.UID},
+	})
+	if err != nil {
+		return err
+	}
+	err = g.setGroupBlacklist(model.GroupNo, []string{model.UID}, false)
+	if err != nil {
+		return err
+	}
+	return g.ctx.SendGroupMemberBeRemove(removeReq)
+}
+
+// NewcomerRestricted 是否是观察期内不允许发送的消息（链接、媒体、名片、@所有人或@标签）
+func NewcomerRestricted(payloadMap map[string]interface{}) bool {
+	if payloadMap == nil {
+		return false
+	}
+	switch int(newcomerPayloadInt(payloadMap["type"])) {
+	case common.Image.Int(), common.GIF.Int(), common.Voice.Int(), common.Video.Int(), common.File.Int(), common.Card.Int():
+		return true
+	}
+	if mentionMap, _ := payloadMap["mention"].(map[string]interface{}); mentionMap != nil {
+		if newcomerPayloadInt(mentionMap["all"]) == 1 {
+			return true
+		}
+		if tags, _ := mentionMap["tags"].([]interface{}); len(tags) > 0 { // @标签会通知标签下的所有成员
+			return true
+		}
+	}
+	content, _ := payloadMap["content"].(string)
+	return newcomerLinkRegexp.MatchString(content)
+}
+
+// 消息体中的数字（IM回调解析为json.Number，接口请求解析为float64）
+func newcomerPayloadInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	case float64:
+		return int64(n)
+	case int:
+		return int64(n)
+	}
+	return 0
+}
+
+// inProbation 入群时间为joinedAt的成员是否处于观察期
+func (s *newcomerSettingModel) inProbation(joinedAt time.Time, now time.Time) bool {
+	if s.Probation <= 0 {
+		return false
+	}
+	return now.Before(joinedAt.Add(time.Duration(s.Probation) * time.Second))
+}
+
+func (s *newcomerSettingModel) newMemberVerify(uid string, now time.Time) *memberVerifyModel {
+	verify := &memberVerifyModel{
+		GroupNo:    s.GroupNo,
+		UID:        uid,
+		VerifyType: s.VerifyType,
+		ExpireAt:   now.Add(time.Duration(s.VerifyTimeout) * time.Second).Unix(),
+		Status:     MemberVerifyStatusPending,
+	}
+	if s.VerifyType == NewcomerVerifyTypeCaptcha {
+		verify.Question, verify.Answer = newCaptcha()
+	}
+	return verify
+}
+
+func (s *newcomerSettingModel) verifyPrompt(verify *memberVerifyModel) string {
+	minutes := (s.VerifyTimeout + 59) / 60
+	if verify.VerifyType == NewcomerVerifyTypeCaptcha {
+		return fmt.Sprintf("请在%d分钟内回答验证问题后发言，超时将被移出群聊：%s", minutes, verify.Question)
+	}
+	if s.Rules == "" {
+		return fmt.Sprintf("请在%d分钟内同意群规后发言，超时将被移出群聊", minutes)
+	}
+	return fmt.Sprintf("请在%d分钟内阅读并同意群规后发言，超时将被移出群聊：\n%s", minutes, s.Rules)
+}
+
+// check 校验验证答案
+func (m *memberVerifyModel) check(answer string) bool {
+	if m.VerifyType != NewcomerVerifyTypeCaptcha {
+		return true
+	}
+	return strings.TrimSpace(answer) == m.Answer
+}
+
+// newCaptcha 生成一道简单的算术验证题
+func newCaptcha() (string, string) {
+	a := rand.Intn(9) + 1
+	b := rand.Intn(9) + 1
+	return fmt.Sprintf("%d + %d = ?", a, b), strconv.Itoa(a + b)
+}
+
+type newcomerSettingReq struct {
+	Probation     int    `json:"probation"`      // 新成员观察期（秒） 0.关闭
+	VerifyType    int    `json:"verify_type"`    // 入群验证方式 0.不验证 1.同意群规 2.回答验证问题
+	Rules         string `json:"rules"`          // 群规内容
+	VerifyTimeout int    `json:"verify_timeout"` // 验证超时时间（秒）
+}
+
+func (r newcomerSettingReq) check() error {
+	if r.Probation < 0 || r.Probation > newcomerMaxProbation {
+		return fmt.Errorf("观察期需在0到%d秒之间！", newcomerMaxProbation)
+	}
+	if r.VerifyType != NewcomerVerifyTypeNone && r.VerifyType != NewcomerVerifyTypeRules && r.VerifyType != NewcomerVerifyTypeCaptcha {
+		return errors.New("入群验证方式不支持！")
+	}
+	if utf8.RuneCountInString(r.Rules) > newcomerMaxRulesLength {
+		return fmt.Errorf("群规不能超过%d个字！", newcomerMaxRulesLength)
+	}
+	if r.VerifyType == NewcomerVerifyTypeRules && r.Rules == "" {
+		return errors.New("群规不能为空！")
+	}
+	if r.VerifyType != NewcomerVerifyTypeNone && (r.VerifyTimeout < newcomerMinVerifyTimeout || r.VerifyTimeout > newcomerMaxVerifyTimeout) {
+		return fmt.Errorf("验证超时时间需在%d到%d秒之间！", newcomerMinVerifyTimeout, newcomerMaxVerifyTimeout)
+	}
+	return nil
+}
+
+type newcomerSettingResp struct {
+	GroupNo       string `json:"group_no"`
+	Probation     int    `json:"probation"`      // 新成员观察期（秒） 0.关闭
+	VerifyType    int    `json:"verify_type"`    // 入群验证方式 0.不验证 1.同意群规 2.回答验证问题
+	Rules         string `json:"rules"`          // 群规内容
+	VerifyTimeout int    `json:"verify_timeout"` // 验证超时时间（秒）
+}
+
+func newNewcomerSettingResp(m *newcomerSettingModel) *newcomerSettingResp {
+	return &newcomerSettingResp{
+		GroupNo:       m.GroupNo,
+		Probation:     m.Probation,
+		VerifyType:    m.VerifyType,
+		Rules:         m.Rules,
+		VerifyTimeout: m.VerifyTimeout,
+	}
+}
+
+type memberVerifyResp struct {
+	GroupNo    string `json:"group_no"`
+	VerifyType int    `json:"verify_type"` // 验证方式 1.同意群规 2.回答验证问题
+	Question   string `json:"question"`    // 验证问题
+	ExpireAt   int64  `json:"expire_at"`   // 验证截止时间（秒级时间戳）
+}
+
+func newMemberVerifyResp(m *memberVerifyModel) *memberVerifyResp {
+	return &memberVerifyResp{
+		GroupNo:    m.GroupNo,
+		VerifyType: m.VerifyType,
+		Question:   m.Question,
+		ExpireAt:   m.ExpireAt,
+	}
+}
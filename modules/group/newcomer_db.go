@@ -0,0 +1,96 @@
+package group
+
+import (
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// queryNewcomerSetting 查询群新成员限制设置
+func (d *DB) queryNewcomerSetting(groupNo string) (*newcomerSettingModel, error) {
+	var model *newcomerSettingModel
+	_, err := d.session.Select("*").From("group_newcomer_setting").Where("group_no=?", groupNo).Load(&model)
+	return model, err
+}
+
+// queryNewcomerSettingTx 查询群新成员限制设置
+func (d *DB) queryNewcomerSettingTx(groupNo string, tx *dbr.Tx) (*newcomerSettingModel, error) {
+	var model *newcomerSettingModel
+	_, err := tx.Select("*").From("group_newcomer_setting").Where("group_no=?", groupNo).Load(&model)
+	return model, err
+}
+
+// upsertNewcomerSetting 添加或修改群新成员限制设置
+func (d *DB) upsertNewcomerSetting(model *newcomerSettingModel) error {
+	_, err := d.session.InsertBySql("insert into group_newcomer_setting(group_no,probation,verify_type,rules,verify_timeout,operator) values(?,?,?,?,?,?) ON DUPLICATE KEY UPDATE probation=VALUES(probation),verify_type=VALUES(verify_type),rules=VALUES(rules),verify_timeout=VALUES(verify_timeout),operator=VALUES(operator)", model.GroupNo, model.Probation, model.VerifyType, model.Rules, model.VerifyTimeout, model.Operator).Exec()
+	return err
+}
+
+// upsertMemberVerifyTx 添加成员入群验证，重新入群时覆盖之前的验证记录
+func (d *DB) upsertMemberVerifyTx(model *memberVerifyModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("insert into group_member_verify(group_no,uid,verify_type,question,answer,expire_at,status,fail_count) values(?,?,?,?,?,?,?,0) ON DUPLICATE KEY UPDATE verify_type=VALUES(verify_type),question=VALUES(question),answer=VALUES(answer),expire_at=VALUES(expire_at),status=VALUES(status),fail_count=0", model.GroupNo, model.UID, model.VerifyType, model.Question, model.Answer, model.ExpireAt, model.Status).Exec()
+	return err
+}
+
+// queryPendingMemberVerify 查询成员待完成的入群验证
+func (d *DB) queryPendingMemberVerify(groupNo string, uid string) (*memberVerifyModel, error) {
+	var model *memberVerifyModel
+	_, err := d.session.Select("*").From("group_member_verify").Where("group_no=? and uid=? and status=?", groupNo, uid, MemberVerifyStatusPending).Load(&model)
+	return model, err
+}
+
+// failMemberVerify 答错验证问题时记录次数并换成新的问题（问题已被换过时返回false）
+func (d *DB) failMemberVerify(groupNo string, uid string, oldAnswer string, question string, answer string) (bool, error) {
+	result, err := d.session.UpdateBySql("update group_member_verify set question=?,answer=?,fail_count=fail_count+1 where group_no=? and uid=? and status=? and answer=?", question, answer, groupNo, uid, MemberVerifyStatusPending, oldAnswer).Exec()
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// queryExpiredMemberVerifies 查询已超时的待验证记录
+func (d *DB) queryExpiredMemberVerifies(limit uint64) ([]*memberVerifyModel, error) {
+	var models []*memberVerifyModel
+	_, err := d.session.Select("*").From("group_member_verify").Where("status=? and expire_at<=?", MemberVerifyStatusPending, time.Now().Unix()).Limit(limit).Load(&models)
+	return models, err
+}
+
+// finishMemberVerify 结束待验证记录，记录已被处理时返回false
+func (d *DB) finishMemberVerify(groupNo string, uid string, status int) (bool, error) {
+	result, err := d.session.Update("group_member_verify").Set("status", status).Where("group_no=? and uid=? and status=?", groupNo, uid, MemberVerifyStatusPending).Exec()
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+type newcomerSettingModel struct {
+	GroupNo       string // 群编号
+	Probation     int    // 新成员观察期（秒） 0.关闭
+	VerifyType    int    // 入群验证方式
+	Rules         string // 群规内容
+	VerifyTimeout int    // 验证超时时间（秒）
+	Operator      string // 最后修改人
+	db.BaseModel
+}
+
+type memberVerifyModel struct {
+	GroupNo    string // 群编号
+	UID        string // 成员uid
+	VerifyType int    // 验证方式
+	Question   string // 验证问题
+	Answer     string // 验证答案
+	ExpireAt   int64  // 验证截止时间
+	Status     int    // 状态
+	FailCount  int    // 答错次数
+	db.BaseModel
+}
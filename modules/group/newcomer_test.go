@@ -0,0 +1,80 @@
+package group
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewcomerInProbation(t *testing.T) {
+	now := time.Now()
+	setting := &newcomerSettingModel{}
+	assert.False(t, setting.inProbation(now, now))
+
+	setting.Probation = 3600
+	assert.True(t, setting.inProbation(now.Add(-time.Minute), now))
+	assert.False(t, setting.inProbation(now.Add(-time.Hour), now))
+}
+
+func TestNewcomerRestricted(t *testing.T) {
+	assert.False(t, NewcomerRestricted(nil))
+	assert.False(t, NewcomerRestricted(map[string]interface{}{"type": json.Number("1"), "content": "大家好"}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{"type": json.Number("1"), "content": "看这里 https://example.com"}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{"type": json.Number("1"), "content": "www.example.com"}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{"type": json.Number("2")}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{"type": json.Number("7")}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{"type": float64(2)}))
+	assert.False(t, NewcomerRestricted(map[string]interface{}{"type": float64(1), "content": "大家好"}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{
+		"type":    json.Number("1"),
+		"content": "@所有人",
+		"mention": map[string]interface{}{"all": json.Number("1")},
+	}))
+	assert.True(t, NewcomerRestricted(map[string]interface{}{
+		"type":    json.Number("1"),
+		"content": "@开发组",
+		"mention": map[string]interface{}{"tags": []interface{}{"tag1"}},
+	}))
+	assert.False(t, NewcomerRestricted(map[string]interface{}{
+		"type":    json.Number("1"),
+		"content": "@u1",
+		"mention": map[string]interface{}{"uids": []interface{}{"u1"}},
+	}))
+}
+
+func TestNewcomerSettingReqCheck(t *testing.T) {
+	assert.NoError(t, newcomerSettingReq{}.check())
+	assert.NoError(t, newcomerSettingReq{Probation: 86400, VerifyType: NewcomerVerifyTypeCaptcha, VerifyTimeout: 300}.check())
+	assert.NoError(t, newcomerSettingReq{VerifyType: NewcomerVerifyTypeRules, Rules: "禁止发广告", VerifyTimeout: 300}.check())
+	assert.Error(t, newcomerSettingReq{Probation: -1}.check())
+	assert.Error(t, newcomerSettingReq{VerifyType: 3, VerifyTimeout: 300}.check())
+	assert.Error(t, newcomerSettingReq{VerifyType: NewcomerVerifyTypeRules, VerifyTimeout: 300}.check())
+	assert.Error(t, newcomerSettingReq{VerifyType: NewcomerVerifyTypeCaptcha}.check())
+	assert.Error(t, newcomerSettingReq{Rules: strings.Repeat("规", newcomerMaxRulesLength+1)}.check())
+}
+
+func TestNewMemberVerify(t *testing.T) {
+	now := time.Now()
+	setting := &newcomerSettingModel{GroupNo: "g1", VerifyType: NewcomerVerifyTypeCaptcha, VerifyTimeout: 300}
+	verify := setting.newMemberVerify("u1", now)
+	assert.Equal(t, "g1", verify.GroupNo)
+	assert.Equal(t, now.Unix()+300, verify.ExpireAt)
+	assert.Equal(t, MemberVerifyStatusPending, verify.Status)
+
+	var a, b int
+	_, err := fmt.Sscanf(verify.Question, "%d + %d = ?", &a, &b)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(a+b), verify.Answer)
+	assert.True(t, verify.check(" "+verify.Answer+" "))
+	assert.False(t, verify.check(""))
+
+	setting.VerifyType = NewcomerVerifyTypeRules
+	verify = setting.newMemberVerify("u1", now)
+	assert.Empty(t, verify.Question)
+	assert.True(t, verify.check(""))
+}
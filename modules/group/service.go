@@ -2,11 +2,15 @@ package group
 
 import (
 	"errors"
+	"strconv"
 	"time"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
 	"go.uber.org/zap"
 )
 
@@ -46,6 +50,12 @@ type IService interface {
 	GetMemberUIDsOfManager(groupNo string) ([]string, error)
 	// 是否是创建者或管理者
 	IsCreatorOrManager(groupNo string, uid string) (bool, error)
+	// 是否拥有指定的群管理权限（群主拥有全部权限）
+	HasPermission(groupNo string, uid string, permission ManagerPermission) (bool, error)
+	// 群成员是否是群所属社群的创建者或管理员（社群管理权限下放到所有子群）
+	IsCommunityAdmin(groupNo string, uid string) (bool, error)
+	// 成员是否处于新成员观察期（观察期内不能发送链接、媒体、名片及@所有人）
+	InProbation(groupNo string, uid string) (bool, error)
 	// 获取成员总数量和在线数量
 	// 第一个返回参数为成员总数量
 	// 第二个返回参数为在线数量
@@ -66,6 +76,12 @@ type IService interface {
 	GetMembersWithUIDAndGroupIds(uid string, groupNos []string) ([]*MemberResp, error)
 	// 查询一批群的管理员及群主
 	GetManagersWithGroupNos(groupNos []string) ([]*MemberResp, error)
+	// 获取一批成员标签下当前在群内的成员uid（用于@标签）
+	GetTagMemberUIDs(groupNo string, tagNos []string) ([]string, error)
+	// 禁言群成员到指定时间（到期后自动解除）
+	MuteMember(groupNo string, uid string, expirTime int64) error
+	// 封禁或解禁群
+	UpdateGroupStatus(groupNo string, status int, operator string, operatorName string) error
 }
 
 // Service Service
@@ -319,6 +335,39 @@ func (s *Service) IsCreatorOrManager(groupNo string, uid string) (bool, error) {
 	return s.db.QueryIsGroupManagerOrCreator(groupNo, uid)
 }
 
+// GetTagMemberUIDs 获取一批成员标签下当前在群内的成员uid
+func (s *Service) GetTagMemberUIDs(groupNo string, tagNos []string) ([]string, error) {
+	return s.db.queryTagMemberUIDs(groupNo, tagNos)
+}
+
+// HasPermission 是否拥有指定的群管理权限
+func (s *Service) HasPermission(groupNo string, uid string, permission ManagerPermission) (bool, error) {
+	return s.db.QueryHasPermission(groupNo, uid, permission)
+}
+
+// IsCommunityAdmin 群成员是否是群所属社群的创建者或管理员
+func (s *Service) IsCommunityAdmin(groupNo string, uid string) (bool, error) {
+	return s.db.QueryIsCommunityAdmin(groupNo, uid)
+}
+
+func (s *Service) InProbation(groupNo string, uid string) (bool, error) {
+	member, err := s.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		return false, err
+	}
+	if member == nil || member.Role != MemberRoleCommon || member.Robot == 1 {
+		return false, nil
+	}
+	setting, err := s.db.queryNewcomerSetting(groupNo)
+	if err != nil {
+		return false, err
+	}
+	if setting == nil {
+		return false, nil
+	}
+	return setting.inProbation(time.Time(member.CreatedAt), time.Now()), nil
+}
+
 func (s *Service) GetMemberTotalAndOnlineCount(groupNo string) (int, int, error) {
 	var onlineCount, memberCount int64
 	var err error
@@ -444,6 +493,7 @@ type MemberResp struct {
 	Name               string // 群成员名称
 	Remark             string // 成员备注
 	Role               int    // 成员角色
+	Permissions        int    // 管理员权限位
 	Version            int64
 	Vercode            string //验证码
 	InviteUID          string // 邀请人uid
@@ -460,6 +510,7 @@ func newMemberResp(m *MemberDetailModel) *MemberResp {
 		Name:               m.Name,
 		Remark:             m.Remark,
 		Role:               m.Role,
+		Permissions:        m.Permissions,
 		Version:            m.Version,
 		Vercode:            m.Vercode,
 		InviteUID:          m.InviteUID,
@@ -470,6 +521,11 @@ func newMemberResp(m *MemberDetailModel) *MemberResp {
 	}
 }
 
+// HasPermission 成员是否拥有指定的群管理权限
+func (m *MemberResp) HasPermission(permission ManagerPermission) bool {
+	return hasPermission(m.Role, m.Permissions, permission)
+}
+
 // SettingResp 群设置
 type SettingResp struct {
 	UID             string
@@ -512,7 +568,7 @@ type GroupResp struct {
 	Name                     string    `json:"name"`                        // 群名称
 	Remark                   string    `json:"remark"`                      // 群备注
 	Notice                   string    `json:"notice"`                      // 群公告
-	Mute                     int       `json:"mute"`                        // 免打扰
+	Mute                     int       `json:"mute"`                        // 免打扰 0.关闭 1.开启 2.仅@我时通知
 	Top                      int       `json:"top"`                         // 置顶
 	ShowNick                 int       `json:"show_nick"`                   // 显示昵称
 	Save                     int       `json:"save"`                        // 是否保存
@@ -534,6 +590,8 @@ type GroupResp struct {
 	Role                     int       `json:"role"`                        // 我在群聊里的角色
 	ForbiddenExpirTime       int64     `json:"forbidden_expir_time"`        // 我在此群的禁言过期时间
 	AllowMemberPinnedMessage int       `json:"allow_member_pinned_message"` //是否允许群成员置顶消息
+	CommunityNo              string    `json:"community_no"`                // 所属社群编号
+	CommunityName            string    `json:"community_name"`              // 所属社群名称
 	CreatedAt                string    `json:"created_at"`
 	UpdatedAt                string    `json:"updated_at"`
 	Version                  int64     `json:"version"` // 群数据版本
@@ -569,3 +627,111 @@ func (g *GroupResp) from(model *DetailModel) *GroupResp {
 		UpdatedAt:                model.UpdatedAt.String(),
 	}
 }
+
+// MuteMember 禁言群成员到指定时间，到期后由CheckForbiddenLoop解除
+func (s *Service) MuteMember(groupNo string, uid string, expirTime int64) error {
+	member, err := s.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		return errors.New("该成员不在群内")
+	}
+	if member.Role == MemberRoleCreator {
+		return errors.New("不能禁言群主")
+	}
+	member.Version = s.ctx.GenSeq(common.GroupMemberSeqKey)
+	member.ForbiddenExpirTime = expirTime
+	err = s.db.UpdateMember(member)
+	if err != nil {
+		return err
+	}
+	err = s.ctx.IMBlacklistAdd(config.ChannelBlacklistReq{
+		ChannelReq: config.ChannelReq{
+			ChannelID:   groupNo,
+			ChannelType: common.ChannelTypeGroup.Uint8(),
+		},
+		UIDs: []string{uid},
+	})
+	if err != nil {
+		return err
+	}
+	return s.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         common.CMDGroupMemberUpdate,
+		Param: map[string]interface{}{
+			"group_no": groupNo,
+			"uid":      uid,
+		},
+	})
+}
+
+// UpdateGroupStatus 封禁或解禁群
+func (s *Service) UpdateGroupStatus(groupNo string, status int, operator string, operatorName string) error {
+	if status != GroupStatusNormal && status != GroupStatusDisabled {
+		return errors.New("未知操作类型")
+	}
+	groupModel, err := s.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		return err
+	}
+	if groupModel == nil {
+		return errors.New("操作的群不存在")
+	}
+	if groupModel.Status == status {
+		return nil
+	}
+	ban := 0
+	if status == GroupStatusDisabled {
+		ban = 1
+	}
+	err = s.ctx.IMCreateOrUpdateChannelInfo(&config.ChannelInfoCreateReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		Ban:         ban,
+		Large:       groupModel.GroupType,
+	})
+	if err != nil {
+		return err
+	}
+	groupModel.Status = status
+	tx, err := s.ctx.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = s.db.UpdateTx(groupModel, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	eventID, err := s.ctx.EventBegin(&wkevent.Data{
+		Event: event.GroupUpdate,
+		Type:  wkevent.Message,
+		Data: &config.MsgGroupUpdateReq{
+			GroupNo:      groupNo,
+			Operator:     operator,
+			OperatorName: operatorName,
+			Attr:         common.GroupAttrKeyStatus,
+			Data: map[string]string{
+				"status": strconv.Itoa(status),
+			},
+		},
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		return err
+	}
+	s.ctx.EventCommit(eventID)
+	return nil
+}
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+-- 群邀请链接
+CREATE TABLE `group_invite_link` (
+  id               integer      not null primary key AUTO_INCREMENT,
+  link_no          VARCHAR(40)  not null default '' comment '链接唯一编号',
+  group_no         VARCHAR(40)  not null default '' comment '群唯一编号',
+  creator          VARCHAR(40)  not null default '' comment '创建者uid',
+  name             VARCHAR(100) not null default '' comment '链接名称',
+  expire_at        BIGINT       not null default 0  comment '过期时间（秒级时间戳） 0.永不过期',
+  max_uses         integer      not null default 0  comment '最大使用次数 0.不限制',
+  uses             integer      not null default 0  comment '已使用次数',
+  require_approval smallint     not null default 0  comment '是否需要管理员审核 0.否 1.是',
+  status           smallint     not null default 1  comment '状态 1.有效 0.已撤销',
+  created_at       timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at       timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_invite_link_no on `group_invite_link` (link_no);
+CREATE INDEX group_invite_link_group_no on `group_invite_link` (group_no);
+
+ALTER TABLE `group_invite` ADD COLUMN link_no VARCHAR(40) not null default '' COMMENT '通过邀请链接申请入群时的链接编号';
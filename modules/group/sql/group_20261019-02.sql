@@ -0,0 +1,5 @@
+-- +migrate Up
+
+ALTER TABLE `group_member` ADD COLUMN permissions integer not null default 0 COMMENT '管理员权限位 1.修改群资料 2.删除消息 4.禁言及移除成员 8.邀请成员 16.置顶消息 32.管理邀请链接 64.添加管理员';
+-- 已有管理员默认拥有全部权限
+UPDATE `group_member` SET permissions=127 WHERE role=2;
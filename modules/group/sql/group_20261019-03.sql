@@ -0,0 +1,29 @@
+-- +migrate Up
+
+-- 群公告
+CREATE TABLE `group_announcement` (
+  id              integer      not null primary key AUTO_INCREMENT,
+  announcement_no VARCHAR(40)  not null default '' comment '公告唯一编号',
+  group_no        VARCHAR(40)  not null default '' comment '群唯一编号',
+  author          VARCHAR(40)  not null default '' comment '发布者uid',
+  title           VARCHAR(100) not null default '' comment '标题',
+  content         TEXT                             comment '内容（markdown）',
+  pinned          smallint     not null default 0  comment '是否置顶 0.否 1.是',
+  require_confirm smallint     not null default 0  comment '是否需要群成员确认 0.否 1.是',
+  is_deleted      smallint     not null default 0  comment '是否已删除',
+  created_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_announcement_no on `group_announcement` (announcement_no);
+CREATE INDEX group_announcement_group_no on `group_announcement` (group_no);
+
+-- 群公告确认记录
+CREATE TABLE `group_announcement_ack` (
+  id              integer      not null primary key AUTO_INCREMENT,
+  announcement_no VARCHAR(40)  not null default '' comment '公告唯一编号',
+  group_no        VARCHAR(40)  not null default '' comment '群唯一编号',
+  uid             VARCHAR(40)  not null default '' comment '确认者uid',
+  created_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_announcement_ack_uid on `group_announcement_ack` (announcement_no, uid);
@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- 群防刷屏设置
+CREATE TABLE `group_flood_control` (
+  id              integer      not null primary key AUTO_INCREMENT,
+  group_no        VARCHAR(40)  not null default '' comment '群唯一编号',
+  slow_mode       integer      not null default 0  comment '慢速模式间隔（秒） 0.关闭',
+  burst_limit     integer      not null default 0  comment '突发窗口内最多发送的消息数 0.不限制',
+  burst_window    integer      not null default 0  comment '突发窗口时长（秒）',
+  mute_violations integer      not null default 0  comment '违规多少次后自动禁言 0.不自动禁言',
+  mute_duration   integer      not null default 0  comment '自动禁言时长（秒）',
+  operator        VARCHAR(40)  not null default '' comment '最后修改人uid',
+  created_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_flood_control_group_no on `group_flood_control` (group_no);
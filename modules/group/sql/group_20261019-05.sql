@@ -0,0 +1,31 @@
+-- +migrate Up
+
+-- 群新成员限制及入群验证设置
+CREATE TABLE `group_newcomer_setting` (
+  id              integer      not null primary key AUTO_INCREMENT,
+  group_no        VARCHAR(40)  not null default '' comment '群唯一编号',
+  probation       integer      not null default 0  comment '新成员观察期（秒），观察期内不能发送链接、图片视频文件、名片及@所有人 0.关闭',
+  verify_type     smallint     not null default 0  comment '入群验证方式 0.不验证 1.同意群规 2.回答验证问题',
+  rules           VARCHAR(2000) not null default '' comment '群规内容',
+  verify_timeout  integer      not null default 0  comment '验证超时时间（秒），超时未验证将被移出群聊',
+  operator        VARCHAR(40)  not null default '' comment '最后修改人uid',
+  created_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_newcomer_setting_group_no on `group_newcomer_setting` (group_no);
+
+-- 群成员入群验证
+CREATE TABLE `group_member_verify` (
+  id              integer      not null primary key AUTO_INCREMENT,
+  group_no        VARCHAR(40)  not null default '' comment '群唯一编号',
+  uid             VARCHAR(40)  not null default '' comment '成员uid',
+  verify_type     smallint     not null default 0  comment '验证方式 1.同意群规 2.回答验证问题',
+  question        VARCHAR(100) not null default '' comment '验证问题',
+  answer          VARCHAR(40)  not null default '' comment '验证答案',
+  expire_at       BIGINT       not null default 0  comment '验证截止时间（秒级时间戳）',
+  status          smallint     not null default 0  comment '状态 0.待验证 1.已通过 2.超时未通过',
+  created_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at      timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_member_verify_group_uid on `group_member_verify` (group_no, uid);
+CREATE INDEX group_member_verify_status_expire on `group_member_verify` (status, expire_at);
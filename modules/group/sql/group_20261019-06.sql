@@ -0,0 +1,19 @@
+-- +migrate Up
+
+-- 公开群目录
+CREATE TABLE `group_directory` (
+  id           integer      not null primary key AUTO_INCREMENT,
+  group_no     VARCHAR(40)  not null default '' comment '群唯一编号',
+  public       smallint     not null default 0  comment '是否公开到群目录 0.否 1.是',
+  description  VARCHAR(500) not null default '' comment '群简介',
+  tags         VARCHAR(200) not null default '' comment '群标签，多个以英文逗号分隔',
+  featured     smallint     not null default 0  comment '是否由后台推荐 0.否 1.是',
+  hidden       smallint     not null default 0  comment '是否被后台隐藏 0.否 1.是',
+  operator     VARCHAR(40)  not null default '' comment '最后修改人uid',
+  created_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_directory_group_no on `group_directory` (group_no);
+CREATE INDEX group_directory_public on `group_directory` (public, hidden);
+
+ALTER TABLE `group_invite` ADD COLUMN self_apply smallint not null default 0 COMMENT '是否为用户通过公开群目录主动申请入群 0.否 1.是';
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- 群定时全员禁言计划
+CREATE TABLE `group_mute_schedule` (
+  id                integer      not null primary key AUTO_INCREMENT,
+  schedule_no       VARCHAR(40)  not null default '' comment '计划唯一编号',
+  group_no          VARCHAR(40)  not null default '' comment '群唯一编号',
+  kind              smallint     not null default 0  comment '计划类型 1.每天重复 2.单次',
+  start_minute      integer      not null default 0  comment '每天开始时间（当天第几分钟）',
+  end_minute        integer      not null default 0  comment '每天结束时间（当天第几分钟），小于开始时间表示跨天',
+  weekdays          integer      not null default 0  comment '生效的星期（位掩码，bit0为周日） 0.每天',
+  start_at          BIGINT       not null default 0  comment '单次计划开始时间（秒级时间戳）',
+  end_at            BIGINT       not null default 0  comment '单次计划结束时间（秒级时间戳）',
+  timezone          VARCHAR(40)  not null default '' comment '时区，为空使用服务器时区',
+  remark            VARCHAR(100) not null default '' comment '备注',
+  enabled           smallint     not null default 1  comment '是否启用',
+  last_window_start BIGINT       not null default 0  comment '最近一次执行禁言的时间窗口开始时间',
+  muted             smallint     not null default 0  comment '当前全员禁言是否由此计划开启',
+  operator          VARCHAR(40)  not null default '' comment '最后修改人uid',
+  created_at        timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at        timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_mute_schedule_schedule_no on `group_mute_schedule` (schedule_no);
+CREATE INDEX group_mute_schedule_group_no on `group_mute_schedule` (group_no);
@@ -0,0 +1,42 @@
+-- +migrate Up
+
+-- 社群（包含多个群的上级组织）
+CREATE TABLE `community` (
+  id                    integer      not null primary key AUTO_INCREMENT,
+  community_no          VARCHAR(40)  not null default '' comment '社群唯一编号',
+  name                  VARCHAR(40)  not null default '' comment '社群名称',
+  description           VARCHAR(500) not null default '' comment '社群简介',
+  creator               VARCHAR(40)  not null default '' comment '创建者uid',
+  announcement_group_no VARCHAR(40)  not null default '' comment '公告群编号（全员禁言，仅管理员可发言）',
+  status                smallint     not null default 1  comment '状态 1.正常 2.已解散',
+  version               BIGINT       not null default 0  comment '数据版本',
+  created_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX community_community_no on `community` (community_no);
+
+-- 社群下的群（一个群只能属于一个社群）
+CREATE TABLE `community_group` (
+  id                    integer      not null primary key AUTO_INCREMENT,
+  community_no          VARCHAR(40)  not null default '' comment '社群编号',
+  group_no              VARCHAR(40)  not null default '' comment '群编号',
+  operator              VARCHAR(40)  not null default '' comment '添加人uid',
+  created_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX community_group_group_no on `community_group` (group_no);
+CREATE INDEX community_group_community_no on `community_group` (community_no);
+
+-- 社群成员角色及封禁（普通成员为各子群成员的并集，不在此表记录）
+CREATE TABLE `community_member` (
+  id                    integer      not null primary key AUTO_INCREMENT,
+  community_no          VARCHAR(40)  not null default '' comment '社群编号',
+  uid                   VARCHAR(40)  not null default '' comment '成员uid',
+  role                  smallint     not null default 0  comment '角色 0.普通成员 1.创建者 2.管理员',
+  status                smallint     not null default 0  comment '状态 0.正常 2.已封禁',
+  operator              VARCHAR(40)  not null default '' comment '最后操作人uid',
+  created_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX community_member_community_uid on `community_member` (community_no, uid);
+CREATE INDEX community_member_uid on `community_member` (uid);
@@ -0,0 +1,27 @@
+-- +migrate Up
+
+-- 群成员标签（用于@标签提醒一组成员）
+CREATE TABLE `group_member_tag` (
+  id                    integer      not null primary key AUTO_INCREMENT,
+  tag_no                VARCHAR(40)  not null default '' comment '标签唯一编号',
+  group_no              VARCHAR(40)  not null default '' comment '群编号',
+  name                  VARCHAR(40)  not null default '' comment '标签名称',
+  creator               VARCHAR(40)  not null default '' comment '创建者uid',
+  created_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_member_tag_tag_no on `group_member_tag` (tag_no);
+CREATE UNIQUE INDEX group_member_tag_group_name on `group_member_tag` (group_no, name);
+
+-- 群成员标签下的成员
+CREATE TABLE `group_member_tag_user` (
+  id                    integer      not null primary key AUTO_INCREMENT,
+  tag_no                VARCHAR(40)  not null default '' comment '标签编号',
+  group_no              VARCHAR(40)  not null default '' comment '群编号',
+  uid                   VARCHAR(40)  not null default '' comment '成员uid',
+  operator              VARCHAR(40)  not null default '' comment '操作人uid',
+  created_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '创建时间',
+  updated_at            timeStamp    not null DEFAULT CURRENT_TIMESTAMP comment '更新时间'
+);
+CREATE UNIQUE INDEX group_member_tag_user_tag_uid on `group_member_tag_user` (tag_no, uid);
+CREATE INDEX group_member_tag_user_group_uid on `group_member_tag_user` (group_no, uid);
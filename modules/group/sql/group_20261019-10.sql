@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `group_member_verify` ADD COLUMN fail_count smallint not null default 0 comment '验证问题答错次数，答错后会换一道新的问题';
@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- 群目录分类单独存储，不再修改群创建时系统设置的分类
+ALTER TABLE `group_directory` ADD COLUMN category VARCHAR(20) not null default '' comment '群目录分类（由群管理员设置）';
+-- 成员数量定时刷新，列表排序时不再实时统计
+ALTER TABLE `group_directory` ADD COLUMN member_count integer not null default 0 comment '成员数量';
+UPDATE `group_directory` SET member_count=(select count(*) from group_member where group_member.group_no=group_directory.group_no and group_member.is_deleted=0);
+CREATE INDEX group_directory_category on `group_directory` (category);
@@ -45,6 +45,11 @@ type Message struct {
 	messageUserExtraDB  *messageUserExtraDB
 	remindersDB         *remindersDB
 	pinnedDB            *pinnedDB
+	pollDB              *pollDB
+	remindLaterDB       *remindLaterDB
+	exportDB            *exportDB
+	mediaDB             *mediaDB
+	service             *Service
 	userService         user.IService
 	groupService        group.IService
 	commonService       commonapi.IService
@@ -64,6 +69,7 @@ func New(ctx *config.Context) *Message {
 		userDB:              user.NewDB(ctx),
 		messageExtraDB:      newMessageExtraDB(ctx),
 		groupService:        group.NewService(ctx),
+		service:             NewService(ctx),
 		memberReadedDB:      newMemberReadedDB(ctx),
 		conversationExtradb: newConversationExtraDB(ctx),
 		messageReactionDB:   newMessageReactionDB(ctx),
@@ -72,6 +78,10 @@ func New(ctx *config.Context) *Message {
 		deviceOffsetDB:      newDeviceOffsetDB(ctx.DB()),
 		remindersDB:         newRemindersDB(ctx),
 		pinnedDB:            newPinnedDB(ctx),
+		pollDB:              newPollDB(ctx),
+		remindLaterDB:       newRemindLaterDB(ctx),
+		exportDB:            newExportDB(ctx),
+		mediaDB:             newMediaDB(ctx),
 		userService:         user.NewService(ctx),
 		commonService:       commonapi.NewService(ctx),
 		fileService:         file.NewService(ctx),
@@ -87,26 +97,37 @@ func (m *Message) Route(r *wkhttp.WKHttp) {
 	message := r.Group("/v1/message", m.ctx.AuthMiddleware(r))
 	{
 
-		message.POST("/sync", m.sync)                             // 同步消息 (写模式才用到 TODO：此方法未来将弃用)
-		message.POST("/syncack/:last_message_seq", m.syncack)     // 同步消息回执 （写模式才用到 TODO：此方法未来将弃用）
-		message.DELETE("", m.delete)                              // 删除消息
-		message.DELETE("/mutual", m.mutualDelete)                 // 双向删除消息
-		message.POST("/revoke", m.revoke)                         // 撤回消息
-		message.POST("/offset", m.offset)                         // 清除某频道消息
-		message.PUT("/voicereaded", m.voiceReaded)                // 语音消息设置为已读
-		message.POST("/search", m.search)                         // 消息搜索
-		message.POST("/typing", m.typing)                         // 发送typing消息
-		message.POST("/channel/sync", m.syncChannelMessage)       // 同步频道消息
-		message.POST("/extra/sync", m.syncMessageExtra)           // 同步消息扩展
-		message.POST("/readed", m.messageReaded)                  // 消息已读
-		message.GET("/sync/sensitivewords", m.syncSensitiveWords) // 同步敏感词
-		message.POST("/edit", m.messageEdit)                      // 消息编辑
-		message.POST("/reminder/sync", m.reminderSync)            // 同步提醒
-		message.POST("/reminder/done", m.reminderDone)            // 提醒已处理完成
-		message.GET("/prohibit_words/sync", m.syncProhibitWords)  // 同步违禁词
-		message.POST("/pinned", m.pinnedMessage)                  // 置顶消息
-		message.POST("/pinned/sync", m.syncPinnedMessage)         // 同步置顶消息
-		message.POST("/pinned/clear", m.clearPinnedMessage)       // 删除所有置顶消息
+		message.POST("/sync", m.sync)                              // 同步消息 (写模式才用到 TODO：此方法未来将弃用)
+		message.POST("/syncack/:last_message_seq", m.syncack)      // 同步消息回执 （写模式才用到 TODO：此方法未来将弃用）
+		message.DELETE("", m.delete)                               // 删除消息
+		message.DELETE("/mutual", m.mutualDelete)                  // 双向删除消息
+		message.POST("/revoke", m.revoke)                          // 撤回消息
+		message.POST("/offset", m.offset)                          // 清除某频道消息
+		message.PUT("/voicereaded", m.voiceReaded)                 // 语音消息设置为已读
+		message.POST("/search", m.search)                          // 消息搜索
+		message.POST("/typing", m.typing)                          // 发送typing消息
+		message.POST("/channel/sync", m.syncChannelMessage)        // 同步频道消息
+		message.POST("/extra/sync", m.syncMessageExtra)            // 同步消息扩展
+		message.POST("/readed", m.messageReaded)                   // 消息已读
+		message.GET("/sync/sensitivewords", m.syncSensitiveWords)  // 同步敏感词
+		message.POST("/edit", m.messageEdit)                       // 消息编辑
+		message.POST("/reminder/sync", m.reminderSync)             // 同步提醒
+		message.POST("/reminder/done", m.reminderDone)             // 提醒已处理完成
+		message.POST("/reminder/later", m.remindLaterAdd)          // 设置稍后提醒
+		message.GET("/reminder/later", m.remindLaterList)          // 待提醒列表
+		message.DELETE("/reminder/later/:id", m.remindLaterCancel) // 取消稍后提醒
+		message.GET("/prohibit_words/sync", m.syncProhibitWords)   // 同步违禁词
+		message.POST("/pinned", m.pinnedMessage)                   // 置顶消息
+		message.POST("/pinned/sync", m.syncPinnedMessage)          // 同步置顶消息
+		message.POST("/pinned/clear", m.clearPinnedMessage)        // 删除所有置顶消息
+		message.POST("/poll", m.pollCreate)                        // 发起投票
+		message.GET("/poll/:poll_no", m.pollGet)                   // 投票详情
+		message.POST("/poll/:poll_no/vote", m.pollVote)            // 投票
+		message.POST("/poll/:poll_no/close", m.pollClose)          // 结束投票
+		message.POST("/export", m.exportCreate)                    // 导出聊天记录
+		message.GET("/export", m.exportList)                       // 我的导出任务
+		message.GET("/export/:export_no", m.exportGet)             // 导出任务状态
+		message.GET("/channel/media", m.mediaList)                 // 频道图片/视频、文件及链接列表
 	}
 	messages := r.Group("/v1/messages", m.ctx.AuthMiddleware(r))
 	{
@@ -124,10 +145,14 @@ func (m *Message) Route(r *wkhttp.WKHttp) {
 	}
 	msg := r.Group("/v1/message")
 	{
-		msg.POST("/send", m.sendMsg) // 代发消息
+		msg.POST("/send", m.sendMsg)                         // 代发消息
+		msg.GET("/export/download/:token", m.exportDownload) // 下载导出的聊天记录（有时效）
 	}
 	m.ctx.AddMessagesListener(m.listenerMessages) // 监听消息
 	m.syncMessageReadedCount()
+	m.ctx.Schedule(time.Minute, m.closeExpiredPolls)       // 定时结束过期投票
+	m.ctx.Schedule(time.Second*30, m.handleDueRemindLater) // 处理到期的稍后提醒
+	m.ctx.Schedule(time.Second*10, m.handlePendingExports) // 执行聊天记录导出任务
 }
 
 func (m *Message) sendMsg(c *wkhttp.Context) {
@@ -211,6 +236,10 @@ func (m *Message) sendMsg(c *wkhttp.Context) {
 			c.ResponseError(errors.New("未在群内"))
 			return
 		}
+		if err = m.checkNewcomerRestricted(req.ReceiveChannelID, uid, req.Payload); err != nil {
+			c.ResponseError(err)
+			return
+		}
 	}
 	err = m.sendMessage(req.ReceiveChannelID, req.ReceiveChannelType, uid, req.Payload)
 	if err != nil {
@@ -276,6 +305,15 @@ func (m *Message) messageEdit(c *wkhttp.Context) {
 		c.ResponseOK()
 		return
 	}
+	if req.ChannelType == common.ChannelTypeGroup.Uint8() {
+		err = m.checkNewcomerRestricted(req.ChannelID, c.GetLoginUID(), map[string]interface{}{
+			"content": contentEdit,
+		})
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
 
 	tx, err := m.db.session.Begin()
 	if err != nil {
@@ -589,8 +627,25 @@ func (m *Message) syncMessageExtra(c *wkhttp.Context) {
 	}
 	resps := make([]*messageExtraResp, 0, len(extraModels))
 	if len(extraModels) > 0 {
+		messageIDs := make([]string, 0, len(extraModels))
 		for _, extraModel := range extraModels {
-			resps = append(resps, newMessageExtraResp(extraModel))
+			messageIDs = append(messageIDs, extraModel.MessageID)
+		}
+		// 投票结果随消息扩展一起下发
+		polls, err := m.pollDB.queryWithMessageIDs(messageIDs)
+		if err != nil {
+			c.ResponseErrorf("查询投票失败！", err)
+			return
+		}
+		pollMap, err := m.getPollResps(polls, c.GetLoginUID())
+		if err != nil {
+			c.ResponseErrorf("查询投票结果失败！", err)
+			return
+		}
+		for _, extraModel := range extraModels {
+			extraResp := newMessageExtraResp(extraModel)
+			extraResp.Poll = pollMap[extraModel.MessageID]
+			resps = append(resps, extraResp)
 		}
 	}
 	c.Response(resps)
@@ -1054,7 +1109,7 @@ func (m *Message) mutualDelete(c *wkhttp.Context) {
 	}
 	isCanDelete := true
 	if req.ChannelType == common.ChannelTypeGroup.Uint8() {
-		isManager, err := m.groupService.IsCreatorOrManager(req.ChannelID, loginUID)
+		isManager, err := m.groupService.HasPermission(req.ChannelID, loginUID, group.ManagerPermissionDeleteMessage)
 		if err != nil {
 			m.Error("查询登录用户群内权限错误", zap.Error(err))
 			c.ResponseError(errors.New("查询登录用户群内权限错误"))
@@ -1314,7 +1369,7 @@ func (m *Message) hasRevokePermission(messageM *messageModel, loginUID string) (
 	if messageM.FromUID == loginUID { // 自己发的消息允许被撤回
 		return true, nil
 	}
-	if messageM.ChannelType == common.ChannelTypeGroup.Uint8() { // 管理者或创建者可以撤回其他成员的消息
+	if messageM.ChannelType == common.ChannelTypeGroup.Uint8() { // 管理者、创建者或社群管理员可以撤回其他成员的消息
 		loginMember, err := m.groupService.GetMember(messageM.ChannelID, loginUID)
 		if err != nil {
 			return false, err
@@ -1326,15 +1381,14 @@ func (m *Message) hasRevokePermission(messageM *messageModel, loginUID string) (
 		if err != nil {
 			return false, err
 		}
-		if fromMember == nil && loginMember.Role != int(common.GroupMemberRoleNormal) {
-			return true, nil
+		if fromMember == nil { // 发送者已不在群内
+			return m.groupService.HasPermission(messageM.ChannelID, loginUID, group.ManagerPermissionDeleteMessage)
 		}
-		if fromMember.Role == int(common.GroupMemberRoleCreater) || loginMember.Role == int(common.GroupMemberRoleNormal) {
-			return false, nil
-		}
-		if loginMember.Role == int(common.GroupMemberRoleCreater) || (loginMember.Role == int(common.GroupMemberRoleManager) && fromMember.Role == int(common.GroupMemberRoleNormal)) {
-			return true, nil
+		communityAdmin, err := m.groupService.IsCommunityAdmin(messageM.ChannelID, loginUID)
+		if err != nil {
+			return false, err
 		}
+		return group.CanManageMember(loginMember.Role, loginMember.Permissions, communityAdmin, fromMember.Role, group.ManagerPermissionDeleteMessage), nil
 
 	}
 
@@ -1352,6 +1406,9 @@ func (m *Message) cancelMentionReminderIfNeed(message *messageModel) {
 		if payloadMap != nil {
 			if m.hasMention(payloadMap) {
 				all, uids := m.getMention(payloadMap)
+				if !all && message.ChannelType == common.ChannelTypeGroup.Uint8() {
+					uids = m.appendTagMentionUIDs(message.ChannelID, message.FromUID, payloadMap, uids)
+				}
 				if all {
 					version := m.ctx.GenSeq(common.RemindersKey)
 					err := m.remindersDB.deleteWithChannel(message.ChannelID, message.ChannelType, message.MessageID, version)
@@ -2062,6 +2119,7 @@ type messageExtraResp struct {
 	IsPinned        int                    `json:"is_pinned,omitempty"`         // 是否置顶
 	ContentEdit     map[string]interface{} `json:"content_edit,omitempty"`      // 编辑后的正文
 	EditedAt        int                    `json:"edited_at,omitempty"`         // 编辑时间 例如 12:23
+	Poll            *pollResp              `json:"poll,omitempty"`              // 投票数据
 	ExtraVersion    int64                  `json:"extra_version"`               // 数据版本
 }
 
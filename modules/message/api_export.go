@@ -0,0 +1,439 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/file"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 创建聊天记录导出任务
+func (m *Message) exportCreate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req exportReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	channelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		channelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
+	} else {
+		exist, err := m.groupService.ExistMember(req.ChannelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群成员错误", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是群成员错误"))
+			return
+		}
+		if !exist {
+			c.ResponseError(errors.New("不是群成员不能导出聊天记录"))
+			return
+		}
+	}
+	count, err := m.exportDB.queryUnfinishedCount(loginUID)
+	if err != nil {
+		m.Error("查询未完成的导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("查询未完成的导出任务错误"))
+		return
+	}
+	if count > 0 {
+		c.ResponseError(errors.New("已有导出任务正在进行中，请稍后再试"))
+		return
+	}
+	exportNo := util.GenerUUID()
+	err = m.exportDB.insert(&exportModel{
+		ExportNo:    exportNo,
+		Requester:   loginUID,
+		ViewUID:     loginUID,
+		ChannelID:   channelID,
+		ChannelType: req.ChannelType,
+		StartAt:     req.StartAt,
+		EndAt:       req.EndAt,
+		Status:      exportStatusPending,
+	})
+	if err != nil {
+		m.Error("新增导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("新增导出任务错误"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"export_no": exportNo,
+	})
+}
+
+// 我的导出任务
+func (m *Message) exportList(c *wkhttp.Context) {
+	list, err := m.exportDB.queryWithRequester(c.GetLoginUID(), 20)
+	if err != nil {
+		m.Error("查询导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务错误"))
+		return
+	}
+	resps := make([]*exportResp, 0, len(list))
+	for _, model := range list {
+		resps = append(resps, newExportResp(model, c.GetLoginUID(), ""))
+	}
+	c.Response(resps)
+}
+
+// 导出任务状态
+func (m *Message) exportGet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	model, err := m.exportDB.queryWithExportNo(c.Param("export_no"))
+	if err != nil {
+		m.Error("查询导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务错误"))
+		return
+	}
+	if model == nil || model.Requester != loginUID || model.IsManager == 1 {
+		c.ResponseError(errors.New("导出任务不存在"))
+		return
+	}
+	downloadURL, err := createExportDownloadURL(m.ctx, model)
+	if err != nil {
+		m.Error("生成下载链接错误", zap.Error(err))
+		c.ResponseError(errors.New("生成下载链接错误"))
+		return
+	}
+	c.Response(newExportResp(model, loginUID, downloadURL))
+}
+
+// 下载导出文件（链接有效期见exportDownloadExpire）
+func (m *Message) exportDownload(c *wkhttp.Context) {
+	exportNo, err := m.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", exportDownloadCachePrefix, c.Param("token")))
+	if err != nil {
+		m.Error("获取下载token错误", zap.Error(err))
+		c.ResponseError(errors.New("获取下载token错误"))
+		return
+	}
+	if exportNo == "" {
+		c.ResponseError(errors.New("下载链接已失效"))
+		return
+	}
+	model, err := m.exportDB.queryWithExportNo(exportNo)
+	if err != nil {
+		m.Error("查询导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务错误"))
+		return
+	}
+	if model == nil || model.Status != exportStatusSuccess {
+		c.ResponseError(errors.New("导出文件不存在"))
+		return
+	}
+	downloadURL, err := m.fileService.DownloadURL(fmt.Sprintf("/%s", model.Path), fmt.Sprintf("%s.zip", model.ExportNo))
+	if err != nil {
+		m.Error("获取文件下载地址错误", zap.Error(err))
+		c.ResponseError(errors.New("获取文件下载地址错误"))
+		return
+	}
+	c.Redirect(http.StatusFound, downloadURL)
+}
+
+// 执行等待中的导出任务
+func (m *Message) handlePendingExports() {
+	resetCount, err := m.exportDB.resetStaleProcessing(time.Now().Add(-exportProcessingTimeout))
+	if err != nil {
+		m.Error("重置超时的导出任务错误", zap.Error(err))
+	} else if resetCount > 0 {
+		m.Warn("重置超时的导出任务", zap.Int64("count", resetCount))
+	}
+	list, err := m.exportDB.queryPending(10)
+	if err != nil {
+		m.Error("查询等待中的导出任务错误", zap.Error(err))
+		return
+	}
+	for _, model := range list {
+		ok, err := m.exportDB.updateProcessing(model.ExportNo)
+		if err != nil {
+			m.Error("修改导出任务状态错误", zap.Error(err), zap.String("exportNo", model.ExportNo))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		path, count, err := m.runExport(model)
+		model.FinishedAt = time.Now().Unix()
+		if err != nil {
+			m.Error("导出聊天记录失败！", zap.Error(err), zap.String("exportNo", model.ExportNo))
+			model.Status = exportStatusFail
+			model.Error = exportErrorText(err)
+		} else {
+			model.Status = exportStatusSuccess
+			model.Path = path
+			model.MessageCount = count
+		}
+		if err = m.exportDB.updateFinished(model); err != nil {
+			m.Error("修改导出任务结果错误", zap.Error(err), zap.String("exportNo", model.ExportNo))
+		}
+	}
+}
+
+// exportErrorText 失败原因（超出字段长度时截断）
+func exportErrorText(err error) string {
+	runes := []rune(err.Error())
+	if len(runes) > exportMaxErrorLength {
+		return string(runes[:exportMaxErrorLength])
+	}
+	return string(runes)
+}
+
+func (m *Message) runExport(model *exportModel) (string, int, error) {
+	var minMessageSeq uint32 = 0
+	var deleteUserExtra bool
+	if model.ViewUID != "" {
+		// 清空记录的偏移以会话对方uid为频道ID存储
+		channelID := model.ChannelID
+		if model.ChannelType == common.ChannelTypePerson.Uint8() {
+			channelID = common.GetToChannelIDWithFakeChannelID(model.ChannelID, model.ViewUID)
+		}
+		var err error
+		minMessageSeq, err = m.getVisibleMinMessageSeq(model.ViewUID, channelID, model.ChannelType, model.ChannelID)
+		if err != nil {
+			return "", 0, err
+		}
+		deleteUserExtra = true
+	}
+	archive := &exportArchive{
+		ChannelID:   model.ChannelID,
+		ChannelType: model.ChannelType,
+		ChannelName: m.exportChannelName(model),
+		StartAt:     model.StartAt,
+		EndAt:       model.EndAt,
+		ExportedAt:  time.Now().Unix(),
+		Messages:    make([]*exportMessage, 0),
+	}
+	baseURL := m.ctx.GetConfig().External.APIBaseURL
+	nameMap := map[string]string{}
+	for len(archive.Messages) < exportMaxMessageCount {
+		messages, err := m.exportDB.queryMessages(model.ChannelID, model.ChannelType, model.StartAt, model.EndAt, minMessageSeq, 500)
+		if err != nil {
+			return "", 0, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		minMessageSeq = messages[len(messages)-1].MessageSeq
+
+		messageIDs := make([]string, 0, len(messages))
+		uids := make([]string, 0)
+		for _, message := range messages {
+			messageIDs = append(messageIDs, strconv.FormatInt(message.MessageID, 10))
+			if _, ok := nameMap[message.FromUID]; !ok {
+				nameMap[message.FromUID] = ""
+				uids = append(uids, message.FromUID)
+			}
+		}
+		if len(uids) > 0 {
+			users, err := m.userService.GetUsers(uids)
+			if err != nil {
+				return "", 0, err
+			}
+			for _, u := range users {
+				nameMap[u.UID] = u.Name
+			}
+		}
+		extras, err := m.messageExtraDB.queryWithMessageIDs(messageIDs)
+		if err != nil {
+			return "", 0, err
+		}
+		extraMap := map[string]*messageExtraModel{}
+		for _, extra := range extras {
+			extraMap[extra.MessageID] = extra
+		}
+		userDeletedMap := map[string]bool{}
+		if deleteUserExtra {
+			userExtras, err := m.messageUserExtraDB.queryWithMessageIDsAndUID(messageIDs, model.ViewUID)
+			if err != nil {
+				return "", 0, err
+			}
+			for _, userExtra := range userExtras {
+				if userExtra.MessageIsDeleted == 1 {
+					userDeletedMap[userExtra.MessageID] = true
+				}
+			}
+		}
+		reactions, err := m.messageReactionDB.queryWithMessageIDs(messageIDs)
+		if err != nil {
+			return "", 0, err
+		}
+		reactionMap := map[string][]*exportReaction{}
+		for _, reaction := range reactions {
+			if reaction.IsDeleted == 1 {
+				continue
+			}
+			reactionMap[reaction.MessageID] = append(reactionMap[reaction.MessageID], &exportReaction{
+				Emoji: reaction.Emoji,
+				UID:   reaction.UID,
+				Name:  reaction.Name,
+			})
+		}
+
+		for _, message := range messages {
+			messageIDStr := strconv.FormatInt(message.MessageID, 10)
+			extra := extraMap[messageIDStr]
+			if message.IsDeleted == 1 || userDeletedMap[messageIDStr] || (extra != nil && extra.IsDeleted == 1) {
+				continue
+			}
+			exportMsg := &exportMessage{
+				MessageID:  messageIDStr,
+				MessageSeq: message.MessageSeq,
+				FromUID:    message.FromUID,
+				FromName:   nameMap[message.FromUID],
+				Timestamp:  message.Timestamp,
+				Reactions:  reactionMap[messageIDStr],
+			}
+			if extra != nil && extra.Revoke == 1 {
+				exportMsg.Revoked = true
+				archive.Messages = append(archive.Messages, exportMsg)
+				continue
+			}
+			if message.Signal == 1 {
+				exportMsg.Content = "[加密消息]"
+				archive.Messages = append(archive.Messages, exportMsg)
+				continue
+			}
+			payload := message.Payload
+			if extra != nil && extra.ContentEdit.String != "" {
+				payload = []byte(extra.ContentEdit.String)
+				exportMsg.Edited = true
+				exportMsg.EditedAt = extra.EditedAt
+			}
+			var payloadMap map[string]interface{}
+			if err := util.ReadJsonByByte(payload, &payloadMap); err != nil {
+				m.Warn("负荷数据不是json格式！", zap.Error(err), zap.String("messageID", messageIDStr))
+				continue
+			}
+			if m.contentType(payloadMap) == common.CMD.Int() {
+				continue
+			}
+			exportMsg.Payload = payloadMap
+			exportMsg.ContentType, exportMsg.Content, exportMsg.Media = parseExportContent(payloadMap, baseURL)
+			archive.Messages = append(archive.Messages, exportMsg)
+		}
+	}
+	data, err := renderExportZip(archive)
+	if err != nil {
+		return "", 0, err
+	}
+	// 路径包含随机编号，只能通过有时效的下载链接获取
+	path := fmt.Sprintf("%s/%s/%s.zip", file.TypeExport, model.Requester, util.GenerUUID())
+	_, err = m.fileService.UploadFile(path, "application/zip", func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return path, len(archive.Messages), nil
+}
+
+func (m *Message) exportChannelName(model *exportModel) string {
+	if model.ChannelType == common.ChannelTypeGroup.Uint8() {
+		groupResp, err := m.groupService.GetGroupDetail(model.ChannelID, model.ViewUID)
+		if err != nil || groupResp == nil {
+			return model.ChannelID
+		}
+		return groupResp.Name
+	}
+	uids := strings.Split(model.ChannelID, "@")
+	users, err := m.userService.GetUsers(uids)
+	if err != nil || len(users) == 0 {
+		return model.ChannelID
+	}
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	return strings.Join(names, " 与 ")
+}
+
+// 生成有时效的下载链接（任务未成功时返回空）
+func createExportDownloadURL(ctx *config.Context, model *exportModel) (string, error) {
+	if model.Status != exportStatusSuccess {
+		return "", nil
+	}
+	token := util.GenerUUID()
+	err := ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", exportDownloadCachePrefix, token), model.ExportNo, exportDownloadExpire)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/message/export/download/%s", ctx.GetConfig().External.APIBaseURL, token), nil
+}
+
+type exportReq struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	StartAt     int64  `json:"start_at"` // 开始时间（10位时间戳）
+	EndAt       int64  `json:"end_at"`   // 结束时间（10位时间戳）
+}
+
+func (r exportReq) check() error {
+	if strings.TrimSpace(r.ChannelID) == "" {
+		return errors.New("频道ID不能为空")
+	}
+	if r.ChannelType != common.ChannelTypePerson.Uint8() && r.ChannelType != common.ChannelTypeGroup.Uint8() {
+		return errors.New("频道类型不支持")
+	}
+	if r.StartAt <= 0 || r.EndAt <= 0 || r.StartAt > r.EndAt {
+		return errors.New("时间范围不合法")
+	}
+	if r.EndAt-r.StartAt > int64(exportMaxDays*24*60*60) {
+		return fmt.Errorf("时间范围不能超过%d天", exportMaxDays)
+	}
+	return nil
+}
+
+type exportResp struct {
+	ExportNo       string `json:"export_no"`
+	ChannelID      string `json:"channel_id"`
+	ChannelType    uint8  `json:"channel_type"`
+	StartAt        int64  `json:"start_at"`
+	EndAt          int64  `json:"end_at"`
+	Status         int    `json:"status"` // 0.等待导出 1.导出中 2.导出成功 3.导出失败
+	MessageCount   int    `json:"message_count"`
+	Error          string `json:"error,omitempty"`
+	FinishedAt     int64  `json:"finished_at"`
+	DownloadURL    string `json:"download_url,omitempty"`
+	DownloadExpire int64  `json:"download_expire,omitempty"` // 下载链接过期时间
+	CreatedAt      string `json:"created_at"`
+}
+
+// loginUID不为空时单聊频道转换为对方uid
+func newExportResp(m *exportModel, loginUID string, downloadURL string) *exportResp {
+	channelID := m.ChannelID
+	if loginUID != "" && m.ChannelType == common.ChannelTypePerson.Uint8() {
+		channelID = common.GetToChannelIDWithFakeChannelID(m.ChannelID, loginUID)
+	}
+	resp := &exportResp{
+		ExportNo:     m.ExportNo,
+		ChannelID:    channelID,
+		ChannelType:  m.ChannelType,
+		StartAt:      m.StartAt,
+		EndAt:        m.EndAt,
+		Status:       m.Status,
+		MessageCount: m.MessageCount,
+		Error:        m.Error,
+		FinishedAt:   m.FinishedAt,
+		DownloadURL:  downloadURL,
+		CreatedAt:    m.CreatedAt.String(),
+	}
+	if downloadURL != "" {
+		resp.DownloadExpire = time.Now().Add(exportDownloadExpire).Unix()
+	}
+	return resp
+}
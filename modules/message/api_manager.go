@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
@@ -29,6 +30,7 @@ type Manager struct {
 	groupService group.IService
 	managerDB    *managerDB
 	pinnedDB     *pinnedDB
+	exportDB     *exportDB
 }
 
 // NewManager NewManager
@@ -40,12 +42,13 @@ func NewManager(ctx *config.Context) *Manager {
 		groupService: group.NewService(ctx),
 		managerDB:    newManagerDB(ctx),
 		pinnedDB:     newPinnedDB(ctx),
+		exportDB:     newExportDB(ctx),
 	}
 }
 
 // Route 路由配置
 func (m *Manager) Route(r *wkhttp.WKHttp) {
-	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r))
+	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r), audit.Middleware(m.ctx))
 	{
 		auth.POST("/message/send", m.sendMsg)                         // 发送消息
 		auth.POST("message/sendfriends", m.sendMsgToFriends)          // 给某个用户代发消息
@@ -57,6 +60,9 @@ func (m *Manager) Route(r *wkhttp.WKHttp) {
 		auth.GET("/message/prohibit_words", m.prohibitWords)          // 查询违禁词
 		auth.DELETE("/message/prohibit_words", m.deleteProhibitWords) // 删除违禁词
 		auth.DELETE("/message", m.delete)                             // 删除消息
+		auth.POST("/message/export", m.exportCreate)                  // 导出聊天记录
+		auth.GET("/message/export", m.exportList)                     // 导出任务列表
+		auth.GET("/message/export/:export_no", m.exportGet)           // 导出任务状态
 	}
 }
 func (m *Manager) sendMsgToFriends(c *wkhttp.Context) {
@@ -239,6 +245,11 @@ func (m *Manager) delete(c *wkhttp.Context) {
 	if eventID > 0 {
 		m.ctx.EventCommit(eventID)
 	}
+	audit.Record(c, "message.delete", req.ChannelID, nil, map[string]interface{}{
+		"channel_type": req.ChannelType,
+		"from_uid":     req.FromUID,
+		"message_ids":  msgIds,
+	})
 	if req.ChannelType == common.ChannelTypePerson.Uint8() {
 		err = m.ctx.SendCMD(config.MsgCMDReq{
 			NoPersist:   false,
@@ -719,6 +730,10 @@ func (m *Manager) sendMsgToAllUsers(c *wkhttp.Context) {
 		uids = append(uids, tempUserList)
 	}
 	go m.sendMessageBatch(uids, req.Content)
+	audit.Record(c, "message.send_all", "", nil, map[string]interface{}{
+		"content":    req.Content,
+		"user_count": len(userList),
+	})
 	c.ResponseOK()
 }
 func (m *Manager) sendMessageBatch(uids [][]string, content string) error {
@@ -931,3 +946,96 @@ type prohibitWordsVO struct {
 	Version   int64  `json:"version"`    // 版本
 	CreatedAt string `json:"created_at"` // 时间
 }
+
+// 导出聊天记录（完整导出，不受用户清空和删除影响）
+func (m *Manager) exportCreate(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		exportReq
+		UID   string `json:"uid"`   // 单聊时的一方
+		ToUID string `json:"touid"` // 单聊时的另一方
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		if strings.TrimSpace(req.UID) == "" || strings.TrimSpace(req.ToUID) == "" {
+			c.ResponseError(errors.New("uid不能为空"))
+			return
+		}
+		req.ChannelID = common.GetFakeChannelIDWith(req.UID, req.ToUID)
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	exportNo := util.GenerUUID()
+	err = m.exportDB.insert(&exportModel{
+		ExportNo:    exportNo,
+		Requester:   c.GetLoginUID(),
+		IsManager:   1,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		StartAt:     req.StartAt,
+		EndAt:       req.EndAt,
+		Status:      exportStatusPending,
+	})
+	if err != nil {
+		m.Error("新增导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("新增导出任务错误"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"export_no": exportNo,
+	})
+}
+
+func (m *Manager) exportList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	list, err := m.exportDB.queryWithRequester(c.GetLoginUID(), 50)
+	if err != nil {
+		m.Error("查询导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务错误"))
+		return
+	}
+	resps := make([]*exportResp, 0, len(list))
+	for _, model := range list {
+		resps = append(resps, newExportResp(model, "", ""))
+	}
+	c.Response(resps)
+}
+
+func (m *Manager) exportGet(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := m.exportDB.queryWithExportNo(c.Param("export_no"))
+	if err != nil {
+		m.Error("查询导出任务错误", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务错误"))
+		return
+	}
+	if model == nil || model.IsManager == 0 {
+		c.ResponseError(errors.New("导出任务不存在"))
+		return
+	}
+	downloadURL, err := createExportDownloadURL(m.ctx, model)
+	if err != nil {
+		m.Error("生成下载链接错误", zap.Error(err))
+		c.ResponseError(errors.New("生成下载链接错误"))
+		return
+	}
+	c.Response(newExportResp(model, "", downloadURL))
+}
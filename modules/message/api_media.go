@@ -0,0 +1,162 @@
+package message
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	mediaTypePhoto = 1 // 图片/视频
+	mediaTypeFile  = 2 // 文件
+	mediaTypeLink  = 3 // 链接
+)
+
+// 频道内的图片/视频、文件及链接列表
+func (m *Message) mediaList(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	channelID := c.Query("channel_id")
+	channelTypeI64, _ := strconv.ParseInt(c.Query("channel_type"), 10, 64)
+	channelType := uint8(channelTypeI64)
+	mediaType, _ := strconv.Atoi(c.Query("media_type"))
+	if strings.TrimSpace(channelID) == "" {
+		c.ResponseError(errors.New("频道ID不能为空"))
+		return
+	}
+	if channelType != common.ChannelTypePerson.Uint8() && channelType != common.ChannelTypeGroup.Uint8() {
+		c.ResponseError(errors.New("不支持的频道类型"))
+		return
+	}
+	if mediaType != mediaTypePhoto && mediaType != mediaTypeFile && mediaType != mediaTypeLink {
+		c.ResponseError(errors.New("媒体类型错误"))
+		return
+	}
+	fakeChannelID := channelID
+	if channelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
+	} else {
+		exist, err := m.groupService.ExistMember(channelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群成员错误", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是群成员错误"))
+			return
+		}
+		if !exist {
+			c.ResponseError(errors.New("不是群成员不能查看"))
+			return
+		}
+	}
+	minMessageSeq, err := m.getVisibleMinMessageSeq(loginUID, channelID, channelType, fakeChannelID)
+	if err != nil {
+		m.Error("查询频道消息偏移错误", zap.Error(err))
+		c.ResponseError(errors.New("查询频道消息偏移错误"))
+		return
+	}
+	filter := &mediaFilter{
+		LoginUID:      loginUID,
+		ChannelID:     fakeChannelID,
+		ChannelType:   channelType,
+		MediaType:     mediaType,
+		MinMessageSeq: minMessageSeq,
+		FromUID:       c.Query("from_uid"),
+		Keyword:       strings.TrimSpace(c.Query("keyword")),
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := m.mediaDB.queryMedias(filter, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询频道媒体错误", zap.Error(err))
+		c.ResponseError(errors.New("查询频道媒体错误"))
+		return
+	}
+	count, err := m.mediaDB.queryMediaCount(filter)
+	if err != nil {
+		m.Error("查询频道媒体数量错误", zap.Error(err))
+		c.ResponseError(errors.New("查询频道媒体数量错误"))
+		return
+	}
+	nameMap := map[string]string{}
+	uids := make([]string, 0)
+	for _, model := range models {
+		if _, ok := nameMap[model.FromUID]; !ok {
+			nameMap[model.FromUID] = ""
+			uids = append(uids, model.FromUID)
+		}
+	}
+	if len(uids) > 0 {
+		users, err := m.userService.GetUsers(uids)
+		if err != nil {
+			m.Error("查询用户信息错误", zap.Error(err))
+			c.ResponseError(errors.New("查询用户信息错误"))
+			return
+		}
+		for _, u := range users {
+			nameMap[u.UID] = u.Name
+		}
+	}
+	list := make([]*mediaResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newMediaResp(model, channelID, nameMap[model.FromUID]))
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+// getVisibleMinMessageSeq 获取用户在频道内可见消息的起始序号（个人清空记录、频道清空记录及新成员不可查看的历史消息）
+func (m *Message) getVisibleMinMessageSeq(loginUID string, channelID string, channelType uint8, fakeChannelID string) (uint32, error) {
+	var minMessageSeq uint32 = 0
+	channelOffsetM, err := m.channelOffsetDB.queryWithUIDAndChannel(loginUID, channelID, channelType)
+	if err != nil {
+		return 0, err
+	}
+	if channelOffsetM != nil {
+		minMessageSeq = channelOffsetM.MessageSeq
+	}
+	channelSettings, err := m.channelService.GetChannelSettings([]string{fakeChannelID})
+	if err != nil {
+		return 0, err
+	}
+	if len(channelSettings) > 0 && channelSettings[0].OffsetMessageSeq > minMessageSeq {
+		minMessageSeq = channelSettings[0].OffsetMessageSeq
+	}
+	return minMessageSeq, nil
+}
+
+type mediaResp struct {
+	MessageID   string `json:"message_id"`
+	MessageSeq  uint32 `json:"message_seq"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	FromUID     string `json:"from_uid"`     // 发送者uid
+	FromName    string `json:"from_name"`    // 发送者名称
+	MediaType   int    `json:"media_type"`   // 媒体类型 1.图片/视频 2.文件 3.链接
+	ContentType int    `json:"content_type"` // 消息正文类型
+	Name        string `json:"name"`         // 文件名或链接
+	Size        int64  `json:"size"`         // 文件大小（字节）
+	URL         string `json:"url"`          // 文件或链接地址
+	Cover       string `json:"cover"`        // 视频封面
+	Timestamp   int32  `json:"timestamp"`    // 消息时间
+}
+
+func newMediaResp(m *mediaModel, channelID string, fromName string) *mediaResp {
+	return &mediaResp{
+		MessageID:   m.MessageID,
+		MessageSeq:  m.MessageSeq,
+		ChannelID:   channelID,
+		ChannelType: m.ChannelType,
+		FromUID:     m.FromUID,
+		FromName:    fromName,
+		MediaType:   m.MediaType,
+		ContentType: m.ContentType,
+		Name:        m.Name,
+		Size:        m.Size,
+		URL:         m.URL,
+		Cover:       m.Cover,
+		Timestamp:   m.Timestamp,
+	}
+}
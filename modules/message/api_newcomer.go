@@ -0,0 +1,79 @@
+package message
+
+import (
+	"errors"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"go.uber.org/zap"
+)
+
+var errNewcomerRestricted = errors.New("新成员观察期内不能发送链接、图片、语音、视频、文件、名片或@所有人、@标签")
+
+// checkNewcomerRestricted 发送前校验观察期内的新成员是否在发送受限消息
+func (m *Message) checkNewcomerRestricted(groupNo string, fromUID string, payloadMap map[string]interface{}) error {
+	if !group.NewcomerRestricted(payloadMap) {
+		return nil
+	}
+	inProbation, err := m.groupService.InProbation(groupNo, fromUID)
+	if err != nil {
+		m.Error("查询成员是否处于观察期失败！", zap.Error(err), zap.String("groupNo", groupNo), zap.String("uid", fromUID))
+		return errors.New("查询成员是否处于观察期失败！")
+	}
+	if inProbation {
+		return errNewcomerRestricted
+	}
+	return nil
+}
+
+// 撤回观察期内新成员发送的受限消息（客户端直接发送到IM的消息只能在送达后撤回），返回未被撤回的消息
+func (m *Message) revokeNewcomerRestrictedMessages(messages []*config.MessageResp) []*config.MessageResp {
+	allowMessages := make([]*config.MessageResp, 0, len(messages))
+	for _, message := range messages {
+		if message.ChannelType != common.ChannelTypeGroup.Uint8() || message.FromUID == "" || message.FromUID == m.ctx.GetConfig().Account.SystemUID {
+			allowMessages = append(allowMessages, message)
+			continue
+		}
+		payloadMap, err := message.GetPayloadMap()
+		if err != nil || payloadMap == nil || !group.NewcomerRestricted(payloadMap) {
+			allowMessages = append(allowMessages, message)
+			continue
+		}
+		inProbation, err := m.groupService.InProbation(message.ChannelID, message.FromUID)
+		if err != nil {
+			m.Warn("查询成员是否处于观察期失败！", zap.Error(err), zap.String("groupNo", message.ChannelID), zap.String("uid", message.FromUID))
+			allowMessages = append(allowMessages, message)
+			continue
+		}
+		if !inProbation {
+			allowMessages = append(allowMessages, message)
+			continue
+		}
+		err = m.revokeNewcomerMessage(message)
+		if err != nil {
+			m.Warn("撤回观察期成员消息失败！", zap.Error(err), zap.Int64("messageID", message.MessageID))
+			allowMessages = append(allowMessages, message)
+		}
+	}
+	return allowMessages
+}
+
+func (m *Message) revokeNewcomerMessage(message *config.MessageResp) error {
+	systemUID := m.ctx.GetConfig().Account.SystemUID
+	err := m.service.revokeWithSystem(message.ChannelID, message.ChannelType, message.ChannelID, systemUID, []*config.MessageResp{message})
+	if err != nil {
+		return err
+	}
+	return m.ctx.SendMessage(&config.MsgSendReq{
+		FromUID:     systemUID,
+		ChannelID:   message.ChannelID,
+		ChannelType: message.ChannelType,
+		Subscribers: []string{message.FromUID},
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"type":    common.Tip,
+			"content": errNewcomerRestricted.Error(),
+		})),
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
@@ -58,7 +59,7 @@ func (m *Message) pinnedMessage(c *wkhttp.Context) {
 			c.ResponseError(errors.New("群不存在或已删除"))
 			return
 		}
-		isCreatorOrManager, err := m.groupService.IsCreatorOrManager(req.ChannelID, loginUID)
+		isCreatorOrManager, err := m.groupService.HasPermission(req.ChannelID, loginUID, group.ManagerPermissionPinMessage)
 		if err != nil {
 			m.Error("查询用户在群内权限错误", zap.Error(err))
 			c.ResponseError(errors.New("查询用户在群内权限错误"))
@@ -267,7 +268,7 @@ func (m *Message) clearPinnedMessage(c *wkhttp.Context) {
 		fakeChannelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
 	} else {
 		// 查询权限
-		isCreatorOrManager, err := m.groupService.IsCreatorOrManager(req.ChannelID, loginUID)
+		isCreatorOrManager, err := m.groupService.HasPermission(req.ChannelID, loginUID, group.ManagerPermissionPinMessage)
 		if err != nil {
 			m.Error("查询用户在群内权限错误", zap.Error(err))
 			c.ResponseError(errors.New("查询用户在群内权限错误"))
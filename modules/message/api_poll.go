@@ -0,0 +1,625 @@
+package message
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// 发起投票
+func (m *Message) pollCreate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req pollCreateReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := m.checkPollGroup(req.ChannelID, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+
+	pollNo := util.GenerUUID()
+	tx, err := m.db.session.Begin()
+	if err != nil {
+		m.Error("开启事务错误", zap.Error(err))
+		c.ResponseError(errors.New("开启事务错误"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = m.pollDB.insertTx(&pollModel{
+		PollNo:           pollNo,
+		ChannelID:        req.ChannelID,
+		ChannelType:      req.ChannelType,
+		Creator:          loginUID,
+		Title:            req.Title,
+		Multiple:         req.Multiple,
+		Anonymous:        req.Anonymous,
+		ResultVisibility: req.ResultVisibility,
+		Deadline:         req.Deadline,
+		Status:           pollStatusOpen,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("新增投票错误", zap.Error(err))
+		c.ResponseError(errors.New("新增投票错误"))
+		return
+	}
+	options := make([]*pollOptionResp, 0, len(req.Options))
+	for i, content := range req.Options {
+		optionID := i + 1
+		err = m.pollDB.insertOptionTx(&pollOptionModel{
+			PollNo:   pollNo,
+			OptionID: optionID,
+			Content:  content,
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			m.Error("新增投票选项错误", zap.Error(err))
+			c.ResponseError(errors.New("新增投票选项错误"))
+			return
+		}
+		options = append(options, &pollOptionResp{
+			OptionID: optionID,
+			Content:  content,
+		})
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("事务提交失败！", err)
+		return
+	}
+
+	result, err := m.ctx.SendMessageWithResult(&config.MsgSendReq{
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		FromUID:     loginUID,
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"type":              ContentTypePoll,
+			"poll_no":           pollNo,
+			"title":             req.Title,
+			"options":           options,
+			"multiple":          req.Multiple,
+			"anonymous":         req.Anonymous,
+			"result_visibility": req.ResultVisibility,
+			"deadline":          req.Deadline,
+		})),
+	})
+	if err != nil {
+		m.Error("发送投票消息失败！", zap.Error(err))
+		if err := m.pollDB.deleteWithPollNo(pollNo); err != nil {
+			m.Warn("清理投票失败！", zap.Error(err), zap.String("pollNo", pollNo))
+		}
+		c.ResponseError(errors.New("发送投票消息失败！"))
+		return
+	}
+	err = m.pollDB.updateMessage(pollNo, strconv.FormatInt(result.MessageID, 10), result.MessageSeq)
+	if err != nil {
+		m.Error("更新投票消息ID失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新投票消息ID失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"poll_no":     pollNo,
+		"message_id":  strconv.FormatInt(result.MessageID, 10),
+		"message_seq": result.MessageSeq,
+	})
+}
+
+// 投票（option_ids为空表示撤回自己的投票）
+func (m *Message) pollVote(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pollNo := c.Param("poll_no")
+	var req struct {
+		OptionIDs []int `json:"option_ids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	poll, err := m.pollDB.queryWithPollNo(pollNo)
+	if err != nil {
+		m.Error("查询投票错误", zap.Error(err))
+		c.ResponseError(errors.New("查询投票错误"))
+		return
+	}
+	if poll == nil || poll.MessageID == "" {
+		c.ResponseError(errors.New("投票不存在"))
+		return
+	}
+	if poll.Status == pollStatusClosed || poll.isExpired(time.Now().Unix()) {
+		c.ResponseError(errors.New("投票已结束"))
+		return
+	}
+	exist, err := m.groupService.ExistMember(poll.ChannelID, loginUID)
+	if err != nil {
+		m.Error("查询是否是群成员错误", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员错误"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员不能投票"))
+		return
+	}
+	if poll.Multiple == 0 && len(req.OptionIDs) > 1 {
+		c.ResponseError(errors.New("该投票为单选"))
+		return
+	}
+	options, err := m.pollDB.queryOptionsWithPollNos([]string{pollNo})
+	if err != nil {
+		m.Error("查询投票选项错误", zap.Error(err))
+		c.ResponseError(errors.New("查询投票选项错误"))
+		return
+	}
+	optionIDs, err := checkPollOptionIDs(req.OptionIDs, options)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+
+	tx, err := m.db.session.Begin()
+	if err != nil {
+		m.Error("开启事务错误", zap.Error(err))
+		c.ResponseError(errors.New("开启事务错误"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	open, err := m.pollDB.lockOpenTx(pollNo, time.Now().Unix(), tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("查询投票状态错误", zap.Error(err))
+		c.ResponseError(errors.New("查询投票状态错误"))
+		return
+	}
+	if !open {
+		tx.Rollback()
+		c.ResponseError(errors.New("投票已结束"))
+		return
+	}
+	err = m.pollDB.deleteVotesWithUIDTx(pollNo, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("删除旧的投票错误", zap.Error(err))
+		c.ResponseError(errors.New("删除旧的投票错误"))
+		return
+	}
+	for _, optionID := range optionIDs {
+		err = m.pollDB.insertVoteTx(&pollVoteModel{
+			PollNo:   pollNo,
+			OptionID: optionID,
+			UID:      loginUID,
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			m.Error("新增投票错误", zap.Error(err))
+			c.ResponseError(errors.New("新增投票错误"))
+			return
+		}
+	}
+	err = m.messageExtraDB.insertOrUpdateVersionTx(&messageExtraModel{
+		MessageID:   poll.MessageID,
+		MessageSeq:  poll.MessageSeq,
+		ChannelID:   poll.ChannelID,
+		ChannelType: poll.ChannelType,
+		Version:     m.genMessageExtraSeq(poll.ChannelID),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("更新消息扩展版本失败！", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("事务提交失败！", err)
+		return
+	}
+	err = m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   poll.ChannelID,
+		ChannelType: poll.ChannelType,
+		FromUID:     loginUID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+	if err != nil {
+		m.Error("发送cmd失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
+// 结束投票（发起人或群管理员）
+func (m *Message) pollClose(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pollNo := c.Param("poll_no")
+	poll, err := m.pollDB.queryWithPollNo(pollNo)
+	if err != nil {
+		m.Error("查询投票错误", zap.Error(err))
+		c.ResponseError(errors.New("查询投票错误"))
+		return
+	}
+	if poll == nil || poll.MessageID == "" {
+		c.ResponseError(errors.New("投票不存在"))
+		return
+	}
+	if poll.Status == pollStatusClosed {
+		c.ResponseError(errors.New("投票已结束"))
+		return
+	}
+	if poll.Creator != loginUID {
+		isCreatorOrManager, err := m.groupService.IsCreatorOrManager(poll.ChannelID, loginUID)
+		if err != nil {
+			m.Error("查询用户在群内权限错误", zap.Error(err))
+			c.ResponseError(errors.New("查询用户在群内权限错误"))
+			return
+		}
+		if !isCreatorOrManager {
+			c.ResponseError(errors.New("只有发起人或管理员才能结束投票"))
+			return
+		}
+	}
+	if err := m.closePoll(poll, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
+// 投票详情
+func (m *Message) pollGet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	poll, err := m.pollDB.queryWithPollNo(c.Param("poll_no"))
+	if err != nil {
+		m.Error("查询投票错误", zap.Error(err))
+		c.ResponseError(errors.New("查询投票错误"))
+		return
+	}
+	if poll == nil || poll.MessageID == "" {
+		c.ResponseError(errors.New("投票不存在"))
+		return
+	}
+	exist, err := m.groupService.ExistMember(poll.ChannelID, loginUID)
+	if err != nil {
+		m.Error("查询是否是群成员错误", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员错误"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不是群成员不能查看投票"))
+		return
+	}
+	resps, err := m.getPollResps([]*pollModel{poll}, loginUID)
+	if err != nil {
+		m.Error("查询投票结果错误", zap.Error(err))
+		c.ResponseError(errors.New("查询投票结果错误"))
+		return
+	}
+	c.Response(resps[poll.MessageID])
+}
+
+func (m *Message) closePoll(poll *pollModel, closer string) error {
+	tx, err := m.db.session.Begin()
+	if err != nil {
+		m.Error("开启事务错误", zap.Error(err))
+		return errors.New("开启事务错误")
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = m.pollDB.closeTx(poll.PollNo, closer, time.Now().Unix(), tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("结束投票错误", zap.Error(err))
+		return errors.New("结束投票错误")
+	}
+	err = m.messageExtraDB.insertOrUpdateVersionTx(&messageExtraModel{
+		MessageID:   poll.MessageID,
+		MessageSeq:  poll.MessageSeq,
+		ChannelID:   poll.ChannelID,
+		ChannelType: poll.ChannelType,
+		Version:     m.genMessageExtraSeq(poll.ChannelID),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("更新消息扩展版本失败！", zap.Error(err))
+		return errors.New("更新消息扩展版本失败！")
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		m.Error("事务提交失败！", zap.Error(err))
+		return errors.New("事务提交失败！")
+	}
+	fromUID := closer
+	if fromUID == "" {
+		fromUID = m.ctx.GetConfig().Account.SystemUID
+	}
+	err = m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   poll.ChannelID,
+		ChannelType: poll.ChannelType,
+		FromUID:     fromUID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+	if err != nil {
+		m.Warn("发送cmd失败！", zap.Error(err))
+	}
+	return nil
+}
+
+// 定时结束已过截止时间的投票
+func (m *Message) closeExpiredPolls() {
+	polls, err := m.pollDB.queryExpired(time.Now().Unix(), 100)
+	if err != nil {
+		m.Error("查询过期投票错误", zap.Error(err))
+		return
+	}
+	for _, poll := range polls {
+		if err := m.closePoll(poll, ""); err != nil {
+			m.Error("结束过期投票错误", zap.Error(err), zap.String("pollNo", poll.PollNo))
+		}
+	}
+}
+
+// 查询投票结果 返回以message_id为key的投票数据
+func (m *Message) getPollResps(polls []*pollModel, loginUID string) (map[string]*pollResp, error) {
+	respMap := map[string]*pollResp{}
+	if len(polls) == 0 {
+		return respMap, nil
+	}
+	pollNos := make([]string, 0, len(polls))
+	for _, poll := range polls {
+		pollNos = append(pollNos, poll.PollNo)
+	}
+	options, err := m.pollDB.queryOptionsWithPollNos(pollNos)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := m.pollDB.queryVotesWithPollNos(pollNos)
+	if err != nil {
+		return nil, err
+	}
+	nameMap := map[string]string{}
+	uids := make([]string, 0, len(votes))
+	for _, vote := range votes {
+		if _, ok := nameMap[vote.UID]; !ok {
+			nameMap[vote.UID] = ""
+			uids = append(uids, vote.UID)
+		}
+	}
+	if len(uids) > 0 {
+		users, err := m.userService.GetUsers(uids)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			nameMap[u.UID] = u.Name
+		}
+	}
+	now := time.Now().Unix()
+	for _, poll := range polls {
+		respMap[poll.MessageID] = newPollResp(poll, options, votes, nameMap, loginUID, now)
+	}
+	return respMap, nil
+}
+
+func (m *Message) checkPollGroup(groupNo string, loginUID string) error {
+	groupInfo, err := m.groupService.GetGroupDetail(groupNo, loginUID)
+	if err != nil {
+		m.Error("查询群组信息错误", zap.Error(err))
+		return errors.New("查询群组信息错误")
+	}
+	if groupInfo == nil || groupInfo.Status != 1 {
+		return errors.New("群不存在或已删除")
+	}
+	exist, err := m.groupService.ExistMember(groupNo, loginUID)
+	if err != nil {
+		m.Error("查询是否是群成员错误", zap.Error(err))
+		return errors.New("查询是否是群成员错误")
+	}
+	if !exist {
+		return errors.New("不是群成员不能发起投票")
+	}
+	return nil
+}
+
+func checkPollOptionIDs(optionIDs []int, options []*pollOptionModel) ([]int, error) {
+	result := make([]int, 0, len(optionIDs))
+	for _, optionID := range optionIDs {
+		found := false
+		for _, option := range options {
+			if option.OptionID == optionID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("投票选项不存在")
+		}
+		duplicate := false
+		for _, id := range result {
+			if id == optionID {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, optionID)
+		}
+	}
+	return result, nil
+}
+
+func (p *pollModel) isExpired(now int64) bool {
+	return p.Deadline > 0 && p.Deadline <= now
+}
+
+type pollCreateReq struct {
+	ChannelID        string   `json:"channel_id"`
+	ChannelType      uint8    `json:"channel_type"`
+	Title            string   `json:"title"`             // 投票标题
+	Options          []string `json:"options"`           // 选项
+	Multiple         int      `json:"multiple"`          // 是否多选
+	Anonymous        int      `json:"anonymous"`         // 是否匿名
+	ResultVisibility int      `json:"result_visibility"` // 结果可见性 0.所有人可见 1.投票后可见 2.结束后可见
+	Deadline         int64    `json:"deadline"`          // 截止时间（秒） 0表示不限
+}
+
+func (r *pollCreateReq) check() error {
+	if r.ChannelID == "" {
+		return errors.New("频道ID不能为空")
+	}
+	if r.ChannelType != common.ChannelTypeGroup.Uint8() {
+		return errors.New("只有群聊才能发起投票")
+	}
+	r.Title = strings.TrimSpace(r.Title)
+	if r.Title == "" {
+		return errors.New("投票标题不能为空")
+	}
+	if len(r.Options) < 2 {
+		return errors.New("投票选项不能少于2个")
+	}
+	if len(r.Options) > pollMaxOptionCount {
+		return errors.New("投票选项过多")
+	}
+	for i, option := range r.Options {
+		r.Options[i] = strings.TrimSpace(option)
+		if r.Options[i] == "" {
+			return errors.New("投票选项不能为空")
+		}
+	}
+	if r.ResultVisibility != PollResultVisibilityAlways && r.ResultVisibility != PollResultVisibilityAfterVote && r.ResultVisibility != PollResultVisibilityAfterClose {
+		return errors.New("结果可见性不合法")
+	}
+	if r.Deadline < 0 || (r.Deadline > 0 && r.Deadline <= time.Now().Unix()) {
+		return errors.New("截止时间不合法")
+	}
+	return nil
+}
+
+type pollResp struct {
+	PollNo           string            `json:"poll_no"`
+	Title            string            `json:"title"`
+	Creator          string            `json:"creator"`
+	Multiple         int               `json:"multiple"`
+	Anonymous        int               `json:"anonymous"`
+	ResultVisibility int               `json:"result_visibility"`
+	Deadline         int64             `json:"deadline"`
+	Status           int               `json:"status"`         // 0.进行中 1.已结束
+	Closer           string            `json:"closer"`         // 结束者 空表示到期自动结束
+	ClosedAt         int64             `json:"closed_at"`      // 结束时间
+	Voted            int               `json:"voted"`          // 自己是否已投票
+	MyOptionIDs      []int             `json:"my_options"`     // 自己投的选项
+	ResultVisible    int               `json:"result_visible"` // 结果对自己是否可见
+	VoterCount       int               `json:"voter_count"`    // 参与人数（结果可见时返回）
+	Options          []*pollOptionResp `json:"options"`
+}
+
+type pollOptionResp struct {
+	OptionID  int                 `json:"option_id"`
+	Content   string              `json:"content"`
+	VoteCount int                 `json:"vote_count,omitempty"` // 票数（结果可见时返回）
+	Voters    []config.UserBaseVo `json:"voters,omitempty"`     // 投票者（实名且结果可见时返回）
+}
+
+func newPollResp(poll *pollModel, options []*pollOptionModel, votes []*pollVoteModel, nameMap map[string]string, loginUID string, now int64) *pollResp {
+	status := poll.Status
+	if status == pollStatusOpen && poll.isExpired(now) {
+		status = pollStatusClosed
+	}
+	myOptionIDs := make([]int, 0)
+	voterMap := map[string]bool{}
+	for _, vote := range votes {
+		if vote.PollNo != poll.PollNo {
+			continue
+		}
+		voterMap[vote.UID] = true
+		if vote.UID == loginUID {
+			myOptionIDs = append(myOptionIDs, vote.OptionID)
+		}
+	}
+	voted := len(myOptionIDs) > 0
+
+	resultVisible := poll.Creator == loginUID || status == pollStatusClosed
+	switch poll.ResultVisibility {
+	case PollResultVisibilityAlways:
+		resultVisible = true
+	case PollResultVisibilityAfterVote:
+		resultVisible = resultVisible || voted
+	}
+
+	resp := &pollResp{
+		PollNo:           poll.PollNo,
+		Title:            poll.Title,
+		Creator:          poll.Creator,
+		Multiple:         poll.Multiple,
+		Anonymous:        poll.Anonymous,
+		ResultVisibility: poll.ResultVisibility,
+		Deadline:         poll.Deadline,
+		Status:           status,
+		Closer:           poll.Closer,
+		ClosedAt:         poll.ClosedAt,
+		MyOptionIDs:      myOptionIDs,
+		Options:          make([]*pollOptionResp, 0),
+	}
+	if voted {
+		resp.Voted = 1
+	}
+	if resultVisible {
+		resp.ResultVisible = 1
+		resp.VoterCount = len(voterMap)
+	}
+	for _, option := range options {
+		if option.PollNo != poll.PollNo {
+			continue
+		}
+		optionResp := &pollOptionResp{
+			OptionID: option.OptionID,
+			Content:  option.Content,
+		}
+		if resultVisible {
+			for _, vote := range votes {
+				if vote.PollNo != poll.PollNo || vote.OptionID != option.OptionID {
+					continue
+				}
+				optionResp.VoteCount++
+				if poll.Anonymous == 0 {
+					optionResp.Voters = append(optionResp.Voters, config.UserBaseVo{
+						UID:  vote.UID,
+						Name: nameMap[vote.UID],
+					})
+				}
+			}
+		}
+		resp.Options = append(resp.Options, optionResp)
+	}
+	return resp
+}
@@ -0,0 +1,279 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 设置稍后提醒
+func (m *Message) remindLaterAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		ChannelID   string `json:"channel_id"`
+		ChannelType uint8  `json:"channel_type"`
+		MessageID   string `json:"message_id"`
+		MessageSeq  uint32 `json:"message_seq"`
+		ClientMsgNo string `json:"client_msg_no"`
+		Note        string `json:"note"`      // 备注
+		RemindAt    int64  `json:"remind_at"` // 提醒时间（10位时间戳）
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if req.ChannelID == "" {
+		c.ResponseError(errors.New("频道ID不能为空"))
+		return
+	}
+	if req.MessageID == "" {
+		c.ResponseError(errors.New("消息ID不能为空"))
+		return
+	}
+	if req.RemindAt <= time.Now().Unix() {
+		c.ResponseError(errors.New("提醒时间必须大于当前时间"))
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len([]rune(req.Note)) > 100 {
+		c.ResponseError(errors.New("备注不能超过100个字"))
+		return
+	}
+	if req.ChannelType != common.ChannelTypePerson.Uint8() && req.ChannelType != common.ChannelTypeGroup.Uint8() {
+		c.ResponseError(errors.New("不支持的频道类型"))
+		return
+	}
+	visible, err := m.remindLaterChannelVisible(loginUID, req.ChannelID, req.ChannelType)
+	if err != nil {
+		m.Error("查询是否是群成员错误", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是群成员错误"))
+		return
+	}
+	if !visible {
+		c.ResponseError(errors.New("不是群成员"))
+		return
+	}
+	message, err := m.db.queryChannelMessageWithMessageID(messageFakeChannelID(req.ChannelID, req.ChannelType, loginUID), req.ChannelType, req.MessageID)
+	if err != nil {
+		m.Error("查询消息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询消息错误"))
+		return
+	}
+	if message == nil || message.IsDeleted == 1 {
+		c.ResponseError(errors.New("消息不存在或已删除"))
+		return
+	}
+	id, err := m.remindLaterDB.insert(&remindLaterModel{
+		UID:         loginUID,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		MessageID:   req.MessageID,
+		MessageSeq:  message.MessageSeq,
+		ClientMsgNo: message.ClientMsgNo,
+		Note:        req.Note,
+		RemindAt:    req.RemindAt,
+		Status:      remindLaterStatusPending,
+	})
+	if err != nil {
+		m.Error("添加稍后提醒失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加稍后提醒失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"id": id,
+	})
+}
+
+// 待提醒列表
+func (m *Message) remindLaterList(c *wkhttp.Context) {
+	list, err := m.remindLaterDB.queryPendingWithUID(c.GetLoginUID())
+	if err != nil {
+		m.Error("查询稍后提醒失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询稍后提醒失败！"))
+		return
+	}
+	resps := make([]*remindLaterResp, 0, len(list))
+	for _, model := range list {
+		resps = append(resps, newRemindLaterResp(model))
+	}
+	c.Response(resps)
+}
+
+// 取消稍后提醒
+func (m *Message) remindLaterCancel(c *wkhttp.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	model, err := m.remindLaterDB.queryWithID(id)
+	if err != nil {
+		m.Error("查询稍后提醒失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询稍后提醒失败！"))
+		return
+	}
+	if model == nil || model.UID != c.GetLoginUID() {
+		c.ResponseError(errors.New("提醒不存在"))
+		return
+	}
+	ok, err := m.remindLaterDB.updateStatusIfPending(id, remindLaterStatusCancelled, 0)
+	if err != nil {
+		m.Error("取消稍后提醒失败！", zap.Error(err))
+		c.ResponseError(errors.New("取消稍后提醒失败！"))
+		return
+	}
+	if !ok {
+		c.ResponseError(errors.New("提醒已触发或已取消"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 处理到期的稍后提醒
+func (m *Message) handleDueRemindLater() {
+	list, err := m.remindLaterDB.queryDue(time.Now().Unix(), 100)
+	if err != nil {
+		m.Error("查询到期的稍后提醒失败！", zap.Error(err))
+		return
+	}
+	if len(list) == 0 {
+		return
+	}
+	reminders := make([]*remindersModel, 0, len(list))
+	dueList := make([]*remindLaterModel, 0, len(list))
+	for _, model := range list {
+		ok, err := m.remindLaterDB.updateStatusIfPending(model.Id, remindLaterStatusReminded, time.Now().Unix())
+		if err != nil {
+			m.Error("修改稍后提醒状态失败！", zap.Error(err), zap.Int64("id", model.Id))
+			continue
+		}
+		if !ok { // 已被取消或已被其他节点处理
+			continue
+		}
+		dueList = append(dueList, model)
+		reminders = append(reminders, &remindersModel{
+			ChannelID:    model.ChannelID,
+			ChannelType:  model.ChannelType,
+			ClientMsgNo:  model.ClientMsgNo,
+			MessageID:    model.MessageID,
+			MessageSeq:   model.MessageSeq,
+			ReminderType: ReminderTypeRemindLater,
+			Publisher:    model.UID,
+			UID:          model.UID,
+			IsLocate:     1,
+			Version:      m.ctx.GenSeq(common.RemindersKey),
+			Text:         "[消息提醒]",
+			Data: util.ToJson(map[string]interface{}{
+				"remind_id": model.Id,
+				"note":      model.Note,
+				"remind_at": model.RemindAt,
+			}),
+		})
+	}
+	m.handleReminders(reminders)
+
+	for _, model := range dueList {
+		m.sendRemindLaterMessage(model)
+	}
+}
+
+// 以系统账号给用户发送提醒消息（离线时会走推送）
+func (m *Message) sendRemindLaterMessage(model *remindLaterModel) {
+	content := "你设置的消息提醒时间到了"
+	if model.Note != "" {
+		content = fmt.Sprintf("%s：%s", content, model.Note)
+	}
+	// 用户已不在群内时不再附带消息摘要
+	visible, err := m.remindLaterChannelVisible(model.UID, model.ChannelID, model.ChannelType)
+	if err != nil {
+		m.Warn("查询是否是群成员失败！", zap.Error(err))
+	}
+	if visible {
+		message, err := m.db.queryChannelMessageWithMessageID(messageFakeChannelID(model.ChannelID, model.ChannelType, model.UID), model.ChannelType, model.MessageID)
+		if err != nil {
+			m.Warn("查询提醒的消息失败！", zap.Error(err))
+		}
+		if message != nil && message.IsDeleted == 0 && message.Signal == 0 {
+			content = fmt.Sprintf("%s\n%s", content, m.remindLaterDigest(message.Payload))
+		}
+	}
+	err = m.ctx.SendMessage(&config.MsgSendReq{
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+		FromUID:     m.ctx.GetConfig().Account.SystemUID,
+		ChannelID:   model.UID,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"type":    common.Text,
+			"content": content,
+			"remind_later": map[string]interface{}{
+				"channel_id":   model.ChannelID,
+				"channel_type": model.ChannelType,
+				"message_id":   model.MessageID,
+				"message_seq":  model.MessageSeq,
+			},
+		})),
+	})
+	if err != nil {
+		m.Error("发送稍后提醒消息失败！", zap.Error(err), zap.Int64("id", model.Id))
+	}
+}
+
+// remindLaterChannelVisible 用户能否查看频道内的消息（群聊需为群成员）
+func (m *Message) remindLaterChannelVisible(uid string, channelID string, channelType uint8) (bool, error) {
+	switch channelType {
+	case common.ChannelTypePerson.Uint8():
+		return true, nil
+	case common.ChannelTypeGroup.Uint8():
+		return m.groupService.ExistMember(channelID, uid)
+	}
+	return false, nil
+}
+
+// 消息摘要
+func (m *Message) remindLaterDigest(payload []byte) string {
+	var payloadMap map[string]interface{}
+	if err := util.ReadJsonByByte(payload, &payloadMap); err != nil {
+		return ""
+	}
+	contentType := m.contentType(payloadMap)
+	if contentType == common.Text.Int() {
+		content, _ := payloadMap["content"].(string)
+		runes := []rune(content)
+		if len(runes) > 50 {
+			content = string(runes[:50]) + "..."
+		}
+		return content
+	}
+	return common.GetDisplayText(contentType)
+}
+
+type remindLaterResp struct {
+	ID          int64  `json:"id"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	MessageID   string `json:"message_id"`
+	MessageSeq  uint32 `json:"message_seq"`
+	Note        string `json:"note"`
+	RemindAt    int64  `json:"remind_at"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func newRemindLaterResp(m *remindLaterModel) *remindLaterResp {
+	return &remindLaterResp{
+		ID:          m.Id,
+		ChannelID:   m.ChannelID,
+		ChannelType: m.ChannelType,
+		MessageID:   m.MessageID,
+		MessageSeq:  m.MessageSeq,
+		Note:        m.Note,
+		RemindAt:    m.RemindAt,
+		CreatedAt:   m.CreatedAt.String(),
+	}
+}
@@ -130,7 +130,8 @@ func (m *Message) reminderSync(c *wkhttp.Context) {
 
 func (m *Message) listenerMessages(messages []*config.MessageResp) {
 
-	reminders := m.getReminders(messages) // 提醒
+	messages = m.revokeNewcomerRestrictedMessages(messages) // 撤回观察期成员的受限消息
+	reminders := m.getReminders(messages)                   // 提醒
 	if len(reminders) > 0 {
 		m.handleReminders(reminders)
 	}
@@ -150,6 +151,9 @@ func (m *Message) getReminders(messages []*config.MessageResp) []*remindersModel
 		}
 		if m.hasMention(payloadMap) {
 			all, uids := m.getMention(payloadMap)
+			if !all && message.ChannelType == common.ChannelTypeGroup.Uint8() {
+				uids = m.appendTagMentionUIDs(message.ChannelID, message.FromUID, payloadMap, uids)
+			}
 			if all {
 				version := m.ctx.GenSeq(common.RemindersKey)
 				reminders = append(reminders, &remindersModel{
@@ -273,6 +277,57 @@ func (m *Message) getMention(payloadMap map[string]interface{}) (all bool, uids
 	return
 }
 
+// getMentionTags 获取@的群成员标签编号
+func (m *Message) getMentionTags(payloadMap map[string]interface{}) []string {
+	mentionMap, _ := payloadMap["mention"].(map[string]interface{})
+	if mentionMap == nil || mentionMap["tags"] == nil {
+		return nil
+	}
+	tagObjs, _ := mentionMap["tags"].([]interface{})
+	tagNos := make([]string, 0, len(tagObjs))
+	for _, tagObj := range tagObjs {
+		if tagNo, ok := tagObj.(string); ok && tagNo != "" {
+			tagNos = append(tagNos, tagNo)
+		}
+	}
+	return tagNos
+}
+
+// appendTagMentionUIDs 将@的标签展开为标签下的成员（不包含发送者本人）
+func (m *Message) appendTagMentionUIDs(groupNo string, fromUID string, payloadMap map[string]interface{}, uids []string) []string {
+	tagNos := m.getMentionTags(payloadMap)
+	if len(tagNos) == 0 {
+		return uids
+	}
+	tagUIDs, err := m.groupService.GetTagMemberUIDs(groupNo, tagNos)
+	if err != nil {
+		m.Warn("查询标签成员失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		return uids
+	}
+	return mergeMentionUIDs(uids, tagUIDs, fromUID)
+}
+
+// mergeMentionUIDs 合并@的成员与标签下的成员并去重
+func mergeMentionUIDs(uids []string, tagUIDs []string, fromUID string) []string {
+	merged := make([]string, 0, len(uids)+len(tagUIDs))
+	exists := make(map[string]bool, len(uids)+len(tagUIDs))
+	for _, uid := range uids {
+		if exists[uid] {
+			continue
+		}
+		exists[uid] = true
+		merged = append(merged, uid)
+	}
+	for _, uid := range tagUIDs {
+		if exists[uid] || uid == fromUID {
+			continue
+		}
+		exists[uid] = true
+		merged = append(merged, uid)
+	}
+	return merged
+}
+
 func (m *Message) contentType(payloadMap map[string]interface{}) int {
 	if payloadMap["type"] != nil {
 		contentTypeI, _ := payloadMap["type"].(json.Number).Int64()
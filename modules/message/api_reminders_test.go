@@ -0,0 +1,16 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeMentionUIDs(t *testing.T) {
+	// @的成员保留顺序，标签成员去重并排除发送者
+	uids := mergeMentionUIDs([]string{"u1", "u2", "u1"}, []string{"u2", "sender", "u3"}, "sender")
+	assert.Equal(t, []string{"u1", "u2", "u3"}, uids)
+
+	uids = mergeMentionUIDs(nil, []string{"u3"}, "sender")
+	assert.Equal(t, []string{"u3"}, uids)
+}
@@ -1,11 +1,15 @@
 package message
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -232,3 +236,88 @@ func NewTestServer1(args ...string) (*server.Server, *config.Context) {
 	return s, ctx
 
 }
+
+func TestNewPollRespVisibility(t *testing.T) {
+	now := time.Now().Unix()
+	poll := &pollModel{
+		PollNo:           "poll1",
+		MessageID:        "1",
+		Creator:          "creator",
+		ResultVisibility: PollResultVisibilityAfterVote,
+	}
+	options := []*pollOptionModel{
+		{PollNo: "poll1", OptionID: 1, Content: "A"},
+		{PollNo: "poll1", OptionID: 2, Content: "B"},
+	}
+	votes := []*pollVoteModel{
+		{PollNo: "poll1", OptionID: 1, UID: "u1"},
+		{PollNo: "poll1", OptionID: 2, UID: "u2"},
+		{PollNo: "poll1", OptionID: 1, UID: "u3"},
+	}
+	nameMap := map[string]string{"u1": "n1", "u2": "n2", "u3": "n3"}
+
+	// 未投票不可见结果
+	resp := newPollResp(poll, options, votes, nameMap, "u4", now)
+	assert.Equal(t, 0, resp.ResultVisible)
+	assert.Equal(t, 0, resp.Options[0].VoteCount)
+
+	// 投票后可见结果
+	resp = newPollResp(poll, options, votes, nameMap, "u1", now)
+	assert.Equal(t, 1, resp.Voted)
+	assert.Equal(t, 1, resp.ResultVisible)
+	assert.Equal(t, 3, resp.VoterCount)
+	assert.Equal(t, 2, resp.Options[0].VoteCount)
+	assert.Equal(t, "n3", resp.Options[0].Voters[1].Name)
+
+	// 发起人始终可见
+	resp = newPollResp(poll, options, votes, nameMap, "creator", now)
+	assert.Equal(t, 1, resp.ResultVisible)
+
+	// 匿名不返回投票者
+	poll.Anonymous = 1
+	resp = newPollResp(poll, options, votes, nameMap, "u1", now)
+	assert.Equal(t, 0, len(resp.Options[0].Voters))
+
+	// 到期视为已结束
+	poll.ResultVisibility = PollResultVisibilityAfterClose
+	poll.Deadline = now - 1
+	resp = newPollResp(poll, options, votes, nameMap, "u4", now)
+	assert.Equal(t, pollStatusClosed, resp.Status)
+	assert.Equal(t, 1, resp.ResultVisible)
+}
+
+func TestRenderExportZip(t *testing.T) {
+	var payload map[string]interface{}
+	err := util.ReadJsonByByte([]byte(`{"type":8,"name":"a.pdf","url":"file/preview/chat/a.pdf"}`), &payload)
+	assert.NoError(t, err)
+	contentType, content, media := parseExportContent(payload, "http://127.0.0.1/v1")
+	assert.Equal(t, common.File.Int(), contentType)
+	assert.Equal(t, "a.pdf", content)
+	assert.Equal(t, "http://127.0.0.1/v1/file/preview/chat/a.pdf", media[0].URL)
+
+	data, err := renderExportZip(&exportArchive{
+		ChannelID:   "g1",
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		ChannelName: "<test>",
+		Messages: []*exportMessage{
+			{MessageID: "1", FromUID: "u1", FromName: "n1", Content: "<script>hi</script>", Edited: true, EditedAt: 1},
+			{MessageID: "2", FromUID: "u2", Revoked: true},
+		},
+	})
+	assert.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(zr.File))
+	f, err := zr.Open("transcript.html")
+	assert.NoError(t, err)
+	html, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "&lt;script&gt;hi&lt;/script&gt;")
+	assert.Contains(t, string(html), "[消息已撤回]")
+}
+
+func TestExportErrorText(t *testing.T) {
+	assert.Equal(t, "失败", exportErrorText(errors.New("失败")))
+	text := exportErrorText(errors.New(strings.Repeat("错", exportMaxErrorLength+10)))
+	assert.Equal(t, exportMaxErrorLength, len([]rune(text)))
+}
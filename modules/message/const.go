@@ -1,5 +1,11 @@
 package message
 
+import (
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+)
+
 const (
 	// 消息已删除
 	CMDMessageDeleted = "messageDeleted"
@@ -14,6 +20,45 @@ type ReminderType int
 const (
 	ReminderTypeMentionMe      = 1 // 有人@我
 	ReminderTypeApplyJoinGroup = 2 // 申请加群
+	ReminderTypeRemindLater    = 3 // 稍后提醒
+)
+
+const (
+	remindLaterStatusPending   = 0 // 待提醒
+	remindLaterStatusReminded  = 1 // 已提醒
+	remindLaterStatusCancelled = 2 // 已取消
+)
+
+// ContentTypePoll 投票消息
+const ContentTypePoll common.ContentType = 17
+
+const (
+	pollStatusOpen   = 0 // 进行中
+	pollStatusClosed = 1 // 已结束
+)
+
+const (
+	PollResultVisibilityAlways     = 0 // 所有人可见
+	PollResultVisibilityAfterVote  = 1 // 投票后可见
+	PollResultVisibilityAfterClose = 2 // 结束后可见
+)
+
+const pollMaxOptionCount = 20 // 投票最多选项数量
+
+const (
+	exportStatusPending    = 0 // 等待导出
+	exportStatusProcessing = 1 // 导出中
+	exportStatusSuccess    = 2 // 导出成功
+	exportStatusFail       = 3 // 导出失败
+)
+
+const (
+	exportDownloadCachePrefix = "messageExportDownload:" // 导出文件下载token
+	exportDownloadExpire      = time.Hour                // 下载链接有效期
+	exportMaxMessageCount     = 100000                   // 单次导出最多消息数
+	exportMaxDays             = 366                      // 单次导出最大时间跨度（天）
+	exportProcessingTimeout   = time.Minute * 30         // 导出中的任务超过该时间未完成视为节点异常退出，重新执行
+	exportMaxErrorLength      = 255                      // 失败原因最大长度
 )
 
 var sensitive_words = []string{
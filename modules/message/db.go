@@ -30,6 +30,13 @@ func (d *DB) queryMessageWithMessageID(channelID string, messageID string) (*mes
 	return m, err
 }
 
+// queryChannelMessageWithMessageID 查询指定频道内的消息 channelID为消息存储使用的频道ID（单聊为双方uid组合）
+func (d *DB) queryChannelMessageWithMessageID(channelID string, channelType uint8, messageID string) (*messageModel, error) {
+	var m *messageModel
+	_, err := d.session.Select("*").From(d.getTable(channelID)).Where("channel_id=? and channel_type=? and message_id=?", channelID, channelType, messageID).Load(&m)
+	return m, err
+}
+
 func (d *DB) queryMessagesWithMessageIDs(channelID string, messageIDs []string) ([]*messageModel, error) {
 	if len(messageIDs) <= 0 {
 		return nil, nil
@@ -0,0 +1,107 @@
+package message
+
+import (
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type exportDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+	db      *DB
+}
+
+func newExportDB(ctx *config.Context) *exportDB {
+	return &exportDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+		db:      NewDB(ctx),
+	}
+}
+
+func (e *exportDB) insert(m *exportModel) error {
+	_, err := e.session.InsertInto("message_export").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (e *exportDB) queryWithExportNo(exportNo string) (*exportModel, error) {
+	var m *exportModel
+	_, err := e.session.Select("*").From("message_export").Where("export_no=?", exportNo).Load(&m)
+	return m, err
+}
+
+func (e *exportDB) queryWithRequester(requester string, limit uint64) ([]*exportModel, error) {
+	var list []*exportModel
+	_, err := e.session.Select("*").From("message_export").Where("requester=?", requester).OrderDir("id", false).Limit(limit).Load(&list)
+	return list, err
+}
+
+func (e *exportDB) queryUnfinishedCount(requester string) (int64, error) {
+	var count int64
+	_, err := e.session.Select("count(*)").From("message_export").Where("requester=? and status in ?", requester, []int{exportStatusPending, exportStatusProcessing}).Load(&count)
+	return count, err
+}
+
+func (e *exportDB) queryPending(limit uint64) ([]*exportModel, error) {
+	var list []*exportModel
+	_, err := e.session.Select("*").From("message_export").Where("status=?", exportStatusPending).OrderAsc("id").Limit(limit).Load(&list)
+	return list, err
+}
+
+// 抢占导出任务（防止多个节点重复执行）
+func (e *exportDB) updateProcessing(exportNo string) (bool, error) {
+	result, err := e.session.Update("message_export").Set("status", exportStatusProcessing).Set("updated_at", dbr.Now).Where("export_no=? and status=?", exportNo, exportStatusPending).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// 重置超时未完成的导出任务（执行节点异常退出后任务会一直处于导出中）
+func (e *exportDB) resetStaleProcessing(before time.Time) (int64, error) {
+	result, err := e.session.Update("message_export").Set("status", exportStatusPending).Set("updated_at", dbr.Now).Where("status=? and updated_at<?", exportStatusProcessing, before).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (e *exportDB) updateFinished(m *exportModel) error {
+	_, err := e.session.Update("message_export").SetMap(map[string]interface{}{
+		"status":        m.Status,
+		"path":          m.Path,
+		"message_count": m.MessageCount,
+		"error":         m.Error,
+		"finished_at":   m.FinishedAt,
+	}).Where("export_no=?", m.ExportNo).Exec()
+	return err
+}
+
+// 按时间范围分批查询频道消息
+func (e *exportDB) queryMessages(channelID string, channelType uint8, startAt, endAt int64, minMessageSeq uint32, limit uint64) ([]*messageModel, error) {
+	var list []*messageModel
+	_, err := e.session.Select("*").From(e.db.getTable(channelID)).Where("channel_id=? and channel_type=? and `timestamp`>=? and `timestamp`<=? and message_seq>?", channelID, channelType, startAt, endAt, minMessageSeq).OrderAsc("message_seq").Limit(limit).Load(&list)
+	return list, err
+}
+
+type exportModel struct {
+	ExportNo     string
+	Requester    string
+	IsManager    int
+	ViewUID      string
+	ChannelID    string
+	ChannelType  uint8
+	StartAt      int64
+	EndAt        int64
+	Status       int
+	Path         string
+	MessageCount int
+	Error        string
+	FinishedAt   int64
+	db.BaseModel
+}
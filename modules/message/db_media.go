@@ -0,0 +1,83 @@
+package message
+
+import (
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type mediaDB struct {
+	ctx                *config.Context
+	session            *dbr.Session
+	messageUserExtraDB *messageUserExtraDB
+}
+
+func newMediaDB(ctx *config.Context) *mediaDB {
+	return &mediaDB{
+		ctx:                ctx,
+		session:            ctx.DB(),
+		messageUserExtraDB: newMessageUserExtraDB(ctx),
+	}
+}
+
+// queryMedias 分页查询频道媒体，排除已撤回、已删除及过期的消息
+func (m *mediaDB) queryMedias(filter *mediaFilter, pageSize, pageIndex uint64) ([]*mediaModel, error) {
+	var models []*mediaModel
+	_, err := m.builder("channel_media.*", filter).OrderDir("channel_media.message_seq", false).OrderAsc("channel_media.item_index").Offset((pageIndex - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryMediaCount 查询频道媒体数量
+func (m *mediaDB) queryMediaCount(filter *mediaFilter) (int64, error) {
+	var count int64
+	_, err := m.builder("count(*)", filter).Load(&count)
+	return count, err
+}
+
+func (m *mediaDB) builder(column string, filter *mediaFilter) *dbr.SelectStmt {
+	userExtraTable := m.messageUserExtraDB.getTable(filter.LoginUID)
+	builder := m.session.Select(column).From("channel_media").
+		LeftJoin("message_extra", "message_extra.message_id=channel_media.message_id").
+		LeftJoin(dbr.I(userExtraTable).As("user_extra"), dbr.Expr("user_extra.message_id=channel_media.message_id and user_extra.uid=?", filter.LoginUID)).
+		Where("channel_media.channel_id=? and channel_media.channel_type=? and channel_media.media_type=? and channel_media.message_seq>?", filter.ChannelID, filter.ChannelType, filter.MediaType, filter.MinMessageSeq).
+		Where("(channel_media.expire_at=0 or channel_media.expire_at>?)", time.Now().Unix()).
+		Where("IFNULL(message_extra.`revoke`,0)=0 and IFNULL(message_extra.is_deleted,0)=0 and IFNULL(user_extra.message_is_deleted,0)=0")
+	if filter.FromUID != "" {
+		builder = builder.Where("channel_media.from_uid=?", filter.FromUID)
+	}
+	if filter.Keyword != "" {
+		builder = builder.Where("channel_media.name like ?", "%"+filter.Keyword+"%")
+	}
+	return builder
+}
+
+// mediaFilter 频道媒体查询条件
+type mediaFilter struct {
+	LoginUID      string // 查询者uid（用于排除自己删除的消息）
+	ChannelID     string // 频道ID（个人频道为fakeChannelID）
+	ChannelType   uint8  // 频道类型
+	MediaType     int    // 媒体类型
+	MinMessageSeq uint32 // 只查询大于此序号的消息（清空记录或新成员不可见的历史消息）
+	FromUID       string // 发送者
+	Keyword       string // 文件名或链接关键字
+}
+
+type mediaModel struct {
+	MessageID   string
+	ItemIndex   int
+	MessageSeq  uint32
+	ChannelID   string
+	ChannelType uint8
+	FromUID     string
+	MediaType   int
+	ContentType int
+	Name        string
+	Size        int64
+	URL         string
+	Cover       string
+	Timestamp   int32
+	ExpireAt    int64
+	db.BaseModel
+}
@@ -46,6 +46,17 @@ func (m *messageExtraDB) insertOrUpdatePinnedTx(md *messageExtraModel, tx *dbr.T
 	return err
 }
 
+func (m *messageExtraDB) insertOrUpdateRevokeTx(md *messageExtraModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("INSERT INTO message_extra (message_id,message_seq,from_uid,channel_id,channel_type,`revoke`,revoker,version) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `revoke`=VALUES(`revoke`),revoker=VALUES(revoker),version=VALUES(version)", md.MessageID, md.MessageSeq, md.FromUID, md.ChannelID, md.ChannelType, md.Revoke, md.Revoker, md.Version).Exec()
+	return err
+}
+
+// 仅更新扩展数据版本（用于通知客户端重新同步消息扩展，例如投票结果变化）
+func (m *messageExtraDB) insertOrUpdateVersionTx(md *messageExtraModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("INSERT INTO message_extra (message_id,message_seq,channel_id,channel_type,version) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE version=VALUES(version)", md.MessageID, md.MessageSeq, md.ChannelID, md.ChannelType, md.Version).Exec()
+	return err
+}
+
 func (m *messageExtraDB) insertOrUpdateDeleted(md *messageExtraModel) error {
 	_, err := m.session.InsertBySql("INSERT INTO message_extra (message_id,message_seq,channel_id,channel_type,is_deleted,version) VALUES (?,?,?,?,?,?) ON DUPLICATE KEY UPDATE is_deleted=VALUES(is_deleted),version=VALUES(version)", md.MessageID, md.MessageSeq, md.ChannelID, md.ChannelType, md.IsDeleted, md.Version).Exec()
 	return err
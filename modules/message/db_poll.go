@@ -0,0 +1,152 @@
+package message
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type pollDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newPollDB(ctx *config.Context) *pollDB {
+	return &pollDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (d *pollDB) insertTx(m *pollModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("poll").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (d *pollDB) insertOptionTx(m *pollOptionModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("poll_option").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (d *pollDB) updateMessage(pollNo string, messageID string, messageSeq uint32) error {
+	_, err := d.session.Update("poll").SetMap(map[string]interface{}{
+		"message_id":  messageID,
+		"message_seq": messageSeq,
+	}).Where("poll_no=?", pollNo).Exec()
+	return err
+}
+
+func (d *pollDB) closeTx(pollNo string, closer string, closedAt int64, tx *dbr.Tx) error {
+	_, err := tx.Update("poll").SetMap(map[string]interface{}{
+		"status":    pollStatusClosed,
+		"closer":    closer,
+		"closed_at": closedAt,
+	}).Where("poll_no=? and status=?", pollNo, pollStatusOpen).Exec()
+	return err
+}
+
+// deleteWithPollNo 删除投票及其选项（投票消息发送失败时清理）
+func (d *pollDB) deleteWithPollNo(pollNo string) error {
+	tx, err := d.session.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+	if _, err = tx.DeleteFrom("poll_option").Where("poll_no=?", pollNo).Exec(); err != nil {
+		return err
+	}
+	if _, err = tx.DeleteFrom("poll").Where("poll_no=?", pollNo).Exec(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockOpenTx 锁定进行中的投票，投票已结束或已过截止时间时返回false（避免投票与结束投票并发）
+func (d *pollDB) lockOpenTx(pollNo string, now int64, tx *dbr.Tx) (bool, error) {
+	var count int64
+	_, err := tx.Select("count(*)").From("poll").Where("poll_no=? and status=? and (deadline=0 or deadline>?)", pollNo, pollStatusOpen, now).Suffix("FOR UPDATE").Load(&count)
+	return count > 0, err
+}
+
+func (d *pollDB) queryWithPollNo(pollNo string) (*pollModel, error) {
+	var m *pollModel
+	_, err := d.session.Select("*").From("poll").Where("poll_no=?", pollNo).Load(&m)
+	return m, err
+}
+
+func (d *pollDB) queryWithMessageIDs(messageIDs []string) ([]*pollModel, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	var list []*pollModel
+	_, err := d.session.Select("*").From("poll").Where("message_id in ?", messageIDs).Load(&list)
+	return list, err
+}
+
+// 查询已过截止时间但未结束的投票
+func (d *pollDB) queryExpired(now int64, limit uint64) ([]*pollModel, error) {
+	var list []*pollModel
+	_, err := d.session.Select("*").From("poll").Where("status=? and deadline>0 and deadline<=? and message_id<>''", pollStatusOpen, now).Limit(limit).Load(&list)
+	return list, err
+}
+
+func (d *pollDB) queryOptionsWithPollNos(pollNos []string) ([]*pollOptionModel, error) {
+	if len(pollNos) == 0 {
+		return nil, nil
+	}
+	var list []*pollOptionModel
+	_, err := d.session.Select("*").From("poll_option").Where("poll_no in ?", pollNos).OrderAsc("option_id").Load(&list)
+	return list, err
+}
+
+func (d *pollDB) queryVotesWithPollNos(pollNos []string) ([]*pollVoteModel, error) {
+	if len(pollNos) == 0 {
+		return nil, nil
+	}
+	var list []*pollVoteModel
+	_, err := d.session.Select("*").From("poll_vote").Where("poll_no in ?", pollNos).OrderAsc("id").Load(&list)
+	return list, err
+}
+
+func (d *pollDB) deleteVotesWithUIDTx(pollNo string, uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("poll_vote").Where("poll_no=? and uid=?", pollNo, uid).Exec()
+	return err
+}
+
+func (d *pollDB) insertVoteTx(m *pollVoteModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("poll_vote").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+type pollModel struct {
+	PollNo           string
+	MessageID        string
+	MessageSeq       uint32
+	ChannelID        string
+	ChannelType      uint8
+	Creator          string
+	Title            string
+	Multiple         int
+	Anonymous        int
+	ResultVisibility int
+	Deadline         int64
+	Status           int
+	Closer           string
+	ClosedAt         int64
+	db.BaseModel
+}
+
+type pollOptionModel struct {
+	PollNo   string
+	OptionID int
+	Content  string
+	db.BaseModel
+}
+
+type pollVoteModel struct {
+	PollNo   string
+	OptionID int
+	UID      string
+	db.BaseModel
+}
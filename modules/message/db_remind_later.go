@@ -0,0 +1,75 @@
+package message
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type remindLaterDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newRemindLaterDB(ctx *config.Context) *remindLaterDB {
+	return &remindLaterDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (r *remindLaterDB) insert(m *remindLaterModel) (int64, error) {
+	result, err := r.session.InsertInto("message_remind_later").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *remindLaterDB) queryWithID(id int64) (*remindLaterModel, error) {
+	var m *remindLaterModel
+	_, err := r.session.Select("*").From("message_remind_later").Where("id=?", id).Load(&m)
+	return m, err
+}
+
+// 查询用户待提醒的项
+func (r *remindLaterDB) queryPendingWithUID(uid string) ([]*remindLaterModel, error) {
+	var list []*remindLaterModel
+	_, err := r.session.Select("*").From("message_remind_later").Where("uid=? and status=?", uid, remindLaterStatusPending).OrderAsc("remind_at").Load(&list)
+	return list, err
+}
+
+// 查询已到提醒时间的项
+func (r *remindLaterDB) queryDue(now int64, limit uint64) ([]*remindLaterModel, error) {
+	var list []*remindLaterModel
+	_, err := r.session.Select("*").From("message_remind_later").Where("status=? and remind_at<=?", remindLaterStatusPending, now).OrderAsc("remind_at").Limit(limit).Load(&list)
+	return list, err
+}
+
+// 修改状态（只修改待提醒的项，返回是否修改成功，用于防止重复提醒）
+func (r *remindLaterDB) updateStatusIfPending(id int64, status int, remindedAt int64) (bool, error) {
+	result, err := r.session.Update("message_remind_later").SetMap(map[string]interface{}{
+		"status":      status,
+		"reminded_at": remindedAt,
+	}).Where("id=? and status=?", id, remindLaterStatusPending).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+type remindLaterModel struct {
+	UID         string
+	ChannelID   string
+	ChannelType uint8
+	MessageID   string
+	MessageSeq  uint32
+	ClientMsgNo string
+	Note        string
+	RemindAt    int64
+	Status      int
+	RemindedAt  int64
+	db.BaseModel
+}
@@ -0,0 +1,193 @@
+package message
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+)
+
+// 导出的聊天记录
+type exportArchive struct {
+	ChannelID   string           `json:"channel_id"`
+	ChannelType uint8            `json:"channel_type"`
+	ChannelName string           `json:"channel_name"`
+	StartAt     int64            `json:"start_at"`
+	EndAt       int64            `json:"end_at"`
+	ExportedAt  int64            `json:"exported_at"`
+	Messages    []*exportMessage `json:"messages"`
+}
+
+type exportMessage struct {
+	MessageID   string                 `json:"message_id"`
+	MessageSeq  uint32                 `json:"message_seq"`
+	FromUID     string                 `json:"from_uid"`
+	FromName    string                 `json:"from_name"`
+	Timestamp   int64                  `json:"timestamp"`
+	ContentType int                    `json:"content_type"`
+	Content     string                 `json:"content"`           // 可读的消息内容
+	Payload     map[string]interface{} `json:"payload,omitempty"` // 原始消息内容（编辑过的为编辑后的内容）
+	Revoked     bool                   `json:"revoked,omitempty"`
+	Edited      bool                   `json:"edited,omitempty"`
+	EditedAt    int                    `json:"edited_at,omitempty"`
+	Reactions   []*exportReaction      `json:"reactions,omitempty"`
+	Media       []*exportMedia         `json:"media,omitempty"`
+}
+
+type exportReaction struct {
+	Emoji string `json:"emoji"`
+	UID   string `json:"uid"`
+	Name  string `json:"name"`
+}
+
+type exportMedia struct {
+	Type string `json:"type"` // image/gif/voice/video/file
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+// 解析消息内容和引用的媒体 baseURL用于补全相对路径
+func parseExportContent(payload map[string]interface{}, baseURL string) (int, string, []*exportMedia) {
+	contentType := 0
+	if payload["type"] != nil {
+		if n, ok := payload["type"].(json.Number); ok {
+			t, _ := n.Int64()
+			contentType = int(t)
+		}
+	}
+	str := func(key string) string {
+		v, _ := payload[key].(string)
+		return v
+	}
+	fullURL := func(u string) string {
+		if u == "" || strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+			return u
+		}
+		return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(u, "/")
+	}
+	var media []*exportMedia
+	content := ""
+	switch common.ContentType(contentType) {
+	case common.Text:
+		content = str("content")
+	case common.Image:
+		media = append(media, &exportMedia{Type: "image", URL: fullURL(str("url"))})
+	case common.GIF:
+		media = append(media, &exportMedia{Type: "gif", URL: fullURL(str("url"))})
+	case common.Voice:
+		media = append(media, &exportMedia{Type: "voice", URL: fullURL(str("url"))})
+	case common.Video:
+		media = append(media, &exportMedia{Type: "video", URL: fullURL(str("url"))})
+	case common.File:
+		media = append(media, &exportMedia{Type: "file", Name: str("name"), URL: fullURL(str("url"))})
+		content = str("name")
+	case ContentTypePoll:
+		content = str("title")
+	default:
+		content = str("content")
+	}
+	if content == "" {
+		content = common.GetDisplayText(contentType)
+		if content == "" {
+			content = "[未知消息]"
+		}
+	}
+	for _, m := range media {
+		if m.URL == "" {
+			return contentType, content, nil
+		}
+	}
+	return contentType, content, media
+}
+
+// 打包成zip（包含messages.json和transcript.html）
+func renderExportZip(archive *exportArchive) ([]byte, error) {
+	jsonData, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	htmlData, err := renderExportHTML(archive)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{name: "messages.json", data: jsonData},
+		{name: "transcript.html", data: htmlData},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderExportHTML(archive *exportArchive) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := exportHTMLTemplate.Execute(buf, archive)
+	return buf.Bytes(), err
+}
+
+var exportHTMLTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"datetime": func(ts int64) string {
+		if ts <= 0 {
+			return ""
+		}
+		return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+	},
+	"edittime": func(ts int) string {
+		return time.Unix(int64(ts), 0).Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.ChannelName}} 聊天记录</title>
+<style>
+body{font-family:-apple-system,"PingFang SC","Microsoft YaHei",sans-serif;background:#f5f5f5;margin:0;padding:24px;color:#333}
+.header{max-width:860px;margin:0 auto 16px}
+.header h1{font-size:20px;margin:0 0 4px}
+.header p{color:#888;font-size:13px;margin:0}
+.msg{max-width:860px;margin:0 auto 8px;background:#fff;border-radius:6px;padding:10px 14px}
+.meta{font-size:12px;color:#999;margin-bottom:4px}
+.meta .name{color:#3a7bd5;font-weight:bold;margin-right:8px}
+.content{white-space:pre-wrap;word-break:break-all}
+.revoked{color:#aaa;font-style:italic}
+.edited{font-size:12px;color:#aaa;margin-left:6px}
+.media a{font-size:13px;margin-right:8px}
+.media img{max-width:240px;max-height:240px;display:block;margin-top:4px}
+.reactions{margin-top:6px;font-size:12px;color:#666}
+.reactions span{background:#f0f0f0;border-radius:10px;padding:2px 8px;margin-right:4px;display:inline-block}
+</style>
+</head>
+<body>
+<div class="header">
+<h1>{{.ChannelName}}</h1>
+<p>{{datetime .StartAt}} ~ {{datetime .EndAt}} · 共{{len .Messages}}条消息 · 导出于 {{datetime .ExportedAt}}</p>
+</div>
+{{range .Messages}}<div class="msg" id="msg-{{.MessageID}}">
+<div class="meta"><span class="name">{{if .FromName}}{{.FromName}}{{else}}{{.FromUID}}{{end}}</span>{{datetime .Timestamp}}</div>
+{{if .Revoked}}<div class="content revoked">[消息已撤回]</div>{{else}}<div class="content">{{.Content}}{{if .Edited}}<span class="edited">(已编辑 {{edittime .EditedAt}})</span>{{end}}</div>
+{{if .Media}}<div class="media">{{range .Media}}{{if or (eq .Type "image") (eq .Type "gif")}}<a href="{{.URL}}" target="_blank"><img src="{{.URL}}" alt="图片"></a>{{else}}<a href="{{.URL}}" target="_blank">[{{.Type}}] {{if .Name}}{{.Name}}{{else}}{{.URL}}{{end}}</a>{{end}}{{end}}</div>{{end}}{{end}}
+{{if .Reactions}}<div class="reactions">{{range .Reactions}}<span title="{{.Name}}">{{.Emoji}} {{.Name}}</span>{{end}}</div>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
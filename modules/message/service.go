@@ -1,25 +1,39 @@
 package message
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
 )
 
 type IService interface {
 	DeleteConversation(uid string, channelID string, channelType uint8) error
+	// GetMessages 获取频道内的指定消息 单聊时loginUID为会话的一方，channelID为另一方
+	GetMessages(channelID string, channelType uint8, loginUID string, messageIDs []string) ([]*config.MessageResp, error)
+	// RevokeMessages 以系统身份撤回频道内的指定消息 单聊时loginUID为会话的一方，channelID为另一方
+	RevokeMessages(channelID string, channelType uint8, loginUID string, messageIDs []string) error
 }
 
 type Service struct {
 	ctx *config.Context
 	log.Log
+	db             *DB
+	messageExtraDB *messageExtraDB
 }
 
 func NewService(ctx *config.Context) *Service {
 
 	return &Service{
-		ctx: ctx,
-		Log: log.NewTLog("message.Service"),
+		ctx:            ctx,
+		Log:            log.NewTLog("message.Service"),
+		db:             NewDB(ctx),
+		messageExtraDB: newMessageExtraDB(ctx),
 	}
 }
 
@@ -47,3 +61,122 @@ func (s *Service) DeleteConversation(uid string, channelID string, channelType u
 
 	return nil
 }
+
+// GetMessages 获取频道内的指定消息（不属于该频道的消息会被忽略）
+func (s *Service) GetMessages(channelID string, channelType uint8, loginUID string, messageIDs []string) ([]*config.MessageResp, error) {
+	fakeChannelID := messageFakeChannelID(channelID, channelType, loginUID)
+	models, err := s.db.queryMessagesWithMessageIDs(fakeChannelID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]*config.MessageResp, 0, len(models))
+	for _, model := range models {
+		if model.ChannelID != fakeChannelID || model.ChannelType != channelType {
+			continue
+		}
+		resps = append(resps, &config.MessageResp{
+			MessageID:    model.MessageID,
+			MessageIDStr: strconv.FormatInt(model.MessageID, 10),
+			MessageSeq:   model.MessageSeq,
+			ClientMsgNo:  model.ClientMsgNo,
+			Setting:      model.Setting,
+			FromUID:      model.FromUID,
+			ChannelID:    channelID,
+			ChannelType:  model.ChannelType,
+			Timestamp:    int32(model.Timestamp),
+			Payload:      model.Payload,
+			IsDeleted:    model.IsDeleted,
+		})
+	}
+	return resps, nil
+}
+
+// RevokeMessages 以系统身份撤回频道内的指定消息
+func (s *Service) RevokeMessages(channelID string, channelType uint8, loginUID string, messageIDs []string) error {
+	messages, err := s.GetMessages(channelID, channelType, loginUID, messageIDs)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	fromUID := s.ctx.GetConfig().Account.SystemUID
+	if channelType == common.ChannelTypePerson.Uint8() {
+		fromUID = loginUID
+	}
+	return s.revokeWithSystem(channelID, channelType, messageFakeChannelID(channelID, channelType, loginUID), fromUID, messages)
+}
+
+// revokeWithSystem 以系统身份撤回消息 fakeChannelID为消息存储使用的频道ID，fromUID为撤回命令的发送者
+func (s *Service) revokeWithSystem(channelID string, channelType uint8, fakeChannelID string, fromUID string, messages []*config.MessageResp) error {
+	systemUID := s.ctx.GetConfig().Account.SystemUID
+	revokeMessageIDs := make([]string, 0, len(messages))
+	tx, err := s.db.session.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	for _, message := range messages {
+		messageID := fmt.Sprintf("%d", message.MessageID)
+		revokeMessageIDs = append(revokeMessageIDs, messageID)
+		err = s.messageExtraDB.insertOrUpdateRevokeTx(&messageExtraModel{
+			MessageID:   messageID,
+			MessageSeq:  message.MessageSeq,
+			FromUID:     message.FromUID,
+			ChannelID:   fakeChannelID,
+			ChannelType: channelType,
+			Revoke:      1,
+			Revoker:     systemUID,
+			Version:     time.Now().UnixNano() / 1e3,
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	eventID, err := s.ctx.EventBegin(&wkevent.Data{
+		Event: event.EventUpdateSearchMessage,
+		Data: &config.UpdateSearchMessageReq{
+			MessageIDs: revokeMessageIDs,
+			ChannelID:  channelID,
+		},
+		Type: wkevent.None,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	s.ctx.EventCommit(eventID)
+
+	for _, message := range messages {
+		err = s.ctx.SendRevoke(&config.MsgRevokeReq{
+			Operator:     systemUID,
+			OperatorName: "系统",
+			FromUID:      fromUID,
+			ChannelID:    channelID,
+			ChannelType:  channelType,
+			MessageID:    message.MessageID,
+		})
+		if err != nil {
+			return fmt.Errorf("发送撤回消息失败！%w", err)
+		}
+	}
+	return nil
+}
+
+// messageFakeChannelID 消息存储使用的频道ID，单聊为双方uid组合
+func messageFakeChannelID(channelID string, channelType uint8, loginUID string) string {
+	if channelType == common.ChannelTypePerson.Uint8() {
+		return common.GetFakeChannelIDWith(channelID, loginUID)
+	}
+	return channelID
+}
@@ -0,0 +1,45 @@
+-- +migrate Up
+
+create table `poll`(
+  id                 bigint          not null primary key AUTO_INCREMENT,
+  poll_no            VARCHAR(40)     not null default '',  -- 投票唯一编号
+  message_id         VARCHAR(20)     not null default '',  -- 投票消息唯一ID
+  message_seq        bigint          not null default 0,   -- 投票消息序列号
+  channel_id         VARCHAR(100)    not null default '',  -- 频道ID
+  channel_type       smallint        not null default 0,   -- 频道类型
+  creator            VARCHAR(40)     not null default '',  -- 发起人uid
+  title              VARCHAR(255)    not null default '',  -- 投票标题
+  multiple           smallint        not null default 0,   -- 是否多选
+  anonymous          smallint        not null default 0,   -- 是否匿名
+  result_visibility  smallint        not null default 0,   -- 结果可见性 0.所有人可见 1.投票后可见 2.结束后可见
+  deadline           bigint          not null default 0,   -- 截止时间（秒） 0表示不限
+  status             smallint        not null default 0,   -- 状态 0.进行中 1.已结束
+  closer             VARCHAR(40)     not null default '',  -- 结束者uid
+  closed_at          bigint          not null default 0,   -- 结束时间（秒）
+  created_at         timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at         timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX poll_poll_no_idx on `poll` (poll_no);
+CREATE INDEX poll_message_idx on `poll` (message_id);
+CREATE INDEX poll_status_deadline_idx on `poll` (status, deadline);
+
+create table `poll_option`(
+  id           bigint          not null primary key AUTO_INCREMENT,
+  poll_no      VARCHAR(40)     not null default '',  -- 投票编号
+  option_id    integer         not null default 0,   -- 选项编号（从1开始）
+  content      VARCHAR(255)    not null default '',  -- 选项内容
+  created_at   timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX poll_option_poll_no_option_idx on `poll_option` (poll_no, option_id);
+
+create table `poll_vote`(
+  id           bigint          not null primary key AUTO_INCREMENT,
+  poll_no      VARCHAR(40)     not null default '',  -- 投票编号
+  option_id    integer         not null default 0,   -- 选项编号
+  uid          VARCHAR(40)     not null default '',  -- 投票者uid
+  created_at   timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX poll_vote_poll_no_uid_option_idx on `poll_vote` (poll_no, uid, option_id);
+CREATE INDEX poll_vote_poll_no_idx on `poll_vote` (poll_no);
@@ -0,0 +1,19 @@
+-- +migrate Up
+
+create table `message_remind_later`(
+  id             bigint          not null primary key AUTO_INCREMENT,
+  uid            VARCHAR(40)     not null default '',  -- 设置提醒的用户uid
+  channel_id     VARCHAR(100)    not null default '',  -- 消息所在频道ID（用户视角）
+  channel_type   smallint        not null default 0,   -- 频道类型
+  message_id     VARCHAR(20)     not null default '',  -- 消息唯一ID
+  message_seq    bigint          not null default 0,   -- 消息序列号
+  client_msg_no  VARCHAR(40)     not null default '',  -- 消息client msg no
+  note           VARCHAR(255)    not null default '',  -- 提醒备注
+  remind_at      bigint          not null default 0,   -- 提醒时间（秒）
+  status         smallint        not null default 0,   -- 状态 0.待提醒 1.已提醒 2.已取消
+  reminded_at    bigint          not null default 0,   -- 实际提醒时间（秒）
+  created_at     timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at     timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE INDEX message_remind_later_uid_idx on `message_remind_later` (uid, status);
+CREATE INDEX message_remind_later_status_remind_at_idx on `message_remind_later` (status, remind_at);
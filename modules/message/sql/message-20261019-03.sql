@@ -0,0 +1,23 @@
+-- +migrate Up
+
+create table `message_export`(
+  id             bigint          not null primary key AUTO_INCREMENT,
+  export_no      VARCHAR(40)     not null default '',  -- 导出编号
+  requester      VARCHAR(40)     not null default '',  -- 发起导出的uid
+  is_manager     smallint        not null default 0,   -- 是否后台管理员发起
+  view_uid       VARCHAR(40)     not null default '',  -- 以谁的视角导出（会过滤该用户清空和删除的消息） 空表示完整导出
+  channel_id     VARCHAR(100)    not null default '',  -- 频道ID（单聊为fake channel id）
+  channel_type   smallint        not null default 0,   -- 频道类型
+  start_at       bigint          not null default 0,   -- 开始时间（秒）
+  end_at         bigint          not null default 0,   -- 结束时间（秒）
+  status         smallint        not null default 0,   -- 状态 0.等待导出 1.导出中 2.导出成功 3.导出失败
+  path           VARCHAR(255)    not null default '',  -- 导出文件路径
+  message_count  integer         not null default 0,   -- 导出消息数量
+  error          VARCHAR(255)    not null default '',  -- 失败原因
+  finished_at    bigint          not null default 0,   -- 完成时间（秒）
+  created_at     timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at     timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_export_export_no_idx on `message_export` (export_no);
+CREATE INDEX message_export_requester_idx on `message_export` (requester);
+CREATE INDEX message_export_status_idx on `message_export` (status);
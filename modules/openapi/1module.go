@@ -1,12 +1,15 @@
 package openapi
 
 import (
-	_ "embed"
+	"embed"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/register"
 )
 
+//go:embed sql
+var sqlFS embed.FS
+
 //go:embed swagger/api.yaml
 var swaggerContent string
 
@@ -17,9 +20,20 @@ func init() {
 		return register.Module{
 			Name:    "openapi",
 			Swagger: swaggerContent,
+			SQLDir:  register.NewSQLFS(sqlFS),
 			SetupAPI: func() register.APIRouter {
 				return api
 			},
 		}
 	})
+
+	// 开放平台应用管理
+	register.AddModule(func(ctx interface{}) register.Module {
+		return register.Module{
+			Name: "openapi_manager",
+			SetupAPI: func() register.APIRouter {
+				return NewManager(ctx.(*config.Context))
+			},
+		}
+	})
 }
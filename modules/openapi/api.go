@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/robot"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +24,14 @@ type OpenAPI struct {
 	openapiAuthcodePrefix    string
 	openapiAccessTokenPrefix string
 	userService              user.IService
+	groupService             group.IService
+	robotService             robot.IService
+	db                       *DB
+	log.Log
+
+	keysLock     sync.Mutex
+	keys         []*signingKey // id_token签名密钥（最新的在前）
+	keysLoadedAt time.Time
 }
 
 func New(ctx *config.Context) *OpenAPI {
@@ -30,6 +42,10 @@ func New(ctx *config.Context) *OpenAPI {
 		openapiAuthcodePrefix:    "openapi:authcodePrefix:",
 		openapiAccessTokenPrefix: "openapi:accessTokenPrefix:",
 		userService:              user.NewService(ctx),
+		groupService:             group.NewService(ctx),
+		robotService:             robot.NewService(ctx),
+		db:                       newDB(ctx),
+		Log:                      log.NewTLog("OpenAPI"),
 	}
 }
 
@@ -41,12 +57,36 @@ func (o *OpenAPI) Route(r *wkhttp.WKHttp) {
 		// #################### openapi ####################
 		openapinoauth.GET("/openapi/access_token", o.accessTokenGet) // 获取用户的授权access_token
 		openapinoauth.GET("/openapi/userinfo", o.userinfoGet)        // 获取用户信息
+
+		// #################### oauth2 ####################
+		openapinoauth.GET("/openapi/.well-known/openid-configuration", o.oidcDiscovery) // OIDC发现文档
+		openapinoauth.GET("/openapi/oauth/jwks", o.oauthJWKS)                           // id_token验签公钥
+		openapinoauth.GET("/openapi/oauth/authorize", o.oauthAuthorize)                 // 授权端点
+		openapinoauth.POST("/openapi/oauth/token", o.oauthToken)                        // 令牌端点
+		openapinoauth.POST("/openapi/oauth/revoke", o.oauthRevoke)                      // 注销令牌
+		openapinoauth.POST("/openapi/oauth/introspect", o.oauthIntrospect)              // 令牌自省
+		openapinoauth.GET("/openapi/oauth/userinfo", o.oauthUserinfo)                   // OIDC用户信息
+		openapinoauth.POST("/openapi/oauth/userinfo", o.oauthUserinfo)
+
+		// #################### 开放接口（使用访问令牌） ####################
+		openapinoauth.GET("/openapi/resource/friends", o.authResource(ScopeFriendsRead), o.resourceFriends)        // 好友列表
+		openapinoauth.GET("/openapi/resource/groups", o.authResource(ScopeGroupsRead), o.resourceGroups)           // 群列表
+		openapinoauth.GET("/openapi/resource/channels", o.authResource(ScopeMessagesSend), o.resourceChannels)     // 用户授权的频道
+		openapinoauth.POST("/openapi/resource/messages", o.authResource(ScopeMessagesSend), o.resourceMessageSend) // 发送消息
 	}
 	// 需要用户认证
 	openapi := r.Group("/v1", o.ctx.AuthMiddleware(r))
 	{
 		// #################### openapi ####################
 		openapi.GET("/openapi/authcode", o.authcodeGet) // 获取用户的授权authcode
+
+		// #################### oauth2 ####################
+		openapi.GET("/openapi/oauth/consent", o.oauthConsentGet)            // 授权确认页信息
+		openapi.POST("/openapi/oauth/consent", o.oauthConsent)              // 确认或拒绝授权
+		openapi.GET("/openapi/oauth/grants", o.oauthGrants)                 // 我授权过的应用
+		openapi.DELETE("/openapi/oauth/grants/:app_id", o.oauthGrantDelete) // 取消授权
+		openapi.GET("/openapi/picker", o.pickerGet)                         // 频道选择器
+		openapi.POST("/openapi/picker", o.pickerSave)                       // 选择授权给应用的频道
 	}
 }
 
@@ -0,0 +1,211 @@
+package openapi
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// Manager 开放平台应用管理
+type Manager struct {
+	ctx        *config.Context
+	appService app.IService
+	log.Log
+}
+
+// NewManager NewManager
+func NewManager(ctx *config.Context) *Manager {
+	return &Manager{
+		ctx:        ctx,
+		appService: app.NewService(ctx),
+		Log:        log.NewTLog("OpenAPIManager"),
+	}
+}
+
+// Route 路由配置
+func (m *Manager) Route(r *wkhttp.WKHttp) {
+	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r), audit.Middleware(m.ctx))
+	{
+		auth.GET("/openapi/apps", m.apps)                          // 应用列表
+		auth.POST("/openapi/apps", m.appAdd)                       // 添加应用
+		auth.PUT("/openapi/apps/:app_id", m.appUpdate)             // 修改应用
+		auth.POST("/openapi/apps/:app_id/resetkey", m.appResetKey) // 重置应用密钥
+	}
+}
+
+func (m *Manager) apps(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	apps, err := m.appService.GetApps()
+	if err != nil {
+		m.Error("查询应用失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询应用失败！"))
+		return
+	}
+	list := make([]*appResp, 0, len(apps))
+	for _, a := range apps {
+		list = append(list, newAppResp(a))
+	}
+	c.Response(list)
+}
+
+func (m *Manager) appAdd(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req appReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	exist, _ := m.appService.GetApp(req.AppID)
+	if exist != nil {
+		c.ResponseError(errors.New("应用ID已存在！"))
+		return
+	}
+	created, err := m.appService.CreateApp(app.Req{AppID: req.AppID})
+	if err != nil {
+		m.Error("创建应用失败！", zap.Error(err))
+		c.ResponseError(errors.New("创建应用失败！"))
+		return
+	}
+	req.Status = app.StatusEnable.Int() // 新建的应用默认启用
+	err = m.appService.UpdateApp(req.toUpdateReq(req.AppID))
+	if err != nil {
+		m.Error("修改应用失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]string{
+		"app_id":  created.AppID,
+		"app_key": created.AppKey,
+	})
+}
+
+func (m *Manager) appUpdate(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req appReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	appID := c.Param("app_id")
+	req.AppID = appID
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if _, err = m.appService.GetApp(appID); err != nil {
+		c.ResponseError(errors.New("应用不存在！"))
+		return
+	}
+	err = m.appService.UpdateApp(req.toUpdateReq(appID))
+	if err != nil {
+		m.Error("修改应用失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
+func (m *Manager) appResetKey(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	appID := c.Param("app_id")
+	if _, err = m.appService.GetApp(appID); err != nil {
+		c.ResponseError(errors.New("应用不存在！"))
+		return
+	}
+	appKey, err := m.appService.ResetAppKey(appID)
+	if err != nil {
+		m.Error("重置应用密钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("重置应用密钥失败！"))
+		return
+	}
+	c.Response(map[string]string{
+		"app_key": appKey,
+	})
+}
+
+type appReq struct {
+	AppID        string   `json:"app_id"`
+	AppName      string   `json:"app_name"`
+	AppLogo      string   `json:"app_logo"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential int      `json:"confidential"` // 1.机密客户端（服务端应用） 0.公开客户端（原生或单页应用，必须使用PKCE）
+	RateLimit    int      `json:"rate_limit"`   // 每分钟允许调用开放接口的次数 0.使用默认值
+	Status       int      `json:"status"`       // 1.启用 0.禁用
+}
+
+func (r appReq) check() error {
+	if strings.TrimSpace(r.AppID) == "" {
+		return errors.New("应用ID不能为空！")
+	}
+	if strings.TrimSpace(r.AppName) == "" {
+		return errors.New("应用名称不能为空！")
+	}
+	return checkScopes(r.Scopes, r.Scopes)
+}
+
+func (r appReq) toUpdateReq(appID string) app.UpdateReq {
+	return app.UpdateReq{
+		AppID:        appID,
+		AppName:      r.AppName,
+		AppLogo:      r.AppLogo,
+		RedirectURIs: r.RedirectURIs,
+		Scopes:       r.Scopes,
+		Confidential: r.Confidential,
+		RateLimit:    r.RateLimit,
+		Status:       app.Status(r.Status),
+	}
+}
+
+type appResp struct {
+	AppID        string   `json:"app_id"`
+	AppName      string   `json:"app_name"`
+	AppLogo      string   `json:"app_logo"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential int      `json:"confidential"`
+	RateLimit    int      `json:"rate_limit"`
+	Status       int      `json:"status"`
+}
+
+func newAppResp(a *app.Resp) *appResp {
+	return &appResp{
+		AppID:        a.AppID,
+		AppName:      a.AppName,
+		AppLogo:      a.AppLogo,
+		RedirectURIs: a.RedirectURIs,
+		Scopes:       a.Scopes,
+		Confidential: a.Confidential,
+		RateLimit:    a.RateLimit,
+		Status:       a.Status.Int(),
+	}
+}
@@ -0,0 +1,806 @@
+package openapi
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 授权请求参数
+type authorizeReq struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             int    `json:"approve"` // 用户是否同意授权 1.同意
+}
+
+func authorizeReqWithQuery(c *wkhttp.Context) authorizeReq {
+	return authorizeReq{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		Nonce:               c.Query("nonce"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+}
+
+// 授权码中保存的数据
+type authCodeData struct {
+	AppID         string `json:"app_id"`
+	UID           string `json:"uid"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	CodeChallenge string `json:"code_challenge"`
+	Nonce         string `json:"nonce"`
+	AuthTime      int64  `json:"auth_time"`
+}
+
+// accessTokenInfo 访问令牌信息
+type accessTokenInfo struct {
+	AppID    string `json:"app_id"`
+	UID      string `json:"uid"`
+	Scope    string `json:"scope"`
+	FamilyID string `json:"family_id"`
+	ExpireAt int64  `json:"expire_at"`
+}
+
+func (a *accessTokenInfo) hasScope(scope string) bool {
+	return containsScopes(parseScopes(a.Scope), []string{scope})
+}
+
+func (o *OpenAPI) issuer() string {
+	return o.ctx.GetConfig().External.APIBaseURL + "/openapi"
+}
+
+// checkAuthorizeReq 校验授权请求 第三个返回值表示错误是否可以通过回调地址返回给应用
+func (o *OpenAPI) checkAuthorizeReq(req authorizeReq) (*app.Resp, []string, bool, *oauthError) {
+	if strings.TrimSpace(req.ClientID) == "" {
+		return nil, nil, false, newOAuthError("invalid_request", "client_id不能为空")
+	}
+	appResp, err := o.appService.GetApp(req.ClientID)
+	if err != nil || appResp == nil || appResp.Status != app.StatusEnable {
+		return nil, nil, false, newOAuthError("invalid_client", "应用不存在或已禁用")
+	}
+	if req.RedirectURI == "" || !matchRedirectURI(appResp.RedirectURIs, req.RedirectURI) {
+		return nil, nil, false, newOAuthError("invalid_request", "redirect_uri未登记")
+	}
+	if req.ResponseType != "code" {
+		return nil, nil, true, newOAuthError("unsupported_response_type", "只支持授权码模式")
+	}
+	scopes := parseScopes(req.Scope)
+	if len(scopes) == 0 {
+		for _, scope := range []string{ScopeOpenID, ScopeProfile} {
+			if containsScopes(appResp.Scopes, []string{scope}) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if err := checkScopes(scopes, appResp.Scopes); err != nil {
+		return nil, nil, true, newOAuthError("invalid_scope", err.Error())
+	}
+	if req.CodeChallenge == "" {
+		if appResp.Confidential != 1 {
+			return nil, nil, true, newOAuthError("invalid_request", "公开客户端必须使用PKCE")
+		}
+	} else if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return nil, nil, true, newOAuthError("invalid_request", "code_challenge_method只支持S256")
+	}
+	return appResp, scopes, false, nil
+}
+
+func authorizeErrorRedirect(req authorizeReq, oauthErr *oauthError, issuer string) string {
+	params := url.Values{}
+	params.Set("error", oauthErr.Code)
+	params.Set("error_description", oauthErr.Description)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	params.Set("iss", issuer)
+	return redirectWithParams(req.RedirectURI, params)
+}
+
+// 授权端点 校验后跳转到客户端的授权确认页
+func (o *OpenAPI) oauthAuthorize(c *wkhttp.Context) {
+	req := authorizeReqWithQuery(c)
+	_, _, redirectable, oauthErr := o.checkAuthorizeReq(req)
+	if oauthErr != nil {
+		if redirectable {
+			c.Redirect(http.StatusFound, authorizeErrorRedirect(req, oauthErr, o.issuer()))
+			return
+		}
+		c.String(http.StatusBadRequest, oauthErr.Description)
+		return
+	}
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s/oauth/authorize?%s", o.ctx.GetConfig().External.H5BaseURL, c.Request.URL.RawQuery))
+}
+
+// 授权确认页获取应用和scope信息
+func (o *OpenAPI) oauthConsentGet(c *wkhttp.Context) {
+	req := authorizeReqWithQuery(c)
+	appResp, scopes, _, oauthErr := o.checkAuthorizeReq(req)
+	if oauthErr != nil {
+		c.ResponseError(errors.New(oauthErr.Description))
+		return
+	}
+	grantM, err := o.db.queryGrant(appResp.AppID, c.GetLoginUID())
+	if err != nil {
+		o.Error("查询授权记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权记录失败！"))
+		return
+	}
+	scopeList := make([]map[string]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeList = append(scopeList, map[string]string{
+			"scope":       scope,
+			"description": scopeDescriptions[scope],
+		})
+	}
+	c.Response(map[string]interface{}{
+		"app_id":    appResp.AppID,
+		"app_name":  appResp.AppName,
+		"app_logo":  appResp.AppLogo,
+		"scopes":    scopeList,
+		"consented": grantM != nil && containsScopes(parseScopes(grantM.Scopes), scopes), // 已同意过这些scope，客户端可以直接确认
+	})
+}
+
+// 用户确认或拒绝授权 返回需要跳转的回调地址
+func (o *OpenAPI) oauthConsent(c *wkhttp.Context) {
+	var req authorizeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	appResp, scopes, redirectable, oauthErr := o.checkAuthorizeReq(req)
+	if oauthErr != nil {
+		if redirectable {
+			c.Response(map[string]string{"redirect_uri": authorizeErrorRedirect(req, oauthErr, o.issuer())})
+			return
+		}
+		c.ResponseError(errors.New(oauthErr.Description))
+		return
+	}
+	if req.Approve != 1 {
+		c.Response(map[string]string{"redirect_uri": authorizeErrorRedirect(req, newOAuthError("access_denied", "用户拒绝了授权"), o.issuer())})
+		return
+	}
+	loginUID := c.GetLoginUID()
+	grantM, err := o.db.queryGrant(appResp.AppID, loginUID)
+	if err != nil {
+		o.Error("查询授权记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权记录失败！"))
+		return
+	}
+	grantScopes := scopes
+	if grantM != nil {
+		grantScopes = mergeScopes(parseScopes(grantM.Scopes), scopes)
+	}
+	err = o.db.insertOrUpdateGrant(&grantModel{
+		AppID:  appResp.AppID,
+		UID:    loginUID,
+		Scopes: strings.Join(grantScopes, " "),
+	})
+	if err != nil {
+		o.Error("保存授权记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存授权记录失败！"))
+		return
+	}
+	code := newOpaqueToken()
+	err = o.ctx.GetRedisConn().SetAndExpire(authCodePrefix+hashToken(code), util.ToJson(&authCodeData{
+		AppID:         appResp.AppID,
+		UID:           loginUID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      time.Now().Unix(),
+	}), authCodeExpire)
+	if err != nil {
+		o.Error("保存授权码失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存授权码失败！"))
+		return
+	}
+	params := url.Values{}
+	params.Set("code", code)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	params.Set("iss", o.issuer())
+	c.Response(map[string]string{"redirect_uri": redirectWithParams(req.RedirectURI, params)})
+}
+
+// authenticateClient 客户端认证（client_secret_basic、client_secret_post或公开客户端none）
+func (o *OpenAPI) authenticateClient(c *wkhttp.Context) (*app.Resp, *oauthError) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+	if clientID == "" {
+		return nil, newOAuthError("invalid_client", "client_id不能为空")
+	}
+	appResp, err := o.appService.GetApp(clientID)
+	if err != nil || appResp == nil || appResp.Status != app.StatusEnable {
+		return nil, newOAuthError("invalid_client", "应用不存在或已禁用")
+	}
+	if clientSecret == "" {
+		if appResp.Confidential == 1 {
+			return nil, newOAuthError("invalid_client", "客户端认证失败")
+		}
+		return appResp, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(clientSecret), []byte(appResp.AppKey)) != 1 {
+		return nil, newOAuthError("invalid_client", "客户端认证失败")
+	}
+	return appResp, nil
+}
+
+func responseOAuthError(c *wkhttp.Context, oauthErr *oauthError) {
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="openapi"`)
+	}
+	c.JSON(status, oauthErr)
+}
+
+// 令牌端点
+func (o *OpenAPI) oauthToken(c *wkhttp.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	appResp, oauthErr := o.authenticateClient(c)
+	if oauthErr != nil {
+		responseOAuthError(c, oauthErr)
+		return
+	}
+	var resp map[string]interface{}
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		resp, oauthErr = o.exchangeAuthCode(c, appResp)
+	case "refresh_token":
+		resp, oauthErr = o.exchangeRefreshToken(c, appResp)
+	default:
+		oauthErr = newOAuthError("unsupported_grant_type", "只支持authorization_code和refresh_token")
+	}
+	if oauthErr != nil {
+		responseOAuthError(c, oauthErr)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (o *OpenAPI) exchangeAuthCode(c *wkhttp.Context, appResp *app.Resp) (map[string]interface{}, *oauthError) {
+	code := c.PostForm("code")
+	if code == "" {
+		return nil, newOAuthError("invalid_request", "code不能为空")
+	}
+	conn := o.ctx.GetRedisConn()
+	key := authCodePrefix + hashToken(code)
+	value, err := conn.GetString(key)
+	if err != nil {
+		o.Error("查询授权码失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "查询授权码失败")
+	}
+	if value == "" {
+		return nil, newOAuthError("invalid_grant", "授权码无效或已过期")
+	}
+	// 授权码只能使用一次 通过原子自增抢占，并发请求只有第一个能成功
+	usedKey := authCodeUsedPrefix + hashToken(code)
+	used, err := conn.Incr(usedKey)
+	if err != nil {
+		o.Error("使用授权码失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "使用授权码失败")
+	}
+	if err = conn.SetExpire(usedKey, authCodeExpire); err != nil {
+		o.Warn("设置授权码使用记录过期时间失败！", zap.Error(err))
+	}
+	if used != 1 {
+		return nil, newOAuthError("invalid_grant", "授权码已被使用")
+	}
+	if err = conn.Del(key); err != nil {
+		o.Warn("删除授权码失败！", zap.Error(err))
+	}
+	var data authCodeData
+	if err = util.ReadJsonByByte([]byte(value), &data); err != nil {
+		return nil, newOAuthError("invalid_grant", "授权码无效")
+	}
+	if data.AppID != appResp.AppID {
+		return nil, newOAuthError("invalid_grant", "授权码不属于该应用")
+	}
+	if c.PostForm("redirect_uri") != data.RedirectURI {
+		return nil, newOAuthError("invalid_grant", "redirect_uri不匹配")
+	}
+	if data.CodeChallenge != "" && !verifyPKCE(c.PostForm("code_verifier"), data.CodeChallenge) {
+		return nil, newOAuthError("invalid_grant", "code_verifier校验失败")
+	}
+	if _, err = o.userService.GetUser(data.UID); err != nil {
+		return nil, newOAuthError("invalid_grant", "用户不可用")
+	}
+	resp, err := o.issueTokens(appResp.AppID, data.UID, parseScopes(data.Scope), util.GenerUUID(), data.Nonce, data.AuthTime)
+	if err != nil {
+		o.Error("签发令牌失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "签发令牌失败")
+	}
+	return resp, nil
+}
+
+// exchangeRefreshToken 刷新令牌每次使用后轮换，旧的刷新令牌再次使用视为泄露并注销整个令牌族
+func (o *OpenAPI) exchangeRefreshToken(c *wkhttp.Context, appResp *app.Resp) (map[string]interface{}, *oauthError) {
+	refreshToken := c.PostForm("refresh_token")
+	if refreshToken == "" {
+		return nil, newOAuthError("invalid_request", "refresh_token不能为空")
+	}
+	tokenHash := hashToken(refreshToken)
+	tokenM, err := o.db.queryTokenWithHash(tokenHash)
+	if err != nil {
+		o.Error("查询刷新令牌失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "查询刷新令牌失败")
+	}
+	if tokenM == nil || tokenM.TokenType != tokenTypeRefresh || tokenM.AppID != appResp.AppID {
+		return nil, newOAuthError("invalid_grant", "刷新令牌无效")
+	}
+	now := time.Now().Unix()
+	if tokenM.RevokedAt != 0 {
+		o.Warn("刷新令牌被重复使用，注销整个令牌族", zap.String("appID", tokenM.AppID), zap.String("uid", tokenM.UID))
+		o.revokeFamilyTokens(tokenM.FamilyID)
+		return nil, newOAuthError("invalid_grant", "刷新令牌已失效")
+	}
+	if tokenM.ExpireAt <= now {
+		return nil, newOAuthError("invalid_grant", "刷新令牌已过期")
+	}
+	scopes := parseScopes(tokenM.Scopes)
+	if scope := c.PostForm("scope"); scope != "" {
+		requested := parseScopes(scope)
+		if !containsScopes(scopes, requested) {
+			return nil, newOAuthError("invalid_scope", "不能申请超出原授权的scope")
+		}
+		scopes = requested
+	}
+	grantM, err := o.db.queryGrant(tokenM.AppID, tokenM.UID)
+	if err != nil {
+		o.Error("查询授权记录失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "查询授权记录失败")
+	}
+	if grantM == nil {
+		return nil, newOAuthError("invalid_grant", "用户已取消授权")
+	}
+	if _, err = o.userService.GetUser(tokenM.UID); err != nil {
+		return nil, newOAuthError("invalid_grant", "用户不可用")
+	}
+	rotated, err := o.db.revokeToken(tokenHash, now)
+	if err != nil {
+		o.Error("轮换刷新令牌失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "轮换刷新令牌失败")
+	}
+	if !rotated { // 并发使用同一个刷新令牌
+		o.revokeFamilyTokens(tokenM.FamilyID)
+		return nil, newOAuthError("invalid_grant", "刷新令牌已失效")
+	}
+	resp, err := o.issueTokens(tokenM.AppID, tokenM.UID, scopes, tokenM.FamilyID, "", 0)
+	if err != nil {
+		o.Error("签发令牌失败！", zap.Error(err))
+		return nil, newOAuthError("server_error", "签发令牌失败")
+	}
+	return resp, nil
+}
+
+// issueTokens 签发访问令牌、刷新令牌和id_token（scope包含openid时）
+func (o *OpenAPI) issueTokens(appID string, uid string, scopes []string, familyID string, nonce string, authTime int64) (map[string]interface{}, error) {
+	now := time.Now()
+	scope := strings.Join(scopes, " ")
+	accessToken := newOpaqueToken()
+	accessTokenHash := hashToken(accessToken)
+	info := &accessTokenInfo{
+		AppID:    appID,
+		UID:      uid,
+		Scope:    scope,
+		FamilyID: familyID,
+		ExpireAt: now.Add(accessTokenExpire).Unix(),
+	}
+	err := o.db.insertToken(&tokenModel{
+		TokenHash: accessTokenHash,
+		TokenType: tokenTypeAccess,
+		AppID:     appID,
+		UID:       uid,
+		Scopes:    scope,
+		FamilyID:  familyID,
+		ExpireAt:  info.ExpireAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = o.ctx.GetRedisConn().SetAndExpire(accessTokenCachePrefix+accessTokenHash, util.ToJson(info), accessTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := newOpaqueToken()
+	err = o.db.insertToken(&tokenModel{
+		TokenHash: hashToken(refreshToken),
+		TokenType: tokenTypeRefresh,
+		AppID:     appID,
+		UID:       uid,
+		Scopes:    scope,
+		FamilyID:  familyID,
+		ExpireAt:  now.Add(refreshTokenExpire).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(accessTokenExpire.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         scope,
+	}
+	if containsScopes(scopes, []string{ScopeOpenID}) {
+		idToken, err := o.signIDToken(appID, uid, scopes, nonce, authTime)
+		if err != nil {
+			return nil, err
+		}
+		resp["id_token"] = idToken
+	}
+	return resp, nil
+}
+
+func (o *OpenAPI) signIDToken(appID string, uid string, scopes []string, nonce string, authTime int64) (string, error) {
+	keys, err := o.signingKeys()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": o.issuer(),
+		"sub": uid,
+		"aud": appID,
+		"iat": now.Unix(),
+		"exp": now.Add(idTokenExpire).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if authTime > 0 {
+		claims["auth_time"] = authTime
+	}
+	if containsScopes(scopes, []string{ScopeProfile}) {
+		for k, v := range o.profileClaims(uid) {
+			claims[k] = v
+		}
+	}
+	return keys[0].signJWT(claims)
+}
+
+func (o *OpenAPI) profileClaims(uid string) map[string]interface{} {
+	userResp, err := o.userService.GetUser(uid)
+	if err != nil {
+		o.Warn("查询用户信息失败！", zap.Error(err), zap.String("uid", uid))
+		return nil
+	}
+	return map[string]interface{}{
+		"name":    userResp.Name,
+		"picture": fmt.Sprintf("%s/%s", o.ctx.GetConfig().External.APIBaseURL, o.ctx.GetConfig().GetAvatarPath(uid)),
+	}
+}
+
+// signingKeys 签名密钥（最新的在前），没有则生成
+func (o *OpenAPI) signingKeys() ([]*signingKey, error) {
+	o.keysLock.Lock()
+	defer o.keysLock.Unlock()
+	if len(o.keys) > 0 && time.Since(o.keysLoadedAt) < signingKeyReload {
+		return o.keys, nil
+	}
+	models, err := o.db.querySigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*signingKey, 0, len(models))
+	for _, m := range models {
+		key, err := parseSigningKey(m.Kid, m.PrivateKey)
+		if err != nil {
+			o.Error("解析签名密钥失败！", zap.Error(err), zap.String("kid", m.Kid))
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		key, keyPEM, err := generateSigningKey(util.GenerUUID())
+		if err != nil {
+			return nil, err
+		}
+		err = o.db.insertSigningKey(&signingKeyModel{
+			Kid:        key.kid,
+			PrivateKey: keyPEM,
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	o.keys = keys
+	o.keysLoadedAt = time.Now()
+	return keys, nil
+}
+
+// verifyAccessToken 校验访问令牌
+// 同时返回令牌所属的应用
+func (o *OpenAPI) verifyAccessToken(accessToken string) (*accessTokenInfo, *app.Resp, error) {
+	if accessToken == "" {
+		return nil, nil, errors.New("access_token不能为空")
+	}
+	tokenHash := hashToken(accessToken)
+	value, err := o.ctx.GetRedisConn().GetString(accessTokenCachePrefix + tokenHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	var info *accessTokenInfo
+	if value != "" {
+		if err = util.ReadJsonByByte([]byte(value), &info); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		tokenM, err := o.db.queryTokenWithHash(tokenHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tokenM == nil || tokenM.TokenType != tokenTypeAccess || tokenM.RevokedAt != 0 {
+			return nil, nil, errors.New("access_token无效")
+		}
+		info = &accessTokenInfo{
+			AppID:    tokenM.AppID,
+			UID:      tokenM.UID,
+			Scope:    tokenM.Scopes,
+			FamilyID: tokenM.FamilyID,
+			ExpireAt: tokenM.ExpireAt,
+		}
+	}
+	if info.ExpireAt <= time.Now().Unix() {
+		return nil, nil, errors.New("access_token已过期")
+	}
+	appResp, err := o.appService.GetApp(info.AppID)
+	if err != nil || appResp == nil || appResp.Status != app.StatusEnable {
+		return nil, nil, errors.New("应用不存在或已禁用")
+	}
+	return info, appResp, nil
+}
+
+// revokeFamilyTokens 注销令牌族（包括已签发的访问令牌）
+func (o *OpenAPI) revokeFamilyTokens(familyID string) {
+	now := time.Now().Unix()
+	tokens, err := o.db.queryActiveAccessTokensWithFamily(familyID, now)
+	if err != nil {
+		o.Error("查询令牌族失败！", zap.Error(err), zap.String("familyID", familyID))
+	}
+	o.deleteAccessTokenCaches(tokens)
+	if err = o.db.revokeFamily(familyID, now); err != nil {
+		o.Error("注销令牌族失败！", zap.Error(err), zap.String("familyID", familyID))
+	}
+}
+
+func (o *OpenAPI) deleteAccessTokenCaches(tokens []*tokenModel) {
+	conn := o.ctx.GetRedisConn()
+	for _, token := range tokens {
+		if err := conn.Del(accessTokenCachePrefix + token.TokenHash); err != nil {
+			o.Warn("删除访问令牌缓存失败！", zap.Error(err))
+		}
+	}
+}
+
+// 注销令牌（RFC 7009）注销刷新令牌时同时注销其令牌族
+func (o *OpenAPI) oauthRevoke(c *wkhttp.Context) {
+	appResp, oauthErr := o.authenticateClient(c)
+	if oauthErr != nil {
+		responseOAuthError(c, oauthErr)
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		responseOAuthError(c, newOAuthError("invalid_request", "token不能为空"))
+		return
+	}
+	tokenHash := hashToken(token)
+	tokenM, err := o.db.queryTokenWithHash(tokenHash)
+	if err != nil {
+		o.Error("查询令牌失败！", zap.Error(err))
+		responseOAuthError(c, newOAuthError("server_error", "查询令牌失败"))
+		return
+	}
+	// 无效的令牌或其他应用的令牌也返回成功
+	if tokenM != nil && tokenM.AppID == appResp.AppID && tokenM.RevokedAt == 0 {
+		if tokenM.TokenType == tokenTypeRefresh {
+			o.revokeFamilyTokens(tokenM.FamilyID)
+		} else {
+			if _, err = o.db.revokeToken(tokenHash, time.Now().Unix()); err != nil {
+				o.Error("注销令牌失败！", zap.Error(err))
+				responseOAuthError(c, newOAuthError("server_error", "注销令牌失败"))
+				return
+			}
+			o.deleteAccessTokenCaches([]*tokenModel{tokenM})
+		}
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+// 令牌自省（RFC 7662）只能查询本应用的令牌
+func (o *OpenAPI) oauthIntrospect(c *wkhttp.Context) {
+	appResp, oauthErr := o.authenticateClient(c)
+	if oauthErr != nil {
+		responseOAuthError(c, oauthErr)
+		return
+	}
+	tokenM, err := o.db.queryTokenWithHash(hashToken(c.PostForm("token")))
+	if err != nil {
+		o.Error("查询令牌失败！", zap.Error(err))
+		responseOAuthError(c, newOAuthError("server_error", "查询令牌失败"))
+		return
+	}
+	if tokenM == nil || tokenM.AppID != appResp.AppID || tokenM.RevokedAt != 0 || tokenM.ExpireAt <= time.Now().Unix() {
+		c.JSON(http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+	tokenType := "Bearer"
+	if tokenM.TokenType == tokenTypeRefresh {
+		tokenType = "refresh_token"
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"active":     true,
+		"scope":      tokenM.Scopes,
+		"client_id":  tokenM.AppID,
+		"sub":        tokenM.UID,
+		"exp":        tokenM.ExpireAt,
+		"iat":        time.Time(tokenM.CreatedAt).Unix(),
+		"iss":        o.issuer(),
+		"token_type": tokenType,
+	})
+}
+
+// bearerToken 获取Authorization头中的Bearer令牌
+func bearerToken(c *wkhttp.Context) string {
+	auth := c.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// OIDC用户信息端点
+func (o *OpenAPI) oauthUserinfo(c *wkhttp.Context) {
+	info, appResp, err := o.verifyAccessToken(bearerToken(c))
+	if err != nil {
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description="%s"`, err.Error()))
+		c.JSON(http.StatusUnauthorized, newOAuthError("invalid_token", err.Error()))
+		return
+	}
+	if !o.allowRequest(c, appResp) {
+		return
+	}
+	if !info.hasScope(ScopeOpenID) && !info.hasScope(ScopeProfile) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid profile"`)
+		c.JSON(http.StatusForbidden, newOAuthError("insufficient_scope", "需要openid或profile权限"))
+		return
+	}
+	resp := map[string]interface{}{
+		"sub": info.UID,
+	}
+	if info.hasScope(ScopeProfile) {
+		for k, v := range o.profileClaims(info.UID) {
+			resp[k] = v
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// OIDC发现文档
+func (o *OpenAPI) oidcDiscovery(c *wkhttp.Context) {
+	issuer := o.issuer()
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"issuer":                                         issuer,
+		"authorization_endpoint":                         issuer + "/oauth/authorize",
+		"token_endpoint":                                 issuer + "/oauth/token",
+		"userinfo_endpoint":                              issuer + "/oauth/userinfo",
+		"jwks_uri":                                       issuer + "/oauth/jwks",
+		"revocation_endpoint":                            issuer + "/oauth/revoke",
+		"introspection_endpoint":                         issuer + "/oauth/introspect",
+		"response_types_supported":                       []string{"code"},
+		"grant_types_supported":                          []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":                        []string{"public"},
+		"id_token_signing_alg_values_supported":          []string{"RS256"},
+		"scopes_supported":                               []string{ScopeOpenID, ScopeProfile, ScopeFriendsRead, ScopeGroupsRead, ScopeMessagesSend},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"claims_supported":                               []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "name", "picture"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
+
+// id_token验签公钥
+func (o *OpenAPI) oauthJWKS(c *wkhttp.Context) {
+	keys, err := o.signingKeys()
+	if err != nil {
+		o.Error("查询签名密钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询签名密钥失败！"))
+		return
+	}
+	jwks := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, key.jwk())
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"keys": jwks,
+	})
+}
+
+// 我授权过的应用
+func (o *OpenAPI) oauthGrants(c *wkhttp.Context) {
+	grants, err := o.db.queryGrantsWithUID(c.GetLoginUID())
+	if err != nil {
+		o.Error("查询授权记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权记录失败！"))
+		return
+	}
+	list := make([]map[string]interface{}, 0, len(grants))
+	for _, grant := range grants {
+		appResp, err := o.appService.GetApp(grant.AppID)
+		if err != nil || appResp == nil {
+			continue
+		}
+		list = append(list, map[string]interface{}{
+			"app_id":     grant.AppID,
+			"app_name":   appResp.AppName,
+			"app_logo":   appResp.AppLogo,
+			"scopes":     parseScopes(grant.Scopes),
+			"updated_at": time.Time(grant.UpdatedAt).Unix(),
+		})
+	}
+	c.Response(list)
+}
+
+// 取消对应用的授权 同时注销该应用的所有令牌
+func (o *OpenAPI) oauthGrantDelete(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	appID := c.Param("app_id")
+	err := o.db.deleteGrant(appID, loginUID)
+	if err != nil {
+		o.Error("删除授权记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除授权记录失败！"))
+		return
+	}
+	now := time.Now().Unix()
+	tokens, err := o.db.queryActiveAccessTokensWithApp(appID, loginUID, now)
+	if err != nil {
+		o.Error("查询应用令牌失败！", zap.Error(err))
+	}
+	o.deleteAccessTokenCaches(tokens)
+	err = o.db.revokeWithApp(appID, loginUID, now)
+	if err != nil {
+		o.Error("注销应用令牌失败！", zap.Error(err))
+		c.ResponseError(errors.New("注销应用令牌失败！"))
+		return
+	}
+	err = o.db.deleteChannels(appID, loginUID)
+	if err != nil {
+		o.Error("删除授权的频道失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除授权的频道失败！"))
+		return
+	}
+	c.ResponseOK()
+}
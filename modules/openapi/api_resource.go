@@ -0,0 +1,456 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gookit/goutil/maputil"
+	"go.uber.org/zap"
+)
+
+const resourceTokenKey = "openapi_token" // 上下文中保存的访问令牌信息
+
+// authResource 开放接口认证 校验访问令牌、应用状态、调用频率和scope
+func (o *OpenAPI) authResource(scope string) wkhttp.HandlerFunc {
+	return func(c *wkhttp.Context) {
+		info, appResp, err := o.verifyAccessToken(bearerToken(c))
+		if err != nil {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description="%s"`, err.Error()))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, newOAuthError("invalid_token", err.Error()))
+			return
+		}
+		if !o.allowRequest(c, appResp) {
+			c.Abort()
+			return
+		}
+		if !info.hasScope(scope) {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			c.AbortWithStatusJSON(http.StatusForbidden, newOAuthError("insufficient_scope", fmt.Sprintf("需要%s权限", scope)))
+			return
+		}
+		c.Set(resourceTokenKey, info)
+		c.Next()
+	}
+}
+
+func resourceToken(c *wkhttp.Context) *accessTokenInfo {
+	return c.MustGet(resourceTokenKey).(*accessTokenInfo)
+}
+
+// rateLimitWindow 按分钟统计 返回当前窗口编号和距离窗口结束的秒数
+func rateLimitWindow(now time.Time) (int64, int64) {
+	window := now.Unix() / 60
+	return window, (window+1)*60 - now.Unix()
+}
+
+// allowRequest 按应用限制调用频率 超出时返回429
+func (o *OpenAPI) allowRequest(c *wkhttp.Context, appResp *app.Resp) bool {
+	limit := appResp.RateLimit
+	if limit <= 0 {
+		limit = defaultRateLimit
+	}
+	window, retryAfter := rateLimitWindow(time.Now())
+	key := fmt.Sprintf("%s%s:%d", rateLimitPrefix, appResp.AppID, window)
+	conn := o.ctx.GetRedisConn()
+	count, err := conn.Incr(key)
+	if err != nil {
+		o.Warn("统计接口调用次数失败！", zap.Error(err), zap.String("appID", appResp.AppID))
+		return true
+	}
+	if count == 1 {
+		_ = conn.Expire(key, time.Minute*2)
+	}
+	remaining := int64(limit) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	if count > int64(limit) {
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+		c.JSON(http.StatusTooManyRequests, newOAuthError("rate_limited", "调用过于频繁，请稍后再试"))
+		return false
+	}
+	return true
+}
+
+// 好友列表
+func (o *OpenAPI) resourceFriends(c *wkhttp.Context) {
+	info := resourceToken(c)
+	friends, err := o.userService.GetFriends(info.UID)
+	if err != nil {
+		o.Error("查询好友失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询好友失败！"))
+		return
+	}
+	list := make([]*resourceChannelResp, 0, len(friends))
+	for _, friend := range friends {
+		if friend.IsAlone == 1 { // 对方已删除自己
+			continue
+		}
+		list = append(list, &resourceChannelResp{
+			ChannelID:   friend.UID,
+			ChannelType: common.ChannelTypePerson.Uint8(),
+			Name:        friend.Name,
+			Avatar:      o.avatarURL(friend.UID, common.ChannelTypePerson.Uint8()),
+		})
+	}
+	c.Response(list)
+}
+
+// 群列表
+func (o *OpenAPI) resourceGroups(c *wkhttp.Context) {
+	info := resourceToken(c)
+	groups, err := o.groupService.GetGroupsWithMemberUID(info.UID)
+	if err != nil {
+		o.Error("查询群列表失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群列表失败！"))
+		return
+	}
+	list := make([]*resourceChannelResp, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, &resourceChannelResp{
+			ChannelID:   group.GroupNo,
+			ChannelType: common.ChannelTypeGroup.Uint8(),
+			Name:        group.Name,
+			Avatar:      o.avatarURL(group.GroupNo, common.ChannelTypeGroup.Uint8()),
+		})
+	}
+	c.Response(list)
+}
+
+// 用户通过频道选择器授权给应用的频道
+func (o *OpenAPI) resourceChannels(c *wkhttp.Context) {
+	info := resourceToken(c)
+	list, err := o.authorizedChannels(info.AppID, info.UID)
+	if err != nil {
+		o.Error("查询授权的频道失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权的频道失败！"))
+		return
+	}
+	c.Response(list)
+}
+
+// 以应用绑定的机器人身份发送消息到用户授权的频道
+func (o *OpenAPI) resourceMessageSend(c *wkhttp.Context) {
+	var req struct {
+		ChannelID   string                 `json:"channel_id"`
+		ChannelType uint8                  `json:"channel_type"`
+		Payload     map[string]interface{} `json:"payload"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		o.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if strings.TrimSpace(req.ChannelID) == "" || req.ChannelType == 0 {
+		c.ResponseError(errors.New("频道不能为空！"))
+		return
+	}
+	payload := maputil.Data(req.Payload)
+	if common.ContentType(payload.Int("type")) != common.Text || strings.TrimSpace(payload.Str("content")) == "" {
+		c.ResponseError(errors.New("只支持发送文本消息！"))
+		return
+	}
+	info := resourceToken(c)
+	exist, err := o.db.existChannel(info.AppID, info.UID, req.ChannelID, req.ChannelType)
+	if err != nil {
+		o.Error("查询授权的频道失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权的频道失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("用户未授权此频道！"))
+		return
+	}
+	// 用户退群或删除好友后不能再以用户授权的名义发送
+	if err = o.checkChannelAccess(info.UID, req.ChannelID, req.ChannelType); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	robotResp, err := o.robotService.GetRobotWithAppID(info.AppID)
+	if err != nil {
+		o.Error("查询应用机器人失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询应用机器人失败！"))
+		return
+	}
+	if robotResp == nil {
+		c.ResponseError(errors.New("应用未绑定机器人！"))
+		return
+	}
+	result, err := o.ctx.SendMessageWithResult(&config.MsgSendReq{
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		FromUID:     robotResp.RobotID,
+		Payload:     []byte(util.ToJson(req.Payload)),
+	})
+	if err != nil {
+		o.Error("发送消息失败！", zap.Error(err), zap.String("appID", info.AppID))
+		c.ResponseError(errors.New("发送消息失败！"))
+		return
+	}
+	c.Response(result)
+}
+
+// checkChannelAccess 用户是否可以授权此频道（自己、好友或所在的群）
+func (o *OpenAPI) checkChannelAccess(uid string, channelID string, channelType uint8) error {
+	switch channelType {
+	case common.ChannelTypePerson.Uint8():
+		if channelID == uid {
+			return nil
+		}
+		isFriend, err := o.userService.IsFriend(uid, channelID)
+		if err != nil {
+			o.Error("查询好友关系失败！", zap.Error(err))
+			return errors.New("查询好友关系失败！")
+		}
+		if !isFriend {
+			return fmt.Errorf("[%s]不是你的好友！", channelID)
+		}
+	case common.ChannelTypeGroup.Uint8():
+		exist, err := o.groupService.ExistMember(channelID, uid)
+		if err != nil {
+			o.Error("查询群成员失败！", zap.Error(err))
+			return errors.New("查询群成员失败！")
+		}
+		if !exist {
+			return fmt.Errorf("你不在群[%s]中！", channelID)
+		}
+	default:
+		return errors.New("不支持的频道类型！")
+	}
+	return nil
+}
+
+// 频道选择器获取应用信息和已授权的频道
+func (o *OpenAPI) pickerGet(c *wkhttp.Context) {
+	appResp, err := o.checkPickerApp(c.Query("client_id"), c.GetLoginUID())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	channels, err := o.authorizedChannels(appResp.AppID, c.GetLoginUID())
+	if err != nil {
+		o.Error("查询授权的频道失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权的频道失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"app_id":   appResp.AppID,
+		"app_name": appResp.AppName,
+		"app_logo": appResp.AppLogo,
+		"channels": channels,
+	})
+}
+
+// 用户选择授权给应用的频道（覆盖之前的选择）
+func (o *OpenAPI) pickerSave(c *wkhttp.Context) {
+	var req struct {
+		ClientID    string         `json:"client_id"`
+		Channels    []*pickChannel `json:"channels"`
+		RedirectURI string         `json:"redirect_uri"` // 选择完成后返回应用的地址（可选，必须已登记）
+		State       string         `json:"state"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		o.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	loginUID := c.GetLoginUID()
+	appResp, err := o.checkPickerApp(req.ClientID, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if req.RedirectURI != "" && !matchRedirectURI(appResp.RedirectURIs, req.RedirectURI) {
+		c.ResponseError(errors.New("redirect_uri未登记！"))
+		return
+	}
+	channels, err := checkPickChannels(req.Channels)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	for _, channel := range channels {
+		if err = o.checkChannelAccess(loginUID, channel.ChannelID, channel.ChannelType); err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
+	tx, err := o.ctx.DB().Begin()
+	if err != nil {
+		o.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = o.db.deleteChannelsTx(appResp.AppID, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		o.Error("删除授权的频道失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除授权的频道失败！"))
+		return
+	}
+	for _, channel := range channels {
+		err = o.db.insertChannelTx(&channelModel{
+			AppID:       appResp.AppID,
+			UID:         loginUID,
+			ChannelID:   channel.ChannelID,
+			ChannelType: channel.ChannelType,
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			o.Error("保存授权的频道失败！", zap.Error(err))
+			c.ResponseError(errors.New("保存授权的频道失败！"))
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		o.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	redirectURI := ""
+	if req.RedirectURI != "" {
+		params := map[string][]string{"picked": {strconv.Itoa(len(channels))}}
+		if req.State != "" {
+			params["state"] = []string{req.State}
+		}
+		redirectURI = redirectWithParams(req.RedirectURI, params)
+	}
+	c.Response(map[string]interface{}{
+		"redirect_uri": redirectURI,
+	})
+}
+
+// checkPickerApp 应用必须可用、绑定了机器人并且用户已授权messages:send
+func (o *OpenAPI) checkPickerApp(clientID string, uid string) (*app.Resp, error) {
+	if strings.TrimSpace(clientID) == "" {
+		return nil, errors.New("client_id不能为空！")
+	}
+	appResp, err := o.appService.GetApp(clientID)
+	if err != nil || appResp == nil || appResp.Status != app.StatusEnable {
+		return nil, errors.New("应用不存在或已禁用！")
+	}
+	grantM, err := o.db.queryGrant(appResp.AppID, uid)
+	if err != nil {
+		o.Error("查询授权记录失败！", zap.Error(err))
+		return nil, errors.New("查询授权记录失败！")
+	}
+	if grantM == nil || !containsScopes(parseScopes(grantM.Scopes), []string{ScopeMessagesSend}) {
+		return nil, errors.New("请先授权应用发送消息！")
+	}
+	robotResp, err := o.robotService.GetRobotWithAppID(appResp.AppID)
+	if err != nil {
+		o.Error("查询应用机器人失败！", zap.Error(err))
+		return nil, errors.New("查询应用机器人失败！")
+	}
+	if robotResp == nil {
+		return nil, errors.New("应用未绑定机器人！")
+	}
+	return appResp, nil
+}
+
+func (o *OpenAPI) authorizedChannels(appID string, uid string) ([]*resourceChannelResp, error) {
+	models, err := o.db.queryChannels(appID, uid)
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]string, 0)
+	groupNos := make([]string, 0)
+	for _, m := range models {
+		if m.ChannelType == common.ChannelTypePerson.Uint8() {
+			uids = append(uids, m.ChannelID)
+		} else {
+			groupNos = append(groupNos, m.ChannelID)
+		}
+	}
+	names := map[string]string{}
+	if len(uids) > 0 {
+		users, err := o.userService.GetUsers(uids)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			names[fmt.Sprintf("%s-%d", user.UID, common.ChannelTypePerson.Uint8())] = user.Name
+		}
+	}
+	if len(groupNos) > 0 {
+		groups, err := o.groupService.GetGroups(groupNos)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			names[fmt.Sprintf("%s-%d", group.GroupNo, common.ChannelTypeGroup.Uint8())] = group.Name
+		}
+	}
+	list := make([]*resourceChannelResp, 0, len(models))
+	for _, m := range models {
+		list = append(list, &resourceChannelResp{
+			ChannelID:   m.ChannelID,
+			ChannelType: m.ChannelType,
+			Name:        names[fmt.Sprintf("%s-%d", m.ChannelID, m.ChannelType)],
+			Avatar:      o.avatarURL(m.ChannelID, m.ChannelType),
+		})
+	}
+	return list, nil
+}
+
+func (o *OpenAPI) avatarURL(channelID string, channelType uint8) string {
+	baseURL := o.ctx.GetConfig().External.APIBaseURL
+	if channelType == common.ChannelTypeGroup.Uint8() {
+		return fmt.Sprintf("%s/groups/%s/avatar", baseURL, channelID)
+	}
+	return fmt.Sprintf("%s/%s", baseURL, o.ctx.GetConfig().GetAvatarPath(channelID))
+}
+
+type pickChannel struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+}
+
+// checkPickChannels 校验并去重选择的频道
+func checkPickChannels(channels []*pickChannel) ([]*pickChannel, error) {
+	result := make([]*pickChannel, 0, len(channels))
+	exist := map[string]bool{}
+	for _, channel := range channels {
+		if channel == nil || strings.TrimSpace(channel.ChannelID) == "" {
+			return nil, errors.New("频道ID不能为空！")
+		}
+		if channel.ChannelType != common.ChannelTypePerson.Uint8() && channel.ChannelType != common.ChannelTypeGroup.Uint8() {
+			return nil, errors.New("不支持的频道类型！")
+		}
+		key := fmt.Sprintf("%s-%d", channel.ChannelID, channel.ChannelType)
+		if exist[key] {
+			continue
+		}
+		exist[key] = true
+		result = append(result, channel)
+	}
+	if len(result) > maxPickChannels {
+		return nil, fmt.Errorf("最多只能选择%d个频道！", maxPickChannels)
+	}
+	return result, nil
+}
+
+type resourceChannelResp struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	Name        string `json:"name"`
+	Avatar      string `json:"avatar"`
+}
@@ -0,0 +1,40 @@
+package openapi
+
+import "time"
+
+// 开放平台支持的scope
+const (
+	ScopeOpenID       = "openid"        // 返回id_token
+	ScopeProfile      = "profile"       // 读取用户基本资料
+	ScopeFriendsRead  = "friends:read"  // 读取好友列表
+	ScopeMessagesSend = "messages:send" // 以应用机器人身份发送消息
+	ScopeGroupsRead   = "groups:read"   // 读取群列表
+)
+
+// 支持的scope及授权页展示的说明
+var scopeDescriptions = map[string]string{
+	ScopeOpenID:       "使用你的账号登录",
+	ScopeProfile:      "获取你的昵称和头像",
+	ScopeFriendsRead:  "获取你的好友列表",
+	ScopeMessagesSend: "以应用身份向你授权的会话发送消息",
+	ScopeGroupsRead:   "获取你的群聊列表",
+}
+
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+
+	authCodeExpire     = time.Minute * 5
+	accessTokenExpire  = time.Hour
+	refreshTokenExpire = time.Hour * 24 * 30
+	idTokenExpire      = time.Hour
+
+	authCodePrefix         = "openapi:oauth:code:"  // 授权码
+	authCodeUsedPrefix     = "openapi:oauth:used:"  // 已使用的授权码
+	accessTokenCachePrefix = "openapi:oauth:token:" // 访问令牌缓存
+	signingKeyReload       = time.Minute * 10       // 签名密钥的内存缓存时间
+
+	rateLimitPrefix  = "openapi:ratelimit:" // 接口调用次数
+	defaultRateLimit = 600                  // 默认每个应用每分钟允许调用的次数
+	maxPickChannels  = 50                   // 一次最多授权的频道数量
+)
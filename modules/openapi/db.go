@@ -0,0 +1,166 @@
+package openapi
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// DB DB
+type DB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newDB(ctx *config.Context) *DB {
+	return &DB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+// ---------- 授权 ----------
+
+func (d *DB) queryGrant(appID string, uid string) (*grantModel, error) {
+	var m *grantModel
+	_, err := d.session.Select("*").From("openapi_grant").Where("app_id=? and uid=?", appID, uid).Load(&m)
+	return m, err
+}
+
+func (d *DB) queryGrantsWithUID(uid string) ([]*grantModel, error) {
+	var models []*grantModel
+	_, err := d.session.Select("*").From("openapi_grant").Where("uid=?", uid).OrderDir("updated_at", false).Load(&models)
+	return models, err
+}
+
+func (d *DB) insertOrUpdateGrant(m *grantModel) error {
+	_, err := d.session.InsertBySql("insert into openapi_grant(app_id,uid,scopes) values(?,?,?) ON DUPLICATE KEY UPDATE scopes=VALUES(scopes),updated_at=NOW()", m.AppID, m.UID, m.Scopes).Exec()
+	return err
+}
+
+func (d *DB) deleteGrant(appID string, uid string) error {
+	_, err := d.session.DeleteFrom("openapi_grant").Where("app_id=? and uid=?", appID, uid).Exec()
+	return err
+}
+
+// ---------- 令牌 ----------
+
+func (d *DB) insertToken(m *tokenModel) error {
+	_, err := d.session.InsertInto("openapi_token").Columns("token_hash", "token_type", "app_id", "uid", "scopes", "family_id", "expire_at").Record(m).Exec()
+	return err
+}
+
+func (d *DB) queryTokenWithHash(tokenHash string) (*tokenModel, error) {
+	var m *tokenModel
+	_, err := d.session.Select("*").From("openapi_token").Where("token_hash=?", tokenHash).Load(&m)
+	return m, err
+}
+
+// 注销令牌 返回是否由本次调用注销（用于刷新令牌的并发轮换）
+func (d *DB) revokeToken(tokenHash string, revokedAt int64) (bool, error) {
+	result, err := d.session.Update("openapi_token").Set("revoked_at", revokedAt).Where("token_hash=? and revoked_at=0", tokenHash).Exec()
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// 查询令牌族中未注销的访问令牌
+func (d *DB) queryActiveAccessTokensWithFamily(familyID string, now int64) ([]*tokenModel, error) {
+	var models []*tokenModel
+	_, err := d.session.Select("*").From("openapi_token").Where("family_id=? and token_type=? and revoked_at=0 and expire_at>?", familyID, tokenTypeAccess, now).Load(&models)
+	return models, err
+}
+
+func (d *DB) revokeFamily(familyID string, revokedAt int64) error {
+	_, err := d.session.Update("openapi_token").Set("revoked_at", revokedAt).Where("family_id=? and revoked_at=0", familyID).Exec()
+	return err
+}
+
+// 查询用户在某个app下未注销的访问令牌
+func (d *DB) queryActiveAccessTokensWithApp(appID string, uid string, now int64) ([]*tokenModel, error) {
+	var models []*tokenModel
+	_, err := d.session.Select("*").From("openapi_token").Where("app_id=? and uid=? and token_type=? and revoked_at=0 and expire_at>?", appID, uid, tokenTypeAccess, now).Load(&models)
+	return models, err
+}
+
+func (d *DB) revokeWithApp(appID string, uid string, revokedAt int64) error {
+	_, err := d.session.Update("openapi_token").Set("revoked_at", revokedAt).Where("app_id=? and uid=? and revoked_at=0", appID, uid).Exec()
+	return err
+}
+
+// ---------- 授权的频道 ----------
+
+func (d *DB) queryChannels(appID string, uid string) ([]*channelModel, error) {
+	var models []*channelModel
+	_, err := d.session.Select("*").From("openapi_channel").Where("app_id=? and uid=?", appID, uid).OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+func (d *DB) existChannel(appID string, uid string, channelID string, channelType uint8) (bool, error) {
+	var count int
+	_, err := d.session.Select("count(*)").From("openapi_channel").Where("app_id=? and uid=? and channel_id=? and channel_type=?", appID, uid, channelID, channelType).Load(&count)
+	return count > 0, err
+}
+
+func (d *DB) insertChannelTx(m *channelModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("openapi_channel").Columns("app_id", "uid", "channel_id", "channel_type").Record(m).Exec()
+	return err
+}
+
+func (d *DB) deleteChannelsTx(appID string, uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("openapi_channel").Where("app_id=? and uid=?", appID, uid).Exec()
+	return err
+}
+
+func (d *DB) deleteChannels(appID string, uid string) error {
+	_, err := d.session.DeleteFrom("openapi_channel").Where("app_id=? and uid=?", appID, uid).Exec()
+	return err
+}
+
+// ---------- 签名密钥 ----------
+
+func (d *DB) querySigningKeys() ([]*signingKeyModel, error) {
+	var models []*signingKeyModel
+	_, err := d.session.Select("*").From("openapi_signing_key").OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+func (d *DB) insertSigningKey(m *signingKeyModel) error {
+	_, err := d.session.InsertInto("openapi_signing_key").Columns("kid", "private_key").Record(m).Exec()
+	return err
+}
+
+type grantModel struct {
+	AppID  string
+	UID    string
+	Scopes string
+	db.BaseModel
+}
+
+type tokenModel struct {
+	TokenHash string
+	TokenType string
+	AppID     string
+	UID       string
+	Scopes    string
+	FamilyID  string
+	ExpireAt  int64
+	RevokedAt int64
+	db.BaseModel
+}
+
+type signingKeyModel struct {
+	Kid        string
+	PrivateKey string
+	db.BaseModel
+}
+
+type channelModel struct {
+	AppID       string
+	UID         string
+	ChannelID   string
+	ChannelType uint8
+	db.BaseModel
+}
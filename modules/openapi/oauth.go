@@ -0,0 +1,202 @@
+package openapi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// oauthError OAuth2标准错误（RFC 6749 5.2）
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func newOAuthError(code string, description string) *oauthError {
+	return &oauthError{Code: code, Description: description}
+}
+
+// parseScopes 解析空格分隔的scope（去重，保持顺序）
+func parseScopes(scope string) []string {
+	scopes := make([]string, 0)
+	exist := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if exist[s] {
+			continue
+		}
+		exist[s] = true
+		scopes = append(scopes, s)
+	}
+	return scopes
+}
+
+// checkScopes 申请的scope必须是支持的并且是app允许的
+func checkScopes(requested []string, allowed []string) error {
+	for _, scope := range requested {
+		if _, ok := scopeDescriptions[scope]; !ok {
+			return fmt.Errorf("不支持的scope：%s", scope)
+		}
+		if !containsScopes(allowed, []string{scope}) {
+			return fmt.Errorf("应用未开通scope：%s", scope)
+		}
+	}
+	return nil
+}
+
+// containsScopes granted是否包含所有的requested
+func containsScopes(granted []string, requested []string) bool {
+	for _, r := range requested {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeScopes 合并scope
+func mergeScopes(a []string, b []string) []string {
+	return parseScopes(strings.Join(append(append([]string{}, a...), b...), " "))
+}
+
+// matchRedirectURI 回调地址必须与登记的完全一致
+// 本机回环地址（原生应用）按RFC 8252忽略端口
+func matchRedirectURI(registered []string, redirectURI string) bool {
+	for _, r := range registered {
+		if r == redirectURI {
+			return true
+		}
+	}
+	uri, err := url.Parse(redirectURI)
+	if err != nil || uri.Scheme != "http" || !isLoopback(uri.Hostname()) {
+		return false
+	}
+	for _, r := range registered {
+		ru, err := url.Parse(r)
+		if err != nil || ru.Scheme != "http" || !isLoopback(ru.Hostname()) {
+			continue
+		}
+		if ru.Hostname() == uri.Hostname() && ru.Path == uri.Path && ru.RawQuery == uri.RawQuery {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// verifyPKCE 校验code_verifier（只支持S256）
+func verifyPKCE(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// redirectWithParams 在回调地址上追加参数
+func redirectWithParams(redirectURI string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	return redirectURI + sep + params.Encode()
+}
+
+// newOpaqueToken 生成随机令牌
+func newOpaqueToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ---------- id_token签名 ----------
+
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func generateSigningKey(kid string) (*signingKey, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, "", err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return &signingKey{kid: kid, key: key}, string(keyPEM), nil
+}
+
+func parseSigningKey(kid string, keyPEM string) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("签名密钥格式有误")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: kid, key: key}, nil
+}
+
+// signJWT 使用RS256签名
+func (k *signingKey) signJWT(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": k.kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwk 公钥的JWK表示
+func (k *signingKey) jwk() map[string]string {
+	pub := k.key.PublicKey
+	return map[string]string{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": k.kid,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
@@ -0,0 +1,81 @@
+package openapi
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 附录B的示例
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.True(t, verifyPKCE(verifier, challenge))
+	assert.False(t, verifyPKCE(verifier+"x", challenge))
+	assert.False(t, verifyPKCE("short", challenge))
+	assert.False(t, verifyPKCE("", challenge))
+}
+
+func TestScopes(t *testing.T) {
+	assert.Equal(t, []string{"openid", "profile"}, parseScopes(" openid  profile openid "))
+	assert.NoError(t, checkScopes([]string{ScopeOpenID, ScopeFriendsRead}, []string{ScopeOpenID, ScopeProfile, ScopeFriendsRead}))
+	assert.Error(t, checkScopes([]string{ScopeGroupsRead}, []string{ScopeOpenID}))
+	assert.Error(t, checkScopes([]string{"admin"}, []string{"admin"}))
+	assert.True(t, containsScopes([]string{ScopeOpenID, ScopeProfile}, []string{ScopeProfile}))
+	assert.False(t, containsScopes([]string{ScopeOpenID}, []string{ScopeProfile}))
+	assert.Equal(t, []string{ScopeOpenID, ScopeProfile, ScopeGroupsRead}, mergeScopes([]string{ScopeOpenID, ScopeProfile}, []string{ScopeProfile, ScopeGroupsRead}))
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{"https://example.com/callback", "http://127.0.0.1/oauth"}
+	assert.True(t, matchRedirectURI(registered, "https://example.com/callback"))
+	assert.False(t, matchRedirectURI(registered, "https://example.com/callback/"))
+	assert.False(t, matchRedirectURI(registered, "https://example.com/callback?x=1"))
+	assert.False(t, matchRedirectURI(registered, "https://evil.com/callback"))
+	// 回环地址忽略端口
+	assert.True(t, matchRedirectURI(registered, "http://127.0.0.1:51234/oauth"))
+	assert.False(t, matchRedirectURI(registered, "http://127.0.0.1:51234/other"))
+	assert.False(t, matchRedirectURI([]string{"https://example.com:8443/cb"}, "https://example.com:9443/cb"))
+}
+
+func TestRedirectWithParams(t *testing.T) {
+	assert.Equal(t, "https://a.com/cb?code=1", redirectWithParams("https://a.com/cb", map[string][]string{"code": {"1"}}))
+	assert.Equal(t, "https://a.com/cb?x=1&code=1", redirectWithParams("https://a.com/cb?x=1", map[string][]string{"code": {"1"}}))
+}
+
+func TestSignJWT(t *testing.T) {
+	key, keyPEM, err := generateSigningKey("kid1")
+	assert.NoError(t, err)
+	parsed, err := parseSigningKey("kid1", keyPEM)
+	assert.NoError(t, err)
+
+	token, err := parsed.signJWT(map[string]interface{}{"sub": "u1", "aud": "app1"})
+	assert.NoError(t, err)
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+
+	var header map[string]string
+	headerBytes, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	assert.NoError(t, json.Unmarshal(headerBytes, &header))
+	assert.Equal(t, "RS256", header["alg"])
+	assert.Equal(t, "kid1", header["kid"])
+
+	// 使用JWK中的公钥验签
+	jwk := key.jwk()
+	n, _ := base64.RawURLEncoding.DecodeString(jwk["n"])
+	e, _ := base64.RawURLEncoding.DecodeString(jwk["e"])
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature))
+
+	_, err = parseSigningKey("kid2", "invalid")
+	assert.Error(t, err)
+}
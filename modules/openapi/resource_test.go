@@ -0,0 +1,43 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitWindow(t *testing.T) {
+	window, retryAfter := rateLimitWindow(time.Unix(120, 0))
+	assert.Equal(t, int64(2), window)
+	assert.Equal(t, int64(60), retryAfter)
+	window, retryAfter = rateLimitWindow(time.Unix(179, 0))
+	assert.Equal(t, int64(2), window)
+	assert.Equal(t, int64(1), retryAfter)
+}
+
+func TestCheckPickChannels(t *testing.T) {
+	person := common.ChannelTypePerson.Uint8()
+	group := common.ChannelTypeGroup.Uint8()
+	channels, err := checkPickChannels([]*pickChannel{
+		{ChannelID: "u1", ChannelType: person},
+		{ChannelID: "g1", ChannelType: group},
+		{ChannelID: "u1", ChannelType: person},
+		{ChannelID: "u1", ChannelType: group},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, channels, 3)
+
+	_, err = checkPickChannels([]*pickChannel{{ChannelID: " ", ChannelType: person}})
+	assert.Error(t, err)
+	_, err = checkPickChannels([]*pickChannel{{ChannelID: "c1", ChannelType: 99}})
+	assert.Error(t, err)
+
+	tooMany := make([]*pickChannel, 0, maxPickChannels+1)
+	for i := 0; i <= maxPickChannels; i++ {
+		tooMany = append(tooMany, &pickChannel{ChannelID: string(rune('a'+i%26)) + string(rune('a'+i/26)), ChannelType: group})
+	}
+	_, err = checkPickChannels(tooMany)
+	assert.Error(t, err)
+}
@@ -0,0 +1,44 @@
+-- +migrate Up
+
+-- 用户对第三方应用的授权（同意过的scope再次授权时不需要确认）
+create table `openapi_grant`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  app_id       VARCHAR(40)    not null default '',                -- app id
+  uid          VARCHAR(40)    not null default '',                -- 用户uid
+  scopes       VARCHAR(255)   not null default '',                -- 已同意的scope（空格分隔）
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `openapi_grant_app_uidx` on `openapi_grant` (`app_id`, `uid`);
+CREATE INDEX `openapi_grant_uidx` on `openapi_grant` (`uid`);
+
+-- 访问令牌和刷新令牌（只保存hash）
+create table `openapi_token`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  token_hash   VARCHAR(64)    not null default '',                -- 令牌的sha256
+  token_type   VARCHAR(20)    not null default '',                -- access或refresh
+  app_id       VARCHAR(40)    not null default '',                -- app id
+  uid          VARCHAR(40)    not null default '',                -- 用户uid
+  scopes       VARCHAR(255)   not null default '',                -- 令牌的scope（空格分隔）
+  family_id    VARCHAR(40)    not null default '',                -- 令牌族 同一次授权轮换出的令牌属于同一族
+  expire_at    bigint         not null default 0,                 -- 过期时间
+  revoked_at   bigint         not null default 0,                 -- 注销或轮换时间 0表示有效
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `openapi_token_hashx` on `openapi_token` (`token_hash`);
+CREATE INDEX `openapi_token_familyx` on `openapi_token` (`family_id`);
+CREATE INDEX `openapi_token_app_uidx` on `openapi_token` (`app_id`, `uid`);
+
+-- id_token签名密钥（jwks会返回所有密钥，签名使用最新的密钥）
+create table `openapi_signing_key`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  kid          VARCHAR(40)    not null default '',                -- 密钥ID
+  private_key  TEXT           not null,                           -- RSA私钥（PEM）
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `openapi_signing_key_kidx` on `openapi_signing_key` (`kid`);
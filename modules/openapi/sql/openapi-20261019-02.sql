@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- 用户通过频道选择器授权给应用发消息的频道
+create table `openapi_channel`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  app_id       VARCHAR(40)    not null default '',                -- app id
+  uid          VARCHAR(40)    not null default '',                -- 授权的用户uid
+  channel_id   VARCHAR(100)   not null default '',                -- 频道ID
+  channel_type smallint       not null default 0,                 -- 频道类型
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `openapi_channel_uidx` on `openapi_channel` (`app_id`, `uid`, `channel_id`, `channel_type`);
@@ -6,21 +6,35 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/message"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
 )
 
+// 单次举报最多关联的消息数量
+const reportMaxMessageCount = 50
+
 // Report 举报
 type Report struct {
 	ctx *config.Context
 	db  *db
+	log.Log
+	groupService   group.IService
+	messageService message.IService
 }
 
 // New 创建一个举报对象
 func New(ctx *config.Context) *Report {
 	return &Report{
-		ctx: ctx,
-		db:  newDB(ctx),
+		ctx:            ctx,
+		db:             newDB(ctx),
+		Log:            log.NewTLog("report"),
+		groupService:   group.NewService(ctx),
+		messageService: message.NewService(ctx),
 	}
 }
 
@@ -70,23 +84,84 @@ func (r *Report) report(c *wkhttp.Context) {
 		return
 	}
 
+	loginUID := c.GetLoginUID()
 	imgsStr := ""
 	if len(req.Imgs) > 0 {
 		imgsStr = strings.Join(req.Imgs, ",")
 	}
 
-	err := r.db.insert(&model{
-		UID:         c.GetLoginUID(),
+	// 服务端保存被举报消息的快照，避免消息撤回或删除后无法取证
+	var messages []*config.MessageResp
+	if len(req.MessageIDs) > 0 {
+		if req.ChannelType == common.ChannelTypeGroup.Uint8() {
+			exist, err := r.groupService.ExistMember(req.ChannelID, loginUID)
+			if err != nil {
+				r.Error("查询是否是群成员失败！", zap.Error(err))
+				c.ResponseError(errors.New("查询是否是群成员失败！"))
+				return
+			}
+			if !exist {
+				c.ResponseError(errors.New("不在群内，不能举报群消息！"))
+				return
+			}
+		}
+		var err error
+		messages, err = r.messageService.GetMessages(req.ChannelID, req.ChannelType, loginUID, req.MessageIDs)
+		if err != nil {
+			r.Error("查询举报的消息失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询举报的消息失败！"))
+			return
+		}
+		if len(messages) == 0 {
+			c.ResponseError(errors.New("举报的消息不存在！"))
+			return
+		}
+	}
+
+	tx, err := r.db.session.Begin()
+	if err != nil {
+		c.ResponseErrorf("开启事务失败！", err)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	reportID, err := r.db.insertTx(&model{
+		UID:         loginUID,
 		CategoryNo:  req.CategoryNo,
 		Imgs:        imgsStr,
 		Remark:      req.Remark,
 		ChannelID:   req.ChannelID,
 		ChannelType: req.ChannelType,
-	})
+	}, tx)
 	if err != nil {
+		tx.Rollback()
 		c.ResponseErrorf("添加举报数据失败！", err)
 		return
 	}
+	for _, message := range messages {
+		err = r.db.insertMessageTx(&messageModel{
+			ReportID:   reportID,
+			MessageID:  message.MessageIDStr,
+			MessageSeq: message.MessageSeq,
+			FromUID:    message.FromUID,
+			Payload:    string(message.Payload),
+			SentAt:     int64(message.Timestamp),
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			c.ResponseErrorf("保存举报消息失败！", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("提交事务失败！", err)
+		return
+	}
 
 	c.ResponseOK()
 
@@ -176,6 +251,7 @@ type reportReq struct {
 	CategoryNo  string   `json:"category_no"`  // 类别编号
 	Imgs        []string `json:"imgs"`         // 举报图片内容
 	Remark      string   `json:"remark"`       // 举报备注
+	MessageIDs  []string `json:"message_ids"`  // 举报的消息ID
 }
 
 func (r reportReq) check() error {
@@ -188,5 +264,8 @@ func (r reportReq) check() error {
 	if r.CategoryNo == "" {
 		return errors.New("举报类别不能为空！")
 	}
+	if len(r.MessageIDs) > reportMaxMessageCount {
+		return fmt.Errorf("单次最多举报%d条消息！", reportMaxMessageCount)
+	}
 	return nil
 }
@@ -5,7 +5,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/message"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
@@ -19,29 +21,42 @@ type Manager struct {
 	ctx       *config.Context
 	managerDB *managerDB
 	log.Log
-	userDB  *user.DB
-	db      *db
-	groupDB *group.DB
+	userDB         *user.DB
+	db             *db
+	groupDB        *group.DB
+	userService    user.IService
+	groupService   group.IService
+	messageService message.IService
 }
 
 // NewManager 创建一个举报对象
 func NewManager(ctx *config.Context) *Manager {
 	return &Manager{
-		ctx:       ctx,
-		Log:       log.NewTLog("reportManager"),
-		managerDB: newManagerDB(ctx),
-		userDB:    user.NewDB(ctx),
-		db:        newDB(ctx),
-		groupDB:   group.NewDB(ctx),
+		ctx:            ctx,
+		Log:            log.NewTLog("reportManager"),
+		managerDB:      newManagerDB(ctx),
+		userDB:         user.NewDB(ctx),
+		db:             newDB(ctx),
+		groupDB:        group.NewDB(ctx),
+		userService:    user.NewService(ctx),
+		groupService:   group.NewService(ctx),
+		messageService: message.NewService(ctx),
 	}
 }
 
 // Route 配置路由规则
 func (m *Manager) Route(l *wkhttp.WKHttp) {
 
-	auth := l.Group("/v1/manager", m.ctx.BasicAuthMiddleware(l), l.AuthMiddleware(m.ctx.Cache(), m.ctx.GetConfig().Cache.TokenCachePrefix))
+	auth := l.Group("/v1/manager", m.ctx.BasicAuthMiddleware(l), l.AuthMiddleware(m.ctx.Cache(), m.ctx.GetConfig().Cache.TokenCachePrefix), audit.Middleware(m.ctx))
 	{
 		auth.GET("/report/list", m.reportList) // 举报列表
+
+		auth.GET("/reports", m.caseList)                    // 举报处理列表
+		auth.GET("/reports/:id", m.caseGet)                 // 举报详情
+		auth.PUT("/reports/:id/assignee", m.caseAssign)     // 指派处理人
+		auth.POST("/reports/:id/notes", m.caseNoteAdd)      // 添加处理备注
+		auth.POST("/reports/:id/actions", m.caseAction)     // 执行处理动作
+		auth.PUT("/reports/:id/status", m.caseStatusUpdate) // 修改处理状态
 	}
 }
 
@@ -128,6 +143,7 @@ func (m *Manager) reportList(c *wkhttp.Context) {
 				imgs = strings.Split(report.Imgs, ",")
 			}
 			result = append(result, &managerReportResp{
+				ID:           report.Id,
 				UID:          report.UID,
 				Name:         username,
 				Imgs:         imgs,
@@ -136,6 +152,7 @@ func (m *Manager) reportList(c *wkhttp.Context) {
 				ChannelName:  channelName,
 				Remark:       report.Remark,
 				CategoryName: report.CategoryName,
+				Status:       report.Status,
 				CreateAt:     report.CreatedAt.String(),
 			})
 		}
@@ -148,6 +165,7 @@ func (m *Manager) reportList(c *wkhttp.Context) {
 }
 
 type managerReportResp struct {
+	ID           int64    `json:"id"`
 	UID          string   `json:"uid"`
 	Name         string   `json:"name"` //举报者名称
 	ChannelID    string   `json:"channel_id"`
@@ -156,5 +174,6 @@ type managerReportResp struct {
 	CategoryName string   `json:"category_name"`
 	Imgs         []string `json:"imgs"`   // 举报图片内容
 	Remark       string   `json:"remark"` // 举报备注
+	Status       int      `json:"status"` // 处理状态 1.待处理 2.处理中 3.已处理 4.已驳回
 	CreateAt     string   `json:"create_at"`
 }
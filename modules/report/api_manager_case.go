@@ -0,0 +1,620 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	caseMaxNoteLength   = 1000
+	caseMaxResultLength = 800
+	caseMaxMuteDuration = 60 * 60 * 24 * 30
+)
+
+// 举报处理列表
+func (m *Manager) caseList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	status, _ := strconv.Atoi(c.Query("status"))
+	channelType, _ := strconv.Atoi(c.Query("channel_type"))
+	filter := caseFilter{
+		Status:      status,
+		ChannelType: channelType,
+		Assignee:    c.Query("assignee"),
+	}
+	list, err := m.managerDB.cases(uint64(pageSize), uint64(pageIndex), filter)
+	if err != nil {
+		m.Error("查询举报列表错误", zap.Error(err))
+		c.ResponseError(errors.New("查询举报列表错误"))
+		return
+	}
+	count, err := m.managerDB.queryCaseCount(filter)
+	if err != nil {
+		m.Error("查询举报总数量错误", zap.Error(err))
+		c.ResponseError(errors.New("查询举报总数量错误"))
+		return
+	}
+	result, err := m.newCaseResps(list)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  result,
+	})
+}
+
+// 举报详情（包含消息快照、处理备注及处理动作）
+func (m *Manager) caseGet(c *wkhttp.Context) {
+	model, ok := m.getCase(c)
+	if !ok {
+		return
+	}
+	resps, err := m.newCaseResps([]*managerReportModel{model})
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	resp := resps[0]
+	messages, err := m.managerDB.queryCaseMessages(model.Id)
+	if err != nil {
+		m.Error("查询举报消息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询举报消息错误"))
+		return
+	}
+	resp.Messages = make([]*caseMessageResp, 0, len(messages))
+	for _, message := range messages {
+		var payload map[string]interface{}
+		if err := util.ReadJsonByByte([]byte(message.Payload), &payload); err != nil {
+			m.Warn("解码消息快照失败！", zap.Error(err), zap.String("messageID", message.MessageID))
+		}
+		resp.Messages = append(resp.Messages, &caseMessageResp{
+			MessageID:  message.MessageID,
+			MessageSeq: message.MessageSeq,
+			FromUID:    message.FromUID,
+			Payload:    payload,
+			Timestamp:  message.SentAt,
+		})
+	}
+	notes, err := m.managerDB.queryNotes(model.Id)
+	if err != nil {
+		m.Error("查询处理备注错误", zap.Error(err))
+		c.ResponseError(errors.New("查询处理备注错误"))
+		return
+	}
+	resp.Notes = make([]*caseNoteResp, 0, len(notes))
+	for _, note := range notes {
+		resp.Notes = append(resp.Notes, &caseNoteResp{
+			Author:    note.Author,
+			Content:   note.Content,
+			CreatedAt: note.CreatedAt.String(),
+		})
+	}
+	actions, err := m.managerDB.queryActions(model.Id)
+	if err != nil {
+		m.Error("查询处理动作错误", zap.Error(err))
+		c.ResponseError(errors.New("查询处理动作错误"))
+		return
+	}
+	resp.Actions = make([]*caseActionResp, 0, len(actions))
+	for _, action := range actions {
+		resp.Actions = append(resp.Actions, newCaseActionResp(action))
+	}
+	c.Response(resp)
+}
+
+// 指派举报处理人
+func (m *Manager) caseAssign(c *wkhttp.Context) {
+	var req struct {
+		Assignee string `json:"assignee"` // 为空表示指派给自己
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	model, ok := m.getOpenCase(c)
+	if !ok {
+		return
+	}
+	assignee := strings.TrimSpace(req.Assignee)
+	if assignee == "" {
+		assignee = c.GetLoginUID()
+	}
+	status := model.Status
+	if status == StatusOpen {
+		status = StatusInReview
+	}
+	err := m.managerDB.updateCaseAssignee(model.Id, assignee, status)
+	if err != nil {
+		m.Error("指派举报处理人错误", zap.Error(err))
+		c.ResponseError(errors.New("指派举报处理人错误"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 添加处理备注
+func (m *Manager) caseNoteAdd(c *wkhttp.Context) {
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		c.ResponseError(errors.New("备注内容不能为空"))
+		return
+	}
+	if utf8.RuneCountInString(content) > caseMaxNoteLength {
+		c.ResponseError(fmt.Errorf("备注内容不能超过%d个字", caseMaxNoteLength))
+		return
+	}
+	model, ok := m.getCase(c)
+	if !ok {
+		return
+	}
+	err := m.managerDB.insertNote(&noteModel{
+		ReportID: model.Id,
+		Author:   c.GetLoginUID(),
+		Content:  content,
+	})
+	if err != nil {
+		m.Error("添加处理备注错误", zap.Error(err))
+		c.ResponseError(errors.New("添加处理备注错误"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 执行处理动作
+func (m *Manager) caseAction(c *wkhttp.Context) {
+	var req caseActionReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if req.Action == ActionBanUser || req.Action == ActionBanGroup {
+		if err := c.CheckLoginRoleIsSuperAdmin(); err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
+	model, ok := m.getOpenCase(c)
+	if !ok {
+		return
+	}
+	messages, err := m.managerDB.queryCaseMessages(model.Id)
+	if err != nil {
+		m.Error("查询举报消息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询举报消息错误"))
+		return
+	}
+	isGroup := model.ChannelType == common.ChannelTypeGroup.Uint8()
+	if (req.Action == ActionMute || req.Action == ActionBanGroup) && !isGroup {
+		c.ResponseError(errors.New("只有群举报才能执行该操作"))
+		return
+	}
+	action := &actionModel{
+		ReportID: model.Id,
+		Action:   req.Action,
+		Operator: c.GetLoginUID(),
+		Status:   ActionStatusSuccess,
+	}
+	switch req.Action {
+	case ActionWarn, ActionMute, ActionBanUser:
+		action.Target = caseTargetUID(model, messages, req.Target)
+		if action.Target == "" {
+			c.ResponseError(errors.New("请指定处理的用户"))
+			return
+		}
+	case ActionBanGroup:
+		action.Target = model.ChannelID
+	case ActionDeleteMessages:
+		action.Target = model.ChannelID
+		req.MessageIDs = caseMessageIDs(messages, req.MessageIDs)
+		if len(req.MessageIDs) == 0 {
+			c.ResponseError(errors.New("没有可删除的举报消息"))
+			return
+		}
+	}
+	action.Params = util.ToJson(map[string]interface{}{
+		"reason":      req.Reason,
+		"duration":    req.Duration,
+		"message_ids": req.MessageIDs,
+	})
+
+	err = m.executeCaseAction(c, model, action, req)
+	if err != nil {
+		m.Warn("执行举报处理动作失败！", zap.Error(err), zap.Int64("reportID", model.Id), zap.String("action", req.Action))
+		action.Status = ActionStatusFail
+		action.Error = err.Error()
+		if utf8.RuneCountInString(action.Error) > 255 {
+			action.Error = string([]rune(action.Error)[:255])
+		}
+	}
+	if insertErr := m.managerDB.insertAction(action); insertErr != nil {
+		m.Error("保存处理动作错误", zap.Error(insertErr))
+		c.ResponseError(errors.New("保存处理动作错误"))
+		return
+	}
+	audit.Record(c, fmt.Sprintf("report.%s", action.Action), action.Target, nil, map[string]interface{}{
+		"report_id": model.Id,
+		"params":    action.Params,
+		"status":    action.Status,
+	})
+	if model.Status == StatusOpen {
+		if updateErr := m.managerDB.updateCaseAssignee(model.Id, caseAssignee(model, c.GetLoginUID()), StatusInReview); updateErr != nil {
+			m.Warn("修改举报处理状态错误", zap.Error(updateErr))
+		}
+	}
+	if err != nil {
+		c.ResponseError(fmt.Errorf("执行处理动作失败：%s", err.Error()))
+		return
+	}
+	c.Response(newCaseActionResp(action))
+}
+
+// 修改举报处理状态，结案（已处理或已驳回）时通知举报人
+func (m *Manager) caseStatusUpdate(c *wkhttp.Context) {
+	var req struct {
+		Status int    `json:"status"`
+		Result string `json:"result"` // 处理结果，结案时发送给举报人
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if req.Status != StatusInReview && req.Status != StatusActioned && req.Status != StatusDismissed {
+		c.ResponseError(errors.New("处理状态不正确"))
+		return
+	}
+	result := strings.TrimSpace(req.Result)
+	if utf8.RuneCountInString(result) > caseMaxResultLength {
+		c.ResponseError(fmt.Errorf("处理结果不能超过%d个字", caseMaxResultLength))
+		return
+	}
+	model, ok := m.getOpenCase(c)
+	if !ok {
+		return
+	}
+	if req.Status == StatusActioned {
+		count, err := m.managerDB.querySuccessActionCount(model.Id)
+		if err != nil {
+			m.Error("查询处理动作错误", zap.Error(err))
+			c.ResponseError(errors.New("查询处理动作错误"))
+			return
+		}
+		if count == 0 {
+			c.ResponseError(errors.New("还未执行任何处理动作，不能标记为已处理"))
+			return
+		}
+	}
+	var handledAt int64
+	if req.Status == StatusActioned || req.Status == StatusDismissed {
+		handledAt = time.Now().Unix()
+	}
+	err := m.managerDB.updateCaseStatus(model.Id, req.Status, result, handledAt)
+	if err != nil {
+		m.Error("修改举报处理状态错误", zap.Error(err))
+		c.ResponseError(errors.New("修改举报处理状态错误"))
+		return
+	}
+	if model.Assignee == "" {
+		if err := m.managerDB.updateCaseAssignee(model.Id, c.GetLoginUID(), req.Status); err != nil {
+			m.Warn("修改举报处理人错误", zap.Error(err))
+		}
+	}
+	if handledAt > 0 {
+		err = m.sendSystemMessage(model.UID, reportOutcomeContent(req.Status, model.CreatedAt.String(), result))
+		if err != nil {
+			m.Warn("通知举报人处理结果失败！", zap.Error(err), zap.Int64("reportID", model.Id))
+		}
+	}
+	c.ResponseOK()
+}
+
+func (m *Manager) executeCaseAction(c *wkhttp.Context, model *managerReportModel, action *actionModel, req caseActionReq) error {
+	switch action.Action {
+	case ActionWarn:
+		return m.sendSystemMessage(action.Target, warnContent(req.Reason))
+	case ActionMute:
+		return m.groupService.MuteMember(model.ChannelID, action.Target, time.Now().Unix()+req.Duration)
+	case ActionBanUser:
+		return m.userService.UpdateUserStatus(action.Target, common.UserDisable)
+	case ActionBanGroup:
+		return m.groupService.UpdateGroupStatus(model.ChannelID, group.GroupStatusDisabled, c.GetLoginUID(), c.GetLoginName())
+	case ActionDeleteMessages:
+		return m.messageService.RevokeMessages(model.ChannelID, model.ChannelType, model.UID, req.MessageIDs)
+	}
+	return errors.New("不支持的处理动作")
+}
+
+func (m *Manager) sendSystemMessage(uid string, content string) error {
+	return m.ctx.SendMessage(&config.MsgSendReq{
+		FromUID:     m.ctx.GetConfig().Account.SystemUID,
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"content": content,
+			"type":    common.Text,
+		})),
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+	})
+}
+
+func (m *Manager) getCase(c *wkhttp.Context) (*managerReportModel, bool) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return nil, false
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	model, err := m.managerDB.queryCase(id)
+	if err != nil {
+		m.Error("查询举报错误", zap.Error(err))
+		c.ResponseError(errors.New("查询举报错误"))
+		return nil, false
+	}
+	if model == nil {
+		c.ResponseError(errors.New("举报不存在"))
+		return nil, false
+	}
+	return model, true
+}
+
+// getOpenCase 获取未结案的举报
+func (m *Manager) getOpenCase(c *wkhttp.Context) (*managerReportModel, bool) {
+	model, ok := m.getCase(c)
+	if !ok {
+		return nil, false
+	}
+	if model.Status == StatusActioned || model.Status == StatusDismissed {
+		c.ResponseError(errors.New("举报已结案"))
+		return nil, false
+	}
+	return model, true
+}
+
+func (m *Manager) newCaseResps(list []*managerReportModel) ([]*caseResp, error) {
+	result := make([]*caseResp, 0, len(list))
+	if len(list) == 0 {
+		return result, nil
+	}
+	uids := make([]string, 0, len(list)*2)
+	groupNos := make([]string, 0)
+	for _, report := range list {
+		uids = append(uids, report.UID)
+		if report.Assignee != "" {
+			uids = append(uids, report.Assignee)
+		}
+		if report.ChannelType == common.ChannelTypeGroup.Uint8() {
+			groupNos = append(groupNos, report.ChannelID)
+		} else {
+			uids = append(uids, report.ChannelID)
+		}
+	}
+	users, err := m.userDB.QueryByUIDs(uids)
+	if err != nil {
+		m.Error("查询用户信息错误", zap.Error(err))
+		return nil, errors.New("查询用户信息错误")
+	}
+	groups, err := m.groupDB.QueryGroupsWithGroupNos(groupNos)
+	if err != nil {
+		m.Error("查询举报群集合错误", zap.Error(err))
+		return nil, errors.New("查询举报群集合错误")
+	}
+	userNameMap := make(map[string]string, len(users))
+	for _, user := range users {
+		userNameMap[user.UID] = user.Name
+	}
+	groupNameMap := make(map[string]string, len(groups))
+	for _, group := range groups {
+		groupNameMap[group.GroupNo] = group.Name
+	}
+	for _, report := range list {
+		channelName := userNameMap[report.ChannelID]
+		if report.ChannelType == common.ChannelTypeGroup.Uint8() {
+			channelName = groupNameMap[report.ChannelID]
+		}
+		imgs := make([]string, 0)
+		if report.Imgs != "" {
+			imgs = strings.Split(report.Imgs, ",")
+		}
+		result = append(result, &caseResp{
+			ID:           report.Id,
+			UID:          report.UID,
+			Name:         userNameMap[report.UID],
+			ChannelID:    report.ChannelID,
+			ChannelType:  report.ChannelType,
+			ChannelName:  channelName,
+			CategoryName: report.CategoryName,
+			Imgs:         imgs,
+			Remark:       report.Remark,
+			Status:       report.Status,
+			Assignee:     report.Assignee,
+			AssigneeName: userNameMap[report.Assignee],
+			Result:       report.Result,
+			HandledAt:    report.HandledAt,
+			CreateAt:     report.CreatedAt.String(),
+		})
+	}
+	return result, nil
+}
+
+// caseTargetUID 处理对象 未指定时单聊为被举报的用户，群聊为举报消息的唯一发送者
+func caseTargetUID(model *managerReportModel, messages []*messageModel, target string) string {
+	target = strings.TrimSpace(target)
+	if target != "" {
+		return target
+	}
+	if model.ChannelType != common.ChannelTypeGroup.Uint8() {
+		return model.ChannelID
+	}
+	fromUID := ""
+	for _, message := range messages {
+		if fromUID != "" && fromUID != message.FromUID {
+			return ""
+		}
+		fromUID = message.FromUID
+	}
+	return fromUID
+}
+
+// caseMessageIDs 需要删除的消息 只能删除举报时保存的消息，未指定时删除全部举报的消息
+func caseMessageIDs(messages []*messageModel, messageIDs []string) []string {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if len(messageIDs) == 0 {
+			ids = append(ids, message.MessageID)
+			continue
+		}
+		for _, messageID := range messageIDs {
+			if messageID == message.MessageID {
+				ids = append(ids, message.MessageID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func caseAssignee(model *managerReportModel, loginUID string) string {
+	if model.Assignee != "" {
+		return model.Assignee
+	}
+	return loginUID
+}
+
+// reportOutcomeContent 通知举报人的处理结果
+func reportOutcomeContent(status int, reportAt string, result string) string {
+	var content string
+	if status == StatusActioned {
+		content = fmt.Sprintf("你于%s提交的举报已核实并处理，感谢你的反馈。", reportAt)
+	} else {
+		content = fmt.Sprintf("你于%s提交的举报经核实暂未发现违规，感谢你的反馈。", reportAt)
+	}
+	if result != "" {
+		content = fmt.Sprintf("%s\n处理结果：%s", content, result)
+	}
+	return content
+}
+
+// warnContent 警告被举报用户的内容
+func warnContent(reason string) string {
+	content := "你的账号因被举报并经核实存在违规行为，现予以警告，多次违规将被限制使用。"
+	if reason != "" {
+		content = fmt.Sprintf("%s\n原因：%s", content, reason)
+	}
+	return content
+}
+
+type caseActionReq struct {
+	Action     string   `json:"action"`      // 处理动作
+	Target     string   `json:"target"`      // 处理的用户uid（警告、禁言、封禁用户时有效）
+	Duration   int64    `json:"duration"`    // 禁言时长（秒）
+	Reason     string   `json:"reason"`      // 处理原因
+	MessageIDs []string `json:"message_ids"` // 需要删除的消息
+}
+
+func (r *caseActionReq) check() error {
+	r.Reason = strings.TrimSpace(r.Reason)
+	switch r.Action {
+	case ActionWarn, ActionBanUser, ActionBanGroup, ActionDeleteMessages:
+	case ActionMute:
+		if r.Duration <= 0 || r.Duration > caseMaxMuteDuration {
+			return errors.New("禁言时长不正确，最长30天")
+		}
+	default:
+		return errors.New("不支持的处理动作")
+	}
+	if utf8.RuneCountInString(r.Reason) > 200 {
+		return errors.New("处理原因不能超过200个字")
+	}
+	return nil
+}
+
+type caseResp struct {
+	ID           int64              `json:"id"`
+	UID          string             `json:"uid"`
+	Name         string             `json:"name"` // 举报者名称
+	ChannelID    string             `json:"channel_id"`
+	ChannelType  uint8              `json:"channel_type"`
+	ChannelName  string             `json:"channel_name"` // 被举报的名称 群名称｜用户名
+	CategoryName string             `json:"category_name"`
+	Imgs         []string           `json:"imgs"`          // 举报图片内容
+	Remark       string             `json:"remark"`        // 举报备注
+	Status       int                `json:"status"`        // 处理状态 1.待处理 2.处理中 3.已处理 4.已驳回
+	Assignee     string             `json:"assignee"`      // 处理人uid
+	AssigneeName string             `json:"assignee_name"` // 处理人名称
+	Result       string             `json:"result"`        // 处理结果
+	HandledAt    int64              `json:"handled_at"`    // 结案时间
+	CreateAt     string             `json:"create_at"`
+	Messages     []*caseMessageResp `json:"messages,omitempty"` // 举报的消息快照（详情返回）
+	Notes        []*caseNoteResp    `json:"notes,omitempty"`    // 处理备注（详情返回）
+	Actions      []*caseActionResp  `json:"actions,omitempty"`  // 处理动作（详情返回）
+}
+
+type caseMessageResp struct {
+	MessageID  string                 `json:"message_id"`
+	MessageSeq uint32                 `json:"message_seq"`
+	FromUID    string                 `json:"from_uid"`
+	Payload    map[string]interface{} `json:"payload"`
+	Timestamp  int64                  `json:"timestamp"`
+}
+
+type caseNoteResp struct {
+	Author    string `json:"author"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+type caseActionResp struct {
+	Action    string `json:"action"`
+	Target    string `json:"target"`
+	Params    string `json:"params"`
+	Operator  string `json:"operator"`
+	Status    int    `json:"status"` // 1.成功 2.失败
+	Error     string `json:"error"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newCaseActionResp(m *actionModel) *caseActionResp {
+	return &caseActionResp{
+		Action:    m.Action,
+		Target:    m.Target,
+		Params:    m.Params,
+		Operator:  m.Operator,
+		Status:    m.Status,
+		Error:     m.Error,
+		CreatedAt: m.CreatedAt.String(),
+	}
+}
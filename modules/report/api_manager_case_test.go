@@ -0,0 +1,53 @@
+package report
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaseTargetUID(t *testing.T) {
+	person := &managerReportModel{ChannelID: "u2", ChannelType: common.ChannelTypePerson.Uint8()}
+	assert.Equal(t, "u2", caseTargetUID(person, nil, ""))
+	assert.Equal(t, "u3", caseTargetUID(person, nil, " u3 "))
+
+	group := &managerReportModel{ChannelID: "g1", ChannelType: common.ChannelTypeGroup.Uint8()}
+	assert.Equal(t, "", caseTargetUID(group, nil, ""))
+	messages := []*messageModel{{MessageID: "1", FromUID: "u5"}, {MessageID: "2", FromUID: "u5"}}
+	assert.Equal(t, "u5", caseTargetUID(group, messages, ""))
+	messages = append(messages, &messageModel{MessageID: "3", FromUID: "u6"})
+	assert.Equal(t, "", caseTargetUID(group, messages, ""))
+	assert.Equal(t, "u6", caseTargetUID(group, messages, "u6"))
+}
+
+func TestCaseMessageIDs(t *testing.T) {
+	messages := []*messageModel{{MessageID: "1"}, {MessageID: "2"}, {MessageID: "3"}}
+	assert.Equal(t, []string{"1", "2", "3"}, caseMessageIDs(messages, nil))
+	assert.Equal(t, []string{"2"}, caseMessageIDs(messages, []string{"2", "9"}))
+	assert.Empty(t, caseMessageIDs(messages, []string{"9"}))
+}
+
+func TestCaseActionReqCheck(t *testing.T) {
+	req := &caseActionReq{Action: ActionMute, Duration: 3600}
+	assert.NoError(t, req.check())
+	req = &caseActionReq{Action: ActionMute}
+	assert.Error(t, req.check())
+	req = &caseActionReq{Action: ActionMute, Duration: caseMaxMuteDuration + 1}
+	assert.Error(t, req.check())
+	req = &caseActionReq{Action: "kick"}
+	assert.Error(t, req.check())
+	req = &caseActionReq{Action: ActionWarn, Reason: strings.Repeat("违", 201)}
+	assert.Error(t, req.check())
+}
+
+func TestReportOutcomeContent(t *testing.T) {
+	content := reportOutcomeContent(StatusActioned, "2026-10-19 12:00:00", "已封禁")
+	assert.Contains(t, content, "已核实并处理")
+	assert.Contains(t, content, "处理结果：已封禁")
+
+	content = reportOutcomeContent(StatusDismissed, "2026-10-19 12:00:00", "")
+	assert.Contains(t, content, "暂未发现违规")
+	assert.NotContains(t, content, "处理结果")
+}
@@ -0,0 +1,35 @@
+package report
+
+// 举报处理状态
+const (
+	// StatusOpen 待处理
+	StatusOpen = 1
+	// StatusInReview 处理中
+	StatusInReview = 2
+	// StatusActioned 已处理
+	StatusActioned = 3
+	// StatusDismissed 已驳回
+	StatusDismissed = 4
+)
+
+// 举报处理动作
+const (
+	// ActionWarn 警告用户
+	ActionWarn = "warn"
+	// ActionMute 群内禁言
+	ActionMute = "mute"
+	// ActionBanUser 封禁用户
+	ActionBanUser = "ban_user"
+	// ActionBanGroup 封禁群
+	ActionBanGroup = "ban_group"
+	// ActionDeleteMessages 删除举报的消息
+	ActionDeleteMessages = "delete_messages"
+)
+
+// 处理动作执行结果
+const (
+	// ActionStatusSuccess 成功
+	ActionStatusSuccess = 1
+	// ActionStatusFail 失败
+	ActionStatusFail = 2
+)
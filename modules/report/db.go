@@ -35,6 +35,20 @@ func (d *db) insert(m *model) error {
 	return err
 }
 
+func (d *db) insertTx(m *model, tx *dbr.Tx) (int64, error) {
+	result, err := tx.InsertInto("report").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// 保存举报的消息快照
+func (d *db) insertMessageTx(m *messageModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("report_message").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
 type categoryModel struct {
 	CategoryNo       string
 	CategoryName     string
@@ -52,3 +66,13 @@ type model struct {
 	Remark      string
 	dba.BaseModel
 }
+
+type messageModel struct {
+	ReportID   int64
+	MessageID  string
+	MessageSeq uint32
+	FromUID    string
+	Payload    string
+	SentAt     int64
+	dba.BaseModel
+}
@@ -3,6 +3,7 @@ package report
 import (
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	dba "github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
 	"github.com/gocraft/dbr/v2"
 )
 
@@ -32,6 +33,106 @@ func (m *managerDB) queryReportCount(channelType int) (int64, error) {
 	return count, err
 }
 
+// 查询举报处理列表
+func (m *managerDB) cases(pageSize, page uint64, filter caseFilter) ([]*managerReportModel, error) {
+	var list []*managerReportModel
+	_, err := m.caseBuilder("report.*,report_category.category_name", filter).Offset((page-1)*pageSize).Limit(pageSize).OrderDir("report.id", false).Load(&list)
+	return list, err
+}
+
+// 查询举报处理数量
+func (m *managerDB) queryCaseCount(filter caseFilter) (int64, error) {
+	var count int64
+	_, err := m.caseBuilder("count(*)", filter).Load(&count)
+	return count, err
+}
+
+func (m *managerDB) caseBuilder(column string, filter caseFilter) *dbr.SelectStmt {
+	builder := m.session.Select(column).From("report").LeftJoin("report_category", "report.category_no=report_category.category_no")
+	if filter.Status > 0 {
+		builder = builder.Where("report.status=?", filter.Status)
+	}
+	if filter.ChannelType > 0 {
+		builder = builder.Where("report.channel_type=?", filter.ChannelType)
+	}
+	if filter.Assignee != "" {
+		builder = builder.Where("report.assignee=?", filter.Assignee)
+	}
+	return builder
+}
+
+// 查询举报
+func (m *managerDB) queryCase(id int64) (*managerReportModel, error) {
+	var model *managerReportModel
+	_, err := m.session.Select("report.*,report_category.category_name").From("report").LeftJoin("report_category", "report.category_no=report_category.category_no").Where("report.id=?", id).Load(&model)
+	return model, err
+}
+
+// 修改举报处理人
+func (m *managerDB) updateCaseAssignee(id int64, assignee string, status int) error {
+	_, err := m.session.Update("report").SetMap(map[string]interface{}{
+		"assignee": assignee,
+		"status":   status,
+	}).Where("id=?", id).Exec()
+	return err
+}
+
+// 修改举报处理状态
+func (m *managerDB) updateCaseStatus(id int64, status int, result string, handledAt int64) error {
+	_, err := m.session.Update("report").SetMap(map[string]interface{}{
+		"status":     status,
+		"result":     result,
+		"handled_at": handledAt,
+	}).Where("id=?", id).Exec()
+	return err
+}
+
+// 查询举报的消息快照
+func (m *managerDB) queryCaseMessages(id int64) ([]*messageModel, error) {
+	var models []*messageModel
+	_, err := m.session.Select("*").From("report_message").Where("report_id=?", id).OrderAsc("message_seq").Load(&models)
+	return models, err
+}
+
+// 添加处理备注
+func (m *managerDB) insertNote(model *noteModel) error {
+	_, err := m.session.InsertInto("report_note").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// 查询处理备注
+func (m *managerDB) queryNotes(id int64) ([]*noteModel, error) {
+	var models []*noteModel
+	_, err := m.session.Select("*").From("report_note").Where("report_id=?", id).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+// 添加处理动作
+func (m *managerDB) insertAction(model *actionModel) error {
+	_, err := m.session.InsertInto("report_action").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// 查询处理动作
+func (m *managerDB) queryActions(id int64) ([]*actionModel, error) {
+	var models []*actionModel
+	_, err := m.session.Select("*").From("report_action").Where("report_id=?", id).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+// 查询执行成功的处理动作数量
+func (m *managerDB) querySuccessActionCount(id int64) (int64, error) {
+	var count int64
+	_, err := m.session.Select("count(*)").From("report_action").Where("report_id=? and status=?", id, ActionStatusSuccess).Load(&count)
+	return count, err
+}
+
+type caseFilter struct {
+	Status      int
+	ChannelType int
+	Assignee    string
+}
+
 type managerReportModel struct {
 	UID          string
 	CategoryNo   string
@@ -40,5 +141,27 @@ type managerReportModel struct {
 	Imgs         string
 	Remark       string
 	CategoryName string
+	Status       int    // 处理状态
+	Assignee     string // 处理人
+	Result       string // 处理结果
+	HandledAt    int64  // 结案时间
+	dba.BaseModel
+}
+
+type noteModel struct {
+	ReportID int64
+	Author   string
+	Content  string
+	dba.BaseModel
+}
+
+type actionModel struct {
+	ReportID int64
+	Action   string
+	Target   string
+	Params   string
+	Operator string
+	Status   int
+	Error    string
 	dba.BaseModel
 }
@@ -0,0 +1,51 @@
+-- +migrate Up
+
+-- 举报处理状态 1.待处理 2.处理中 3.已处理 4.已驳回
+ALTER TABLE `report` ADD COLUMN status smallint not null DEFAULT 1 comment '处理状态 1.待处理 2.处理中 3.已处理 4.已驳回';
+ALTER TABLE `report` ADD COLUMN assignee VARCHAR(40) not null DEFAULT '' comment '处理人uid';
+ALTER TABLE `report` ADD COLUMN result VARCHAR(800) not null DEFAULT '' comment '处理结果（通知举报人）';
+ALTER TABLE `report` ADD COLUMN handled_at integer not null DEFAULT 0 comment '结案时间（秒）';
+CREATE INDEX report_status_idx on `report` (status);
+
+-- 举报的消息快照（举报时由服务端保存消息内容）
+create table IF NOT EXISTS `report_message`
+(
+    id integer PRIMARY KEY AUTO_INCREMENT,
+    report_id    integer      not null DEFAULT 0 comment '举报ID',
+    message_id   VARCHAR(40)  not null DEFAULT '' comment '消息ID',
+    message_seq  integer      not null DEFAULT 0 comment '消息序号',
+    from_uid     VARCHAR(40)  not null DEFAULT '' comment '消息发送者',
+    payload      mediumtext   comment '消息内容快照',
+    sent_at      integer      not null DEFAULT 0 comment '消息发送时间',
+    created_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP,
+    updated_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX report_message_report_id_idx on `report_message` (report_id);
+
+-- 举报处理备注
+create table IF NOT EXISTS `report_note`
+(
+    id integer PRIMARY KEY AUTO_INCREMENT,
+    report_id    integer       not null DEFAULT 0 comment '举报ID',
+    author       VARCHAR(40)   not null DEFAULT '' comment '备注人uid',
+    content      VARCHAR(1000) not null DEFAULT '' comment '备注内容',
+    created_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP,
+    updated_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX report_note_report_id_idx on `report_note` (report_id);
+
+-- 举报处理动作
+create table IF NOT EXISTS `report_action`
+(
+    id integer PRIMARY KEY AUTO_INCREMENT,
+    report_id    integer       not null DEFAULT 0 comment '举报ID',
+    action       VARCHAR(40)   not null DEFAULT '' comment '动作 warn.警告 mute.禁言 ban_user.封禁用户 ban_group.封禁群 delete_messages.删除消息',
+    target       VARCHAR(40)   not null DEFAULT '' comment '处理对象（用户uid或群编号）',
+    params       VARCHAR(1000) not null DEFAULT '' comment '动作参数',
+    operator     VARCHAR(40)   not null DEFAULT '' comment '操作人uid',
+    status       smallint      not null DEFAULT 1 comment '执行结果 1.成功 2.失败',
+    error        VARCHAR(255)  not null DEFAULT '' comment '失败原因',
+    created_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP,
+    updated_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX report_action_report_id_idx on `report_action` (report_id);
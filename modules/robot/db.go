@@ -120,3 +120,10 @@ type robot struct {
 	Status      int
 	db.BaseModel
 }
+
+// 查询app绑定的可用机器人
+func (d *robotDB) queryVaildRobotWithAppID(appID string) (*robot, error) {
+	var m *robot
+	_, err := d.session.Select("*").From("robot").Where("app_id=? and status=1", appID).OrderDir("id", true).Limit(1).Load(&m)
+	return m, err
+}
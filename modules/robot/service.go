@@ -0,0 +1,48 @@
+package robot
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+)
+
+// IService 机器人服务
+type IService interface {
+	// GetRobotWithAppID 获取app绑定的可用机器人 没有返回nil
+	GetRobotWithAppID(appID string) (*Resp, error)
+}
+
+// Service 机器人服务
+type Service struct {
+	ctx *config.Context
+	db  *robotDB
+}
+
+// NewService NewService
+func NewService(ctx *config.Context) IService {
+	return &Service{
+		ctx: ctx,
+		db:  newBotDB(ctx),
+	}
+}
+
+// GetRobotWithAppID 获取app绑定的可用机器人
+func (s *Service) GetRobotWithAppID(appID string) (*Resp, error) {
+	robotM, err := s.db.queryVaildRobotWithAppID(appID)
+	if err != nil {
+		return nil, err
+	}
+	if robotM == nil {
+		return nil, nil
+	}
+	return &Resp{
+		RobotID:  robotM.RobotID,
+		AppID:    robotM.AppID,
+		Username: robotM.Username,
+	}, nil
+}
+
+// Resp 机器人信息
+type Resp struct {
+	RobotID  string // 机器人ID（即机器人的uid）
+	AppID    string
+	Username string
+}
@@ -54,13 +54,12 @@ type User struct {
 	friendDB      *friendDB
 	deviceDB      *deviceDB
 	smsServie     commonapi.ISMSService
+	emailService  commonapi.IEmailService
 	fileService   file.IService
 	settingDB     *SettingDB
 	onlineDB      *onlineDB
 	userService   IService
 	onlineService *OnlineService
-	giteeDB       *giteeDB
-	githubDB      *githubDB
 
 	setting *Setting
 	log.Log
@@ -77,6 +76,13 @@ type User struct {
 	deviceFlagDB             *deviceFlagDB
 	deviceFlagsCache         []*deviceFlagModel
 	appService               app.IService
+	passwordService          *passwordService
+	totpService              *totpService
+	limiter                  *loginLimiter
+	sessionService           *sessionService
+	identityDB               *identityDB
+	oidcProviderDB           *oidcProviderDB
+	ldapService              *ldapService
 }
 
 // New New
@@ -103,11 +109,17 @@ func New(ctx *config.Context) *User {
 		onetimePrekeysDB:         newOnetimePrekeysDB(ctx),
 		maillistDB:               newMaillistDB(ctx),
 		deviceFlagDB:             newDeviceFlagDB(ctx),
-		giteeDB:                  newGiteeDB(ctx),
-		githubDB:                 newGithubDB(ctx),
 		commonService:            common2.NewService(ctx),
 		appService:               app.NewService(ctx),
-	}
+		passwordService:          newPasswordService(ctx),
+		totpService:              newTotpService(ctx),
+		limiter:                  newLoginLimiter(ctx),
+		sessionService:           newSessionService(ctx),
+		identityDB:               newIdentityDB(ctx),
+		oidcProviderDB:           newOIDCProviderDB(ctx),
+		ldapService:              newLDAPService(ctx),
+	}
+	u.emailService = commonapi.NewEmailService(ctx, u.emailProvider)
 	u.updateSystemUserToken()
 	source.SetUserProvider(u)
 	return u
@@ -145,9 +157,17 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		user.GET("/customerservices", u.customerservices)          //客服列表
 		user.DELETE("/destroy/:code", u.destroyAccount)            // 注销用户
 		user.POST("/sms/destroy", u.sendDestroyCode)               //获取注销账号短信验证码
+		user.POST("/email/bindcode", u.sendEmailBindCode)          // 获取绑定邮箱验证码
+		user.POST("/email/bind", u.emailBind)                      // 绑定邮箱
 		user.PUT("/updatepassword", u.updatePwd)                   // 修改登录密码
 		user.POST("/web3publickey", u.uploadWeb3PublicKey)         // 上传web3公钥
 		user.POST("/quit", u.quit)                                 // 退出登录
+		// #################### 两步验证 ####################
+		user.GET("/totp", u.totpStatus)                        // 两步验证状态
+		user.POST("/totp/setup", u.totpSetup)                  // 获取两步验证密钥
+		user.POST("/totp/enable", u.totpEnable)                // 确认开启两步验证
+		user.POST("/totp/disable", u.totpDisable)              // 关闭两步验证
+		user.POST("/totp/recovery_codes", u.totpRecoveryCodes) // 重新生成恢复码
 		// #################### 登录设备管理 ####################
 		user.GET("/devices", u.deviceList)                 // 用户登录设备
 		user.DELETE("/devices/:device_id", u.deviceDelete) // 删除登录设备
@@ -155,6 +175,14 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		user.GET("/online", u.onlineList)                  // 用户在线列表（我的设备和我的好友）
 		user.POST("/online", u.onlinelistWithUIDs)         // 获取指定的uid在线状态
 		user.POST("/pc/quit", u.pcQuit)                    // 退出pc登录
+		// #################### 登录会话 ####################
+		user.GET("/sessions", u.sessionList)                        // 我的登录会话
+		user.DELETE("/sessions/:session_id", u.sessionRevoke)       // 注销某个登录会话
+		user.POST("/sessions/revoke_others", u.sessionRevokeOthers) // 退出其他所有登录
+		// #################### 第三方身份 ####################
+		user.GET("/identities", u.identities)                   // 我绑定的第三方身份
+		user.POST("/identities/:provider/link", u.identityLink) // 获取绑定第三方身份的授权地址
+		user.DELETE("/identities/:provider", u.identityUnlink)  // 解除绑定第三方身份
 
 		// #################### 用户通讯录 ####################
 		user.POST("/maillist", u.addMaillist)
@@ -187,22 +215,30 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		v.POST("/user/login_authcode/:auth_code", u.loginWithAuthCode)   // 通过认证码登录
 		v.POST("/user/sms/login_check_phone", u.sendLoginCheckPhoneCode) //发送登录设备验证验证码
 		v.POST("/user/login/check_phone", u.loginCheckPhone)             //登录验证设备手机号
+		v.POST("/user/login/totp", u.loginTotp)                          // 登录两步验证
+		v.GET("/user/captcha", u.getCaptcha)                             // 获取图形验证码
+		v.POST("/user/token/refresh", u.tokenRefresh)                    // 刷新访问令牌
+		// #################### 邮箱 ####################
+		v.POST("/user/email/registercode", u.sendEmailRegisterCode) // 获取邮箱注册验证码
+		v.POST("/user/email/register", u.emailRegister)             // 邮箱注册
+		v.POST("/user/email/forgetpwd", u.sendEmailForgetPwdCode)   // 获取邮箱重置密码验证码
+		v.POST("/user/email/pwdforget", u.emailPwdForget)           // 通过邮箱重置登录密码
 
 		// #################### 第三方授权 ####################
 		v.GET("/user/thirdlogin/authcode", u.thirdAuthcode)     // 第三方授权码获取
 		v.GET("/user/thirdlogin/authstatus", u.thirdAuthStatus) // github认证页面
-		// github
-		v.GET("/user/github", u.github)            // github认证页面
-		v.GET("/user/oauth/github", u.githubOAuth) // github登录
-		// gitee
-		v.GET("/user/gitee", u.gitee)            // gitee认证页面
-		v.GET("/user/oauth/gitee", u.giteeOAuth) // gitee登录
+		v.GET("/user/oidc/providers", u.oidcProviders)          // 可用的第三方登录方式
+		v.GET("/user/oidc/:provider", u.oidcAuthorize)          // 跳转到第三方授权页面
+		v.GET("/user/oauth/:provider", u.oidcCallback)          // 第三方授权回调
+		v.GET("/user/github", u.github)                         // github认证页面
+		v.GET("/user/gitee", u.gitee)                           // gitee认证页面
 
 	}
 
 	u.ctx.AddOnlineStatusListener(u.onlineService.listenOnlineStatus) // 监听在线状态
 	u.ctx.AddOnlineStatusListener(u.handleOnlineStatus)               // 需要放在listenOnlineStatus之后
 	u.ctx.Schedule(time.Minute*5, u.onlineStatusCheck)                // 在线状态定时检查
+	u.ctx.Schedule(time.Minute, u.ldapSyncCheck)                      // LDAP目录定时同步
 
 }
 
@@ -634,7 +670,7 @@ func (u *User) userUpdateWithField(c *wkhttp.Context) {
 		}
 		if key == "name" {
 			// 将重新设置token设置到缓存（这里主要是更新登录者的name）
-			err = u.ctx.Cache().Set(u.ctx.GetConfig().Cache.TokenCachePrefix+c.GetHeader("token"), fmt.Sprintf("%s@%s@%s", loginUID, value, c.GetLoginRole()))
+			err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+c.GetHeader("token"), fmt.Sprintf("%s@%s@%s", loginUID, value, c.GetLoginRole()), accessTokenExpire)
 			if err != nil {
 				u.Error("重新设置token缓存失败！", zap.Error(err))
 				c.ResponseError(errors.New("重新设置token缓存失败！"))
@@ -901,6 +937,9 @@ func (u *User) wxLogin(c *wkhttp.Context) {
 			c.ResponseError(errors.New("用户不存在"))
 			return
 		}
+		if u.needTotpChallenge(userInfo, totpSceneLogin, req.Flag, req.Device, c) {
+			return
+		}
 		u.execLoginAndRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
 	} else {
 		// 创建用户
@@ -961,6 +1000,12 @@ func (u *User) login(c *wkhttp.Context) {
 	loginSpan.SetTag("username", req.Username)
 	defer loginSpan.Finish()
 
+	subject := limitSubject{Account: req.Username, IP: util.GetClientPublicIP(c.Request), Device: deviceIDOf(req.Device)}
+	if err := u.limiter.check(limitActionPassword, subject, req.CaptchaID, req.CaptchaCode); err != nil {
+		responseLimitError(c, err)
+		return
+	}
+
 	userInfo, err := u.db.QueryByUsernameCxt(loginSpanCtx, req.Username)
 	if err != nil {
 		u.Error("查询用户信息失败！", zap.String("username", req.Username))
@@ -968,6 +1013,7 @@ func (u *User) login(c *wkhttp.Context) {
 		return
 	}
 	if userInfo == nil || userInfo.IsDestroy == 1 {
+		u.limiter.hit(limitActionPassword, subject)
 		c.ResponseError(errors.New("用户不存在"))
 		return
 	}
@@ -975,17 +1021,23 @@ func (u *User) login(c *wkhttp.Context) {
 		c.ResponseError(errors.New("此账号不允许登录"))
 		return
 	}
-	if util.MD5(util.MD5(req.Password)) != userInfo.Password {
+	subject.UID = userInfo.UID
+	if !u.passwordService.verify(userInfo.UID, req.Password, userInfo.Password) {
+		u.limiter.hit(limitActionPassword, subject)
 		c.ResponseError(errors.New("密码不正确！"))
 		return
 	}
+	u.limiter.reset(limitActionPassword, subject)
+	if u.needTotpChallenge(userInfo, totpSceneLogin, req.Flag, req.Device, c) {
+		return
+	}
 	u.execLoginAndRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
 }
 
 // 验证登录用户信息
 func (u *User) execLoginAndRespose(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context, c *wkhttp.Context) {
 
-	result, err := u.execLogin(userInfo, flag, device, loginSpanCtx)
+	result, err := u.execLogin(userInfo, flag, device, newSessionClient(c), loginSpanCtx)
 	if err != nil {
 		if errors.Is(err, ErrUserNeedVerification) {
 			phone := ""
@@ -1010,7 +1062,7 @@ func (u *User) execLoginAndRespose(userInfo *Model, flag config.DeviceFlag, devi
 	go u.sentWelcomeMsg(publicIP, userInfo.UID)
 }
 
-func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context) (*loginUserDetailResp, error) {
+func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *deviceReq, client *sessionClient, loginSpanCtx context.Context) (*loginUserDetailResp, error) {
 	if userInfo.Status == int(common.UserDisable) {
 		return nil, errors.New("该用户已被禁用")
 	}
@@ -1073,22 +1125,18 @@ func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *device
 		tokenSpan.Finish()
 		return nil, errors.New("获取旧token错误")
 	}
-	if flag == config.APP {
-		if oldToken != "" {
-			err = u.ctx.Cache().Delete(u.ctx.GetConfig().Cache.TokenCachePrefix + oldToken)
-			if err != nil {
-				u.Error("清除旧token数据错误", zap.Error(err))
-				tokenSpan.Finish()
-				return nil, errors.New("清除旧token数据错误")
-			}
-		}
-	} else { // PC暂时不执行删除操作，因为PC可以同时登陆
-		if strings.TrimSpace(oldToken) != "" { // 如果是web或pc类设备 因为支持多登所以这里依然使用老token
-			token = oldToken
+	// web/pc可以同时登录多个客户端，每次登录签发新的token和会话，旧token不删除
+	if flag == config.APP && oldToken != "" {
+		err = u.ctx.Cache().Delete(u.ctx.GetConfig().Cache.TokenCachePrefix + oldToken)
+		if err != nil {
+			u.Error("清除旧token数据错误", zap.Error(err))
+			tokenSpan.Finish()
+			return nil, errors.New("清除旧token数据错误")
 		}
+		u.sessionService.revokeWithToken(oldToken)
 	}
 
-	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userInfo.UID, userInfo.Name, userInfo.Role), u.ctx.GetConfig().Cache.TokenExpire)
+	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userInfo.UID, userInfo.Name, userInfo.Role), accessTokenExpire)
 	if err != nil {
 		u.Error("设置token缓存失败！", zap.Error(err))
 		tokenSpan.Finish()
@@ -1122,8 +1170,11 @@ func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *device
 	if imResp.Status == config.UpdateTokenStatusBan {
 		return nil, errors.New("此账号已经被封禁！")
 	}
+	refreshToken := u.sessionService.add(userInfo.UID, token, flag, device, client, true)
 
-	return newLoginUserDetailResp(userInfo, token, u.ctx), nil
+	resp := newLoginUserDetailResp(userInfo, token, u.ctx)
+	resp.setRefreshToken(refreshToken)
+	return resp, nil
 }
 
 // sendWelcomeMsg 发送欢迎语
@@ -1181,43 +1232,20 @@ func (u *User) register(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	if err := u.passwordService.check(req.Password); err != nil {
+		c.ResponseError(err)
+		return
+	}
 
 	if u.ctx.GetConfig().Register.Off {
 		c.ResponseError(errors.New("注册通道暂不开放"))
 		return
 	}
-	appConfig, err := u.commonService.GetAppConfig()
+	invite, err := u.checkRegisterInvite(req.InviteCode)
 	if err != nil {
-		u.Error("查询应用设置错误", zap.Error(err))
 		c.ResponseError(err)
 		return
 	}
-	var registerInviteOn = 0
-	if appConfig != nil {
-		registerInviteOn = appConfig.RegisterInviteOn
-	}
-	var invite *model.Invite
-	if registerInviteOn == 1 {
-		if req.InviteCode == "" {
-			c.ResponseError(errors.New("邀请码不能为空"))
-			return
-		}
-		var inviteCodeIsExist = false
-		modules := register.GetModules(u.ctx)
-		for _, m := range modules {
-			if m.BussDataSource.GetInviteCode != nil {
-				invite, _ = m.BussDataSource.GetInviteCode(req.InviteCode)
-				if invite != nil && invite.Uid != "" {
-					inviteCodeIsExist = true
-					break
-				}
-			}
-		}
-		if !inviteCodeIsExist {
-			c.ResponseError(errors.New("邀请码不存在"))
-			return
-		}
-	}
 	registerSpan := u.ctx.Tracer().StartSpan(
 		"user.register",
 		opentracing.ChildOf(c.GetSpanContext()),
@@ -1245,9 +1273,9 @@ func (u *User) register(c *wkhttp.Context) {
 		}
 	} else {
 		//线上验证短信验证码
-		err = u.smsServie.Verify(registerSpanCtx, req.Zone, req.Phone, req.Code, commonapi.CodeTypeRegister)
+		err = u.verifySMSCode(registerSpanCtx, c, req.Zone, req.Phone, req.Code, commonapi.CodeTypeRegister)
 		if err != nil {
-			c.ResponseError(err)
+			responseLimitError(c, err)
 			return
 		}
 	}
@@ -1265,6 +1293,31 @@ func (u *User) register(c *wkhttp.Context) {
 	u.createUser(registerSpanCtx, model, c, invite)
 }
 
+// 校验注册邀请码（未开启注册邀请时返回nil）
+func (u *User) checkRegisterInvite(inviteCode string) (*model.Invite, error) {
+	appConfig, err := u.commonService.GetAppConfig()
+	if err != nil {
+		u.Error("查询应用设置错误", zap.Error(err))
+		return nil, err
+	}
+	if appConfig == nil || appConfig.RegisterInviteOn != 1 {
+		return nil, nil
+	}
+	if inviteCode == "" {
+		return nil, errors.New("邀请码不能为空")
+	}
+	modules := register.GetModules(u.ctx)
+	for _, m := range modules {
+		if m.BussDataSource.GetInviteCode != nil {
+			invite, _ := m.BussDataSource.GetInviteCode(inviteCode)
+			if invite != nil && invite.Uid != "" {
+				return invite, nil
+			}
+		}
+	}
+	return nil, errors.New("邀请码不存在")
+}
+
 // 搜索用户
 func (u *User) search(c *wkhttp.Context) {
 	keyword := c.Query("keyword")
@@ -1505,6 +1558,8 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 	}
 	if strings.TrimSpace(token) == "" {
 		token = util.GenerUUID()
+	} else if revoked, _ := u.sessionService.revoked(token); revoked {
+		token = util.GenerUUID()
 	}
 
 	userModel, err := u.db.QueryByUID(scaner)
@@ -1514,6 +1569,7 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 		return
 	}
 	// 获取缓存设备
+	var device *deviceReq
 	uuid := authInfoMap["uuid"].(string)
 	if uuid != "" {
 		deviceCache, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", common.DeviceCacheUUIDPrefix, uuid))
@@ -1534,6 +1590,7 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 			deviceName := deviceInfoMap["device_name"].(string)
 			dmodel := deviceInfoMap["device_model"].(string)
 			if deviceId != "" && deviceName != "" && dmodel != "" {
+				device = &deviceReq{DeviceID: deviceId, DeviceName: deviceName, DeviceModel: dmodel}
 				span := u.ctx.Tracer().StartSpan(
 					"user.authCodeLogin",
 					opentracing.ChildOf(c.GetSpanContext()),
@@ -1573,7 +1630,7 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 	}
 
 	// 将token设置到缓存
-	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s", userModel.UID, userModel.Name), u.ctx.GetConfig().Cache.TokenExpire)
+	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s", userModel.UID, userModel.Name), accessTokenExpire)
 	if err != nil {
 		u.Error("设置token缓存失败！", zap.Error(err))
 		c.ResponseError(errors.New("设置token缓存失败！"))
@@ -1592,16 +1649,19 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("设置uidtoken缓存失败！"))
 		return
 	}
+	refreshToken := u.sessionService.add(userModel.UID, token, flag, device, newSessionClient(c), true)
 
 	c.Response(map[string]interface{}{
-		"app_id":     userModel.AppID,
-		"name":       userModel.Name,
-		"username":   userModel.Username,
-		"uid":        userModel.UID,
-		"token":      token,
-		"short_no":   userModel.ShortNo,
-		"avatar":     u.ctx.GetConfig().GetAvatarPath(userModel.UID),
-		"im_pub_key": "",
+		"app_id":        userModel.AppID,
+		"name":          userModel.Name,
+		"username":      userModel.Username,
+		"uid":           userModel.UID,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int64(accessTokenExpire / time.Second),
+		"short_no":      userModel.ShortNo,
+		"avatar":        u.ctx.GetConfig().GetAvatarPath(userModel.UID),
+		"im_pub_key":    "",
 	})
 }
 
@@ -1937,8 +1997,12 @@ func (u *User) sendRegisterCode(c *wkhttp.Context) {
 		})
 		return
 	}
-	err = u.smsServie.SendVerifyCode(spanCtx, req.Zone, req.Phone, commonapi.CodeTypeRegister)
+	err = u.sendSMSCode(spanCtx, c, req.Zone, req.Phone, commonapi.CodeTypeRegister)
 	if err != nil {
+		if isLimitError(err) {
+			responseLimitError(c, err)
+			return
+		}
 		u.Error("发送短信验证码失败", zap.Error(err))
 		c.ResponseError(errors.New("发送短信验证码失败！"))
 		return
@@ -1970,7 +2034,7 @@ func (u *User) setChatPwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("查询用户信息失败"))
 		return
 	}
-	if user.Password != util.MD5(util.MD5(req.LoginPwd)) {
+	if !u.passwordService.verify(user.UID, req.LoginPwd, user.Password) {
 		c.ResponseError(errors.New("登录密码错误"))
 		return
 	}
@@ -2080,13 +2144,26 @@ func (u *User) sendLoginCheckPhoneCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该用户不存在"))
 		return
 	}
+	if useEmailChannel(userinfo) {
+		err = u.sendEmailCode(spanCtx, c, userinfo.Email, commonapi.CodeTypeCheckMobile)
+		if err != nil {
+			u.responseSendEmailError(c, err)
+			return
+		}
+		c.ResponseOK()
+		return
+	}
 	//发送短信
 	// if u.ctx.GetConfig().Test {
 	// 	c.ResponseOK()
 	// 	return
 	// }
-	err = u.smsServie.SendVerifyCode(spanCtx, userinfo.Zone, userinfo.Phone, commonapi.CodeTypeCheckMobile)
+	err = u.sendSMSCode(spanCtx, c, userinfo.Zone, userinfo.Phone, commonapi.CodeTypeCheckMobile)
 	if err != nil {
+		if isLimitError(err) {
+			responseLimitError(c, err)
+			return
+		}
 		u.Error("发送短信失败", zap.Error(err))
 		ext.LogError(span, err)
 		c.ResponseError(errors.New("发送短信失败"))
@@ -2132,10 +2209,14 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该用户不存在"))
 		return
 	}
-	err = u.smsServie.Verify(spanCtx, userInfo.Zone, userInfo.Phone, req.Code, commonapi.CodeTypeCheckMobile)
+	if useEmailChannel(userInfo) {
+		err = u.verifyEmailCode(spanCtx, c, userInfo.Email, req.Code, commonapi.CodeTypeCheckMobile)
+	} else {
+		err = u.verifySMSCode(spanCtx, c, userInfo.Zone, userInfo.Phone, req.Code, commonapi.CodeTypeCheckMobile)
+	}
 	if err != nil {
 		u.Error("验证短信失败", zap.Error(err))
-		c.ResponseError(err)
+		responseLimitError(c, err)
 		return
 	}
 
@@ -2170,7 +2251,7 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 	}
 	token := util.GenerUUID()
 	// 将token设置到缓存
-	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s", userInfo.UID, userInfo.Name), u.ctx.GetConfig().Cache.TokenExpire)
+	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s", userInfo.UID, userInfo.Name), accessTokenExpire)
 	if err != nil {
 		u.Error("设置token缓存失败！", zap.Error(err))
 		c.ResponseError(errors.New("设置token缓存失败！"))
@@ -2192,7 +2273,10 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 		c.ResponseError(errors.New("此账号已经被封禁！"))
 		return
 	}
-	c.Response(newLoginUserDetailResp(userInfo, token, u.ctx))
+	refreshToken := u.sessionService.add(userInfo.UID, token, config.APP, loginDeivce, newSessionClient(c), true)
+	resp := newLoginUserDetailResp(userInfo, token, u.ctx)
+	resp.setRefreshToken(refreshToken)
+	c.Response(resp)
 }
 
 // customerservices 客服列表
@@ -2228,9 +2312,18 @@ func (u *User) sendDestroyCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("登录用户不存在"))
 		return
 	}
-	err = u.smsServie.SendVerifyCode(c.Context, userInfo.Zone, userInfo.Phone, commonapi.CodeTypeDestroyAccount)
+	if useEmailChannel(userInfo) {
+		err = u.sendEmailCode(c.Context, c, userInfo.Email, commonapi.CodeTypeDestroyAccount)
+		if err != nil {
+			u.responseSendEmailError(c, err)
+			return
+		}
+		c.ResponseOK()
+		return
+	}
+	err = u.sendSMSCode(c.Context, c, userInfo.Zone, userInfo.Phone, commonapi.CodeTypeDestroyAccount)
 	if err != nil {
-		c.ResponseError(err)
+		responseLimitError(c, err)
 		return
 	}
 	c.ResponseOK()
@@ -2254,8 +2347,13 @@ func (u *User) destroyAccount(c *wkhttp.Context) {
 		c.ResponseError(errors.New("登录用户不存在"))
 		return
 	}
-	//测试模式
-	if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != "" {
+	if useEmailChannel(userInfo) {
+		err = u.verifyEmailCode(c.Context, c, userInfo.Email, code, commonapi.CodeTypeDestroyAccount)
+		if err != nil {
+			responseLimitError(c, err)
+			return
+		}
+	} else if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != "" { //测试模式
 		if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != code {
 			c.ResponseError(errors.New("验证码错误"))
 			return
@@ -2263,9 +2361,9 @@ func (u *User) destroyAccount(c *wkhttp.Context) {
 	} else {
 		//线上验证短信验证码
 		// 校验验证码
-		err = u.smsServie.Verify(c.Context, userInfo.Zone, userInfo.Phone, code, commonapi.CodeTypeDestroyAccount)
+		err = u.verifySMSCode(c.Context, c, userInfo.Zone, userInfo.Phone, code, commonapi.CodeTypeDestroyAccount)
 		if err != nil {
-			c.ResponseError(err)
+			responseLimitError(c, err)
 			return
 		}
 	}
@@ -2403,6 +2501,10 @@ func (u *User) pwdforget(c *wkhttp.Context) {
 		c.ResponseError(errors.New("密码不能为空！"))
 		return
 	}
+	if err := u.passwordService.check(req.Pwd); err != nil {
+		c.ResponseError(err)
+		return
+	}
 	userInfo, err := u.db.QueryByPhone(req.Zone, req.Phone)
 	if err != nil {
 		u.Error("查询用户信息错误", zap.Error(err))
@@ -2421,14 +2523,20 @@ func (u *User) pwdforget(c *wkhttp.Context) {
 		}
 	} else {
 		//线上验证短信验证码
-		err = u.smsServie.Verify(context.Background(), req.Zone, req.Phone, req.Code, commonapi.CodeTypeForgetLoginPWD)
+		err = u.verifySMSCode(context.Background(), c, req.Zone, req.Phone, req.Code, commonapi.CodeTypeForgetLoginPWD)
 		if err != nil {
-			c.ResponseError(err)
+			responseLimitError(c, err)
 			return
 		}
 	}
 
-	err = u.db.UpdateUsersWithField("password", util.MD5(util.MD5(req.Pwd)), userInfo.UID)
+	pwdHash, err := u.passwordService.hash(req.Pwd)
+	if err != nil {
+		u.Error("生成密码hash失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	err = u.db.UpdateUsersWithField("password", pwdHash, userInfo.UID)
 	if err != nil {
 		u.Error("修改登录密码错误", zap.Error(err))
 		c.ResponseError(errors.New("修改登录密码错误"))
@@ -2470,8 +2578,12 @@ func (u *User) getForgetPwdSMS(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该手机号未注册"))
 		return
 	}
-	err = u.smsServie.SendVerifyCode(spanCtx, req.Zone, req.Phone, commonapi.CodeTypeForgetLoginPWD)
+	err = u.sendSMSCode(spanCtx, c, req.Zone, req.Phone, commonapi.CodeTypeForgetLoginPWD)
 	if err != nil {
+		if isLimitError(err) {
+			responseLimitError(c, err)
+			return
+		}
 		u.Error("发送短信验证码失败", zap.Error(err))
 		c.ResponseError(errors.New("发送短信验证码失败！"))
 		return
@@ -2573,7 +2685,11 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 		userModel.Username = fmt.Sprintf("%s%s", createUser.Zone, createUser.Phone)
 	}
 	if createUser.Password != "" {
-		userModel.Password = util.MD5(util.MD5(createUser.Password))
+		userModel.Password, err = u.passwordService.hash(createUser.Password)
+		if err != nil {
+			u.Error("生成密码hash失败！", zap.Error(err))
+			return nil, err
+		}
 	}
 	if createUser.Username != "" {
 		userModel.Username = createUser.Username
@@ -2590,8 +2706,8 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 	userModel.IsUploadAvatar = createUser.IsUploadAvatar
 	userModel.WXOpenid = createUser.WXOpenid
 	userModel.WXUnionid = createUser.WXUnionid
-	userModel.GiteeUID = createUser.GiteeUID
-	userModel.GithubUID = createUser.GithubUID
+	userModel.Email = createUser.Email
+	userModel.EmailVerified = createUser.EmailVerified
 	userModel.Status = int(common.UserAvailable)
 	err = u.db.insertTx(userModel, tx)
 	if err != nil {
@@ -2651,7 +2767,7 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 	u.ctx.EventCommit(eventID)
 	token := util.GenerUUID()
 	// 将token设置到缓存
-	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userModel.UID, userModel.Name, userModel.Role), u.ctx.GetConfig().Cache.TokenExpire)
+	err = u.ctx.Cache().SetAndExpire(u.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userModel.UID, userModel.Name, userModel.Role), accessTokenExpire)
 	if err != nil {
 		u.Error("设置token缓存失败！", zap.Error(err))
 		return nil, err
@@ -2666,6 +2782,7 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 		u.Error("更新IM的token失败！", zap.Error(err))
 		return nil, err
 	}
+	refreshToken := u.sessionService.add(createUser.UID, token, config.DeviceFlag(createUser.Flag), createUser.Device, &sessionClient{IP: publicIP}, true)
 	go u.sentWelcomeMsg(publicIP, createUser.UID)
 
 	if u.ctx.GetConfig().ShortNo.NumOn {
@@ -2675,7 +2792,9 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 		}
 	}
 
-	return newLoginUserDetailResp(userModel, token, u.ctx), nil
+	resp := newLoginUserDetailResp(userModel, token, u.ctx)
+	resp.setRefreshToken(refreshToken)
+	return resp, nil
 }
 
 // ---------- vo ----------
@@ -2688,9 +2807,9 @@ type createUserModel struct {
 	Password       string
 	WXOpenid       string
 	WXUnionid      string
-	GiteeUID       string
-	GithubUID      string
 	Username       string
+	Email          string
+	EmailVerified  int
 	Flag           int
 	IsUploadAvatar int
 	Device         *deviceReq
@@ -2731,9 +2850,6 @@ func (r registerReq) CheckRegister() error {
 	if strings.TrimSpace(r.Password) == "" {
 		return errors.New("密码不能为空！")
 	}
-	if len(r.Password) < 6 {
-		return errors.New("密码长度必须大于6位！")
-	}
 	return nil
 }
 
@@ -2753,6 +2869,9 @@ type loginReq struct {
 	Password string     `json:"password"`
 	Flag     int        `json:"flag"`   // 设备标示 0.APP 1.PC
 	Device   *deviceReq `json:"device"` //登录设备信息
+	// 多次失败后需要图形验证码
+	CaptchaID   string `json:"captcha_id"`
+	CaptchaCode string `json:"captcha_code"`
 }
 
 func (r loginReq) Check() error {
@@ -2795,6 +2914,8 @@ type loginUserDetailResp struct {
 	ShortNo         string  `json:"short_no"`          // 用户唯一短编号
 	Zone            string  `json:"zone"`              //区号
 	Phone           string  `json:"phone"`             //手机号
+	Email           string  `json:"email"`             // 邮箱
+	EmailVerified   int     `json:"email_verified"`    // 邮箱是否已验证
 	Token           string  `json:"token"`             //token
 	ChatPwd         string  `json:"chat_pwd"`          //聊天密码
 	LockScreenPwd   string  `json:"lock_screen_pwd"`   // 锁屏密码
@@ -2803,6 +2924,13 @@ type loginUserDetailResp struct {
 	RSAPublicKey    string  `json:"rsa_public_key"` // 应用公钥做一些消息验证 base64编码
 	ShortStatus     int     `json:"short_status"`
 	MsgExpireSecond int64   `json:"msg_expire_second"` // 消息过期时长
+	RefreshToken    string  `json:"refresh_token"`     // 刷新令牌 token过期后通过/v1/user/token/refresh换取新token
+	ExpiresIn       int64   `json:"expires_in"`        // token有效期（秒）
+}
+
+func (r *loginUserDetailResp) setRefreshToken(refreshToken string) {
+	r.RefreshToken = refreshToken
+	r.ExpiresIn = int64(accessTokenExpire / time.Second)
 }
 
 type setting struct {
@@ -2835,6 +2963,8 @@ func newLoginUserDetailResp(m *Model, token string, ctx *config.Context) *loginU
 		ShortNo:         m.ShortNo,
 		Zone:            m.Zone,
 		Phone:           m.Phone,
+		Email:           m.Email,
+		EmailVerified:   m.EmailVerified,
 		Token:           token,
 		ChatPwd:         m.ChatPwd,
 		LockScreenPwd:   m.LockScreenPwd,
@@ -0,0 +1,422 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+var (
+	errEmailOff   = errors.New("未开启邮箱注册登录！")
+	errEmailExist = errors.New("该邮箱已被其他账号绑定")
+)
+
+// emailProvider 根据后台配置创建SMTP邮件发送
+func (u *User) emailProvider() (commonapi.IEmailProvider, error) {
+	appConfig, err := u.commonService.GetAppConfig()
+	if err != nil {
+		return nil, err
+	}
+	if appConfig == nil || appConfig.EmailOn != 1 {
+		return nil, errEmailOff
+	}
+	return commonapi.NewSMTPProvider(commonapi.SMTPConfig{
+		Addr:     appConfig.SMTPAddr,
+		Username: appConfig.SMTPUsername,
+		Password: appConfig.SMTPPassword,
+		From:     appConfig.SMTPFrom,
+		SSL:      appConfig.SMTPSSL == 1,
+	}), nil
+}
+
+func (u *User) emailOn() bool {
+	appConfig, err := u.commonService.GetAppConfig()
+	if err != nil {
+		u.Error("查询应用设置错误", zap.Error(err))
+		return false
+	}
+	return appConfig != nil && appConfig.EmailOn == 1
+}
+
+// 规范化并校验邮箱地址
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", errors.New("邮箱不能为空！")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("邮箱格式有误！")
+	}
+	return email, nil
+}
+
+// 用户没有绑定手机号时使用已验证的邮箱接收验证码
+func useEmailChannel(m *Model) bool {
+	return strings.TrimSpace(m.Phone) == "" && m.Email != "" && m.EmailVerified == 1
+}
+
+func emailLimitSubject(c *wkhttp.Context, email string) limitSubject {
+	return limitSubject{
+		Account: email,
+		IP:      util.GetClientPublicIP(c.Request),
+	}
+}
+
+// sendEmailCode 发送邮箱验证码（与短信共用发送频率限制）
+func (u *User) sendEmailCode(ctx context.Context, c *wkhttp.Context, email string, codeType commonapi.CodeType) error {
+	subject := emailLimitSubject(c, email)
+	if err := u.limiter.check(limitActionSMSSend, subject, "", ""); err != nil {
+		return err
+	}
+	err := u.emailService.SendVerifyCode(ctx, email, codeType)
+	if err != nil {
+		return err
+	}
+	u.limiter.hit(limitActionSMSSend, subject)
+	return nil
+}
+
+// verifyEmailCode 校验邮箱验证码（限制错误次数）
+func (u *User) verifyEmailCode(ctx context.Context, c *wkhttp.Context, email, code string, codeType commonapi.CodeType) error {
+	//测试模式
+	if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != "" {
+		if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != code {
+			return errors.New("验证码错误")
+		}
+		return nil
+	}
+	subject := emailLimitSubject(c, email)
+	if err := u.limiter.check(limitActionSMSVerify, subject, "", ""); err != nil {
+		return err
+	}
+	err := u.emailService.Verify(ctx, email, code, codeType)
+	if err != nil {
+		u.limiter.hit(limitActionSMSVerify, subject)
+		return err
+	}
+	u.limiter.reset(limitActionSMSVerify, subject)
+	return nil
+}
+
+func (u *User) responseSendEmailError(c *wkhttp.Context, err error) {
+	if isLimitError(err) || errors.Is(err, errEmailOff) {
+		responseLimitError(c, err)
+		return
+	}
+	u.Error("发送邮箱验证码失败", zap.Error(err))
+	c.ResponseError(errors.New("发送邮箱验证码失败！"))
+}
+
+// 获取邮箱注册验证码
+func (u *User) sendEmailRegisterCode(c *wkhttp.Context) {
+	var req emailCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !u.emailOn() {
+		c.ResponseError(errEmailOff)
+		return
+	}
+	span := u.ctx.Tracer().StartSpan(
+		"user.sendEmailRegisterCode",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer span.Finish()
+	spanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), span)
+
+	model, err := u.db.queryByVerifiedEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if model != nil {
+		c.Response(map[string]interface{}{
+			"exist": 1,
+		})
+		return
+	}
+	err = u.sendEmailCode(spanCtx, c, email, commonapi.CodeTypeRegister)
+	if err != nil {
+		u.responseSendEmailError(c, err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"exist": 0,
+	})
+}
+
+// 邮箱注册
+func (u *User) emailRegister(c *wkhttp.Context) {
+	var req emailRegisterReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	if strings.TrimSpace(req.Password) == "" {
+		c.ResponseError(errors.New("密码不能为空！"))
+		return
+	}
+	if err := u.passwordService.check(req.Password); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if u.ctx.GetConfig().Register.Off {
+		c.ResponseError(errors.New("注册通道暂不开放"))
+		return
+	}
+	if !u.emailOn() {
+		c.ResponseError(errEmailOff)
+		return
+	}
+	invite, err := u.checkRegisterInvite(req.InviteCode)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	registerSpan := u.ctx.Tracer().StartSpan(
+		"user.emailRegister",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer registerSpan.Finish()
+	registerSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), registerSpan)
+	registerSpan.SetTag("email", email)
+
+	userInfo, err := u.db.queryByVerifiedEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo != nil {
+		c.ResponseError(errors.New("该邮箱已注册"))
+		return
+	}
+	err = u.verifyEmailCode(registerSpanCtx, c, email, req.Code, commonapi.CodeTypeRegister)
+	if err != nil {
+		responseLimitError(c, err)
+		return
+	}
+	u.createUser(registerSpanCtx, &createUserModel{
+		UID:           util.GenerUUID(),
+		Sex:           1,
+		Name:          req.Name,
+		Email:         email,
+		EmailVerified: 1,
+		Password:      req.Password,
+		Flag:          int(req.Flag),
+		Device:        req.Device,
+	}, c, invite)
+}
+
+// 获取邮箱重置密码验证码
+func (u *User) sendEmailForgetPwdCode(c *wkhttp.Context) {
+	var req emailCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	span := u.ctx.Tracer().StartSpan(
+		"user.sendEmailForgetPwdCode",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer span.Finish()
+	spanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), span)
+
+	model, err := u.db.queryByVerifiedEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if model == nil {
+		c.ResponseError(errors.New("该邮箱未注册"))
+		return
+	}
+	err = u.sendEmailCode(spanCtx, c, email, commonapi.CodeTypeForgetLoginPWD)
+	if err != nil {
+		u.responseSendEmailError(c, err)
+		return
+	}
+	c.ResponseOK()
+}
+
+// 通过邮箱重置登录密码
+func (u *User) emailPwdForget(c *wkhttp.Context) {
+	var req emailResetPwdReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	if strings.TrimSpace(req.Pwd) == "" {
+		c.ResponseError(errors.New("密码不能为空！"))
+		return
+	}
+	if err := u.passwordService.check(req.Pwd); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	userInfo, err := u.db.queryByVerifiedEmail(email)
+	if err != nil {
+		u.Error("查询用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息错误"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("该账号不存在"))
+		return
+	}
+	err = u.verifyEmailCode(context.Background(), c, email, req.Code, commonapi.CodeTypeForgetLoginPWD)
+	if err != nil {
+		responseLimitError(c, err)
+		return
+	}
+	pwdHash, err := u.passwordService.hash(req.Pwd)
+	if err != nil {
+		u.Error("生成密码hash失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	err = u.db.UpdateUsersWithField("password", pwdHash, userInfo.UID)
+	if err != nil {
+		u.Error("修改登录密码错误", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 获取绑定邮箱验证码
+func (u *User) sendEmailBindCode(c *wkhttp.Context) {
+	var req emailCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := u.db.queryByVerifiedEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if model != nil {
+		c.ResponseError(errors.New("该邮箱已被其他账号绑定"))
+		return
+	}
+	err = u.sendEmailCode(c.Context, c, email, commonapi.CodeTypeBindEmail)
+	if err != nil {
+		u.responseSendEmailError(c, err)
+		return
+	}
+	c.ResponseOK()
+}
+
+// 绑定邮箱
+func (u *User) emailBind(c *wkhttp.Context) {
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	model, err := u.db.queryByVerifiedEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if model != nil && model.UID != loginUID {
+		c.ResponseError(errEmailExist)
+		return
+	}
+	err = u.verifyEmailCode(c.Context, c, email, req.Code, commonapi.CodeTypeBindEmail)
+	if err != nil {
+		responseLimitError(c, err)
+		return
+	}
+	err = u.db.updateEmail(loginUID, email)
+	if err == errEmailExist {
+		c.ResponseError(err)
+		return
+	}
+	if err != nil {
+		u.Error("绑定邮箱失败！", zap.Error(err))
+		c.ResponseError(errors.New("绑定邮箱失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+type emailCodeReq struct {
+	Email string `json:"email"`
+}
+
+type emailRegisterReq struct {
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Code       string     `json:"code"`
+	Password   string     `json:"password"`
+	Flag       uint8      `json:"flag"`        // 注册设备的标记 0.APP 1.PC
+	Device     *deviceReq `json:"device"`      //注册用户设备信息
+	InviteCode string     `json:"invite_code"` // 邀请码
+}
+
+type emailResetPwdReq struct {
+	Email string `json:"email"` // 邮箱
+	Code  string `json:"code"`  //验证码
+	Pwd   string `json:"pwd"`   //密码
+}
@@ -0,0 +1,427 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/register"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkevent"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// ldapService LDAP/AD目录登录和同步
+type ldapService struct {
+	ctx            *config.Context
+	db             *ldapDB
+	userDB         *DB
+	identityDB     *identityDB
+	sessionService *sessionService
+	log.Log
+}
+
+func newLDAPService(ctx *config.Context) *ldapService {
+	return &ldapService{
+		ctx:            ctx,
+		db:             newLDAPDB(ctx),
+		userDB:         NewDB(ctx),
+		identityDB:     newIdentityDB(ctx),
+		sessionService: newSessionService(ctx),
+		Log:            log.NewTLog("ldapService"),
+	}
+}
+
+// enabledConfig 已启用的目录配置 未启用返回nil
+func (s *ldapService) enabledConfig() *ldapConfigModel {
+	cfg, err := s.db.queryConfig()
+	if err != nil {
+		s.Error("查询LDAP配置失败！", zap.Error(err))
+		return nil
+	}
+	if cfg == nil || cfg.Status != 1 || cfg.URL == "" {
+		return nil
+	}
+	return cfg
+}
+
+// 同步结果
+type ldapSyncResult struct {
+	Directory int `json:"directory"` // 目录中的用户数
+	Disabled  int `json:"disabled"`  // 本次禁用的用户数
+	Joined    int `json:"joined"`    // 加入群的成员数
+	Removed   int `json:"removed"`   // 移出群的成员数
+}
+
+// sync 禁用已离开目录的用户，并按组映射同步群成员
+func (s *ldapService) sync(cfg *ldapConfigModel) (*ldapSyncResult, error) {
+	entries, err := newLDAPDirectory(cfg).searchUsers()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 { // 配置错误时可能查不到任何用户，避免误禁用所有人
+		return nil, errors.New("目录中没有查询到用户，已跳过同步")
+	}
+	result := &ldapSyncResult{Directory: len(entries)}
+	entryMap := make(map[string]*ldapEntry, len(entries))
+	for _, entry := range entries {
+		entryMap[entry.subject()] = entry
+	}
+	identities, err := s.identityDB.queryWithProvider(ldapProvider)
+	if err != nil {
+		return nil, err
+	}
+	// 目录中存在的用户 uid -> entry
+	present := make(map[string]*ldapEntry, len(identities))
+	managed := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		managed[identity.UID] = true
+		if entry := entryMap[identity.Subject]; entry != nil {
+			present[identity.UID] = entry
+			continue
+		}
+		disabled, err := s.disableUser(identity.UID)
+		if err != nil {
+			s.Error("禁用已离开目录的用户失败！", zap.Error(err), zap.String("uid", identity.UID))
+			continue
+		}
+		if disabled {
+			result.Disabled++
+		}
+	}
+	joined, removed, err := s.syncGroups(present, managed)
+	if err != nil {
+		return nil, err
+	}
+	result.Joined = joined
+	result.Removed = removed
+	return result, nil
+}
+
+// disableUser 禁用用户并注销其所有会话
+func (s *ldapService) disableUser(uid string) (bool, error) {
+	userInfo, err := s.userDB.QueryByUID(uid)
+	if err != nil {
+		return false, err
+	}
+	if userInfo == nil || userInfo.Status == int(common.UserDisable) {
+		return false, nil
+	}
+	err = s.userDB.UpdateUsersWithField("status", strconv.Itoa(int(common.UserDisable)), uid)
+	if err != nil {
+		return false, err
+	}
+	err = s.ctx.IMCreateOrUpdateChannelInfo(&config.ChannelInfoCreateReq{
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Ban:         1,
+	})
+	if err != nil {
+		return false, err
+	}
+	sessions, err := s.sessionService.activeSessions(uid)
+	if err != nil {
+		return false, err
+	}
+	for _, session := range sessions {
+		if err = s.sessionService.revoke(session, false); err != nil {
+			s.Warn("注销会话失败！", zap.Error(err), zap.String("sessionID", session.SessionID))
+		}
+	}
+	err = s.ctx.QuitUserDevice(uid, -1)
+	if err != nil {
+		return false, err
+	}
+	s.Info("用户已离开目录，已禁用", zap.String("uid", uid))
+	return true, nil
+}
+
+// syncGroups 按目录组与群的映射同步群成员
+// user模块不能依赖group模块，当前成员通过group模块注册的数据源获取，成员变更通过组织成员变更事件交给group模块处理
+func (s *ldapService) syncGroups(present map[string]*ldapEntry, managed map[string]bool) (int, int, error) {
+	groups, err := s.db.queryGroups()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(groups) == 0 {
+		return 0, 0, nil
+	}
+	groupModule := register.GetModuleByName("group", s.ctx)
+	if groupModule.IMDatasource.Subscribers == nil {
+		return 0, 0, errors.New("群模块未注册，无法同步目录组")
+	}
+	// 群编号 -> 目录组中的用户 uid -> name
+	desiredMap := make(map[string]map[string]string)
+	for _, group := range groups {
+		desired := desiredMap[group.GroupNo]
+		if desired == nil {
+			desired = make(map[string]string)
+			desiredMap[group.GroupNo] = desired
+		}
+		for uid, entry := range present {
+			if entry.inGroup(group.GroupDN) {
+				desired[uid] = entry.Name
+			}
+		}
+	}
+	systemUID := s.ctx.GetConfig().Account.SystemUID
+	members := make([]*config.OrgOrDeptEmployeeVO, 0)
+	joined, removed := 0, 0
+	for groupNo, desired := range desiredMap {
+		current, err := groupModule.IMDatasource.Subscribers(groupNo, common.ChannelTypeGroup.Uint8())
+		if err != nil {
+			s.Error("查询群成员失败！", zap.Error(err), zap.String("groupNo", groupNo))
+			continue
+		}
+		adds, removes := diffLDAPGroupMembers(desired, current, managed)
+		for _, uid := range adds {
+			members = append(members, &config.OrgOrDeptEmployeeVO{
+				Operator:     systemUID,
+				EmployeeUid:  uid,
+				EmployeeName: desired[uid],
+				GroupNo:      groupNo,
+				Action:       "add",
+			})
+			joined++
+		}
+		for _, uid := range removes {
+			if groupModule.BussDataSource.GetGroupMember != nil {
+				member, err := groupModule.BussDataSource.GetGroupMember(groupNo, uid)
+				if err != nil {
+					s.Error("查询群成员失败！", zap.Error(err), zap.String("groupNo", groupNo))
+					continue
+				}
+				if member != nil && member.Role == int(common.GroupMemberRoleCreater) { // 群主不移除
+					continue
+				}
+			}
+			members = append(members, &config.OrgOrDeptEmployeeVO{
+				Operator:    systemUID,
+				EmployeeUid: uid,
+				GroupNo:     groupNo,
+				Action:      "delete",
+			})
+			removed++
+		}
+	}
+	if len(members) == 0 {
+		return 0, 0, nil
+	}
+	tx, err := s.ctx.DB().Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	eventID, err := s.ctx.EventBegin(&wkevent.Data{
+		Event: event.OrgOrDeptEmployeeUpdate,
+		Type:  wkevent.Message,
+		Data: &config.MsgOrgOrDeptEmployeeUpdateReq{
+			Members: members,
+		},
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+	s.ctx.EventCommit(eventID)
+	return joined, removed, nil
+}
+
+// 定时检查是否需要同步目录
+func (u *User) ldapSyncCheck() {
+	cfg := u.ldapService.enabledConfig()
+	if cfg == nil || cfg.SyncOn != 1 {
+		return
+	}
+	interval := cfg.SyncInterval
+	if interval < ldapMinSyncMinute {
+		interval = ldapMinSyncMinute
+	}
+	now := time.Now().Unix()
+	if now-cfg.LastSyncAt < int64(interval*60) {
+		return
+	}
+	ok, err := u.ldapService.db.updateLastSyncAt(cfg.Id, cfg.LastSyncAt, now)
+	if err != nil {
+		u.Error("更新LDAP同步时间失败！", zap.Error(err))
+		return
+	}
+	if !ok { // 其他实例正在同步
+		return
+	}
+	result, err := u.ldapService.sync(cfg)
+	if err != nil {
+		u.Error("同步LDAP目录失败！", zap.Error(err))
+		return
+	}
+	u.Info("同步LDAP目录完成", zap.Int("directory", result.Directory), zap.Int("disabled", result.Disabled), zap.Int("joined", result.Joined), zap.Int("removed", result.Removed))
+}
+
+// ldapUsernameLogin 通过目录认证用户名登录 userInfo为空时在目录认证成功后创建用户
+func (u *User) ldapUsernameLogin(cfg *ldapConfigModel, userInfo *Model, req loginReq, subject limitSubject, loginSpanCtx context.Context, c *wkhttp.Context) {
+	entry, err := newLDAPDirectory(cfg).authenticate(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, errLDAPUserNotFound) && userInfo == nil {
+			u.limiter.hit(limitActionPassword, subject)
+			c.ResponseError(errors.New("该用户名不存在"))
+			return
+		}
+		if errors.Is(err, errLDAPUserNotFound) || errors.Is(err, errLDAPInvalidCredentials) {
+			u.limiter.hit(limitActionPassword, subject)
+			c.ResponseError(errors.New("密码不正确！"))
+			return
+		}
+		u.Error("LDAP认证失败！", zap.Error(err), zap.String("username", req.Username))
+		c.ResponseError(errors.New("目录服务暂时不可用，请稍后再试"))
+		return
+	}
+	u.limiter.reset(limitActionPassword, subject)
+
+	identityM, err := u.identityDB.queryWithSubject(ldapProvider, entry.subject())
+	if err != nil {
+		u.Error("查询目录身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询目录身份失败！"))
+		return
+	}
+	if userInfo == nil && identityM != nil {
+		userInfo, err = u.db.QueryByUID(identityM.UID)
+		if err != nil {
+			u.Error("查询用户信息失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询用户信息失败！"))
+			return
+		}
+	}
+	if userInfo == nil {
+		resp, err := u.ldapRegister(entry, req, loginSpanCtx, c)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		c.Response(map[string]interface{}{
+			"data":                      resp,
+			"need_upload_web3publickey": 1,
+		})
+		return
+	}
+	if identityM != nil && identityM.UID != userInfo.UID {
+		c.ResponseError(errors.New("该目录账号已绑定其他用户"))
+		return
+	}
+	if identityM == nil {
+		// 用户已绑定的目录账号必须是本次认证的目录账号（目录中的用户名可能被重新分配）
+		boundM, err := u.identityDB.queryWithUIDAndProvider(userInfo.UID, ldapProvider)
+		if err != nil {
+			u.Error("查询用户的目录身份失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询用户的目录身份失败！"))
+			return
+		}
+		if boundM != nil {
+			c.ResponseError(errors.New("该用户已绑定其他目录账号"))
+			return
+		}
+	}
+	identity := &identityModel{
+		Provider:    ldapProvider,
+		Subject:     entry.subject(),
+		UID:         userInfo.UID,
+		Name:        entry.Name,
+		Email:       entry.Email,
+		LastLoginAt: time.Now().Unix(),
+	}
+	if identityM == nil {
+		err = u.identityDB.insert(identity)
+	} else {
+		identity.Id = identityM.Id
+		err = u.identityDB.updateLogin(identity)
+	}
+	if err != nil {
+		u.Error("更新目录身份失败！", zap.Error(err), zap.String("uid", userInfo.UID))
+		c.ResponseError(errors.New("更新目录身份失败！"))
+		return
+	}
+	if u.needTotpChallenge(userInfo, totpSceneUsernameLogin, req.Flag, req.Device, c) {
+		return
+	}
+	u.usernameLoginRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
+}
+
+// ldapRegister 目录用户首次登录时创建用户
+func (u *User) ldapRegister(entry *ldapEntry, req loginReq, loginSpanCtx context.Context, c *wkhttp.Context) (*loginUserDetailResp, error) {
+	if len(entry.Username) > 40 {
+		return nil, errors.New("目录用户名过长")
+	}
+	name := entry.Name
+	if strings.TrimSpace(name) == "" {
+		name = entry.Username
+	}
+	uid := util.GenerUUID()
+	model := &createUserModel{
+		UID:      uid,
+		Sex:      1,
+		Name:     name,
+		Username: entry.Username,
+		Flag:     req.Flag,
+		Device:   req.Device,
+	}
+	if entry.Email != "" {
+		emailUser, err := u.db.queryByVerifiedEmail(entry.Email)
+		if err != nil {
+			u.Error("查询邮箱是否已绑定失败！", zap.Error(err))
+			return nil, errors.New("查询邮箱是否已绑定失败！")
+		}
+		if emailUser == nil {
+			model.Email = strings.ToLower(entry.Email)
+			model.EmailVerified = 1
+		}
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		return nil, errors.New("开启事务失败！")
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = u.identityDB.insertTx(&identityModel{
+		Provider:    ldapProvider,
+		Subject:     entry.subject(),
+		UID:         uid,
+		Name:        entry.Name,
+		Email:       entry.Email,
+		LastLoginAt: time.Now().Unix(),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("添加目录身份失败！", zap.Error(err))
+		return nil, errors.New("添加目录身份失败！")
+	}
+	publicIP := util.GetClientPublicIP(c.Request)
+	resp, err := u.createUserWithRespAndTx(loginSpanCtx, model, publicIP, nil, tx, func() error {
+		err := tx.Commit()
+		if err != nil {
+			tx.Rollback()
+			u.Error("数据库事物提交失败", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("创建目录用户失败：%w", err)
+	}
+	return resp, nil
+}
@@ -6,6 +6,12 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	loginLogTypeLogin  = 0 // 登录
+	loginLogTypeLock   = 1 // 锁定
+	loginLogTypeUnlock = 2 // 解除锁定
+)
+
 // LoginLog 用户设置
 type LoginLog struct {
 	ctx *config.Context
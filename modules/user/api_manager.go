@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
 	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
@@ -24,27 +25,43 @@ import (
 type Manager struct {
 	ctx *config.Context
 	log.Log
-	db            *managerDB
-	userDB        *DB
-	userSettingDB *SettingDB
-	deviceDB      *deviceDB
-	friendDB      *friendDB
-	onlineService IOnlineService
-	commonService common2.IService
+	db              *managerDB
+	userDB          *DB
+	userSettingDB   *SettingDB
+	deviceDB        *deviceDB
+	friendDB        *friendDB
+	onlineService   IOnlineService
+	commonService   common2.IService
+	passwordService *passwordService
+	totpService     *totpService
+	limiter         *loginLimiter
+	loginLogDB      *LoginLogDB
+	sessionService  *sessionService
+	oidcProviderDB  *oidcProviderDB
+	identityDB      *identityDB
+	ldapService     *ldapService
 }
 
 // NewManager NewManager
 func NewManager(ctx *config.Context) *Manager {
 	m := &Manager{
-		ctx:           ctx,
-		Log:           log.NewTLog("userManager"),
-		db:            newManagerDB(ctx),
-		deviceDB:      newDeviceDB(ctx),
-		friendDB:      newFriendDB(ctx),
-		userDB:        NewDB(ctx),
-		userSettingDB: NewSettingDB(ctx.DB()),
-		onlineService: NewOnlineService(ctx),
-		commonService: common2.NewService(ctx),
+		ctx:             ctx,
+		Log:             log.NewTLog("userManager"),
+		db:              newManagerDB(ctx),
+		deviceDB:        newDeviceDB(ctx),
+		friendDB:        newFriendDB(ctx),
+		userDB:          NewDB(ctx),
+		userSettingDB:   NewSettingDB(ctx.DB()),
+		onlineService:   NewOnlineService(ctx),
+		commonService:   common2.NewService(ctx),
+		passwordService: newPasswordService(ctx),
+		totpService:     newTotpService(ctx),
+		limiter:         newLoginLimiter(ctx),
+		loginLogDB:      NewLoginLogDB(ctx.DB()),
+		sessionService:  newSessionService(ctx),
+		oidcProviderDB:  newOIDCProviderDB(ctx),
+		identityDB:      newIdentityDB(ctx),
+		ldapService:     newLDAPService(ctx),
 	}
 	m.createManagerAccount()
 	return m
@@ -54,23 +71,40 @@ func NewManager(ctx *config.Context) *Manager {
 func (m *Manager) Route(r *wkhttp.WKHttp) {
 	user := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r))
 	{
-		user.POST("/login", m.login) // 账号登录
+		user.POST("/login", m.login)                     // 账号登录
+		user.POST("/login/totp", m.loginTotp)            // 登录两步验证
+		user.POST("/login/totp/setup", m.loginTotpSetup) // 登录时开启两步验证（强制开启时）
 	}
-	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r))
+	auth := r.Group("/v1/manager", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r), audit.Middleware(m.ctx))
 	{
-		auth.POST("/user/admin", m.addAdminUser)              // 添加一个管理员
-		auth.GET("/user/admin", m.getAdminUsers)              // 查询管理员用户
-		auth.DELETE("/user/admin", m.deleteAdminUsers)        // 删除管理员用户
-		auth.POST("/user/add", m.addUser)                     // 添加一个用户
-		auth.POST("/user/resetpassword", m.resetUserPassword) // 重置用户密码
-		auth.GET("/user/list", m.list)                        // 用户列表
-		auth.GET("/user/friends", m.friends)                  // 某个用户的好友
-		auth.GET("/user/blacklist", m.blacklist)              // 用户黑名单列表
-		auth.GET("/user/disablelist", m.disableUsers)         // 封禁用户列表
-		auth.GET("user/online", m.online)                     // 在线设备信息
-		auth.PUT("/user/liftban/:uid/:status", m.liftBanUser) // 解禁或封禁用户
-		auth.POST("/user/updatepassword", m.updatePwd)        // 修改用户密码
-		auth.GET("/user/devices", m.devices)                  // 查看某用户设备列表
+		auth.POST("/user/admin", m.addAdminUser)                       // 添加一个管理员
+		auth.GET("/user/admin", m.getAdminUsers)                       // 查询管理员用户
+		auth.DELETE("/user/admin", m.deleteAdminUsers)                 // 删除管理员用户
+		auth.POST("/user/add", m.addUser)                              // 添加一个用户
+		auth.POST("/user/resetpassword", m.resetUserPassword)          // 重置用户密码
+		auth.GET("/user/list", m.list)                                 // 用户列表
+		auth.GET("/user/friends", m.friends)                           // 某个用户的好友
+		auth.GET("/user/blacklist", m.blacklist)                       // 用户黑名单列表
+		auth.GET("/user/disablelist", m.disableUsers)                  // 封禁用户列表
+		auth.GET("user/online", m.online)                              // 在线设备信息
+		auth.PUT("/user/liftban/:uid/:status", m.liftBanUser)          // 解禁或封禁用户
+		auth.POST("/user/updatepassword", m.updatePwd)                 // 修改用户密码
+		auth.GET("/user/devices", m.devices)                           // 查看某用户设备列表
+		auth.DELETE("/user/totp/:uid", m.resetUserTotp)                // 重置用户两步验证
+		auth.GET("/user/locks", m.locks)                               // 当前被锁定的账号/IP/设备
+		auth.GET("/user/locklogs", m.lockLogs)                         // 锁定和解除锁定日志
+		auth.POST("/user/unlock", m.unlock)                            // 解除锁定
+		auth.GET("/oidc/providers", m.oidcProviderList)                // 第三方登录提供方列表
+		auth.POST("/oidc/providers", m.oidcProviderAdd)                // 添加第三方登录提供方
+		auth.PUT("/oidc/providers/:provider", m.oidcProviderUpdate)    // 修改第三方登录提供方
+		auth.DELETE("/oidc/providers/:provider", m.oidcProviderDelete) // 删除第三方登录提供方
+		auth.GET("/ldap", m.ldapConfigGet)                             // LDAP配置
+		auth.PUT("/ldap", m.ldapConfigUpdate)                          // 保存LDAP配置
+		auth.POST("/ldap/test", m.ldapConfigTest)                      // 测试LDAP配置
+		auth.POST("/ldap/sync", m.ldapSync)                            // 立即同步LDAP目录
+		auth.GET("/ldap/groups", m.ldapGroupList)                      // 目录组与群的映射
+		auth.POST("/ldap/groups", m.ldapGroupAdd)                      // 添加目录组与群的映射
+		auth.DELETE("/ldap/groups/:id", m.ldapGroupDelete)             // 删除目录组与群的映射
 	}
 }
 
@@ -151,6 +185,11 @@ func (m *Manager) login(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	subject := limitSubject{Account: req.Username, IP: util.GetClientPublicIP(c.Request)}
+	if err := m.limiter.check(limitActionPassword, subject, req.CaptchaID, req.CaptchaCode); err != nil {
+		responseLimitError(c, err)
+		return
+	}
 	userInfo, err := m.db.queryUserInfoWithNameAndPwd(req.Username)
 	if err != nil {
 		m.Error("登录错误", zap.Error(err))
@@ -158,39 +197,79 @@ func (m *Manager) login(c *wkhttp.Context) {
 		return
 	}
 	if userInfo == nil || userInfo.UID == "" {
+		m.limiter.hit(limitActionPassword, subject)
 		c.ResponseError(errors.New("登录用户不存在"))
 		return
 	}
-	if userInfo.Password != util.MD5(util.MD5(req.Password)) {
+	subject.UID = userInfo.UID
+	if !m.passwordService.verify(userInfo.UID, req.Password, userInfo.Password) {
+		m.limiter.hit(limitActionPassword, subject)
 		c.ResponseError(errors.New("用户名或密码错误"))
 		return
 	}
+	m.limiter.reset(limitActionPassword, subject)
 	if userInfo.Role != string(wkhttp.Admin) && userInfo.Role != string(wkhttp.SuperAdmin) {
 		c.ResponseError(errors.New("登录账号未开通管理权限"))
 		return
 	}
+	enabled, err := m.totpService.enabled(userInfo.UID)
+	if err != nil {
+		m.Error("查询两步验证信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证信息失败！"))
+		return
+	}
+	if enabled || m.totpService.adminRequired() {
+		enroll := 0
+		if !enabled {
+			enroll = 1
+		}
+		token, err := m.totpService.newChallenge(&totpChallenge{
+			UID:    userInfo.UID,
+			Scene:  totpSceneManager,
+			Flag:   int(config.Web),
+			Enroll: enroll,
+		})
+		if err != nil {
+			m.Error("创建两步验证挑战失败！", zap.Error(err))
+			c.ResponseError(errors.New("创建两步验证挑战失败！"))
+			return
+		}
+		responseTotpChallenge(c, userInfo.UID, token, !enabled)
+		return
+	}
+	resp, err := m.execLogin(userInfo.UID, userInfo.Name, userInfo.Role, newSessionClient(c))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(resp)
+}
+
+// 生成后台登录token
+func (m *Manager) execLogin(uid string, name string, role string, client *sessionClient) (*managerLoginResp, error) {
 	token := util.GenerUUID()
 	// 将token设置到缓存
-	err = m.ctx.Cache().SetAndExpire(m.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userInfo.UID, userInfo.Name, userInfo.Role), m.ctx.GetConfig().Cache.TokenExpire)
+	err := m.ctx.Cache().SetAndExpire(m.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", uid, name, role), accessTokenExpire)
 	if err != nil {
 		m.Error("设置token缓存失败！", zap.Error(err))
-		c.ResponseError(errors.New("设置token缓存失败！"))
-		return
+		return nil, errors.New("设置token缓存失败！")
 	}
 
-	err = m.ctx.Cache().SetAndExpire(fmt.Sprintf("%s%d%s", m.ctx.GetConfig().Cache.UIDTokenCachePrefix, config.Web, userInfo.UID), token, m.ctx.GetConfig().Cache.TokenExpire)
+	err = m.ctx.Cache().SetAndExpire(fmt.Sprintf("%s%d%s", m.ctx.GetConfig().Cache.UIDTokenCachePrefix, config.Web, uid), token, m.ctx.GetConfig().Cache.TokenExpire)
 	if err != nil {
 		m.Error("设置uidtoken缓存失败！", zap.Error(err))
-		c.ResponseError(errors.New("设置token缓存失败！"))
-		return
+		return nil, errors.New("设置token缓存失败！")
 	}
+	refreshToken := m.sessionService.add(uid, token, config.Web, nil, client, false)
 
-	c.Response(&managerLoginResp{
-		UID:   userInfo.UID,
-		Token: token,
-		Name:  userInfo.Name,
-		Role:  userInfo.Role,
-	})
+	return &managerLoginResp{
+		UID:          uid,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenExpire / time.Second),
+		Name:         name,
+		Role:         role,
+	}, nil
 }
 
 // 重置用户密码
@@ -211,8 +290,8 @@ func (m *Manager) resetUserPassword(c *wkhttp.Context) {
 		c.ResponseError(errors.New("请求数据格式有误！"))
 		return
 	}
-	if len(req.NewPassword) < 6 {
-		c.ResponseError(errors.New("密码长度必须大于6位"))
+	if err := m.passwordService.check(req.NewPassword); err != nil {
+		c.ResponseError(err)
 		return
 	}
 	if req.NewPassword != req.NewPassswordConfirmation {
@@ -234,12 +313,19 @@ func (m *Manager) resetUserPassword(c *wkhttp.Context) {
 		return
 	}
 
-	err = m.userDB.UpdateUsersWithField("password", util.MD5(util.MD5(req.NewPassword)), req.Uid)
+	pwdHash, err := m.passwordService.hash(req.NewPassword)
+	if err != nil {
+		m.Error("生成密码hash失败！", zap.Error(err))
+		c.ResponseError(errors.New("重置用户密码错误"))
+		return
+	}
+	err = m.userDB.UpdateUsersWithField("password", pwdHash, req.Uid)
 	if err != nil {
 		m.Error("重置用户密码错误", zap.Error(err))
 		c.Response("重置用户密码错误")
 		return
 	}
+	audit.Record(c, "user.reset_password", req.Uid, nil, nil)
 	c.ResponseOK()
 }
 
@@ -279,6 +365,11 @@ func (m *Manager) deleteAdminUsers(c *wkhttp.Context) {
 		c.ResponseError(errors.New("删除管理员错误"))
 		return
 	}
+	audit.Record(c, "admin.delete", uid, map[string]interface{}{
+		"login_name": user.Username,
+		"name":       user.Name,
+		"role":       user.Role,
+	}, nil)
 	oldToken, err := m.ctx.Cache().Get(fmt.Sprintf("%s%d%s", m.ctx.GetConfig().Cache.UIDTokenCachePrefix, config.Web, user.UID))
 	if err != nil {
 		m.Error("获取旧token错误", zap.Error(err))
@@ -292,6 +383,7 @@ func (m *Manager) deleteAdminUsers(c *wkhttp.Context) {
 			c.ResponseError(errors.New("清除旧token数据错误"))
 			return
 		}
+		m.sessionService.revokeWithToken(oldToken)
 	}
 	c.ResponseOK()
 }
@@ -352,6 +444,11 @@ func (m *Manager) addAdminUser(c *wkhttp.Context) {
 		c.ResponseError(errors.New("密码不能为空"))
 		return
 	}
+	pwdHash, err := m.passwordService.checkAndHash(req.Password)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
 	user, err := m.db.queryUserWithNameAndRole(req.LoginName, string(wkhttp.Admin))
 	if err != nil {
 		m.Error("查询用户是否存在错误", zap.String("username", req.LoginName))
@@ -371,7 +468,7 @@ func (m *Manager) addAdminUser(c *wkhttp.Context) {
 	userModel.Username = req.LoginName
 	userModel.Zone = ""
 	userModel.Role = string(wkhttp.Admin)
-	userModel.Password = util.MD5(util.MD5(req.Password))
+	userModel.Password = pwdHash
 	userModel.ShortNo = util.Ten2Hex(time.Now().UnixNano())
 	userModel.IsUploadAvatar = 0
 	userModel.NewMsgNotice = 0
@@ -388,6 +485,11 @@ func (m *Manager) addAdminUser(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	audit.Record(c, "admin.add", userModel.UID, nil, map[string]interface{}{
+		"login_name": userModel.Username,
+		"name":       userModel.Name,
+		"role":       userModel.Role,
+	})
 	c.ResponseOK()
 }
 
@@ -407,6 +509,11 @@ func (m *Manager) addUser(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	pwdHash, err := m.passwordService.checkAndHash(req.Password)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
 	userInfo, err := m.userDB.QueryByUsername(fmt.Sprintf("%s%s", req.Zone, req.Phone))
 	if err != nil {
 		m.Error("查询用户信息失败！", zap.String("username", req.Phone))
@@ -453,7 +560,7 @@ func (m *Manager) addUser(c *wkhttp.Context) {
 	userModel.Phone = req.Phone
 	userModel.Username = fmt.Sprintf("%s%s", req.Zone, req.Phone)
 	userModel.Zone = req.Zone
-	userModel.Password = util.MD5(util.MD5(req.Password))
+	userModel.Password = pwdHash
 	userModel.ShortNo = shortNo
 	userModel.IsUploadAvatar = 0
 	userModel.NewMsgNotice = 1
@@ -581,6 +688,16 @@ func (m *Manager) list(c *wkhttp.Context) {
 			c.ResponseError(errors.New("查询用户最后一次登录设备信息错误"))
 			return
 		}
+		identities, err := m.identityDB.queryWithUIDs(uids)
+		if err != nil {
+			m.Error("查询用户绑定的第三方身份错误", zap.Error(err))
+			c.ResponseError(errors.New("查询用户绑定的第三方身份错误"))
+			return
+		}
+		identityMap := make(map[string][]*identityResp, len(uids))
+		for _, identity := range identities {
+			identityMap[identity.UID] = append(identityMap[identity.UID], newIdentityResp(identity))
+		}
 		var i = 0
 		for _, user := range userList {
 			var device *deviceModel
@@ -611,6 +728,10 @@ func (m *Manager) list(c *wkhttp.Context) {
 				lastOnlineTime = util.ToyyyyMMddHHmm(time.Unix(int64(respsdata[user.UID].LastOffline), 0))
 			}
 			showPhone := getShowPhoneNum(user.Phone)
+			userIdentities := identityMap[user.UID]
+			if userIdentities == nil {
+				userIdentities = make([]*identityResp, 0)
+			}
 			result = append(result, &managerUserResp{
 				UID:            user.UID,
 				Username:       user.Username,
@@ -626,9 +747,10 @@ func (m *Manager) list(c *wkhttp.Context) {
 				RegisterTime:   user.CreatedAt.String(),
 				Status:         user.Status,
 				IsDestroy:      user.IsDestroy,
-				GiteeUID:       user.GiteeUID,
-				GithubUID:      user.GithubUID,
+				GiteeUID:       identitySubject(identities, user.UID, "gitee"),
+				GithubUID:      identitySubject(identities, user.UID, "github"),
 				WXOpenid:       user.WXOpenid,
+				Identities:     userIdentities,
 			})
 			i++
 		}
@@ -855,6 +977,7 @@ func (m *Manager) liftBanUser(c *wkhttp.Context) {
 		c.ResponseError(errors.New("修改用户状态错误"))
 		return
 	}
+	audit.Record(c, "user.status", uid, map[string]interface{}{"status": userInfo.Status}, map[string]interface{}{"status": userStatus})
 
 	ban := 0
 	if userStatus == int(common.UserDisable) {
@@ -911,19 +1034,20 @@ func (m *Manager) updatePwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("操作用户不存在"))
 		return
 	}
-	if util.MD5(util.MD5(req.Password)) != user.Password {
+	if !m.passwordService.verify("", req.Password, user.Password) {
 		c.ResponseError(errors.New("原密码错误"))
 		return
 	}
-	if len(req.NewPassword) < 6 {
-		c.ResponseError(errors.New("密码长度必须大于6位"))
-		return
-	}
 	if req.Password == req.NewPassword {
 		c.ResponseError(errors.New("新密码不能和旧密码一样"))
 		return
 	}
-	err = m.userDB.UpdateUsersWithField("password", util.MD5(util.MD5(req.NewPassword)), loginUID)
+	pwdHash, err := m.passwordService.checkAndHash(req.NewPassword)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = m.userDB.UpdateUsersWithField("password", pwdHash, loginUID)
 	if err != nil {
 		m.Error("修改用户密码错误", zap.Error(err))
 		c.Response("修改用户密码错误")
@@ -1058,6 +1182,11 @@ func (m *Manager) createManagerAccount() {
 	username := string(wkhttp.SuperAdmin)
 	role := string(wkhttp.SuperAdmin)
 	var pwd = m.ctx.GetConfig().AdminPwd
+	pwdHash, err := m.passwordService.hash(pwd)
+	if err != nil {
+		m.Error("生成密码hash失败！", zap.Error(err))
+		return
+	}
 	err = m.userDB.Insert(&Model{
 		UID:      m.ctx.GetConfig().Account.AdminUID,
 		Name:     "超级管理员",
@@ -1068,7 +1197,7 @@ func (m *Manager) createManagerAccount() {
 		Zone:     "0086",
 		Phone:    "13000000002",
 		Status:   1,
-		Password: util.MD5(util.MD5(pwd)),
+		Password: pwdHash,
 	})
 	if err != nil {
 		m.Error("新增系统管理员错误", zap.Error(err))
@@ -1095,15 +1224,33 @@ func getShowPhoneNum(mobile string) string {
 }
 
 type managerLoginReq struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	CaptchaID   string `json:"captcha_id"`
+	CaptchaCode string `json:"captcha_code"`
+}
+
+type managerLockLogResp struct {
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	Type      int    `json:"type"`   // 1.锁定 2.解除锁定
+	Action    string `json:"action"` // 触发锁定的行为
+	Account   string `json:"account"`
+	LoginIP   string `json:"login_ip"`
+	DeviceID  string `json:"device_id"`
+	Reason    string `json:"reason"`
+	ExpireAt  int64  `json:"expire_at"`
+	CreatedAt string `json:"created_at"`
 }
 
 type managerLoginResp struct {
-	UID   string `json:"uid"`
-	Token string `json:"token"`
-	Name  string `json:"name"`
-	Role  string `json:"role"`
+	UID           string   `json:"uid"`
+	Token         string   `json:"token"`
+	RefreshToken  string   `json:"refresh_token"` // 刷新令牌
+	ExpiresIn     int64    `json:"expires_in"`    // token有效期（秒）
+	Name          string   `json:"name"`
+	Role          string   `json:"role"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // 登录时开启两步验证返回的恢复码
 }
 type managerAddUserReq struct {
 	Name     string `json:"name"`
@@ -1124,23 +1271,24 @@ type adminUserResp struct {
 	RegisterTime string `json:"register_time"`
 }
 type managerUserResp struct {
-	Name           string `json:"name"`
-	UID            string `json:"uid"`
-	Phone          string `json:"phone"`
-	Username       string `json:"username"`
-	ShortNo        string `json:"short_no"`
-	Sex            int    `json:"sex"`
-	RegisterTime   string `json:"register_time"`
-	LastLoginTime  string `json:"last_login_time"`
-	DeviceName     string `json:"device_name"`
-	DeviceModel    string `json:"device_model"`
-	Online         int    `json:"online"`
-	LastOnlineTime string `json:"last_online_time"`
-	Status         int    `json:"status"`
-	IsDestroy      int    `json:"is_destroy"`
-	WXOpenid       string `json:"wx_openid"`  // 微信openid
-	GiteeUID       string `json:"gitee_uid"`  // gitee uid
-	GithubUID      string `json:"github_uid"` // github uid
+	Name           string          `json:"name"`
+	UID            string          `json:"uid"`
+	Phone          string          `json:"phone"`
+	Username       string          `json:"username"`
+	ShortNo        string          `json:"short_no"`
+	Sex            int             `json:"sex"`
+	RegisterTime   string          `json:"register_time"`
+	LastLoginTime  string          `json:"last_login_time"`
+	DeviceName     string          `json:"device_name"`
+	DeviceModel    string          `json:"device_model"`
+	Online         int             `json:"online"`
+	LastOnlineTime string          `json:"last_online_time"`
+	Status         int             `json:"status"`
+	IsDestroy      int             `json:"is_destroy"`
+	WXOpenid       string          `json:"wx_openid"`  // 微信openid
+	GiteeUID       string          `json:"gitee_uid"`  // gitee用户ID（来自绑定的第三方身份）
+	GithubUID      string          `json:"github_uid"` // github用户ID（来自绑定的第三方身份）
+	Identities     []*identityResp `json:"identities"` // 绑定的第三方身份
 }
 
 type managerFriendResp struct {
@@ -1187,3 +1335,259 @@ func newUserOnlineResp(m *onlineStatusWeightModel) *userOnlineResp {
 		Online:      m.Online,
 	}
 }
+
+// 后台登录两步验证
+func (m *Manager) loginTotp(c *wkhttp.Context) {
+	var req totpLoginReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if req.Challenge == "" || strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	challenge, err := m.totpService.getChallenge(req.Challenge)
+	if err != nil {
+		m.Error("查询两步验证挑战失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证挑战失败！"))
+		return
+	}
+	if challenge == nil || challenge.Scene != totpSceneManager {
+		c.ResponseError(errors.New("验证已过期，请重新登录"))
+		return
+	}
+	subject := limitSubject{Account: challenge.UID, IP: util.GetClientPublicIP(c.Request), UID: challenge.UID}
+	if err = m.limiter.check(limitActionTotp, subject, "", ""); err != nil {
+		responseLimitError(c, err)
+		return
+	}
+	var recoveryCodes []string
+	if challenge.Enroll == 1 {
+		recoveryCodes, err = m.totpService.enable(challenge.UID, req.Code)
+		if err != nil && !errors.Is(err, ErrTotpInvalidCode) {
+			m.Error("开启两步验证失败！", zap.Error(err))
+			c.ResponseError(err)
+			return
+		}
+	} else {
+		var ok bool
+		ok, err = m.totpService.verify(challenge.UID, req.Code)
+		if err != nil {
+			m.Error("校验两步验证码失败！", zap.Error(err))
+			c.ResponseError(errors.New("校验两步验证码失败！"))
+			return
+		}
+		if !ok {
+			err = ErrTotpInvalidCode
+		}
+	}
+	if err != nil {
+		m.limiter.hit(limitActionTotp, subject)
+		m.totpService.challengeFailed(req.Challenge, challenge)
+		c.ResponseError(err)
+		return
+	}
+	m.limiter.reset(limitActionTotp, subject)
+	m.totpService.deleteChallenge(req.Challenge)
+
+	userInfo, err := m.userDB.QueryByUID(challenge.UID)
+	if err != nil {
+		m.Error("查询用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息错误"))
+		return
+	}
+	if userInfo == nil || (userInfo.Role != string(wkhttp.Admin) && userInfo.Role != string(wkhttp.SuperAdmin)) {
+		c.ResponseError(errors.New("登录账号未开通管理权限"))
+		return
+	}
+	resp, err := m.execLogin(userInfo.UID, userInfo.Name, userInfo.Role, newSessionClient(c))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	resp.RecoveryCodes = recoveryCodes
+	c.Response(resp)
+}
+
+// 强制开启两步验证时 登录过程中获取密钥
+func (m *Manager) loginTotpSetup(c *wkhttp.Context) {
+	var req struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	challenge, err := m.totpService.getChallenge(req.Challenge)
+	if err != nil {
+		m.Error("查询两步验证挑战失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证挑战失败！"))
+		return
+	}
+	if challenge == nil || challenge.Scene != totpSceneManager {
+		c.ResponseError(errors.New("验证已过期，请重新登录"))
+		return
+	}
+	if challenge.Enroll != 1 {
+		c.ResponseError(errors.New("已开启两步验证"))
+		return
+	}
+	userInfo, err := m.userDB.QueryByUID(challenge.UID)
+	if err != nil {
+		m.Error("查询用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息错误"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("操作用户不存在"))
+		return
+	}
+	secret, uri, err := m.totpService.setup(userInfo.UID, totpAccountName(userInfo))
+	if err != nil {
+		m.Error("生成两步验证密钥失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// 重置用户两步验证（用户丢失设备和恢复码时）
+func (m *Manager) resetUserTotp(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	uid := c.Param("uid")
+	if uid == "" {
+		c.ResponseError(errors.New("用户uid不能为空！"))
+		return
+	}
+	user, err := m.userDB.QueryByUID(uid)
+	if err != nil {
+		m.Error("查询用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息错误"))
+		return
+	}
+	if user == nil {
+		c.ResponseError(errors.New("操作用户不存在"))
+		return
+	}
+	err = m.totpService.reset(uid)
+	if err != nil {
+		m.Error("重置用户两步验证错误", zap.Error(err))
+		c.ResponseError(errors.New("重置用户两步验证错误"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 当前被锁定的账号/IP/设备
+func (m *Manager) locks(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	list, err := m.limiter.locks()
+	if err != nil {
+		m.Error("查询锁定列表错误", zap.Error(err))
+		c.ResponseError(errors.New("查询锁定列表错误"))
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ExpireAt > list[j].ExpireAt
+	})
+	c.Response(list)
+}
+
+// 锁定和解除锁定日志
+func (m *Manager) lockLogs(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	keyword := strings.TrimSpace(c.Query("keyword"))
+	pageIndex, pageSize := c.GetPage()
+	types := []int{loginLogTypeLock, loginLogTypeUnlock}
+	logs, err := m.loginLogDB.queryWithTypes(types, keyword, uint64(pageIndex), uint64(pageSize))
+	if err != nil {
+		m.Error("查询锁定日志错误", zap.Error(err))
+		c.ResponseError(errors.New("查询锁定日志错误"))
+		return
+	}
+	count, err := m.loginLogDB.queryCountWithTypes(types, keyword)
+	if err != nil {
+		m.Error("查询锁定日志数量错误", zap.Error(err))
+		c.ResponseError(errors.New("查询锁定日志数量错误"))
+		return
+	}
+	list := make([]*managerLockLogResp, 0, len(logs))
+	for _, logModel := range logs {
+		list = append(list, &managerLockLogResp{
+			ID:        logModel.Id,
+			UID:       logModel.UID,
+			Type:      logModel.Type,
+			Action:    logModel.Action,
+			Account:   logModel.Account,
+			LoginIP:   logModel.LoginIP,
+			DeviceID:  logModel.DeviceID,
+			Reason:    logModel.Reason,
+			ExpireAt:  logModel.ExpireAt,
+			CreatedAt: logModel.CreatedAt.String(),
+		})
+	}
+	c.Response(map[string]interface{}{
+		"list":  list,
+		"count": count,
+	})
+}
+
+// 解除锁定
+func (m *Manager) unlock(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		Dimension string `json:"dimension"` // account.账号 ip.IP device.设备
+		Value     string `json:"value"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	dimension := limitDimension(req.Dimension)
+	if dimension != limitDimensionAccount && dimension != limitDimensionIP && dimension != limitDimensionDevice {
+		c.ResponseError(errors.New("锁定类型不正确"))
+		return
+	}
+	if strings.TrimSpace(req.Value) == "" {
+		c.ResponseError(errors.New("解除锁定的对象不能为空"))
+		return
+	}
+	value := limitSubject{Account: req.Value, IP: req.Value, Device: req.Value}.value(dimension)
+	err = m.limiter.clear(dimension, value)
+	if err != nil {
+		m.Error("解除锁定错误", zap.Error(err))
+		c.ResponseError(errors.New("解除锁定错误"))
+		return
+	}
+	err = m.loginLogDB.insert(&LoginLogModel{
+		UID:     c.GetLoginUID(),
+		LoginIP: util.GetClientPublicIP(c.Request),
+		Type:    loginLogTypeUnlock,
+		Account: value,
+		Reason:  fmt.Sprintf("管理员[%s]解除%s锁定", c.GetLoginName(), limitDimensionName(dimension)),
+	})
+	if err != nil {
+		m.Warn("添加解除锁定日志失败！", zap.Error(err))
+	}
+	c.ResponseOK()
+}
@@ -0,0 +1,293 @@
+package user
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 获取LDAP配置（不返回服务账号密码）
+func (m *Manager) ldapConfigGet(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	cfg, err := m.ldapService.db.queryConfig()
+	if err != nil {
+		m.Error("查询LDAP配置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询LDAP配置失败！"))
+		return
+	}
+	if cfg == nil {
+		cfg = &ldapConfigModel{}
+	}
+	c.Response(newManagerLDAPConfigResp(cfg))
+}
+
+// 保存LDAP配置（bind_password为空则不修改）
+func (m *Manager) ldapConfigUpdate(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req managerLDAPConfigReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	exist, err := m.ldapService.db.queryConfig()
+	if err != nil {
+		m.Error("查询LDAP配置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询LDAP配置失败！"))
+		return
+	}
+	model := req.toModel()
+	if exist == nil {
+		err = m.ldapService.db.insertConfig(model)
+	} else {
+		model.Id = exist.Id
+		if req.BindPassword == "" {
+			model.BindPassword = exist.BindPassword
+		}
+		err = m.ldapService.db.updateConfig(model)
+	}
+	if err != nil {
+		m.Error("保存LDAP配置失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存LDAP配置失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 测试LDAP配置 填写了用户名和密码时测试该用户能否登录，否则测试能否查询到用户
+func (m *Manager) ldapConfigTest(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	cfg, err := m.ldapService.db.queryConfig()
+	if err != nil {
+		m.Error("查询LDAP配置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询LDAP配置失败！"))
+		return
+	}
+	if cfg == nil || cfg.URL == "" {
+		c.ResponseError(errors.New("请先保存LDAP配置"))
+		return
+	}
+	directory := newLDAPDirectory(cfg)
+	if req.Username != "" {
+		entry, err := directory.authenticate(req.Username, req.Password)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		c.Response(entry)
+		return
+	}
+	entries, err := directory.searchUsers()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"count": len(entries),
+	})
+}
+
+// 立即同步目录
+func (m *Manager) ldapSync(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	cfg := m.ldapService.enabledConfig()
+	if cfg == nil {
+		c.ResponseError(errors.New("LDAP未启用"))
+		return
+	}
+	result, err := m.ldapService.sync(cfg)
+	if err != nil {
+		m.Error("同步LDAP目录失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.Response(result)
+}
+
+// 目录组与群的映射列表
+func (m *Manager) ldapGroupList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	models, err := m.ldapService.db.queryGroups()
+	if err != nil {
+		m.Error("查询目录组映射失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询目录组映射失败！"))
+		return
+	}
+	list := make([]map[string]interface{}, 0, len(models))
+	for _, model := range models {
+		list = append(list, map[string]interface{}{
+			"id":       model.Id,
+			"group_dn": model.GroupDN,
+			"group_no": model.GroupNo,
+		})
+	}
+	c.Response(list)
+}
+
+// 添加目录组与群的映射
+func (m *Manager) ldapGroupAdd(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		GroupDN string `json:"group_dn"`
+		GroupNo string `json:"group_no"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	req.GroupDN = strings.ToLower(strings.TrimSpace(req.GroupDN))
+	req.GroupNo = strings.TrimSpace(req.GroupNo)
+	if req.GroupDN == "" || req.GroupNo == "" {
+		c.ResponseError(errors.New("目录组DN和群编号不能为空"))
+		return
+	}
+	err = m.ldapService.db.insertGroup(&ldapGroupModel{
+		GroupDN: req.GroupDN,
+		GroupNo: req.GroupNo,
+	})
+	if err != nil {
+		m.Error("添加目录组映射失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加目录组映射失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 删除目录组与群的映射（已加入群的成员不会被移除）
+func (m *Manager) ldapGroupDelete(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	err = m.ldapService.db.deleteGroup(id)
+	if err != nil {
+		m.Error("删除目录组映射失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除目录组映射失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+type managerLDAPConfigReq struct {
+	URL          string `json:"url"`           // 目录地址 ldap://或ldaps://
+	StartTLS     int    `json:"start_tls"`     // ldap://连接是否升级为TLS
+	SkipVerify   int    `json:"skip_verify"`   // 是否跳过证书校验
+	BindDN       string `json:"bind_dn"`       // 服务账号DN 为空则匿名查询
+	BindPassword string `json:"bind_password"` // 服务账号密码
+	BaseDN       string `json:"base_dn"`       // 用户的查询根
+	UserFilter   string `json:"user_filter"`   // 用户过滤条件 %s为用户名
+	UsernameAttr string `json:"username_attr"` // 用户名属性
+	NameAttr     string `json:"name_attr"`     // 名称属性（逗号分隔）
+	EmailAttr    string `json:"email_attr"`    // 邮箱属性
+	GroupAttr    string `json:"group_attr"`    // 所属组属性
+	SyncOn       int    `json:"sync_on"`       // 是否开启定时同步
+	SyncInterval int    `json:"sync_interval"` // 同步间隔（分钟）
+	Status       int    `json:"status"`        // 是否启用LDAP登录
+}
+
+func (r managerLDAPConfigReq) check() error {
+	parsed, err := url.Parse(r.URL)
+	if err != nil || (parsed.Scheme != "ldap" && parsed.Scheme != "ldaps") || parsed.Host == "" {
+		return errors.New("目录地址格式有误")
+	}
+	if strings.TrimSpace(r.BaseDN) == "" {
+		return errors.New("查询根不能为空")
+	}
+	if r.UserFilter != "" && strings.Count(r.UserFilter, "%s") != 1 {
+		return errors.New("用户过滤条件必须包含一个%s")
+	}
+	if r.SyncInterval != 0 && r.SyncInterval < ldapMinSyncMinute {
+		return errors.New("同步间隔不能小于5分钟")
+	}
+	return nil
+}
+
+func (r managerLDAPConfigReq) toModel() *ldapConfigModel {
+	syncInterval := r.SyncInterval
+	if syncInterval == 0 {
+		syncInterval = 60
+	}
+	return &ldapConfigModel{
+		URL:          strings.TrimSpace(r.URL),
+		StartTLS:     r.StartTLS,
+		SkipVerify:   r.SkipVerify,
+		BindDN:       strings.TrimSpace(r.BindDN),
+		BindPassword: r.BindPassword,
+		BaseDN:       strings.TrimSpace(r.BaseDN),
+		UserFilter:   defaultString(strings.TrimSpace(r.UserFilter), "(uid=%s)"),
+		UsernameAttr: defaultString(strings.TrimSpace(r.UsernameAttr), "uid"),
+		NameAttr:     defaultString(strings.TrimSpace(r.NameAttr), "displayName,cn"),
+		EmailAttr:    defaultString(strings.TrimSpace(r.EmailAttr), "mail"),
+		GroupAttr:    defaultString(strings.TrimSpace(r.GroupAttr), "memberOf"),
+		SyncOn:       r.SyncOn,
+		SyncInterval: syncInterval,
+		Status:       r.Status,
+	}
+}
+
+type managerLDAPConfigResp struct {
+	managerLDAPConfigReq
+	LastSyncAt int64 `json:"last_sync_at"` // 最后一次同步时间
+}
+
+func newManagerLDAPConfigResp(m *ldapConfigModel) *managerLDAPConfigResp {
+	return &managerLDAPConfigResp{
+		managerLDAPConfigReq: managerLDAPConfigReq{
+			URL:          m.URL,
+			StartTLS:     m.StartTLS,
+			SkipVerify:   m.SkipVerify,
+			BindDN:       m.BindDN,
+			BaseDN:       m.BaseDN,
+			UserFilter:   m.UserFilter,
+			UsernameAttr: m.UsernameAttr,
+			NameAttr:     m.NameAttr,
+			EmailAttr:    m.EmailAttr,
+			GroupAttr:    m.GroupAttr,
+			SyncOn:       m.SyncOn,
+			SyncInterval: m.SyncInterval,
+			Status:       m.Status,
+		},
+		LastSyncAt: m.LastSyncAt,
+	}
+}
@@ -0,0 +1,227 @@
+package user
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+var oidcProviderKeyRegexp = regexp.MustCompile(`^[a-z0-9_-]{2,40}$`)
+
+// 身份提供方列表
+func (m *Manager) oidcProviderList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	models, err := m.oidcProviderDB.queryAll()
+	if err != nil {
+		m.Error("查询身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询身份提供方失败！"))
+		return
+	}
+	list := make([]*managerOIDCProviderResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newManagerOIDCProviderResp(model))
+	}
+	c.Response(list)
+}
+
+// 添加身份提供方
+func (m *Manager) oidcProviderAdd(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req managerOIDCProviderReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.ClientSecret) == "" {
+		c.ResponseError(errors.New("client_secret不能为空"))
+		return
+	}
+	exist, err := m.oidcProviderDB.queryWithProvider(req.Provider)
+	if err != nil {
+		m.Error("查询身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询身份提供方失败！"))
+		return
+	}
+	if exist != nil {
+		c.ResponseError(errors.New("该提供方标识已存在"))
+		return
+	}
+	err = m.oidcProviderDB.insert(req.toModel())
+	if err != nil {
+		m.Error("添加身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加身份提供方失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 修改身份提供方（client_secret为空则不修改）
+func (m *Manager) oidcProviderUpdate(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req managerOIDCProviderReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	req.Provider = c.Param("provider")
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	exist, err := m.oidcProviderDB.queryWithProvider(req.Provider)
+	if err != nil {
+		m.Error("查询身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询身份提供方失败！"))
+		return
+	}
+	if exist == nil {
+		c.ResponseError(errors.New("身份提供方不存在"))
+		return
+	}
+	model := req.toModel()
+	if strings.TrimSpace(req.ClientSecret) == "" {
+		model.ClientSecret = exist.ClientSecret
+	}
+	err = m.oidcProviderDB.update(model)
+	if err != nil {
+		m.Error("修改身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改身份提供方失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 删除身份提供方（已绑定的身份保留，重新添加同一标识后可继续登录）
+func (m *Manager) oidcProviderDelete(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = m.oidcProviderDB.delete(c.Param("provider"))
+	if err != nil {
+		m.Error("删除身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除身份提供方失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+type managerOIDCProviderReq struct {
+	Provider           string `json:"provider"`             // 提供方标识 回调地址为 {api_base_url}/user/oauth/{provider}
+	Name               string `json:"name"`                 // 显示名称
+	Issuer             string `json:"issuer"`               // OIDC issuer（填写后自动发现端点）
+	AuthURL            string `json:"auth_url"`             // 授权端点
+	TokenURL           string `json:"token_url"`            // token端点
+	UserinfoURL        string `json:"userinfo_url"`         // 用户信息端点
+	ClientID           string `json:"client_id"`            // client id
+	ClientSecret       string `json:"client_secret"`        // client secret
+	Scopes             string `json:"scopes"`               // scope 空格分隔
+	PKCE               int    `json:"pkce"`                 // 是否使用PKCE
+	UserinfoTokenQuery int    `json:"userinfo_token_query"` // 获取用户信息时通过query参数传递access_token
+	SubjectClaim       string `json:"subject_claim"`        // 用户唯一标识字段 默认sub
+	NameClaim          string `json:"name_claim"`           // 名称字段 默认name,preferred_username,nickname
+	AvatarClaim        string `json:"avatar_claim"`         // 头像字段 默认picture
+	EmailClaim         string `json:"email_claim"`          // 邮箱字段 默认email
+	TrustEmail         int    `json:"trust_email"`          // 是否信任提供方已验证的邮箱
+	Status             int    `json:"status"`               // 状态 0.禁用 1.启用
+}
+
+func (r managerOIDCProviderReq) check() error {
+	if !oidcProviderKeyRegexp.MatchString(r.Provider) {
+		return errors.New("提供方标识只能是2-40位小写字母、数字、下划线或中划线")
+	}
+	if r.Provider == ldapProvider {
+		return errors.New("ldap为目录登录保留的标识")
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("名称不能为空")
+	}
+	if strings.TrimSpace(r.ClientID) == "" {
+		return errors.New("client_id不能为空")
+	}
+	if r.Issuer == "" && (r.AuthURL == "" || r.TokenURL == "" || r.UserinfoURL == "") {
+		return errors.New("未填写issuer时必须填写授权、token和用户信息端点")
+	}
+	for _, u := range []string{r.Issuer, r.AuthURL, r.TokenURL, r.UserinfoURL} {
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return errors.New("端点地址格式有误")
+		}
+	}
+	return nil
+}
+
+func (r managerOIDCProviderReq) toModel() *oidcProviderModel {
+	return &oidcProviderModel{
+		Provider:           r.Provider,
+		Name:               strings.TrimSpace(r.Name),
+		Issuer:             strings.TrimSpace(r.Issuer),
+		AuthURL:            strings.TrimSpace(r.AuthURL),
+		TokenURL:           strings.TrimSpace(r.TokenURL),
+		UserinfoURL:        strings.TrimSpace(r.UserinfoURL),
+		ClientID:           strings.TrimSpace(r.ClientID),
+		ClientSecret:       strings.TrimSpace(r.ClientSecret),
+		Scopes:             strings.TrimSpace(r.Scopes),
+		PKCE:               r.PKCE,
+		UserinfoTokenQuery: r.UserinfoTokenQuery,
+		SubjectClaim:       strings.TrimSpace(r.SubjectClaim),
+		NameClaim:          strings.TrimSpace(r.NameClaim),
+		AvatarClaim:        strings.TrimSpace(r.AvatarClaim),
+		EmailClaim:         strings.TrimSpace(r.EmailClaim),
+		TrustEmail:         r.TrustEmail,
+		Status:             r.Status,
+	}
+}
+
+type managerOIDCProviderResp struct {
+	managerOIDCProviderReq
+	RedirectPath string `json:"redirect_path"` // 需要在提供方登记的回调路径
+}
+
+func newManagerOIDCProviderResp(m *oidcProviderModel) *managerOIDCProviderResp {
+	return &managerOIDCProviderResp{
+		managerOIDCProviderReq: managerOIDCProviderReq{
+			Provider:           m.Provider,
+			Name:               m.Name,
+			Issuer:             m.Issuer,
+			AuthURL:            m.AuthURL,
+			TokenURL:           m.TokenURL,
+			UserinfoURL:        m.UserinfoURL,
+			ClientID:           m.ClientID,
+			Scopes:             m.Scopes,
+			PKCE:               m.PKCE,
+			UserinfoTokenQuery: m.UserinfoTokenQuery,
+			SubjectClaim:       m.SubjectClaim,
+			NameClaim:          m.NameClaim,
+			AvatarClaim:        m.AvatarClaim,
+			EmailClaim:         m.EmailClaim,
+			TrustEmail:         m.TrustEmail,
+			Status:             m.Status,
+		},
+		RedirectPath: "/user/oauth/" + m.Provider,
+	}
+}
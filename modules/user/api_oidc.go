@@ -0,0 +1,644 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+const (
+	ThirdAuthcodePrefix = "thirdlogin:authcode:"
+	oidcStatePrefix     = "oidc:state:"
+	oidcStateExpire     = time.Minute * 10
+
+	oidcProviderGithub = "github"
+	oidcProviderGitee  = "gitee"
+)
+
+// 授权请求的状态（回调时校验）
+type oidcState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	Authcode     string `json:"authcode"` // 登录时客户端轮询登录结果用的授权码
+	UID          string `json:"uid"`      // 不为空表示为此用户绑定身份
+}
+
+// 内置的github和gitee（使用配置文件中的client信息，可在后台添加同名提供方覆盖）
+func (u *User) builtinOIDCProvider(provider string) *oidcProviderModel {
+	cfg := u.ctx.GetConfig()
+	switch provider {
+	case oidcProviderGithub:
+		if cfg.Github.ClientID == "" {
+			return nil
+		}
+		return &oidcProviderModel{
+			Provider:     oidcProviderGithub,
+			Name:         "GitHub",
+			AuthURL:      defaultString(cfg.Github.OAuthURL, "https://github.com/login/oauth/authorize"),
+			TokenURL:     "https://github.com/login/oauth/access_token",
+			UserinfoURL:  "https://api.github.com/user",
+			ClientID:     cfg.Github.ClientID,
+			ClientSecret: cfg.Github.ClientSecret,
+			SubjectClaim: "id",
+			NameClaim:    "name,login",
+			AvatarClaim:  "avatar_url",
+			EmailClaim:   "email",
+			Status:       1,
+		}
+	case oidcProviderGitee:
+		if cfg.Gitee.ClientID == "" {
+			return nil
+		}
+		return &oidcProviderModel{
+			Provider:           oidcProviderGitee,
+			Name:               "Gitee",
+			AuthURL:            defaultString(cfg.Gitee.OAuthURL, "https://gitee.com/oauth/authorize"),
+			TokenURL:           "https://gitee.com/oauth/token",
+			UserinfoURL:        "https://gitee.com/api/v5/user",
+			ClientID:           cfg.Gitee.ClientID,
+			ClientSecret:       cfg.Gitee.ClientSecret,
+			UserinfoTokenQuery: 1,
+			SubjectClaim:       "id",
+			NameClaim:          "name,login",
+			AvatarClaim:        "avatar_url",
+			EmailClaim:         "email",
+			Status:             1,
+		}
+	}
+	return nil
+}
+
+// oidcProvider 获取启用的身份提供方
+func (u *User) oidcProvider(provider string) (*oidcProviderModel, error) {
+	m, err := u.oidcProviderDB.queryWithProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = u.builtinOIDCProvider(provider)
+	}
+	if m == nil || m.Status != 1 || m.ClientID == "" {
+		return nil, errors.New("不支持的登录方式")
+	}
+	return m, nil
+}
+
+func (u *User) oidcRedirectURI(provider string) string {
+	return fmt.Sprintf("%s/user/oauth/%s", u.ctx.GetConfig().External.APIBaseURL, provider)
+}
+
+// oidcAuthURL 生成授权地址并保存授权状态
+func (u *User) oidcAuthURL(ctx context.Context, provider string, authcode string, uid string) (string, error) {
+	providerM, err := u.oidcProvider(provider)
+	if err != nil {
+		return "", err
+	}
+	state := &oidcState{
+		Provider:     provider,
+		CodeVerifier: newPKCEVerifier(),
+		Nonce:        util.GenerUUID(),
+		Authcode:     authcode,
+		UID:          uid,
+	}
+	stateID := util.GenerUUID()
+	authURL, err := newOIDCConnector(providerM).authURL(ctx, u.oidcRedirectURI(provider), stateID, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		return "", err
+	}
+	err = u.ctx.GetRedisConn().SetAndExpire(oidcStatePrefix+stateID, util.ToJson(state), oidcStateExpire)
+	if err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// 跳转到身份提供方授权页面
+func (u *User) oidcAuthorize(c *wkhttp.Context) {
+	u.oidcRedirect(c, c.Param("provider"))
+}
+
+func (u *User) github(c *wkhttp.Context) {
+	u.oidcRedirect(c, oidcProviderGithub)
+}
+
+func (u *User) gitee(c *wkhttp.Context) {
+	u.oidcRedirect(c, oidcProviderGitee)
+}
+
+func (u *User) oidcRedirect(c *wkhttp.Context, provider string) {
+	authURL, err := u.oidcAuthURL(c.Request.Context(), provider, c.Query("authcode"), "")
+	if err != nil {
+		u.Error("生成授权地址失败！", zap.Error(err), zap.String("provider", provider))
+		c.ResponseError(err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// 身份提供方授权回调
+func (u *User) oidcCallback(c *wkhttp.Context) {
+	provider := c.Param("provider")
+	code := c.Query("code")
+	if len(code) == 0 {
+		c.ResponseError(errors.New("code不能为空"))
+		return
+	}
+	stateKey := oidcStatePrefix + c.Query("state")
+	stateStr, err := u.ctx.GetRedisConn().GetString(stateKey)
+	if err != nil {
+		u.Error("获取授权状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("获取授权状态失败！"))
+		return
+	}
+	if stateStr == "" {
+		c.ResponseError(errors.New("授权已过期，请重新登录"))
+		return
+	}
+	_ = u.ctx.GetRedisConn().Del(stateKey) // 一次有效
+	var state *oidcState
+	if err = util.ReadJsonByByte([]byte(stateStr), &state); err != nil || state.Provider != provider {
+		c.ResponseError(errors.New("授权状态无效"))
+		return
+	}
+	providerM, err := u.oidcProvider(provider)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	connector := newOIDCConnector(providerM)
+	timeoutCtx, cancel := context.WithTimeout(c.Request.Context(), oidcHTTPTimeout*3)
+	defer cancel()
+	token, err := connector.exchange(timeoutCtx, code, u.oidcRedirectURI(provider), state.CodeVerifier)
+	if err != nil {
+		u.Error("获取access_token失败！", zap.Error(err), zap.String("provider", provider))
+		c.ResponseError(errors.New("获取授权信息失败"))
+		return
+	}
+	claims, err := connector.claims(timeoutCtx, token, state.Nonce)
+	if err != nil {
+		u.Error("获取第三方用户信息失败！", zap.Error(err), zap.String("provider", provider))
+		c.ResponseError(errors.New("获取第三方用户信息失败"))
+		return
+	}
+	identity, err := connector.mapClaims(claims)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if state.UID != "" {
+		u.oidcLink(c, providerM, identity, state.UID)
+		return
+	}
+	u.oidcLogin(c, providerM, identity, state.Authcode)
+}
+
+// 通过第三方身份登录（没有绑定账号的自动注册）
+func (u *User) oidcLogin(c *wkhttp.Context, providerM *oidcProviderModel, identity *oidcIdentity, authcode string) {
+	identityM, err := u.identityDB.queryWithSubject(providerM.Provider, identity.Subject)
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	loginSpan := u.ctx.Tracer().StartSpan(
+		"oidclogin",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	deviceFlag := config.APP
+	loginSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), loginSpan)
+	loginSpan.SetTag("provider", providerM.Provider)
+	loginSpan.SetTag("subject", identity.Subject)
+	defer loginSpan.Finish()
+
+	trustEmail := providerM.TrustEmail == 1 && identity.EmailVerified && identity.Email != ""
+	var userInfoM *Model
+	if identityM != nil {
+		userInfoM, err = u.db.QueryByUID(identityM.UID)
+	} else if trustEmail { // 提供方已验证的邮箱关联已有账号
+		userInfoM, err = u.db.queryByVerifiedEmail(identity.Email)
+		if err == nil && userInfoM != nil {
+			identityM = &identityModel{Provider: providerM.Provider, Subject: identity.Subject, UID: userInfoM.UID}
+		}
+	}
+	if err != nil {
+		u.Error("查询第三方身份关联的用户失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+
+	var loginResp *loginUserDetailResp
+	var totpResp *thirdAuthTotpResp
+	if userInfoM != nil { // 存在就登录
+		if userInfoM.IsDestroy == 1 {
+			c.ResponseError(errors.New("用户不存在"))
+			return
+		}
+		identityM.Name = identity.Name
+		identityM.Avatar = identity.Avatar
+		identityM.Email = identity.Email
+		identityM.LastLoginAt = time.Now().Unix()
+		if identityM.Id == 0 {
+			err = u.identityDB.insert(identityM)
+			if err != nil {
+				u.Error("关联第三方身份失败！", zap.Error(err))
+				c.ResponseError(errors.New("关联第三方身份失败！"))
+				return
+			}
+		} else if err = u.identityDB.updateLogin(identityM); err != nil {
+			u.Warn("更新第三方身份信息失败！", zap.Error(err))
+		}
+		// 开启了两步验证的需要在应用内完成验证后才能登录
+		challenge, err := u.newTotpChallenge(userInfoM, totpSceneOIDCLogin, int(deviceFlag), nil)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		if challenge != "" {
+			totpResp = &thirdAuthTotpResp{UID: userInfoM.UID, Challenge: challenge}
+		} else {
+			loginResp, err = u.execLogin(userInfoM, deviceFlag, nil, newSessionClient(c), loginSpanCtx)
+			if err != nil {
+				c.ResponseError(err)
+				return
+			}
+			// 发送登录消息
+			publicIP := util.GetClientPublicIP(c.Request)
+			go u.sentWelcomeMsg(publicIP, userInfoM.UID)
+		}
+	} else {
+		loginResp, err = u.oidcRegister(c, loginSpanCtx, providerM, identity, trustEmail)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
+	var loginRespStr string
+	if totpResp != nil {
+		loginRespStr = util.ToJson(totpResp)
+	} else if loginResp != nil {
+		loginRespStr = util.ToJson(loginResp)
+	} else {
+		loginRespStr = "0"
+	}
+	err = u.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode), loginRespStr, time.Minute*1)
+	if err != nil {
+		u.Error("redis set error", zap.Error(err))
+		c.ResponseError(errors.New("redis set error"))
+		return
+	}
+	time.Sleep(time.Second * 3)      // 这里等待2秒，让前端有足够的时间跳转到登录成功页面。
+	c.String(http.StatusOK, "登录失败！") // 如果一切正常，理论上是看不到这个返回结果的
+}
+
+// 使用第三方身份创建用户
+func (u *User) oidcRegister(c *wkhttp.Context, loginSpanCtx context.Context, providerM *oidcProviderModel, identity *oidcIdentity, trustEmail bool) (*loginUserDetailResp, error) {
+	uid := util.GenerUUID()
+	name := identity.Name
+	if strings.TrimSpace(name) == "" {
+		name = fmt.Sprintf("%s用户", providerM.Name)
+	}
+	var model = &createUserModel{
+		UID:  uid,
+		Name: name,
+		Flag: int(config.APP.Uint8()),
+	}
+	if trustEmail {
+		model.Email = strings.ToLower(identity.Email)
+		model.EmailVerified = 1
+	}
+	if identity.Avatar != "" && !strings.HasSuffix(identity.Avatar, "no_portrait.png") {
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		imgReader, _ := u.fileService.DownloadImage(identity.Avatar, timeoutCtx)
+		cancel()
+		if imgReader != nil {
+			avatarID := crc32.ChecksumIEEE([]byte(uid)) % uint32(u.ctx.GetConfig().Avatar.Partition)
+			_, err := u.fileService.UploadFile(fmt.Sprintf("avatar/%d/%s.png", avatarID, uid), "image/png", func(w io.Writer) error {
+				_, err := io.Copy(w, imgReader)
+				return err
+			})
+			defer imgReader.Close()
+			if err == nil {
+				model.IsUploadAvatar = 1
+			}
+		}
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		return nil, errors.New("开启事务失败！")
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = u.identityDB.insertTx(&identityModel{
+		Provider:    providerM.Provider,
+		Subject:     identity.Subject,
+		UID:         uid,
+		Name:        identity.Name,
+		Avatar:      identity.Avatar,
+		Email:       identity.Email,
+		LastLoginAt: time.Now().Unix(),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("添加第三方身份失败！", zap.Error(err))
+		return nil, errors.New("添加第三方身份失败！")
+	}
+	publicIP := util.GetClientPublicIP(c.Request)
+	resp, err := u.createUserWithRespAndTx(loginSpanCtx, model, publicIP, nil, tx, func() error {
+		err := tx.Commit()
+		if err != nil {
+			tx.Rollback()
+			u.Error("数据库事物提交失败", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// 为已登录用户绑定第三方身份
+func (u *User) oidcLink(c *wkhttp.Context, providerM *oidcProviderModel, identity *oidcIdentity, uid string) {
+	identityM, err := u.identityDB.queryWithSubject(providerM.Provider, identity.Subject)
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	if identityM != nil {
+		if identityM.UID != uid {
+			c.String(http.StatusOK, fmt.Sprintf("该%s账号已绑定其他用户", providerM.Name))
+			return
+		}
+		c.String(http.StatusOK, "绑定成功，请返回应用")
+		return
+	}
+	existM, err := u.identityDB.queryWithUIDAndProvider(uid, providerM.Provider)
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	if existM != nil {
+		c.String(http.StatusOK, fmt.Sprintf("已绑定其他%s账号，请先解除绑定", providerM.Name))
+		return
+	}
+	err = u.identityDB.insert(&identityModel{
+		Provider: providerM.Provider,
+		Subject:  identity.Subject,
+		UID:      uid,
+		Name:     identity.Name,
+		Avatar:   identity.Avatar,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		u.Error("绑定第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("绑定第三方身份失败！"))
+		return
+	}
+	c.String(http.StatusOK, "绑定成功，请返回应用")
+}
+
+// 可用的第三方登录方式
+func (u *User) oidcProviders(c *wkhttp.Context) {
+	models, err := u.oidcProviderDB.queryAll()
+	if err != nil {
+		u.Error("查询身份提供方失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询身份提供方失败！"))
+		return
+	}
+	exists := map[string]bool{}
+	list := make([]*oidcProviderResp, 0, len(models)+2)
+	for _, m := range models {
+		exists[m.Provider] = true
+		if m.Status == 1 && m.ClientID != "" {
+			list = append(list, &oidcProviderResp{Provider: m.Provider, Name: m.Name})
+		}
+	}
+	for _, provider := range []string{oidcProviderGithub, oidcProviderGitee} {
+		if exists[provider] {
+			continue
+		}
+		if m := u.builtinOIDCProvider(provider); m != nil {
+			list = append(list, &oidcProviderResp{Provider: m.Provider, Name: m.Name})
+		}
+	}
+	c.Response(list)
+}
+
+// 我绑定的第三方身份
+func (u *User) identities(c *wkhttp.Context) {
+	models, err := u.identityDB.queryWithUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	list := make([]*identityResp, 0, len(models))
+	for _, m := range models {
+		list = append(list, newIdentityResp(m))
+	}
+	c.Response(list)
+}
+
+// 获取绑定第三方身份的授权地址
+func (u *User) identityLink(c *wkhttp.Context) {
+	provider := c.Param("provider")
+	existM, err := u.identityDB.queryWithUIDAndProvider(c.GetLoginUID(), provider)
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	if existM != nil {
+		c.ResponseError(errors.New("已绑定该登录方式，请先解除绑定"))
+		return
+	}
+	authURL, err := u.oidcAuthURL(c.Request.Context(), provider, "", c.GetLoginUID())
+	if err != nil {
+		u.Error("生成授权地址失败！", zap.Error(err), zap.String("provider", provider))
+		c.ResponseError(err)
+		return
+	}
+	c.Response(gin.H{
+		"url": authURL,
+	})
+}
+
+// 解除绑定第三方身份
+func (u *User) identityUnlink(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	provider := c.Param("provider")
+	if provider == ldapProvider {
+		c.ResponseError(errors.New("目录账号由管理员管理，不能解除绑定"))
+		return
+	}
+	identityM, err := u.identityDB.queryWithUIDAndProvider(loginUID, provider)
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	if identityM == nil {
+		c.ResponseError(errors.New("未绑定该登录方式"))
+		return
+	}
+	userInfo, err := u.db.QueryByUID(loginUID)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("登录用户不存在"))
+		return
+	}
+	identities, err := u.identityDB.queryWithUID(loginUID)
+	if err != nil {
+		u.Error("查询第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方身份失败！"))
+		return
+	}
+	// 解绑后必须还有其他登录方式
+	hasOtherLogin := userInfo.Password != "" || userInfo.Phone != "" || userInfo.EmailVerified == 1 || len(identities) > 1
+	if !hasOtherLogin {
+		c.ResponseError(errors.New("这是唯一的登录方式，请先设置密码或绑定手机号/邮箱"))
+		return
+	}
+	err = u.identityDB.delete(loginUID, provider)
+	if err != nil {
+		u.Error("解除绑定第三方身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("解除绑定第三方身份失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+func (u *User) thirdAuthcode(c *wkhttp.Context) {
+	c.ResponseError(errors.New("不支持注册"))
+	// authcode := util.GenerUUID()
+	// err := u.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode), "1", time.Minute*5)
+	// if err != nil {
+	// 	u.Error("redis set error", zap.Error(err))
+	// 	c.ResponseError(errors.New("redis set error"))
+	// 	return
+	// }
+
+	// c.Response(gin.H{
+	// 	"authcode": authcode,
+	// })
+}
+
+func (u *User) thirdAuthStatus(c *wkhttp.Context) {
+	authcode := c.Query("authcode")
+	key := fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode)
+	result, err := u.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		u.Error("获取登录状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("获取登录状态失败！"))
+		return
+	}
+	if len(result) == 0 {
+		c.ResponseError(errors.New("登录状态已过期！"))
+		return
+	}
+	if result == "1" {
+		c.Response(gin.H{
+			"status": 0, // 等待登录
+		})
+		return
+	}
+	if result == "0" {
+		c.Response(gin.H{
+			"status": 2, // 登录失败
+		})
+		return
+	}
+
+	err = u.ctx.GetRedisConn().Del(key)
+	if err != nil {
+		u.Error("redis del error", zap.Error(err))
+	}
+
+	var totpResp *thirdAuthTotpResp
+	if err = util.ReadJsonByByte([]byte(result), &totpResp); err == nil && totpResp != nil && totpResp.Challenge != "" {
+		c.Response(gin.H{
+			"status":    3, // 需要两步验证 通过 /v1/user/login/totp 完成登录
+			"uid":       totpResp.UID,
+			"challenge": totpResp.Challenge,
+		})
+		return
+	}
+
+	var loginResp *loginUserDetailResp
+	err = util.ReadJsonByByte([]byte(result), &loginResp)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(gin.H{
+		"status": 1, // 登录成功
+		"result": loginResp,
+	})
+}
+
+func newIdentityResp(m *identityModel) *identityResp {
+	return &identityResp{
+		Provider:    m.Provider,
+		Name:        m.Name,
+		Avatar:      m.Avatar,
+		Email:       m.Email,
+		LastLoginAt: m.LastLoginAt,
+		CreatedAt:   time.Time(m.CreatedAt).Unix(),
+	}
+}
+
+// identitySubject 用户在某个提供方的用户ID
+func identitySubject(identities []*identityModel, uid string, provider string) string {
+	for _, identity := range identities {
+		if identity.UID == uid && identity.Provider == provider {
+			return identity.Subject
+		}
+	}
+	return ""
+}
+
+// 第三方登录后等待两步验证
+type thirdAuthTotpResp struct {
+	UID       string `json:"uid"`
+	Challenge string `json:"totp_challenge"`
+}
+
+type oidcProviderResp struct {
+	Provider string `json:"provider"` // 提供方标识 授权地址为 /v1/user/oidc/{provider}?authcode=xxx
+	Name     string `json:"name"`     // 显示名称
+}
+
+type identityResp struct {
+	Provider    string `json:"provider"`      // 提供方标识
+	Name        string `json:"name"`          // 提供方的用户名称
+	Avatar      string `json:"avatar"`        // 提供方的用户头像
+	Email       string `json:"email"`         // 提供方的用户邮箱
+	LastLoginAt int64  `json:"last_login_at"` // 最后一次通过此身份登录的时间
+	CreatedAt   int64  `json:"created_at"`    // 绑定时间
+}
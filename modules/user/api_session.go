@@ -0,0 +1,633 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	sessionTokenPrefix   = "sessionToken:"   // 会话ID对应的token（注销时清除token缓存用）
+	sessionRevokedPrefix = "sessionRevoked:" // 已注销的token
+	sessionSeenPrefix    = "sessionSeen:"    // 最后活跃时间的更新间隔
+
+	sessionSeenInterval = time.Minute // 最后活跃时间最多每分钟更新一次
+	userAgentMaxLen     = 500
+
+	accessTokenExpire = time.Hour * 2 // 访问令牌有效期（刷新令牌的有效期为配置的token有效期）
+
+	refreshTokenStatusValid   = 0 // 可用
+	refreshTokenStatusUsed    = 1 // 已使用（轮换过）
+	refreshTokenStatusRevoked = 2 // 已注销
+)
+
+var (
+	// ErrRefreshTokenInvalid 刷新令牌无效
+	ErrRefreshTokenInvalid = errors.New("登录已失效，请重新登录！")
+)
+
+// 登录客户端信息
+type sessionClient struct {
+	IP        string
+	UserAgent string
+}
+
+func newSessionClient(c *wkhttp.Context) *sessionClient {
+	return &sessionClient{
+		IP:        util.GetClientPublicIP(c.Request),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// 登录会话
+type sessionService struct {
+	ctx    *config.Context
+	db     *sessionDB
+	userDB *DB
+	log.Log
+}
+
+func newSessionService(ctx *config.Context) *sessionService {
+	return &sessionService{
+		ctx:    ctx,
+		db:     newSessionDB(ctx),
+		userDB: NewDB(ctx),
+		Log:    log.NewTLog("sessionService"),
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// add 签发token后记录会话并返回刷新令牌
+func (s *sessionService) add(uid string, token string, flag config.DeviceFlag, device *deviceReq, client *sessionClient, imSync bool) string {
+	now := time.Now().Unix()
+	m := &sessionModel{
+		SessionID:  util.GenerUUID(),
+		UID:        uid,
+		TokenHash:  hashToken(token),
+		DeviceFlag: int(flag),
+		LoginAt:    now,
+		LastSeenAt: now,
+	}
+	m.FamilyID = m.SessionID
+	if imSync {
+		m.IMSync = 1
+	}
+	if device != nil {
+		m.DeviceID = device.DeviceID
+		m.DeviceName = device.DeviceName
+		m.DeviceModel = device.DeviceModel
+	}
+	m.setClient(client)
+	err := s.db.insert(m)
+	if err != nil {
+		s.Error("添加登录会话失败！", zap.Error(err), zap.String("uid", uid))
+		return ""
+	}
+	s.cacheSessionToken(m.SessionID, token)
+	refreshToken, err := s.issueRefreshToken(uid, m.FamilyID)
+	if err != nil {
+		s.Error("签发刷新令牌失败！", zap.Error(err), zap.String("uid", uid))
+		return ""
+	}
+	return refreshToken
+}
+
+func (m *sessionModel) setClient(client *sessionClient) {
+	if client == nil {
+		return
+	}
+	m.LoginIP = client.IP
+	m.LastSeenIP = client.IP
+	m.UserAgent = client.UserAgent
+	if len(m.UserAgent) > userAgentMaxLen {
+		m.UserAgent = m.UserAgent[:userAgentMaxLen]
+	}
+}
+
+func (s *sessionService) cacheSessionToken(sessionID string, token string) {
+	err := s.ctx.GetRedisConn().SetAndExpire(sessionTokenPrefix+sessionID, token, s.ctx.GetConfig().Cache.TokenExpire)
+	if err != nil {
+		s.Warn("缓存会话token失败！", zap.Error(err))
+	}
+}
+
+// 签发刷新令牌 有效期为配置的token有效期
+func (s *sessionService) issueRefreshToken(uid string, familyID string) (string, error) {
+	refreshToken, m, err := s.newRefreshTokenModel(uid, familyID)
+	if err != nil {
+		return "", err
+	}
+	if err = s.db.insertRefreshToken(m); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+func (s *sessionService) newRefreshTokenModel(uid string, familyID string) (string, *refreshTokenModel, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+	return refreshToken, &refreshTokenModel{
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		UID:       uid,
+		Status:    refreshTokenStatusValid,
+		ExpireAt:  time.Now().Add(s.ctx.GetConfig().Cache.TokenExpire).Unix(),
+	}, nil
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// refresh 使用刷新令牌换取新的访问令牌（刷新令牌每次轮换，旧的刷新令牌被再次使用时注销整个会话族）
+// 可能失败的步骤都在标记刷新令牌已使用之前完成，失败时客户端可以用同一个刷新令牌重试
+func (s *sessionService) refresh(refreshToken string, client *sessionClient) (*tokenPairResp, error) {
+	now := time.Now()
+	rt, err := s.db.queryRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if rt == nil || rt.Status == refreshTokenStatusRevoked || rt.ExpireAt <= now.Unix() {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if rt.Status == refreshTokenStatusUsed {
+		s.Warn("刷新令牌被重复使用，注销整个会话族！", zap.String("uid", rt.UID), zap.String("familyID", rt.FamilyID))
+		s.revokeFamily(rt.FamilyID)
+		return nil, ErrRefreshTokenInvalid
+	}
+	sessions, err := s.db.queryActiveWithFamilyID(rt.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrRefreshTokenInvalid
+	}
+	current := sessions[0]
+	userInfo, err := s.userDB.QueryByUID(rt.UID)
+	if err != nil {
+		return nil, err
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if userInfo.Status == int(common.UserDisable) {
+		s.revokeFamily(rt.FamilyID)
+		return nil, errors.New("该用户已被禁用")
+	}
+
+	cacheCfg := s.ctx.GetConfig().Cache
+	flag := config.DeviceFlag(current.DeviceFlag)
+	var token string
+	// web/pc刚轮换过的token直接复用，避免频繁更新IM token
+	if flag != config.APP && now.Unix()-current.LoginAt < int64(accessTokenExpire/time.Second)/2 {
+		token, err = s.ctx.GetRedisConn().GetString(sessionTokenPrefix + current.SessionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rotated := token == ""
+	var next *sessionModel
+	if rotated {
+		token = util.GenerUUID()
+		if current.IMSync == 1 {
+			deviceLevel := config.DeviceLevelSlave
+			if flag == config.APP {
+				deviceLevel = config.DeviceLevelMaster
+			}
+			imResp, err := s.ctx.UpdateIMToken(config.UpdateIMTokenReq{
+				UID:         userInfo.UID,
+				Token:       token,
+				DeviceFlag:  flag,
+				DeviceLevel: deviceLevel,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if imResp.Status == config.UpdateTokenStatusBan {
+				return nil, errors.New("此账号已经被封禁！")
+			}
+		}
+		next = &sessionModel{
+			SessionID:   util.GenerUUID(),
+			FamilyID:    current.FamilyID,
+			UID:         current.UID,
+			TokenHash:   hashToken(token),
+			DeviceFlag:  current.DeviceFlag,
+			DeviceID:    current.DeviceID,
+			DeviceName:  current.DeviceName,
+			DeviceModel: current.DeviceModel,
+			LoginAt:     now.Unix(),
+			LastSeenAt:  now.Unix(),
+			IMSync:      current.IMSync,
+		}
+		next.setClient(client)
+	}
+	nextRefreshToken, nextRT, err := s.newRefreshTokenModel(userInfo.UID, rt.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ctx.Cache().SetAndExpire(cacheCfg.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userInfo.UID, userInfo.Name, userInfo.Role), accessTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.rotateRefreshToken(rt.TokenHash, next, nextRT, now.Unix())
+	if err != nil || !ok {
+		s.discardToken(token, rotated)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok { // 并发使用同一个刷新令牌
+		s.Warn("刷新令牌被并发使用，注销整个会话族！", zap.String("uid", rt.UID), zap.String("familyID", rt.FamilyID))
+		s.revokeFamily(rt.FamilyID)
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if next != nil {
+		err = s.ctx.Cache().SetAndExpire(fmt.Sprintf("%s%d%s", cacheCfg.UIDTokenCachePrefix, flag, userInfo.UID), token, cacheCfg.TokenExpire)
+		if err != nil {
+			s.Error("设置uidtoken缓存失败！", zap.Error(err), zap.String("uid", userInfo.UID))
+		}
+		s.cacheSessionToken(next.SessionID, token)
+		if err = s.retire(current); err != nil {
+			s.Warn("注销轮换前的会话失败！", zap.Error(err))
+		}
+	}
+	return &tokenPairResp{
+		Token:        token,
+		RefreshToken: nextRefreshToken,
+		ExpiresIn:    int64(accessTokenExpire / time.Second),
+	}, nil
+}
+
+// rotateRefreshToken 在同一个事务中添加新会话、签发新的刷新令牌并标记旧的刷新令牌已使用
+func (s *sessionService) rotateRefreshToken(tokenHash string, next *sessionModel, nextRT *refreshTokenModel, usedAt int64) (bool, error) {
+	tx, err := s.db.session.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.RollbackUnlessCommitted()
+	if next != nil {
+		if err = s.db.insertTx(next, tx); err != nil {
+			return false, err
+		}
+	}
+	if err = s.db.insertRefreshTokenTx(nextRT, tx); err != nil {
+		return false, err
+	}
+	ok, err := s.db.useRefreshTokenTx(tokenHash, usedAt, tx)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// discardToken 刷新失败时清除新签发的token缓存（复用的token仍在使用，不清除）
+func (s *sessionService) discardToken(token string, rotated bool) {
+	if !rotated {
+		return
+	}
+	if err := s.ctx.Cache().Delete(s.ctx.GetConfig().Cache.TokenCachePrefix + token); err != nil {
+		s.Warn("清除token缓存失败！", zap.Error(err))
+	}
+}
+
+// retire 轮换后旧的会话及token立即失效
+func (s *sessionService) retire(m *sessionModel) error {
+	err := s.db.revoke(m.TokenHash, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	conn := s.ctx.GetRedisConn()
+	token, err := conn.GetString(sessionTokenPrefix + m.SessionID)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		if err = s.ctx.Cache().Delete(s.ctx.GetConfig().Cache.TokenCachePrefix + token); err != nil {
+			return err
+		}
+	}
+	return conn.Del(sessionTokenPrefix + m.SessionID)
+}
+
+// revokeFamily 注销整个会话族
+func (s *sessionService) revokeFamily(familyID string) {
+	sessions, err := s.db.queryActiveWithFamilyID(familyID)
+	if err != nil {
+		s.Error("查询会话族失败！", zap.Error(err), zap.String("familyID", familyID))
+	}
+	for _, session := range sessions {
+		if err = s.revoke(session, true); err != nil {
+			s.Error("注销会话失败！", zap.Error(err), zap.String("sessionID", session.SessionID))
+		}
+	}
+	if err = s.db.revokeRefreshTokens(familyID); err != nil {
+		s.Error("注销刷新令牌失败！", zap.Error(err), zap.String("familyID", familyID))
+	}
+}
+
+// revoked token是否已被注销
+func (s *sessionService) revoked(token string) (bool, error) {
+	value, err := s.ctx.GetRedisConn().GetString(sessionRevokedPrefix + hashToken(token))
+	if err != nil {
+		return false, err
+	}
+	return value != "", nil
+}
+
+// revoke 注销会话 quitIM为true时同时让该设备类型的IM连接下线
+func (s *sessionService) revoke(m *sessionModel, quitIM bool) error {
+	err := s.db.revoke(m.TokenHash, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if err = s.db.revokeRefreshTokens(m.FamilyID); err != nil {
+		return err
+	}
+	conn := s.ctx.GetRedisConn()
+	cacheCfg := s.ctx.GetConfig().Cache
+	err = conn.SetAndExpire(sessionRevokedPrefix+m.TokenHash, "1", cacheCfg.TokenExpire)
+	if err != nil {
+		return err
+	}
+	token, err := conn.GetString(sessionTokenPrefix + m.SessionID)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		if err = s.ctx.Cache().Delete(cacheCfg.TokenCachePrefix + token); err != nil {
+			return err
+		}
+		uidTokenKey := fmt.Sprintf("%s%d%s", cacheCfg.UIDTokenCachePrefix, m.DeviceFlag, m.UID)
+		uidToken, err := s.ctx.Cache().Get(uidTokenKey)
+		if err != nil {
+			return err
+		}
+		if uidToken == token {
+			if err = s.ctx.Cache().Delete(uidTokenKey); err != nil {
+				return err
+			}
+		} else if m.DeviceFlag != int(config.APP) {
+			// IM中该设备类型的token已被其他客户端的登录替换，不需要让同类型的其他客户端下线
+			quitIM = false
+		}
+		_ = conn.Del(sessionTokenPrefix + m.SessionID)
+	}
+	if quitIM {
+		if err = s.ctx.QuitUserDevice(m.UID, m.DeviceFlag); err != nil {
+			s.Warn("退出IM设备失败！", zap.Error(err), zap.String("uid", m.UID))
+		}
+	}
+	return nil
+}
+
+// revokeWithToken 旧token被新token替换时注销旧会话（app登录会踢掉旧token）
+func (s *sessionService) revokeWithToken(token string) {
+	tokenHash := hashToken(token)
+	m, err := s.db.queryWithTokenHash(tokenHash)
+	if err != nil {
+		s.Warn("查询旧会话失败！", zap.Error(err))
+		return
+	}
+	if m != nil {
+		if err = s.db.revoke(tokenHash, time.Now().Unix()); err != nil {
+			s.Warn("注销旧会话失败！", zap.Error(err))
+			return
+		}
+		if err = s.db.revokeRefreshTokens(m.FamilyID); err != nil {
+			s.Warn("注销旧会话的刷新令牌失败！", zap.Error(err))
+		}
+	}
+	err = s.ctx.GetRedisConn().SetAndExpire(sessionRevokedPrefix+tokenHash, "1", s.ctx.GetConfig().Cache.TokenExpire)
+	if err != nil {
+		s.Warn("缓存已注销的token失败！", zap.Error(err))
+	}
+}
+
+// touch 更新最后活跃时间
+func (s *sessionService) touch(token string, ip string) {
+	tokenHash := hashToken(token)
+	conn := s.ctx.GetRedisConn()
+	seen, err := conn.GetString(sessionSeenPrefix + tokenHash)
+	if err != nil {
+		s.Warn("查询会话活跃时间失败！", zap.Error(err))
+		return
+	}
+	if seen != "" {
+		return
+	}
+	if err = conn.SetAndExpire(sessionSeenPrefix+tokenHash, "1", sessionSeenInterval); err != nil {
+		s.Warn("设置会话活跃时间失败！", zap.Error(err))
+		return
+	}
+	if err = s.db.updateLastSeen(tokenHash, time.Now().Unix(), ip); err != nil {
+		s.Warn("更新会话活跃时间失败！", zap.Error(err))
+	}
+}
+
+// 未过期的会话列表
+func (s *sessionService) activeSessions(uid string) ([]*sessionModel, error) {
+	loginAfter := time.Now().Add(-s.ctx.GetConfig().Cache.TokenExpire).Unix()
+	return s.db.queryActiveWithUID(uid, loginAfter)
+}
+
+// SessionMiddleware 会话中间件 拒绝已注销的token并更新会话的最后活跃时间
+// 需要在模块路由注册之前通过Use安装（库中的AuthMiddleware无法修改）
+func SessionMiddleware(ctx *config.Context) wkhttp.HandlerFunc {
+	s := newSessionService(ctx)
+	return func(c *wkhttp.Context) {
+		token := c.GetHeader("token")
+		if token == "" {
+			c.Next()
+			return
+		}
+		revoked, err := s.revoked(token)
+		if err != nil {
+			s.Warn("查询token是否注销失败！", zap.Error(err))
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"msg": "登录已失效，请重新登录！",
+			})
+			return
+		}
+		c.Next()
+		if c.GetLoginUID() != "" { // 通过了认证中间件
+			s.touch(token, util.GetClientPublicIP(c.Request))
+		}
+	}
+}
+
+// 我的登录会话
+func (u *User) sessionList(c *wkhttp.Context) {
+	sessions, err := u.sessionService.activeSessions(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	currentHash := hashToken(c.GetHeader("token"))
+	resps := make([]*sessionResp, 0, len(sessions))
+	for _, session := range sessions {
+		resps = append(resps, newSessionResp(session, session.TokenHash == currentHash))
+	}
+	c.Response(resps)
+}
+
+// 注销某个登录会话
+func (u *User) sessionRevoke(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	sessionID := c.Param("session_id")
+	session, err := u.sessionService.db.queryWithSessionID(sessionID)
+	if err != nil {
+		u.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	if session == nil || session.UID != loginUID {
+		c.ResponseError(errors.New("登录会话不存在！"))
+		return
+	}
+	if session.Revoked == 1 {
+		c.ResponseOK()
+		return
+	}
+	current, err := u.sessionService.db.queryWithTokenHash(hashToken(c.GetHeader("token")))
+	if err != nil {
+		u.Error("查询当前登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询当前登录会话失败！"))
+		return
+	}
+	// 同一设备类型只有一个IM token 和当前会话同类型时不能让IM下线
+	quitIM := current == nil || current.DeviceFlag != session.DeviceFlag || current.SessionID == session.SessionID
+	err = u.sessionService.revoke(session, quitIM)
+	if err != nil {
+		u.Error("注销登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("注销登录会话失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 退出除当前会话外的所有登录
+func (u *User) sessionRevokeOthers(c *wkhttp.Context) {
+	sessions, err := u.sessionService.activeSessions(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	currentHash := hashToken(c.GetHeader("token"))
+	currentFlag := -1
+	for _, session := range sessions {
+		if session.TokenHash == currentHash {
+			currentFlag = session.DeviceFlag
+			break
+		}
+	}
+	for _, session := range sessions {
+		if session.TokenHash == currentHash {
+			continue
+		}
+		err = u.sessionService.revoke(session, session.DeviceFlag != currentFlag)
+		if err != nil {
+			u.Error("注销登录会话失败！", zap.Error(err), zap.String("sessionID", session.SessionID))
+			c.ResponseError(errors.New("注销登录会话失败！"))
+			return
+		}
+	}
+	c.ResponseOK()
+}
+
+// 刷新访问令牌
+func (u *User) tokenRefresh(c *wkhttp.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.RefreshToken) == "" {
+		c.ResponseError(errors.New("刷新令牌不能为空！"))
+		return
+	}
+	resp, err := u.sessionService.refresh(req.RefreshToken, newSessionClient(c))
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenInvalid) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"msg": err.Error(),
+			})
+			return
+		}
+		u.Error("刷新访问令牌失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.Response(resp)
+}
+
+type tokenPairResp struct {
+	Token        string `json:"token"`         // 访问令牌（同时用于IM连接）
+	RefreshToken string `json:"refresh_token"` // 刷新令牌（每次刷新后更换）
+	ExpiresIn    int64  `json:"expires_in"`    // 访问令牌有效期（秒）
+}
+
+type sessionResp struct {
+	SessionID   string `json:"session_id"`
+	DeviceFlag  int    `json:"device_flag"` // 设备标记 0.APP 1.WEB 2.PC
+	DeviceID    string `json:"device_id"`
+	DeviceName  string `json:"device_name"`
+	DeviceModel string `json:"device_model"`
+	LoginIP     string `json:"login_ip"`
+	UserAgent   string `json:"user_agent"`
+	LastSeenIP  string `json:"last_seen_ip"`
+	CreatedAt   int64  `json:"created_at"`
+	LastSeenAt  int64  `json:"last_seen_at"`
+	Self        int    `json:"self"` // 是否是当前会话
+}
+
+func newSessionResp(m *sessionModel, self bool) *sessionResp {
+	resp := &sessionResp{
+		SessionID:   m.SessionID,
+		DeviceFlag:  m.DeviceFlag,
+		DeviceID:    m.DeviceID,
+		DeviceName:  strings.TrimSpace(m.DeviceName),
+		DeviceModel: m.DeviceModel,
+		LoginIP:     m.LoginIP,
+		UserAgent:   m.UserAgent,
+		LastSeenIP:  m.LastSeenIP,
+		LastSeenAt:  m.LastSeenAt,
+		CreatedAt:   time.Time(m.CreatedAt).Unix(),
+	}
+	if self {
+		resp.Self = 1
+	}
+	return resp
+}
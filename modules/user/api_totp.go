@@ -0,0 +1,601 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/totp"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gocraft/dbr/v2"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+const (
+	totpStatusPending = 0 // 待确认
+	totpStatusEnabled = 1 // 已开启
+
+	totpSkew               = 1               // 允许前后一个时间步的误差
+	totpRecoveryCodeCount  = 10              // 恢复码数量
+	totpChallengeExpire    = time.Minute * 5 // 登录挑战有效期
+	totpChallengeMaxFailed = 5               // 登录挑战最多失败次数
+	totpChallengePrefix    = "totpChallenge:"
+
+	totpSceneLogin         = "login"         // 手机号登录
+	totpSceneUsernameLogin = "usernamelogin" // 用户名登录
+	totpSceneOIDCLogin     = "oidclogin"     // 第三方登录
+	totpSceneManager       = "manager"       // 后台登录
+
+	// 登录需要两步验证
+	totpStatusNeedVerify = 111
+	// 登录需要先开启两步验证（后台强制开启）
+	totpStatusNeedEnroll = 112
+)
+
+var (
+	// ErrTotpInvalidCode 验证码错误
+	ErrTotpInvalidCode = errors.New("两步验证码错误")
+)
+
+// 登录挑战（密码验证通过后等待两步验证）
+type totpChallenge struct {
+	UID      string     `json:"uid"`
+	Scene    string     `json:"scene"`
+	Flag     int        `json:"flag"`
+	Device   *deviceReq `json:"device,omitempty"`
+	Enroll   int        `json:"enroll"` // 1.需要先开启两步验证
+	Failed   int        `json:"failed"` // 失败次数
+	ExpireAt int64      `json:"expire_at"`
+}
+
+// 两步验证
+type totpService struct {
+	ctx           *config.Context
+	db            *totpDB
+	commonService common2.IService
+	log.Log
+}
+
+func newTotpService(ctx *config.Context) *totpService {
+	return &totpService{
+		ctx:           ctx,
+		db:            newTotpDB(ctx),
+		commonService: common2.NewService(ctx),
+		Log:           log.NewTLog("totpService"),
+	}
+}
+
+// 是否已开启两步验证
+func (t *totpService) enabled(uid string) (bool, error) {
+	m, err := t.db.queryWithUID(uid)
+	if err != nil {
+		return false, err
+	}
+	return m != nil && m.Status == totpStatusEnabled, nil
+}
+
+// 后台管理员是否必须开启两步验证
+func (t *totpService) adminRequired() bool {
+	appConfig, err := t.commonService.GetAppConfig()
+	if err != nil {
+		t.Warn("查询应用配置失败！", zap.Error(err))
+		return false
+	}
+	return appConfig != nil && appConfig.AdminTotpRequired == 1
+}
+
+// setup 生成新的密钥（待确认）
+func (t *totpService) setup(uid string, account string) (string, string, error) {
+	m, err := t.db.queryWithUID(uid)
+	if err != nil {
+		return "", "", err
+	}
+	if m != nil && m.Status == totpStatusEnabled {
+		return "", "", errors.New("已开启两步验证")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err = t.db.insertOrUpdatePending(uid, secret); err != nil {
+		return "", "", err
+	}
+	return secret, totp.ProvisioningURI(t.ctx.GetConfig().AppName, account, secret), nil
+}
+
+// enable 用验证码确认开启 返回恢复码（只返回一次）
+func (t *totpService) enable(uid string, code string) ([]string, error) {
+	m, err := t.db.queryWithUID(uid)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("请先获取两步验证密钥")
+	}
+	if m.Status == totpStatusEnabled {
+		return nil, errors.New("已开启两步验证")
+	}
+	step, ok := totp.Validate(m.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrTotpInvalidCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := t.ctx.DB().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	if err = t.db.enableTx(uid, step, time.Now().Unix(), tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = t.replaceRecoveryTx(uid, hashes, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verify 校验验证码或恢复码
+func (t *totpService) verify(uid string, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, nil
+	}
+	m, err := t.db.queryWithUID(uid)
+	if err != nil {
+		return false, err
+	}
+	if m == nil || m.Status != totpStatusEnabled {
+		return false, nil
+	}
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(m.Secret, code, time.Now(), totpSkew)
+		if !ok || step <= m.LastStep {
+			return false, nil
+		}
+		return t.db.updateLastStep(uid, step)
+	}
+	return t.db.useRecovery(uid, hashRecoveryCode(code), time.Now().Unix())
+}
+
+// regenerateRecovery 重新生成恢复码
+func (t *totpService) regenerateRecovery(uid string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := t.ctx.DB().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	if err = t.replaceRecoveryTx(uid, hashes, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (t *totpService) replaceRecoveryTx(uid string, hashes []string, tx *dbr.Tx) error {
+	if err := t.db.deleteRecoveryTx(uid, tx); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err := t.db.insertRecoveryTx(&totpRecoveryModel{
+			UID:      uid,
+			CodeHash: hash,
+		}, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset 关闭两步验证并清除恢复码
+func (t *totpService) reset(uid string) error {
+	tx, err := t.ctx.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	if err = t.db.deleteTx(uid, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = t.db.deleteRecoveryTx(uid, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// newChallenge 创建登录挑战
+func (t *totpService) newChallenge(challenge *totpChallenge) (string, error) {
+	token := util.GenerUUID()
+	challenge.ExpireAt = time.Now().Add(totpChallengeExpire).Unix()
+	err := t.ctx.GetRedisConn().SetAndExpire(totpChallengePrefix+token, util.ToJson(challenge), totpChallengeExpire)
+	return token, err
+}
+
+func (t *totpService) getChallenge(token string) (*totpChallenge, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := t.ctx.GetRedisConn().GetString(totpChallengePrefix + token)
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+	var challenge *totpChallenge
+	if err = util.ReadJsonByByte([]byte(data), &challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// challengeFailed 记录失败次数 超过次数后挑战失效需要重新登录
+func (t *totpService) challengeFailed(token string, challenge *totpChallenge) {
+	challenge.Failed++
+	var err error
+	expire := time.Until(time.Unix(challenge.ExpireAt, 0))
+	if challenge.Failed >= totpChallengeMaxFailed || expire <= 0 {
+		err = t.ctx.GetRedisConn().Del(totpChallengePrefix + token)
+	} else {
+		err = t.ctx.GetRedisConn().SetAndExpire(totpChallengePrefix+token, util.ToJson(challenge), expire)
+	}
+	if err != nil {
+		t.Warn("更新两步验证挑战失败！", zap.Error(err))
+	}
+}
+
+func (t *totpService) deleteChallenge(token string) {
+	if err := t.ctx.GetRedisConn().Del(totpChallengePrefix + token); err != nil {
+		t.Warn("删除两步验证挑战失败！", zap.Error(err))
+	}
+}
+
+// 返回需要两步验证的响应
+func responseTotpChallenge(c *wkhttp.Context, uid string, token string, enroll bool) {
+	status := totpStatusNeedVerify
+	msg := "需要两步验证！"
+	if enroll {
+		status = totpStatusNeedEnroll
+		msg = "需要先开启两步验证！"
+	}
+	c.ResponseWithStatus(http.StatusBadRequest, map[string]interface{}{
+		"status":    status,
+		"msg":       msg,
+		"uid":       uid,
+		"challenge": token,
+	})
+}
+
+// 生成恢复码 返回明文和hash
+func newRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, 0, totpRecoveryCodeCount)
+	hashes := make([]string, 0, totpRecoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := 0; i < totpRecoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(alphabet[int(b)%len(alphabet)])
+		}
+		code := sb.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// ---------- 用户接口 ----------
+
+// 两步验证状态
+func (u *User) totpStatus(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	m, err := u.totpService.db.queryWithUID(loginUID)
+	if err != nil {
+		u.Error("查询两步验证信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证信息失败！"))
+		return
+	}
+	enabled := 0
+	enabledAt := int64(0)
+	remaining := 0
+	if m != nil && m.Status == totpStatusEnabled {
+		enabled = 1
+		enabledAt = m.EnabledAt
+		remaining, err = u.totpService.db.queryUnusedRecoveryCount(loginUID)
+		if err != nil {
+			u.Error("查询恢复码数量失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询恢复码数量失败！"))
+			return
+		}
+	}
+	c.Response(map[string]interface{}{
+		"enabled":                  enabled,
+		"enabled_at":               enabledAt,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// 获取两步验证密钥
+func (u *User) totpSetup(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	userInfo, err := u.db.QueryByUID(loginUID)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("用户不存在"))
+		return
+	}
+	secret, uri, err := u.totpService.setup(loginUID, totpAccountName(userInfo))
+	if err != nil {
+		u.Error("生成两步验证密钥失败！", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// 确认开启两步验证
+func (u *User) totpEnable(c *wkhttp.Context) {
+	var req totpCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	codes, err := u.totpService.enable(c.GetLoginUID(), req.Code)
+	if err != nil {
+		if !errors.Is(err, ErrTotpInvalidCode) {
+			u.Error("开启两步验证失败！", zap.Error(err))
+		}
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// 关闭两步验证
+func (u *User) totpDisable(c *wkhttp.Context) {
+	var req totpCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	ok, err := u.totpService.verify(loginUID, req.Code)
+	if err != nil {
+		u.Error("校验两步验证码失败！", zap.Error(err))
+		c.ResponseError(errors.New("校验两步验证码失败！"))
+		return
+	}
+	if !ok {
+		c.ResponseError(ErrTotpInvalidCode)
+		return
+	}
+	if err = u.totpService.reset(loginUID); err != nil {
+		u.Error("关闭两步验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("关闭两步验证失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 重新生成恢复码
+func (u *User) totpRecoveryCodes(c *wkhttp.Context) {
+	var req totpCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	ok, err := u.totpService.verify(loginUID, req.Code)
+	if err != nil {
+		u.Error("校验两步验证码失败！", zap.Error(err))
+		c.ResponseError(errors.New("校验两步验证码失败！"))
+		return
+	}
+	if !ok {
+		c.ResponseError(ErrTotpInvalidCode)
+		return
+	}
+	codes, err := u.totpService.regenerateRecovery(loginUID)
+	if err != nil {
+		u.Error("生成恢复码失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成恢复码失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// 登录时的两步验证
+func (u *User) loginTotp(c *wkhttp.Context) {
+	var req totpLoginReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if req.Challenge == "" || strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	challenge, err := u.totpService.getChallenge(req.Challenge)
+	if err != nil {
+		u.Error("查询两步验证挑战失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证挑战失败！"))
+		return
+	}
+	if challenge == nil || (challenge.Scene != totpSceneLogin && challenge.Scene != totpSceneUsernameLogin && challenge.Scene != totpSceneOIDCLogin) {
+		c.ResponseError(errors.New("验证已过期，请重新登录"))
+		return
+	}
+	subject := limitSubject{Account: challenge.UID, IP: util.GetClientPublicIP(c.Request), UID: challenge.UID}
+	if err = u.limiter.check(limitActionTotp, subject, "", ""); err != nil {
+		responseLimitError(c, err)
+		return
+	}
+	ok, err := u.totpService.verify(challenge.UID, req.Code)
+	if err != nil {
+		u.Error("校验两步验证码失败！", zap.Error(err))
+		c.ResponseError(errors.New("校验两步验证码失败！"))
+		return
+	}
+	if !ok {
+		u.limiter.hit(limitActionTotp, subject)
+		u.totpService.challengeFailed(req.Challenge, challenge)
+		c.ResponseError(ErrTotpInvalidCode)
+		return
+	}
+	u.limiter.reset(limitActionTotp, subject)
+	u.totpService.deleteChallenge(req.Challenge)
+
+	userInfo, err := u.db.QueryByUID(challenge.UID)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		c.ResponseError(errors.New("用户不存在"))
+		return
+	}
+	loginSpan := u.ctx.Tracer().StartSpan(
+		"loginTotp",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	loginSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), loginSpan)
+	defer loginSpan.Finish()
+
+	if challenge.Scene == totpSceneUsernameLogin {
+		u.usernameLoginRespose(userInfo, config.DeviceFlag(challenge.Flag), challenge.Device, loginSpanCtx, c)
+		return
+	}
+	u.execLoginAndRespose(userInfo, config.DeviceFlag(challenge.Flag), challenge.Device, loginSpanCtx, c)
+}
+
+// 密码验证通过后检查是否需要两步验证 需要时返回挑战并返回true
+func (u *User) needTotpChallenge(userInfo *Model, scene string, flag int, device *deviceReq, c *wkhttp.Context) bool {
+	token, err := u.newTotpChallenge(userInfo, scene, flag, device)
+	if err != nil {
+		c.ResponseError(err)
+		return true
+	}
+	if token == "" {
+		return false
+	}
+	responseTotpChallenge(c, userInfo.UID, token, false)
+	return true
+}
+
+// 用户开启了两步验证时创建登录挑战 未开启时返回空
+func (u *User) newTotpChallenge(userInfo *Model, scene string, flag int, device *deviceReq) (string, error) {
+	enabled, err := u.totpService.enabled(userInfo.UID)
+	if err != nil {
+		u.Error("查询两步验证信息失败！", zap.Error(err))
+		return "", errors.New("查询两步验证信息失败！")
+	}
+	if !enabled {
+		return "", nil
+	}
+	token, err := u.totpService.newChallenge(&totpChallenge{
+		UID:    userInfo.UID,
+		Scene:  scene,
+		Flag:   flag,
+		Device: device,
+	})
+	if err != nil {
+		u.Error("创建两步验证挑战失败！", zap.Error(err))
+		return "", errors.New("创建两步验证挑战失败！")
+	}
+	return token, nil
+}
+
+func totpAccountName(m *Model) string {
+	if m.Username != "" {
+		return m.Username
+	}
+	if m.Phone != "" {
+		return fmt.Sprintf("%s%s", m.Zone, m.Phone)
+	}
+	return m.UID
+}
+
+type totpCodeReq struct {
+	Code string `json:"code"` // 两步验证码或恢复码
+}
+
+type totpLoginReq struct {
+	Challenge string `json:"challenge"` // 登录挑战
+	Code      string `json:"code"`      // 两步验证码或恢复码
+}
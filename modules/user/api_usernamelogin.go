@@ -40,6 +40,10 @@ func (u *User) usernameRegister(c *wkhttp.Context) {
 		c.ResponseError(errors.New("用户名必须在8-22位"))
 		return
 	}
+	if err := u.passwordService.check(req.Password); err != nil {
+		c.ResponseError(err)
+		return
+	}
 	userInfo, err := u.db.QueryByUsername(req.Username)
 	if err != nil {
 		u.Error("查询用户信息失败！", zap.String("username", req.Username))
@@ -65,7 +69,8 @@ func (u *User) usernameLogin(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	if len(req.Username) < 8 || len(req.Username) > 22 {
+	ldapConfig := u.ldapService.enabledConfig()
+	if ldapConfig == nil && (len(req.Username) < 8 || len(req.Username) > 22) { // 目录用户名不受长度限制
 		c.ResponseError(errors.New("用户名必须在8-22位"))
 		return
 	}
@@ -77,23 +82,59 @@ func (u *User) usernameLogin(c *wkhttp.Context) {
 	loginSpan.SetTag("username", req.Username)
 	defer loginSpan.Finish()
 
+	subject := limitSubject{Account: req.Username, IP: util.GetClientPublicIP(c.Request), Device: deviceIDOf(req.Device)}
+	if err := u.limiter.check(limitActionPassword, subject, req.CaptchaID, req.CaptchaCode); err != nil {
+		responseLimitError(c, err)
+		return
+	}
+
 	userInfo, err := u.db.QueryByUsernameCxt(loginSpanCtx, req.Username)
 	if err != nil {
 		u.Error("查询用户信息失败！", zap.String("username", req.Username))
 		c.ResponseError(err)
 		return
 	}
+	if userInfo != nil {
+		subject.UID = userInfo.UID
+	}
+	// 开启LDAP后，目录用户和本地不存在的用户通过目录认证
+	if ldapConfig != nil {
+		ldapUser := userInfo == nil
+		if userInfo != nil {
+			identityM, err := u.identityDB.queryWithUIDAndProvider(userInfo.UID, ldapProvider)
+			if err != nil {
+				u.Error("查询目录身份失败！", zap.Error(err))
+				c.ResponseError(errors.New("查询目录身份失败！"))
+				return
+			}
+			ldapUser = identityM != nil
+		}
+		if ldapUser {
+			u.ldapUsernameLogin(ldapConfig, userInfo, req, subject, loginSpanCtx, c)
+			return
+		}
+	}
 	if userInfo == nil {
+		u.limiter.hit(limitActionPassword, subject)
 		c.ResponseError(errors.New("该用户名不存在"))
 		return
 	}
 
-	if util.MD5(util.MD5(req.Password)) != userInfo.Password {
+	if !u.passwordService.verify(userInfo.UID, req.Password, userInfo.Password) {
+		u.limiter.hit(limitActionPassword, subject)
 		c.ResponseError(errors.New("密码不正确！"))
 		return
 	}
+	u.limiter.reset(limitActionPassword, subject)
+	if u.needTotpChallenge(userInfo, totpSceneUsernameLogin, req.Flag, req.Device, c) {
+		return
+	}
+	u.usernameLoginRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
+}
 
-	result, err := u.execLogin(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx)
+// 用户名登录成功后的响应
+func (u *User) usernameLoginRespose(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context, c *wkhttp.Context) {
+	result, err := u.execLogin(userInfo, flag, device, newSessionClient(c), loginSpanCtx)
 	if err != nil {
 		c.ResponseError(err)
 		return
@@ -186,6 +227,10 @@ func (u *User) resetPwdWithWeb3PublicKey(c *wkhttp.Context) {
 		c.ResponseError(errors.New("密码不能为空"))
 		return
 	}
+	if err := u.passwordService.check(req.Password); err != nil {
+		c.ResponseError(err)
+		return
+	}
 	if req.VerifyText == "" {
 		c.ResponseError(errors.New("校验字符不能为空"))
 		return
@@ -231,8 +276,14 @@ func (u *User) resetPwdWithWeb3PublicKey(c *wkhttp.Context) {
 		return
 	}
 
+	pwdHash, err := u.passwordService.hash(req.Password)
+	if err != nil {
+		u.Error("生成密码hash失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改用户密码错误"))
+		return
+	}
 	updateMap := map[string]interface{}{}
-	updateMap["password"] = util.MD5(util.MD5(req.Password))
+	updateMap["password"] = pwdHash
 	err = u.db.updateUser(updateMap, user.UID)
 	if err != nil {
 		u.Error("修改用户密码错误", zap.Error(err))
@@ -459,12 +510,16 @@ func (u *User) updatePwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该用户不存在"))
 		return
 	}
-	oldPwd := util.MD5(util.MD5(req.Password))
-	if oldPwd != userInfo.Password {
+	if !u.passwordService.verify("", req.Password, userInfo.Password) {
 		c.ResponseError(errors.New("旧密码错误"))
 		return
 	}
-	err = u.db.UpdateUsersWithField("password", util.MD5(util.MD5(req.NewPassword)), userInfo.UID)
+	pwdHash, err := u.passwordService.checkAndHash(req.NewPassword)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = u.db.UpdateUsersWithField("password", pwdHash, userInfo.UID)
 	if err != nil {
 		u.Error("修改登录密码错误", zap.Error(err))
 		c.ResponseError(errors.New("修改登录密码错误"))
@@ -0,0 +1,164 @@
+package user
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	captchaCachePrefix = "captcha:"
+	captchaExpire      = time.Minute * 5
+	captchaLength      = 4
+	captchaChars       = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+	captchaWidth       = 120
+	captchaHeight      = 40
+)
+
+// 图形验证码
+type captchaService struct {
+	ctx *config.Context
+	log.Log
+}
+
+func newCaptchaService(ctx *config.Context) *captchaService {
+	return &captchaService{
+		ctx: ctx,
+		Log: log.NewTLog("captcha"),
+	}
+}
+
+// generate 生成验证码 返回验证码ID和png图片（data url）
+func (s *captchaService) generate() (string, string, error) {
+	code := make([]byte, captchaLength)
+	for i := range code {
+		code[i] = captchaChars[randInt(len(captchaChars))]
+	}
+	img, err := renderCaptchaPNG(string(code))
+	if err != nil {
+		return "", "", err
+	}
+	id := util.GenerUUID()
+	err = s.ctx.GetRedisConn().SetAndExpire(captchaCachePrefix+id, string(code), captchaExpire)
+	if err != nil {
+		return "", "", err
+	}
+	return id, img, nil
+}
+
+// verify 校验验证码（一次有效）
+func (s *captchaService) verify(id string, code string) bool {
+	if id == "" || code == "" {
+		return false
+	}
+	key := captchaCachePrefix + id
+	expected, err := s.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		s.Warn("获取图形验证码失败！", zap.Error(err))
+		return false
+	}
+	if expected == "" {
+		return false
+	}
+	if err = s.ctx.GetRedisConn().Del(key); err != nil {
+		s.Warn("删除图形验证码失败！", zap.Error(err))
+	}
+	return strings.EqualFold(expected, strings.TrimSpace(code))
+}
+
+// renderCaptchaPNG 将验证码绘制为png图片 字符按点阵放大、随机偏移和倾斜，图片中不包含可直接读取的文字
+func renderCaptchaPNG(code string) (string, error) {
+	img := image.NewRGBA(image.Rect(0, 0, captchaWidth, captchaHeight))
+	for y := 0; y < captchaHeight; y++ {
+		for x := 0; x < captchaWidth; x++ {
+			img.Set(x, y, color.RGBA{0xf4, 0xf6, 0xf8, 0xff})
+		}
+	}
+	for i := 0; i < 4; i++ { // 干扰线
+		drawCaptchaCurve(img, randInt(20), randInt(captchaHeight), randInt(captchaWidth), randInt(captchaHeight), captchaWidth-randInt(20), randInt(captchaHeight), randColor())
+	}
+	face := basicfont.Face7x13
+	glyphWidth, glyphHeight := face.Advance, face.Height
+	step := captchaWidth / (len(code) + 1)
+	for i, c := range code {
+		glyph := image.NewAlpha(image.Rect(0, 0, glyphWidth, glyphHeight))
+		drawer := &font.Drawer{Dst: glyph, Src: image.Opaque, Face: face, Dot: fixed.P(0, face.Ascent)}
+		drawer.DrawString(string(c))
+
+		scale := 2 + randInt(2)
+		shear := float64(randInt(7)-3) / 10
+		x0 := step*(i+1) - glyphWidth*scale/2 + randInt(5) - 2
+		y0 := (captchaHeight-glyphHeight*scale)/2 + randInt(5) - 2
+		fill := randColor()
+		for y := 0; y < glyphHeight*scale; y++ {
+			offset := int(shear * float64(y-glyphHeight*scale/2))
+			for x := 0; x < glyphWidth*scale; x++ {
+				if glyph.AlphaAt(x/scale, y/scale).A == 0 {
+					continue
+				}
+				img.Set(x0+x+offset, y0+y, fill)
+			}
+		}
+	}
+	for i := 0; i < 30; i++ { // 干扰点
+		img.Set(randInt(captchaWidth), randInt(captchaHeight), randColor())
+	}
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buff.Bytes()), nil
+}
+
+// drawCaptchaCurve 绘制二次贝塞尔曲线
+func drawCaptchaCurve(img *image.RGBA, x0, y0, x1, y1, x2, y2 int, c color.Color) {
+	const steps = 200
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / steps
+		x := (1-t)*(1-t)*float64(x0) + 2*(1-t)*t*float64(x1) + t*t*float64(x2)
+		y := (1-t)*(1-t)*float64(y0) + 2*(1-t)*t*float64(y1) + t*t*float64(y2)
+		img.Set(int(x), int(y), c)
+	}
+}
+
+func randInt(max int) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0
+	}
+	return int(n.Int64())
+}
+
+func randColor() color.RGBA {
+	return color.RGBA{uint8(40 + randInt(120)), uint8(40 + randInt(120)), uint8(40 + randInt(120)), 0xff}
+}
+
+// 获取图形验证码
+func (u *User) getCaptcha(c *wkhttp.Context) {
+	id, image, err := u.limiter.captcha.generate()
+	if err != nil {
+		u.Error("生成图形验证码失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成图形验证码失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"captcha_id": id,
+		"image":      image,
+	})
+}
@@ -2,10 +2,13 @@ package user
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/go-sql-driver/mysql"
 	"github.com/gocraft/dbr/v2"
 )
 
@@ -30,10 +33,10 @@ func (d *DB) QueryByKeyword(keyword string) (*Model, error) {
 	return model, err
 }
 
-// QueryByUsername 通过用户名查询用户信息
+// QueryByUsername 通过用户名查询用户信息（邮箱以小写存储）
 func (d *DB) QueryByUsername(username string) (*Model, error) {
 	var model *Model
-	_, err := d.session.Select("*").From("user").Where("username=? or concat(zone,phone)=? or email=?", username, username, username).Load(&model)
+	_, err := d.session.Select("*").From("user").Where("username=? or concat(zone,phone)=? or (email=? and email_verified=1)", username, username, strings.ToLower(strings.TrimSpace(username))).Load(&model)
 	return model, err
 }
 
@@ -51,6 +54,31 @@ func (d *DB) QueryByUsernameCxt(ctx context.Context, username string) (*Model, e
 	return d.QueryByUsername(username)
 }
 
+// queryByVerifiedEmail 通过已验证的邮箱查询用户信息
+func (d *DB) queryByVerifiedEmail(email string) (*Model, error) {
+	var model *Model
+	_, err := d.session.Select("*").From("user").Where("email=? and email_verified=1", strings.ToLower(email)).Load(&model)
+	return model, err
+}
+
+// updateEmail 更新用户邮箱（已验证） 邮箱已被其他账号验证时返回errEmailExist
+func (d *DB) updateEmail(uid string, email string) error {
+	_, err := d.session.Update("user").SetMap(map[string]interface{}{
+		"email":          email,
+		"email_verified": 1,
+	}).Where("uid=?", uid).Exec()
+	if isDuplicateErr(err) {
+		return errEmailExist
+	}
+	return err
+}
+
+// 是否违反唯一索引
+func isDuplicateErr(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
 // QueryByPhone 通过手机号和区号查询用户信息
 func (d *DB) QueryByPhone(zone string, phone string) (*Model, error) {
 	var model *Model
@@ -216,9 +244,10 @@ func (d *DB) updatePassword(password string, uid string) error {
 // 注销账户
 func (d *DB) destroyAccount(uid, username, phone string) error {
 	_, err := d.session.Update("user").SetMap(map[string]interface{}{
-		"phone":      phone,
-		"username":   username,
-		"is_destroy": 1,
+		"phone":          phone,
+		"username":       username,
+		"email_verified": 0,
+		"is_destroy":     1,
 	}).Where("uid=?", uid).Exec()
 	return err
 }
@@ -237,20 +266,6 @@ func (d *DB) queryWithWXOpenIDAndWxUnionid(wxOpenid, wxUnionid string) (*Model,
 }
 
 // 通过gitee uid查询用户
-func (d *DB) queryWithGiteeUID(giteeUID string) (*Model, error) {
-
-	var model *Model
-	_, err := d.session.Select("*").From("user").Where("gitee_uid=?", giteeUID).Load(&model)
-	return model, err
-}
-
-// 通过github uid查询用户
-func (d *DB) queryWithGithubUID(githubUID string) (*Model, error) {
-	var model *Model
-	_, err := d.session.Select("*").From("user").Where("github_uid=?", githubUID).Load(&model)
-	return model, err
-}
-
 func (d *DB) updateUserMsgExpireSecond(uid string, msgExpireSecond int64) error {
 	_, err := d.session.Update("user").Set("msg_expire_second", msgExpireSecond).Where("uid=?", uid).Exec()
 	return err
@@ -314,6 +329,7 @@ type Model struct {
 	Name              string // 用户名称
 	Username          string // 用户名
 	Email             string // email地址
+	EmailVerified     int    // email是否已验证 0.否 1.是
 	Password          string // 用户密码
 	Category          string //用户分类
 	Sex               int    //性别
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// 第三方登录身份
+type identityDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newIdentityDB(ctx *config.Context) *identityDB {
+	return &identityDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (d *identityDB) insert(m *identityModel) error {
+	_, err := d.session.InsertInto("user_identity").Columns("provider", "subject", "uid", "name", "avatar", "email", "last_login_at").Record(m).Exec()
+	return err
+}
+
+func (d *identityDB) insertTx(m *identityModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("user_identity").Columns("provider", "subject", "uid", "name", "avatar", "email", "last_login_at").Record(m).Exec()
+	return err
+}
+
+func (d *identityDB) queryWithSubject(provider string, subject string) (*identityModel, error) {
+	var m *identityModel
+	_, err := d.session.Select("*").From("user_identity").Where("provider=? and subject=?", provider, subject).Load(&m)
+	return m, err
+}
+
+func (d *identityDB) queryWithUIDAndProvider(uid string, provider string) (*identityModel, error) {
+	var m *identityModel
+	_, err := d.session.Select("*").From("user_identity").Where("uid=? and provider=?", uid, provider).Load(&m)
+	return m, err
+}
+
+func (d *identityDB) queryWithUID(uid string) ([]*identityModel, error) {
+	var models []*identityModel
+	_, err := d.session.Select("*").From("user_identity").Where("uid=?", uid).OrderDir("created_at", true).Load(&models)
+	return models, err
+}
+
+func (d *identityDB) queryWithUIDs(uids []string) ([]*identityModel, error) {
+	var models []*identityModel
+	if len(uids) == 0 {
+		return models, nil
+	}
+	_, err := d.session.Select("*").From("user_identity").Where("uid in ?", uids).OrderDir("created_at", true).Load(&models)
+	return models, err
+}
+
+func (d *identityDB) queryWithProvider(provider string) ([]*identityModel, error) {
+	var models []*identityModel
+	_, err := d.session.Select("*").From("user_identity").Where("provider=?", provider).Load(&models)
+	return models, err
+}
+
+// 登录时同步提供方最新的用户资料
+func (d *identityDB) updateLogin(m *identityModel) error {
+	_, err := d.session.Update("user_identity").SetMap(map[string]interface{}{
+		"name":          m.Name,
+		"avatar":        m.Avatar,
+		"email":         m.Email,
+		"last_login_at": m.LastLoginAt,
+	}).Where("id=?", m.Id).Exec()
+	return err
+}
+
+func (d *identityDB) delete(uid string, provider string) error {
+	_, err := d.session.DeleteFrom("user_identity").Where("uid=? and provider=?", uid, provider).Exec()
+	return err
+}
+
+type identityModel struct {
+	Provider    string
+	Subject     string
+	UID         string
+	Name        string
+	Avatar      string
+	Email       string
+	LastLoginAt int64
+	db.BaseModel
+}
+
+// 身份提供方配置
+type oidcProviderDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newOIDCProviderDB(ctx *config.Context) *oidcProviderDB {
+	return &oidcProviderDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (d *oidcProviderDB) insert(m *oidcProviderModel) error {
+	_, err := d.session.InsertInto("user_oidc_provider").Columns("provider", "name", "issuer", "auth_url", "token_url", "userinfo_url", "client_id", "client_secret", "scopes", "pkce", "userinfo_token_query", "subject_claim", "name_claim", "avatar_claim", "email_claim", "trust_email", "status").Record(m).Exec()
+	return err
+}
+
+func (d *oidcProviderDB) update(m *oidcProviderModel) error {
+	_, err := d.session.Update("user_oidc_provider").SetMap(map[string]interface{}{
+		"name":                 m.Name,
+		"issuer":               m.Issuer,
+		"auth_url":             m.AuthURL,
+		"token_url":            m.TokenURL,
+		"userinfo_url":         m.UserinfoURL,
+		"client_id":            m.ClientID,
+		"client_secret":        m.ClientSecret,
+		"scopes":               m.Scopes,
+		"pkce":                 m.PKCE,
+		"userinfo_token_query": m.UserinfoTokenQuery,
+		"subject_claim":        m.SubjectClaim,
+		"name_claim":           m.NameClaim,
+		"avatar_claim":         m.AvatarClaim,
+		"email_claim":          m.EmailClaim,
+		"trust_email":          m.TrustEmail,
+		"status":               m.Status,
+	}).Where("provider=?", m.Provider).Exec()
+	return err
+}
+
+func (d *oidcProviderDB) delete(provider string) error {
+	_, err := d.session.DeleteFrom("user_oidc_provider").Where("provider=?", provider).Exec()
+	return err
+}
+
+func (d *oidcProviderDB) queryWithProvider(provider string) (*oidcProviderModel, error) {
+	var m *oidcProviderModel
+	_, err := d.session.Select("*").From("user_oidc_provider").Where("provider=?", provider).Load(&m)
+	return m, err
+}
+
+func (d *oidcProviderDB) queryAll() ([]*oidcProviderModel, error) {
+	var models []*oidcProviderModel
+	_, err := d.session.Select("*").From("user_oidc_provider").OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+type oidcProviderModel struct {
+	Provider           string
+	Name               string
+	Issuer             string
+	AuthURL            string
+	TokenURL           string
+	UserinfoURL        string
+	ClientID           string
+	ClientSecret       string
+	Scopes             string
+	PKCE               int
+	UserinfoTokenQuery int
+	SubjectClaim       string
+	NameClaim          string
+	AvatarClaim        string
+	EmailClaim         string
+	TrustEmail         int
+	Status             int
+	db.BaseModel
+}
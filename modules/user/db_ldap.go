@@ -0,0 +1,102 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// LDAP目录配置
+type ldapDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newLDAPDB(ctx *config.Context) *ldapDB {
+	return &ldapDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (d *ldapDB) queryConfig() (*ldapConfigModel, error) {
+	var m *ldapConfigModel
+	_, err := d.session.Select("*").From("user_ldap_config").OrderDir("id", true).Limit(1).Load(&m)
+	return m, err
+}
+
+func (d *ldapDB) insertConfig(m *ldapConfigModel) error {
+	_, err := d.session.InsertInto("user_ldap_config").Columns("url", "start_tls", "skip_verify", "bind_dn", "bind_password", "base_dn", "user_filter", "username_attr", "name_attr", "email_attr", "group_attr", "sync_on", "sync_interval", "status").Record(m).Exec()
+	return err
+}
+
+func (d *ldapDB) updateConfig(m *ldapConfigModel) error {
+	_, err := d.session.Update("user_ldap_config").SetMap(map[string]interface{}{
+		"url":           m.URL,
+		"start_tls":     m.StartTLS,
+		"skip_verify":   m.SkipVerify,
+		"bind_dn":       m.BindDN,
+		"bind_password": m.BindPassword,
+		"base_dn":       m.BaseDN,
+		"user_filter":   m.UserFilter,
+		"username_attr": m.UsernameAttr,
+		"name_attr":     m.NameAttr,
+		"email_attr":    m.EmailAttr,
+		"group_attr":    m.GroupAttr,
+		"sync_on":       m.SyncOn,
+		"sync_interval": m.SyncInterval,
+		"status":        m.Status,
+	}).Where("id=?", m.Id).Exec()
+	return err
+}
+
+// 抢占本次同步（多个实例同时运行时只有一个能更新成功）
+func (d *ldapDB) updateLastSyncAt(id int64, oldLastSyncAt int64, lastSyncAt int64) (bool, error) {
+	result, err := d.session.Update("user_ldap_config").Set("last_sync_at", lastSyncAt).Where("id=? and last_sync_at=?", id, oldLastSyncAt).Exec()
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+func (d *ldapDB) insertGroup(m *ldapGroupModel) error {
+	_, err := d.session.InsertInto("user_ldap_group").Columns("group_dn", "group_no").Record(m).Exec()
+	return err
+}
+
+func (d *ldapDB) deleteGroup(id int64) error {
+	_, err := d.session.DeleteFrom("user_ldap_group").Where("id=?", id).Exec()
+	return err
+}
+
+func (d *ldapDB) queryGroups() ([]*ldapGroupModel, error) {
+	var models []*ldapGroupModel
+	_, err := d.session.Select("*").From("user_ldap_group").OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+type ldapConfigModel struct {
+	URL          string
+	StartTLS     int
+	SkipVerify   int
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string
+	UsernameAttr string
+	NameAttr     string
+	EmailAttr    string
+	GroupAttr    string
+	SyncOn       int
+	SyncInterval int
+	LastSyncAt   int64
+	Status       int
+	db.BaseModel
+}
+
+type ldapGroupModel struct {
+	GroupDN string
+	GroupNo string
+	db.BaseModel
+}
@@ -27,16 +27,44 @@ func (l *LoginLogDB) insert(m *LoginLogModel) error {
 // queryLastLoginIP 查询最后一次登录日志
 func (l *LoginLogDB) queryLastLoginIP(uid string) (*LoginLogModel, error) {
 	var model *LoginLogModel
-	_, err := l.session.Select("*").From("login_log").Where("uid=?", uid).OrderDir("created_at", false).Limit(1).Load(&model)
+	_, err := l.session.Select("*").From("login_log").Where("uid=? and type=?", uid, loginLogTypeLogin).OrderDir("created_at", false).Limit(1).Load(&model)
 	if err != nil {
 		return nil, err
 	}
 	return model, nil
 }
 
+// queryWithTypes 按类型分页查询日志
+func (l *LoginLogDB) queryWithTypes(types []int, keyword string, pageIndex, pageSize uint64) ([]*LoginLogModel, error) {
+	var models []*LoginLogModel
+	builder := l.session.Select("*").From("login_log").Where("type in ?", types)
+	if keyword != "" {
+		builder = builder.Where("uid=? or account=? or login_ip=?", keyword, keyword, keyword)
+	}
+	_, err := builder.OrderDir("id", false).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryCountWithTypes 按类型查询日志数量
+func (l *LoginLogDB) queryCountWithTypes(types []int, keyword string) (int64, error) {
+	var count int64
+	builder := l.session.Select("count(*)").From("login_log").Where("type in ?", types)
+	if keyword != "" {
+		builder = builder.Where("uid=? or account=? or login_ip=?", keyword, keyword, keyword)
+	}
+	_, err := builder.Load(&count)
+	return count, err
+}
+
 // LoginLogModel 登录日志
 type LoginLogModel struct {
-	LoginIP string //登录IP
-	UID     string
+	LoginIP  string //登录IP
+	UID      string
+	Type     int    // 类型 0.登录 1.锁定 2.解除锁定
+	Action   string // 触发锁定的行为
+	Account  string // 被锁定的账号/IP/设备
+	DeviceID string
+	Reason   string // 原因
+	ExpireAt int64  // 锁定到期时间
 	db.BaseModel
 }
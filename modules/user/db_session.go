@@ -0,0 +1,138 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type sessionDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newSessionDB(ctx *config.Context) *sessionDB {
+	return &sessionDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+// 添加会话（每次签发token对应一个会话）
+func (d *sessionDB) insert(m *sessionModel) error {
+	_, err := d.session.InsertInto("user_session").Columns("session_id", "family_id", "uid", "token_hash", "device_flag", "device_id", "device_name", "device_model", "login_ip", "user_agent", "login_at", "last_seen_at", "last_seen_ip", "im_sync").Record(m).Exec()
+	return err
+}
+
+func (d *sessionDB) insertTx(m *sessionModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("user_session").Columns("session_id", "family_id", "uid", "token_hash", "device_flag", "device_id", "device_name", "device_model", "login_ip", "user_agent", "login_at", "last_seen_at", "last_seen_ip", "im_sync").Record(m).Exec()
+	return err
+}
+
+func (d *sessionDB) queryWithTokenHash(tokenHash string) (*sessionModel, error) {
+	var m *sessionModel
+	_, err := d.session.Select("*").From("user_session").Where("token_hash=?", tokenHash).Load(&m)
+	return m, err
+}
+
+func (d *sessionDB) queryWithSessionID(sessionID string) (*sessionModel, error) {
+	var m *sessionModel
+	_, err := d.session.Select("*").From("user_session").Where("session_id=?", sessionID).Load(&m)
+	return m, err
+}
+
+// 查询用户未注销且未过期的会话
+func (d *sessionDB) queryActiveWithUID(uid string, loginAfter int64) ([]*sessionModel, error) {
+	var models []*sessionModel
+	_, err := d.session.Select("*").From("user_session").Where("uid=? and revoked=0 and login_at>?", uid, loginAfter).OrderDir("last_seen_at", false).Load(&models)
+	return models, err
+}
+
+// 更新最后活跃时间
+func (d *sessionDB) updateLastSeen(tokenHash string, lastSeenAt int64, lastSeenIP string) error {
+	_, err := d.session.Update("user_session").SetMap(map[string]interface{}{
+		"last_seen_at": lastSeenAt,
+		"last_seen_ip": lastSeenIP,
+	}).Where("token_hash=? and revoked=0", tokenHash).Exec()
+	return err
+}
+
+// 查询会话族中未注销的会话
+func (d *sessionDB) queryActiveWithFamilyID(familyID string) ([]*sessionModel, error) {
+	var models []*sessionModel
+	_, err := d.session.Select("*").From("user_session").Where("family_id=? and revoked=0", familyID).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+func (d *sessionDB) revoke(tokenHash string, revokedAt int64) error {
+	_, err := d.session.Update("user_session").SetMap(map[string]interface{}{
+		"revoked":    1,
+		"revoked_at": revokedAt,
+	}).Where("token_hash=? and revoked=0", tokenHash).Exec()
+	return err
+}
+
+func (d *sessionDB) insertRefreshToken(m *refreshTokenModel) error {
+	_, err := d.session.InsertInto("user_refresh_token").Columns("token_hash", "family_id", "uid", "status", "expire_at").Record(m).Exec()
+	return err
+}
+
+func (d *sessionDB) insertRefreshTokenTx(m *refreshTokenModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("user_refresh_token").Columns("token_hash", "family_id", "uid", "status", "expire_at").Record(m).Exec()
+	return err
+}
+
+func (d *sessionDB) queryRefreshToken(tokenHash string) (*refreshTokenModel, error) {
+	var m *refreshTokenModel
+	_, err := d.session.Select("*").From("user_refresh_token").Where("token_hash=?", tokenHash).Load(&m)
+	return m, err
+}
+
+// 使用刷新令牌 只有可用状态才能使用成功（并发刷新时只有一个能成功）
+func (d *sessionDB) useRefreshTokenTx(tokenHash string, usedAt int64, tx *dbr.Tx) (bool, error) {
+	result, err := tx.Update("user_refresh_token").SetMap(map[string]interface{}{
+		"status":  refreshTokenStatusUsed,
+		"used_at": usedAt,
+	}).Where("token_hash=? and status=?", tokenHash, refreshTokenStatusValid).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// 注销会话族下所有可用的刷新令牌
+func (d *sessionDB) revokeRefreshTokens(familyID string) error {
+	_, err := d.session.Update("user_refresh_token").Set("status", refreshTokenStatusRevoked).Where("family_id=? and status=?", familyID, refreshTokenStatusValid).Exec()
+	return err
+}
+
+type sessionModel struct {
+	SessionID   string
+	FamilyID    string
+	UID         string
+	TokenHash   string
+	DeviceFlag  int
+	DeviceID    string
+	DeviceName  string
+	DeviceModel string
+	LoginIP     string
+	UserAgent   string
+	LoginAt     int64
+	LastSeenAt  int64
+	LastSeenIP  string
+	Revoked     int
+	RevokedAt   int64
+	IMSync      int
+	db.BaseModel
+}
+
+type refreshTokenModel struct {
+	TokenHash string
+	FamilyID  string
+	UID       string
+	Status    int
+	ExpireAt  int64
+	UsedAt    int64
+	db.BaseModel
+}
@@ -0,0 +1,111 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type totpDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newTotpDB(ctx *config.Context) *totpDB {
+	return &totpDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (d *totpDB) queryWithUID(uid string) (*totpModel, error) {
+	var m *totpModel
+	_, err := d.session.Select("*").From("user_totp").Where("uid=?", uid).Load(&m)
+	return m, err
+}
+
+// 查询已开启两步验证的用户
+func (d *totpDB) queryEnabledUIDs(uids []string) ([]string, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	var enabledUIDs []string
+	_, err := d.session.Select("uid").From("user_totp").Where("uid in ? and status=?", uids, totpStatusEnabled).Load(&enabledUIDs)
+	return enabledUIDs, err
+}
+
+// 保存待确认的密钥（重新绑定时覆盖）
+func (d *totpDB) insertOrUpdatePending(uid string, secret string) error {
+	_, err := d.session.InsertBySql("insert into user_totp(uid,secret,status,last_step,enabled_at) values(?,?,?,0,0) ON DUPLICATE KEY UPDATE secret=VALUES(secret),status=VALUES(status),last_step=0,enabled_at=0", uid, secret, totpStatusPending).Exec()
+	return err
+}
+
+func (d *totpDB) enableTx(uid string, step int64, enabledAt int64, tx *dbr.Tx) error {
+	_, err := tx.Update("user_totp").SetMap(map[string]interface{}{
+		"status":     totpStatusEnabled,
+		"last_step":  step,
+		"enabled_at": enabledAt,
+	}).Where("uid=? and status=?", uid, totpStatusPending).Exec()
+	return err
+}
+
+// 更新最后使用的时间步 只有大于已使用的时间步才能更新成功（防止同一个验证码被重复使用）
+func (d *totpDB) updateLastStep(uid string, step int64) (bool, error) {
+	result, err := d.session.Update("user_totp").Set("last_step", step).Where("uid=? and last_step<?", uid, step).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (d *totpDB) deleteTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("user_totp").Where("uid=?", uid).Exec()
+	return err
+}
+
+func (d *totpDB) insertRecoveryTx(m *totpRecoveryModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("user_totp_recovery").Columns("uid", "code_hash").Record(m).Exec()
+	return err
+}
+
+func (d *totpDB) deleteRecoveryTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("user_totp_recovery").Where("uid=?", uid).Exec()
+	return err
+}
+
+func (d *totpDB) queryUnusedRecoveryCount(uid string) (int, error) {
+	var count int
+	_, err := d.session.Select("count(*)").From("user_totp_recovery").Where("uid=? and used=0", uid).Load(&count)
+	return count, err
+}
+
+// 使用恢复码 返回是否使用成功
+func (d *totpDB) useRecovery(uid string, codeHash string, usedAt int64) (bool, error) {
+	result, err := d.session.Update("user_totp_recovery").SetMap(map[string]interface{}{
+		"used":    1,
+		"used_at": usedAt,
+	}).Where("uid=? and code_hash=? and used=0", uid, codeHash).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+type totpModel struct {
+	UID       string
+	Secret    string
+	Status    int
+	LastStep  int64
+	EnabledAt int64
+	db.BaseModel
+}
+
+type totpRecoveryModel struct {
+	UID      string
+	CodeHash string
+	Used     int
+	UsedAt   int64
+	db.BaseModel
+}
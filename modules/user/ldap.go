@@ -0,0 +1,192 @@
+package user
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ldapProvider      = "ldap" // 目录用户在user_identity中的提供方标识
+	ldapTimeout       = time.Second * 10
+	ldapPageSize      = 500
+	ldapMinSyncMinute = 5
+)
+
+var (
+	errLDAPUserNotFound       = errors.New("目录中不存在该用户")
+	errLDAPInvalidCredentials = errors.New("目录用户名或密码不正确")
+)
+
+// 目录中的用户
+type ldapEntry struct {
+	DN       string   `json:"dn"`
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Groups   []string `json:"groups"` // 所属组DN（小写）
+}
+
+// subject 目录用户在user_identity中的唯一标识（DN会随部门调整变化，所以使用用户名）
+func (e *ldapEntry) subject() string {
+	return strings.ToLower(e.Username)
+}
+
+func (e *ldapEntry) inGroup(groupDN string) bool {
+	for _, group := range e.Groups {
+		if group == groupDN {
+			return true
+		}
+	}
+	return false
+}
+
+// ldapDirectory LDAP/AD目录
+type ldapDirectory struct {
+	cfg *ldapConfigModel
+}
+
+func newLDAPDirectory(cfg *ldapConfigModel) *ldapDirectory {
+	return &ldapDirectory{
+		cfg: cfg,
+	}
+}
+
+func (l *ldapDirectory) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: l.cfg.SkipVerify == 1}
+	if parsed, err := url.Parse(l.cfg.URL); err == nil {
+		tlsConfig.ServerName = parsed.Hostname()
+	}
+	conn, err := ldap.DialURL(l.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if l.cfg.StartTLS == 1 {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// 使用服务账号绑定（未配置服务账号则匿名查询）
+func (l *ldapDirectory) bindService(conn *ldap.Conn) error {
+	if l.cfg.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(l.cfg.BindDN, l.cfg.BindPassword)
+}
+
+func (l *ldapDirectory) attributes() []string {
+	attributes := []string{defaultString(l.cfg.UsernameAttr, "uid"), defaultString(l.cfg.EmailAttr, "mail"), defaultString(l.cfg.GroupAttr, "memberOf")}
+	for _, name := range strings.Split(defaultString(l.cfg.NameAttr, "displayName,cn"), ",") {
+		attributes = append(attributes, strings.TrimSpace(name))
+	}
+	return attributes
+}
+
+func (l *ldapDirectory) filter(username string) string {
+	return fmt.Sprintf(defaultString(l.cfg.UserFilter, "(uid=%s)"), username)
+}
+
+func (l *ldapDirectory) toEntry(e *ldap.Entry) *ldapEntry {
+	entry := &ldapEntry{
+		DN:       e.DN,
+		Username: e.GetEqualFoldAttributeValue(defaultString(l.cfg.UsernameAttr, "uid")),
+		Email:    strings.ToLower(e.GetEqualFoldAttributeValue(defaultString(l.cfg.EmailAttr, "mail"))),
+	}
+	for _, name := range strings.Split(defaultString(l.cfg.NameAttr, "displayName,cn"), ",") {
+		if entry.Name = e.GetEqualFoldAttributeValue(strings.TrimSpace(name)); entry.Name != "" {
+			break
+		}
+	}
+	for _, group := range e.GetEqualFoldAttributeValues(defaultString(l.cfg.GroupAttr, "memberOf")) {
+		entry.Groups = append(entry.Groups, strings.ToLower(group))
+	}
+	return entry
+}
+
+// authenticate 查找用户后以该用户的DN和密码绑定
+func (l *ldapDirectory) authenticate(username string, password string) (*ldapEntry, error) {
+	if password == "" { // 空密码会被目录当作匿名绑定而成功
+		return nil, errLDAPInvalidCredentials
+	}
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = l.bindService(conn); err != nil {
+		return nil, err
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false, l.filter(ldap.EscapeFilter(username)), l.attributes(), nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, errLDAPUserNotFound
+	}
+	entry := l.toEntry(result.Entries[0])
+	if entry.Username == "" {
+		return nil, errLDAPUserNotFound
+	}
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, errLDAPInvalidCredentials
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// searchUsers 查询目录中的所有用户
+func (l *ldapDirectory) searchUsers() ([]*ldapEntry, error) {
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = l.bindService(conn); err != nil {
+		return nil, err
+	}
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, l.filter("*"), l.attributes(), nil), ldapPageSize)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*ldapEntry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		entry := l.toEntry(e)
+		if entry.Username != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// diffLDAPGroupMembers 计算群需要加入和移除的成员
+// desired为目录组中的用户 current为当前群成员 managed为由目录管理的用户（只移除这些用户，不影响群里的其他成员）
+func diffLDAPGroupMembers(desired map[string]string, current []string, managed map[string]bool) (adds []string, removes []string) {
+	currentSet := make(map[string]bool, len(current))
+	for _, uid := range current {
+		currentSet[uid] = true
+		if _, ok := desired[uid]; !ok && managed[uid] {
+			removes = append(removes, uid)
+		}
+	}
+	for uid := range desired {
+		if !currentSet[uid] {
+			adds = append(adds, uid)
+		}
+	}
+	sort.Strings(adds)
+	return adds, removes
+}
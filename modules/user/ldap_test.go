@@ -0,0 +1,205 @@
+package user
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试用的LDAP服务（只支持简单绑定和基本的过滤条件）
+type testLDAPServer struct {
+	listener  net.Listener
+	passwords map[string]string // dn -> password
+	entries   []*ldap.Entry
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &testLDAPServer{
+		listener: listener,
+		passwords: map[string]string{
+			"cn=admin,dc=example,dc=com":            "adminpwd",
+			"uid=alice,ou=people,dc=example,dc=com": "alicepwd",
+			"uid=bob,ou=people,dc=example,dc=com":   "bobpwd",
+		},
+		entries: []*ldap.Entry{
+			ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"alice"},
+				"cn":          {"Alice"},
+				"displayName": {"爱丽丝"},
+				"mail":        {"Alice@Example.com"},
+				"memberOf":    {"CN=Dev,OU=Groups,DC=example,DC=com"},
+			}),
+			ldap.NewEntry("uid=bob,ou=people,dc=example,dc=com", map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"bob"},
+				"cn":          {"Bob"},
+			}),
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultSuccess)
+			if dn != "" && (password == "" || s.passwords[dn] != password) {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			s.reply(conn, messageID, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			baseDN := strings.ToLower(op.Children[0].Value.(string))
+			for _, entry := range s.entries {
+				if !strings.HasSuffix(entry.DN, baseDN) || !matchTestFilter(op.Children[6], entry) {
+					continue
+				}
+				result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+				result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+				attributes := ber.NewSequence("Attributes")
+				for _, attr := range entry.Attributes {
+					attribute := ber.NewSequence("Attribute")
+					attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr.Name, "Type"))
+					values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+					for _, value := range attr.Values {
+						values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+					}
+					attribute.AppendChild(values)
+					attributes.AppendChild(attribute)
+				}
+				result.AppendChild(attributes)
+				s.write(conn, messageID, result)
+			}
+			s.reply(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+		default:
+			return
+		}
+	}
+}
+
+func (s *testLDAPServer) reply(conn net.Conn, messageID int64, tag ber.Tag, code uint16) {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	s.write(conn, messageID, result)
+}
+
+func (s *testLDAPServer) write(conn net.Conn, messageID int64, op *ber.Packet) {
+	envelope := ber.NewSequence("LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	envelope.AppendChild(op)
+	_, _ = conn.Write(envelope.Bytes())
+}
+
+func matchTestFilter(filter *ber.Packet, entry *ldap.Entry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchTestFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchTestFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchTestFilter(filter.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		value := filter.Children[1].Data.String()
+		for _, v := range entry.GetEqualFoldAttributeValues(filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(entry.GetEqualFoldAttributeValues(filter.Data.String())) > 0
+	}
+	return false
+}
+
+func TestLDAPDirectory(t *testing.T) {
+	server := newTestLDAPServer(t)
+	directory := newLDAPDirectory(&ldapConfigModel{
+		URL:          server.url(),
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "adminpwd",
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(&(objectClass=person)(uid=%s))",
+	})
+
+	entry, err := directory.authenticate("alice", "alicepwd")
+	assert.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=example,dc=com", entry.DN)
+	assert.Equal(t, "alice", entry.subject())
+	assert.Equal(t, "爱丽丝", entry.Name)
+	assert.Equal(t, "alice@example.com", entry.Email)
+	assert.True(t, entry.inGroup("cn=dev,ou=groups,dc=example,dc=com"))
+
+	_, err = directory.authenticate("alice", "wrong")
+	assert.ErrorIs(t, err, errLDAPInvalidCredentials)
+	_, err = directory.authenticate("alice", "")
+	assert.ErrorIs(t, err, errLDAPInvalidCredentials)
+	_, err = directory.authenticate("carol", "carolpwd")
+	assert.ErrorIs(t, err, errLDAPUserNotFound)
+	// 用户名中的通配符需要转义
+	_, err = directory.authenticate("*", "alicepwd")
+	assert.ErrorIs(t, err, errLDAPUserNotFound)
+
+	entries, err := directory.searchUsers()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "Bob", entries[1].Name)
+
+	directory.cfg.BindPassword = "wrong"
+	_, err = directory.searchUsers()
+	assert.Error(t, err)
+}
+
+func TestDiffLDAPGroupMembers(t *testing.T) {
+	desired := map[string]string{"u1": "A", "u2": "B"}
+	current := []string{"u2", "u3", "u4"}
+	managed := map[string]bool{"u1": true, "u2": true, "u3": true}
+	adds, removes := diffLDAPGroupMembers(desired, current, managed)
+	assert.Equal(t, []string{"u1"}, adds)
+	// u4不是目录用户，不移除
+	assert.Equal(t, []string{"u3"}, removes)
+}
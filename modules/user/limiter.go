@@ -0,0 +1,453 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+// 限制的行为
+type limitAction string
+
+const (
+	limitActionPassword  limitAction = "pwd"        // 登录密码错误
+	limitActionTotp      limitAction = "totp"       // 两步验证码错误
+	limitActionSMSSend   limitAction = "sms_send"   // 发送短信验证码
+	limitActionSMSVerify limitAction = "sms_verify" // 短信验证码错误
+)
+
+// 统计维度
+type limitDimension string
+
+const (
+	limitDimensionAccount limitDimension = "account" // 账号（用户名/手机号/uid）
+	limitDimensionIP      limitDimension = "ip"
+	limitDimensionDevice  limitDimension = "device"
+)
+
+var limitDimensions = []limitDimension{limitDimensionAccount, limitDimensionIP, limitDimensionDevice}
+
+const (
+	limitStatusCaptcha = 113 // 需要图形验证码
+	limitStatusLocked  = 114 // 已锁定或操作过于频繁
+
+	limitCachePrefix = "loginLimit:"
+	limitLocksKey    = limitCachePrefix + "locks" // 当前所有锁定（有序集合，score为解锁时间）
+)
+
+// 限制规则
+type limitRule struct {
+	Window       time.Duration // 统计窗口
+	CaptchaAfter int           // 失败多少次后需要图形验证码 0.不需要
+	DelayAfter   int           // 失败多少次后开始递增等待 0.不等待
+	BaseDelay    time.Duration // 初始等待时间（之后每次翻倍）
+	MaxDelay     time.Duration // 最大等待时间
+	LockAfter    int           // 失败多少次后锁定 0.不锁定
+	LockDuration time.Duration // 锁定时长
+}
+
+var limitRules = map[limitAction]map[limitDimension]*limitRule{
+	limitActionPassword: {
+		limitDimensionAccount: {Window: time.Minute * 15, CaptchaAfter: 3, DelayAfter: 3, BaseDelay: time.Second, MaxDelay: time.Second * 30, LockAfter: 10, LockDuration: time.Minute * 15},
+		limitDimensionIP:      {Window: time.Minute * 15, CaptchaAfter: 10, LockAfter: 50, LockDuration: time.Minute * 30},
+		limitDimensionDevice:  {Window: time.Minute * 15, CaptchaAfter: 5, LockAfter: 20, LockDuration: time.Minute * 30},
+	},
+	limitActionTotp: {
+		limitDimensionAccount: {Window: time.Minute * 15, DelayAfter: 3, BaseDelay: time.Second, MaxDelay: time.Second * 30, LockAfter: 10, LockDuration: time.Minute * 30},
+		limitDimensionIP:      {Window: time.Minute * 15, LockAfter: 50, LockDuration: time.Minute * 30},
+	},
+	limitActionSMSSend: {
+		limitDimensionAccount: {Window: time.Hour, DelayAfter: 1, BaseDelay: time.Minute, MaxDelay: time.Minute * 10, LockAfter: 10, LockDuration: time.Hour},
+		limitDimensionIP:      {Window: time.Hour, LockAfter: 30, LockDuration: time.Hour},
+		limitDimensionDevice:  {Window: time.Hour, LockAfter: 10, LockDuration: time.Hour},
+	},
+	limitActionSMSVerify: {
+		limitDimensionAccount: {Window: time.Minute * 10, LockAfter: 5, LockDuration: time.Minute * 30},
+		limitDimensionIP:      {Window: time.Minute * 10, LockAfter: 30, LockDuration: time.Minute * 30},
+	},
+}
+
+// 限制对象
+type limitSubject struct {
+	Account string
+	IP      string
+	Device  string
+	UID     string // 已知的用户uid（记录登录日志用）
+}
+
+func (s limitSubject) value(dimension limitDimension) string {
+	switch dimension {
+	case limitDimensionAccount:
+		return strings.ToLower(strings.TrimSpace(s.Account))
+	case limitDimensionIP:
+		return s.IP
+	case limitDimensionDevice:
+		return s.Device
+	}
+	return ""
+}
+
+// 被限制时返回的错误
+type limitError struct {
+	status     int
+	msg        string
+	retryAfter int64 // 多少秒后可重试
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+// 返回限制错误（非限制错误按普通错误返回）
+func responseLimitError(c *wkhttp.Context, err error) {
+	var limitErr *limitError
+	if !errors.As(err, &limitErr) {
+		c.ResponseError(err)
+		return
+	}
+	resp := map[string]interface{}{
+		"status":      limitErr.status,
+		"msg":         limitErr.msg,
+		"retry_after": limitErr.retryAfter,
+	}
+	if limitErr.status == limitStatusCaptcha {
+		resp["captcha_required"] = 1
+	}
+	c.ResponseWithStatus(http.StatusBadRequest, resp)
+}
+
+// 登录、短信等接口的防暴力破解
+type loginLimiter struct {
+	ctx        *config.Context
+	loginLogDB *LoginLogDB
+	captcha    *captchaService
+	log.Log
+}
+
+func newLoginLimiter(ctx *config.Context) *loginLimiter {
+	return &loginLimiter{
+		ctx:        ctx,
+		loginLogDB: NewLoginLogDB(ctx.DB()),
+		captcha:    newCaptchaService(ctx),
+		Log:        log.NewTLog("loginLimiter"),
+	}
+}
+
+func limitKey(kind string, action limitAction, dimension limitDimension, value string) string {
+	return fmt.Sprintf("%s%s:%s:%s:%s", limitCachePrefix, kind, action, dimension, value)
+}
+
+// check 请求前检查是否被锁定、是否需要等待、是否需要图形验证码（redis异常时放行）
+func (l *loginLimiter) check(action limitAction, subject limitSubject, captchaID string, captchaCode string) error {
+	rules := limitRules[action]
+	now := time.Now()
+	needCaptcha := false
+	for _, dimension := range limitDimensions {
+		rule := rules[dimension]
+		value := subject.value(dimension)
+		if rule == nil || value == "" {
+			continue
+		}
+		conn := l.ctx.GetRedisConn()
+		lockExpireAt, err := conn.GetString(limitKey("lock", action, dimension, value))
+		if err != nil {
+			l.Warn("查询锁定状态失败！", zap.Error(err))
+			continue
+		}
+		if lockExpireAt != "" {
+			expireAt, _ := strconv.ParseInt(lockExpireAt, 10, 64)
+			if retryAfter := expireAt - now.Unix(); retryAfter > 0 {
+				return &limitError{status: limitStatusLocked, msg: lockedMsg(action, retryAfter), retryAfter: retryAfter}
+			}
+		}
+		countStr, err := conn.GetString(limitKey("fail", action, dimension, value))
+		if err != nil {
+			l.Warn("查询失败次数失败！", zap.Error(err))
+			continue
+		}
+		count, _ := strconv.Atoi(countStr)
+		if count == 0 {
+			continue
+		}
+		if delay := limitDelay(rule, count); delay > 0 {
+			lastStr, err := conn.GetString(limitKey("last", action, dimension, value))
+			if err != nil {
+				l.Warn("查询最后失败时间失败！", zap.Error(err))
+				continue
+			}
+			last, _ := strconv.ParseInt(lastStr, 10, 64)
+			if retryAfter := last + int64(delay/time.Second) - now.Unix(); retryAfter > 0 {
+				return &limitError{status: limitStatusLocked, msg: fmt.Sprintf("操作过于频繁，请%d秒后再试", retryAfter), retryAfter: retryAfter}
+			}
+		}
+		if rule.CaptchaAfter > 0 && count >= rule.CaptchaAfter {
+			needCaptcha = true
+		}
+	}
+	if needCaptcha && !l.captcha.verify(captchaID, captchaCode) {
+		msg := "请输入图形验证码"
+		if captchaID != "" {
+			msg = "图形验证码错误"
+		}
+		return &limitError{status: limitStatusCaptcha, msg: msg}
+	}
+	return nil
+}
+
+// hit 记录一次失败（发送短信时记录一次发送） 达到次数后锁定并记录登录日志
+func (l *loginLimiter) hit(action limitAction, subject limitSubject) {
+	rules := limitRules[action]
+	now := time.Now()
+	for _, dimension := range limitDimensions {
+		rule := rules[dimension]
+		value := subject.value(dimension)
+		if rule == nil || value == "" {
+			continue
+		}
+		conn := l.ctx.GetRedisConn()
+		failKey := limitKey("fail", action, dimension, value)
+		count, err := conn.Incr(failKey)
+		if err != nil {
+			l.Error("记录失败次数失败！", zap.Error(err), zap.String("key", failKey))
+			continue
+		}
+		if count == 1 {
+			if err = conn.Expire(failKey, rule.Window); err != nil {
+				l.Warn("设置失败次数过期时间失败！", zap.Error(err))
+			}
+		}
+		if rule.DelayAfter > 0 {
+			if err = conn.SetAndExpire(limitKey("last", action, dimension, value), now.Unix(), rule.Window); err != nil {
+				l.Warn("记录最后失败时间失败！", zap.Error(err))
+			}
+		}
+		if rule.LockAfter > 0 && int(count) >= rule.LockAfter {
+			l.lock(action, dimension, value, rule, int(count), subject)
+		}
+	}
+}
+
+func (l *loginLimiter) lock(action limitAction, dimension limitDimension, value string, rule *limitRule, count int, subject limitSubject) {
+	conn := l.ctx.GetRedisConn()
+	expireAt := time.Now().Add(rule.LockDuration).Unix()
+	if err := conn.SetAndExpire(limitKey("lock", action, dimension, value), expireAt, rule.LockDuration); err != nil {
+		l.Error("锁定失败！", zap.Error(err))
+		return
+	}
+	if err := conn.ZAdd(limitLocksKey, float64(expireAt), limitLockMember(action, dimension, value)); err != nil {
+		l.Warn("记录锁定列表失败！", zap.Error(err))
+	}
+	_ = conn.Del(limitKey("fail", action, dimension, value))
+	_ = conn.Del(limitKey("last", action, dimension, value))
+
+	reason := fmt.Sprintf("%s%d次，%s[%s]锁定%d分钟", limitActionName(action), count, limitDimensionName(dimension), value, int(rule.LockDuration/time.Minute))
+	l.Warn("触发锁定", zap.String("reason", reason))
+	err := l.loginLogDB.insert(&LoginLogModel{
+		UID:      subject.UID,
+		LoginIP:  subject.IP,
+		Type:     loginLogTypeLock,
+		Action:   string(action),
+		Account:  value,
+		DeviceID: subject.Device,
+		Reason:   reason,
+		ExpireAt: expireAt,
+	})
+	if err != nil {
+		l.Error("添加锁定日志失败！", zap.Error(err))
+	}
+}
+
+// reset 成功后清除账号和设备的失败次数（IP可能被多人共用，不清除）
+func (l *loginLimiter) reset(action limitAction, subject limitSubject) {
+	conn := l.ctx.GetRedisConn()
+	for _, dimension := range []limitDimension{limitDimensionAccount, limitDimensionDevice} {
+		value := subject.value(dimension)
+		if value == "" {
+			continue
+		}
+		_ = conn.Del(limitKey("fail", action, dimension, value))
+		_ = conn.Del(limitKey("last", action, dimension, value))
+	}
+}
+
+// clear 清除某个对象所有行为的锁定和失败次数（后台解除锁定）
+func (l *loginLimiter) clear(dimension limitDimension, value string) error {
+	conn := l.ctx.GetRedisConn()
+	for action := range limitRules {
+		for _, kind := range []string{"lock", "fail", "last"} {
+			if err := conn.Del(limitKey(kind, action, dimension, value)); err != nil {
+				return err
+			}
+		}
+		if err := conn.ZRem(limitLocksKey, limitLockMember(action, dimension, value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func limitLockMember(action limitAction, dimension limitDimension, value string) string {
+	return fmt.Sprintf("%s:%s:%s", action, dimension, value)
+}
+
+// locks 当前所有锁定
+func (l *loginLimiter) locks() ([]*limitLockResp, error) {
+	conn := l.ctx.GetRedisConn()
+	now := time.Now().Unix()
+	nowStr := strconv.FormatInt(now, 10)
+	if err := conn.ZRemRangeByScore(limitLocksKey, "-inf", nowStr); err != nil {
+		return nil, err
+	}
+	members, err := conn.ZRangeByScore(limitLocksKey, redis.ZRangeBy{
+		Min: "(" + nowStr,
+		Max: "+inf",
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*limitLockResp, 0, len(members))
+	for _, member := range members {
+		parts := strings.SplitN(member, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		expireAtStr, err := conn.GetString(limitKey("lock", limitAction(parts[0]), limitDimension(parts[1]), parts[2]))
+		if err != nil {
+			return nil, err
+		}
+		expireAt, _ := strconv.ParseInt(expireAtStr, 10, 64)
+		if expireAt <= now {
+			continue
+		}
+		list = append(list, &limitLockResp{
+			Action:    parts[0],
+			Dimension: parts[1],
+			Value:     parts[2],
+			ExpireAt:  expireAt,
+		})
+	}
+	return list, nil
+}
+
+// 第count次失败后需要等待的时间
+func limitDelay(rule *limitRule, count int) time.Duration {
+	if rule.DelayAfter <= 0 || count < rule.DelayAfter {
+		return 0
+	}
+	delay := rule.BaseDelay
+	for i := rule.DelayAfter; i < count; i++ {
+		delay *= 2
+		if delay >= rule.MaxDelay {
+			return rule.MaxDelay
+		}
+	}
+	if rule.MaxDelay > 0 && delay > rule.MaxDelay {
+		return rule.MaxDelay
+	}
+	return delay
+}
+
+func lockedMsg(action limitAction, retryAfter int64) string {
+	minutes := (retryAfter + 59) / 60
+	switch action {
+	case limitActionSMSSend:
+		return fmt.Sprintf("验证码发送过于频繁，请%d分钟后再试", minutes)
+	case limitActionSMSVerify:
+		return fmt.Sprintf("验证码错误次数过多，请%d分钟后再试", minutes)
+	}
+	return fmt.Sprintf("错误次数过多，账号已被临时锁定，请%d分钟后再试", minutes)
+}
+
+func limitActionName(action limitAction) string {
+	switch action {
+	case limitActionPassword:
+		return "密码错误"
+	case limitActionTotp:
+		return "两步验证码错误"
+	case limitActionSMSSend:
+		return "发送短信"
+	case limitActionSMSVerify:
+		return "短信验证码错误"
+	}
+	return string(action)
+}
+
+func limitDimensionName(dimension limitDimension) string {
+	switch dimension {
+	case limitDimensionAccount:
+		return "账号"
+	case limitDimensionIP:
+		return "IP"
+	case limitDimensionDevice:
+		return "设备"
+	}
+	return string(dimension)
+}
+
+type limitLockResp struct {
+	Action    string `json:"action"`
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+	ExpireAt  int64  `json:"expire_at"`
+}
+
+func isLimitError(err error) bool {
+	var limitErr *limitError
+	return errors.As(err, &limitErr)
+}
+
+func deviceIDOf(device *deviceReq) string {
+	if device == nil {
+		return ""
+	}
+	return device.DeviceID
+}
+
+// 短信的限制对象（手机号+IP）
+func smsLimitSubject(c *wkhttp.Context, zone, phone string) limitSubject {
+	return limitSubject{
+		Account: fmt.Sprintf("%s%s", zone, phone),
+		IP:      util.GetClientPublicIP(c.Request),
+	}
+}
+
+// sendSMSCode 发送短信验证码（限制同一手机号和IP的发送频率）
+func (u *User) sendSMSCode(ctx context.Context, c *wkhttp.Context, zone, phone string, codeType commonapi.CodeType) error {
+	subject := smsLimitSubject(c, zone, phone)
+	if err := u.limiter.check(limitActionSMSSend, subject, "", ""); err != nil {
+		return err
+	}
+	err := u.smsServie.SendVerifyCode(ctx, zone, phone, codeType)
+	if err != nil {
+		return err
+	}
+	u.limiter.hit(limitActionSMSSend, subject)
+	return nil
+}
+
+// verifySMSCode 校验短信验证码（限制错误次数）
+func (u *User) verifySMSCode(ctx context.Context, c *wkhttp.Context, zone, phone, code string, codeType commonapi.CodeType) error {
+	subject := smsLimitSubject(c, zone, phone)
+	if err := u.limiter.check(limitActionSMSVerify, subject, "", ""); err != nil {
+		return err
+	}
+	err := u.smsServie.Verify(ctx, zone, phone, code, codeType)
+	if err != nil {
+		u.limiter.hit(limitActionSMSVerify, subject)
+		return err
+	}
+	u.limiter.reset(limitActionSMSVerify, subject)
+	return nil
+}
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitDelay(t *testing.T) {
+	rule := &limitRule{DelayAfter: 3, BaseDelay: time.Second, MaxDelay: time.Second * 30}
+	assert.Equal(t, time.Duration(0), limitDelay(rule, 2))
+	assert.Equal(t, time.Second, limitDelay(rule, 3))
+	assert.Equal(t, time.Second*2, limitDelay(rule, 4))
+	assert.Equal(t, time.Second*16, limitDelay(rule, 7))
+	assert.Equal(t, time.Second*30, limitDelay(rule, 8))
+	assert.Equal(t, time.Second*30, limitDelay(rule, 100))
+
+	assert.Equal(t, time.Duration(0), limitDelay(&limitRule{LockAfter: 5}, 10))
+}
+
+func TestLimitSubjectValue(t *testing.T) {
+	subject := limitSubject{Account: " Test@Example.com ", IP: "1.2.3.4"}
+	assert.Equal(t, "test@example.com", subject.value(limitDimensionAccount))
+	assert.Equal(t, "1.2.3.4", subject.value(limitDimensionIP))
+	assert.Equal(t, "", subject.value(limitDimensionDevice))
+}
+
+func TestRenderCaptchaPNG(t *testing.T) {
+	data, err := renderCaptchaPNG("AB34")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(data, "data:image/png;base64,"))
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(data, "data:image/png;base64,"))
+	assert.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, captchaWidth, img.Bounds().Dx())
+	assert.Equal(t, captchaHeight, img.Bounds().Dy())
+	assert.NotContains(t, string(raw), "AB34")
+}
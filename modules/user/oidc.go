@@ -0,0 +1,366 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcDiscoveryExpire = time.Hour
+	oidcHTTPTimeout     = time.Second * 10
+)
+
+var oidcHTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+
+// oidc发现文档（只取需要的端点）
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type oidcDiscoveryCache struct {
+	discovery *oidcDiscovery
+	expireAt  time.Time
+}
+
+var oidcDiscoveries sync.Map // issuer -> *oidcDiscoveryCache
+
+type oidcToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// 从身份提供方获取的用户身份
+type oidcIdentity struct {
+	Subject       string
+	Name          string
+	Avatar        string
+	Email         string
+	EmailVerified bool
+}
+
+// oidcConnector 通用的OIDC/OAuth2授权码流程
+type oidcConnector struct {
+	provider *oidcProviderModel
+}
+
+func newOIDCConnector(provider *oidcProviderModel) *oidcConnector {
+	return &oidcConnector{
+		provider: provider,
+	}
+}
+
+// endpoints 获取授权、token和用户信息端点（配置了issuer的通过发现文档获取，手动配置的端点优先）
+func (o *oidcConnector) endpoints(ctx context.Context) (*oidcDiscovery, error) {
+	p := o.provider
+	endpoints := &oidcDiscovery{
+		Issuer:                p.Issuer,
+		AuthorizationEndpoint: p.AuthURL,
+		TokenEndpoint:         p.TokenURL,
+		UserinfoEndpoint:      p.UserinfoURL,
+	}
+	if p.Issuer != "" && (p.AuthURL == "" || p.TokenURL == "" || p.UserinfoURL == "") {
+		discovery, err := discoverOIDC(ctx, p.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		if endpoints.AuthorizationEndpoint == "" {
+			endpoints.AuthorizationEndpoint = discovery.AuthorizationEndpoint
+		}
+		if endpoints.TokenEndpoint == "" {
+			endpoints.TokenEndpoint = discovery.TokenEndpoint
+		}
+		if endpoints.UserinfoEndpoint == "" {
+			endpoints.UserinfoEndpoint = discovery.UserinfoEndpoint
+		}
+	}
+	if endpoints.AuthorizationEndpoint == "" || endpoints.TokenEndpoint == "" {
+		return nil, errors.New("身份提供方端点配置不完整")
+	}
+	return endpoints, nil
+}
+
+func discoverOIDC(ctx context.Context, issuer string) (*oidcDiscovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if cached, ok := oidcDiscoveries.Load(issuer); ok {
+		c := cached.(*oidcDiscoveryCache)
+		if time.Now().Before(c.expireAt) {
+			return c.discovery, nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery *oidcDiscovery
+	if err = doOIDCRequest(req, &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("发现文档的issuer[%s]与配置不一致", discovery.Issuer)
+	}
+	oidcDiscoveries.Store(issuer, &oidcDiscoveryCache{
+		discovery: discovery,
+		expireAt:  time.Now().Add(oidcDiscoveryExpire),
+	})
+	return discovery, nil
+}
+
+func (o *oidcConnector) scopes() string {
+	if o.provider.Scopes != "" {
+		return o.provider.Scopes
+	}
+	if o.provider.Issuer != "" {
+		return "openid profile email"
+	}
+	return ""
+}
+
+// authURL 生成授权地址
+func (o *oidcConnector) authURL(ctx context.Context, redirectURI string, state string, nonce string, codeVerifier string) (string, error) {
+	endpoints, err := o.endpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", o.provider.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("state", state)
+	if scopes := o.scopes(); scopes != "" {
+		params.Set("scope", scopes)
+	}
+	if o.provider.Issuer != "" && nonce != "" {
+		params.Set("nonce", nonce)
+	}
+	if o.provider.PKCE == 1 && codeVerifier != "" {
+		params.Set("code_challenge", pkceChallenge(codeVerifier))
+		params.Set("code_challenge_method", "S256")
+	}
+	sep := "?"
+	if strings.Contains(endpoints.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return endpoints.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// exchange 用授权码换取token
+func (o *oidcConnector) exchange(ctx context.Context, code string, redirectURI string, codeVerifier string) (*oidcToken, error) {
+	endpoints, err := o.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", o.provider.ClientID)
+	form.Set("client_secret", o.provider.ClientSecret)
+	if o.provider.PKCE == 1 && codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token *oidcToken
+	if err = doOIDCRequest(req, &token); err != nil {
+		return nil, err
+	}
+	if token == nil || token.AccessToken == "" {
+		return nil, errors.New("身份提供方没有返回access_token")
+	}
+	return token, nil
+}
+
+// claims 获取用户声明（id_token中的声明和userinfo合并，userinfo优先）
+// id_token直接从token端点通过TLS获取，按OIDC规范可以不校验签名
+func (o *oidcConnector) claims(ctx context.Context, token *oidcToken, nonce string) (map[string]interface{}, error) {
+	claims := map[string]interface{}{}
+	if token.IDToken != "" {
+		idClaims, err := decodeJWTClaims(token.IDToken)
+		if err != nil {
+			return nil, err
+		}
+		if err = o.verifyIDClaims(idClaims, nonce); err != nil {
+			return nil, err
+		}
+		for k, v := range idClaims {
+			claims[k] = v
+		}
+	}
+	endpoints, err := o.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if endpoints.UserinfoEndpoint == "" {
+		return claims, nil
+	}
+	userinfoURL := endpoints.UserinfoEndpoint
+	if o.provider.UserinfoTokenQuery == 1 {
+		sep := "?"
+		if strings.Contains(userinfoURL, "?") {
+			sep = "&"
+		}
+		userinfoURL = userinfoURL + sep + "access_token=" + url.QueryEscape(token.AccessToken)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userinfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if o.provider.UserinfoTokenQuery != 1 {
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+	var userinfo map[string]interface{}
+	if err = doOIDCRequest(req, &userinfo); err != nil {
+		return nil, err
+	}
+	if sub, ok := claims["sub"]; ok && userinfo["sub"] != nil && userinfo["sub"] != sub {
+		return nil, errors.New("userinfo的sub与id_token不一致")
+	}
+	for k, v := range userinfo {
+		claims[k] = v
+	}
+	return claims, nil
+}
+
+// verifyIDClaims 校验id_token的iss、aud和nonce
+func (o *oidcConnector) verifyIDClaims(idClaims map[string]interface{}, nonce string) error {
+	issuer := strings.TrimSuffix(o.provider.Issuer, "/")
+	if issuer != "" {
+		iss, _ := idClaims["iss"].(string)
+		if strings.TrimSuffix(iss, "/") != issuer {
+			return errors.New("id_token的iss不匹配")
+		}
+	}
+	if !claimAudienceContains(idClaims["aud"], o.provider.ClientID) {
+		return errors.New("id_token的aud不匹配")
+	}
+	// 授权时发送了nonce的必须原样返回，防止id_token重放
+	if issuer != "" && nonce != "" && idClaims["nonce"] != nonce {
+		return errors.New("id_token的nonce不匹配")
+	}
+	return nil
+}
+
+// claimAudienceContains aud可以是字符串或字符串数组
+func claimAudienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, item := range v {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapClaims 按配置将声明映射为用户身份
+func (o *oidcConnector) mapClaims(claims map[string]interface{}) (*oidcIdentity, error) {
+	p := o.provider
+	identity := &oidcIdentity{
+		Subject: claimString(claims, defaultString(p.SubjectClaim, "sub")),
+		Name:    claimString(claims, defaultString(p.NameClaim, "name,preferred_username,nickname")),
+		Avatar:  claimString(claims, defaultString(p.AvatarClaim, "picture")),
+		Email:   strings.ToLower(claimString(claims, defaultString(p.EmailClaim, "email"))),
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("身份提供方没有返回用户唯一标识")
+	}
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		identity.EmailVerified = v == "true"
+	}
+	return identity, nil
+}
+
+// claimString 依次尝试多个字段（英文逗号分隔），返回第一个非空值
+func claimString(claims map[string]interface{}, names string) string {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		switch v := claims[name].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64: // json数字（例如github的用户ID）
+			return fmt.Sprintf("%.0f", v)
+		case json.Number:
+			return v.String()
+		}
+	}
+	return ""
+}
+
+func defaultString(value string, def string) string {
+	if strings.TrimSpace(value) == "" {
+		return def
+	}
+	return value
+}
+
+func decodeJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("id_token格式有误")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func doOIDCRequest(req *http.Request, result interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求身份提供方失败，状态码：%d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, result)
+}
+
+// 生成PKCE的code_verifier
+func newPKCEVerifier() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
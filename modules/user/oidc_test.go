@@ -0,0 +1,138 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// RFC 7636 附录B的示例
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", pkceChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+	assert.Len(t, newPKCEVerifier(), 43)
+}
+
+func TestOIDCConnector(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 server.URL,
+				"authorization_endpoint": server.URL + "/authorize",
+				"token_endpoint":         server.URL + "/token",
+				"userinfo_endpoint":      server.URL + "/userinfo",
+			})
+		case "/token":
+			r.ParseForm()
+			if r.Form.Get("code") != "code1" || r.Form.Get("code_verifier") != "verifier1" || r.Form.Get("client_secret") != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			payload, _ := json.Marshal(map[string]interface{}{"iss": server.URL, "aud": "client", "sub": "u1", "nonce": "nonce1", "email_verified": true})
+			json.NewEncoder(w).Encode(map[string]string{
+				"access_token": "at1",
+				"id_token":     "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig",
+			})
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer at1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"sub":                "u1",
+				"preferred_username": "alice",
+				"picture":            "https://example.com/a.png",
+				"email":              "Alice@Example.com",
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	connector := newOIDCConnector(&oidcProviderModel{
+		Provider:     "test",
+		Issuer:       server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		PKCE:         1,
+	})
+	ctx := context.Background()
+
+	authURL, err := connector.authURL(ctx, "https://api.example.com/user/oauth/test", "state1", "nonce1", "verifier1")
+	assert.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "/authorize", parsed.Path)
+	assert.Equal(t, "state1", parsed.Query().Get("state"))
+	assert.Equal(t, "openid profile email", parsed.Query().Get("scope"))
+	assert.Equal(t, pkceChallenge("verifier1"), parsed.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+
+	token, err := connector.exchange(ctx, "code1", "https://api.example.com/user/oauth/test", "verifier1")
+	assert.NoError(t, err)
+	assert.Equal(t, "at1", token.AccessToken)
+
+	_, err = connector.claims(ctx, token, "other")
+	assert.Error(t, err)
+
+	claims, err := connector.claims(ctx, token, "nonce1")
+	assert.NoError(t, err)
+	identity, err := connector.mapClaims(claims)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", identity.Subject)
+	assert.Equal(t, "alice", identity.Name)
+	assert.Equal(t, "https://example.com/a.png", identity.Avatar)
+	assert.Equal(t, "alice@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+}
+
+func TestOIDCVerifyIDClaims(t *testing.T) {
+	connector := newOIDCConnector(&oidcProviderModel{
+		Issuer:   "https://idp.example.com/",
+		ClientID: "client",
+	})
+	valid := map[string]interface{}{"iss": "https://idp.example.com", "aud": "client", "nonce": "n1"}
+	assert.NoError(t, connector.verifyIDClaims(valid, "n1"))
+	assert.NoError(t, connector.verifyIDClaims(map[string]interface{}{"iss": "https://idp.example.com", "aud": []interface{}{"other", "client"}, "nonce": "n1"}, "n1"))
+
+	// 缺少nonce、nonce不一致、iss或aud不匹配都不能通过
+	assert.Error(t, connector.verifyIDClaims(map[string]interface{}{"iss": "https://idp.example.com", "aud": "client"}, "n1"))
+	assert.Error(t, connector.verifyIDClaims(valid, "n2"))
+	assert.Error(t, connector.verifyIDClaims(map[string]interface{}{"iss": "https://evil.example.com", "aud": "client", "nonce": "n1"}, "n1"))
+	assert.Error(t, connector.verifyIDClaims(map[string]interface{}{"iss": "https://idp.example.com", "aud": "other", "nonce": "n1"}, "n1"))
+	assert.Error(t, connector.verifyIDClaims(map[string]interface{}{"iss": "https://idp.example.com", "nonce": "n1"}, "n1"))
+
+	// 没有配置issuer的只校验aud
+	connector = newOIDCConnector(&oidcProviderModel{ClientID: "client"})
+	assert.NoError(t, connector.verifyIDClaims(map[string]interface{}{"aud": "client"}, "n1"))
+}
+
+func TestOIDCMapClaims(t *testing.T) {
+	// github的用户信息没有sub，用户ID是数字
+	connector := newOIDCConnector(&oidcProviderModel{
+		SubjectClaim: "id",
+		NameClaim:    "name,login",
+		AvatarClaim:  "avatar_url",
+	})
+	identity, err := connector.mapClaims(map[string]interface{}{
+		"id":         float64(1234567),
+		"login":      "octocat",
+		"name":       "",
+		"avatar_url": "https://example.com/o.png",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1234567", identity.Subject)
+	assert.Equal(t, "octocat", identity.Name)
+	assert.False(t, identity.EmailVerified)
+
+	_, err = connector.mapClaims(map[string]interface{}{"login": "octocat"})
+	assert.Error(t, err)
+}
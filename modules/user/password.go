@@ -0,0 +1,93 @@
+package user
+
+import (
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/password"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+// 登录密码的hash、校验和策略
+type passwordService struct {
+	commonService common2.IService
+	db            *DB
+	log.Log
+}
+
+func newPasswordService(ctx *config.Context) *passwordService {
+	return &passwordService{
+		commonService: common2.NewService(ctx),
+		db:            NewDB(ctx),
+		Log:           log.NewTLog("passwordService"),
+	}
+}
+
+// 读取app配置中的密码算法和密码策略
+func (p *passwordService) loadConfig() *password.Policy {
+	policy := password.DefaultPolicy()
+	appConfig, err := p.commonService.GetAppConfig()
+	if err != nil {
+		p.Warn("查询应用配置失败！", zap.Error(err))
+		return policy
+	}
+	if appConfig == nil {
+		return policy
+	}
+	if appConfig.PasswordHasher != "" {
+		if _, err = password.Get(appConfig.PasswordHasher); err != nil {
+			p.Warn("密码算法配置有误，使用默认算法", zap.Error(err))
+		} else {
+			policy.Hasher = appConfig.PasswordHasher
+		}
+	}
+	if appConfig.PasswordMinLength > 0 {
+		policy.MinLength = appConfig.PasswordMinLength
+	}
+	policy.MinClasses = appConfig.PasswordMinClasses
+	policy.BreachedFile = appConfig.PasswordBreachedFile
+	return policy
+}
+
+// check 检查密码是否符合策略（注册和修改密码时）
+func (p *passwordService) check(pwd string) error {
+	return p.loadConfig().Check(pwd)
+}
+
+// checkAndHash 检查密码策略并生成hash
+func (p *passwordService) checkAndHash(pwd string) (string, error) {
+	policy := p.loadConfig()
+	if err := policy.Check(pwd); err != nil {
+		return "", err
+	}
+	return policy.Hash(pwd)
+}
+
+// hash 生成hash（不检查策略，用于系统或管理员创建的账号）
+func (p *passwordService) hash(pwd string) (string, error) {
+	return p.loadConfig().Hash(pwd)
+}
+
+// verify 校验登录密码 旧版hash校验通过后会升级为当前算法
+func (p *passwordService) verify(uid string, pwd string, encoded string) bool {
+	policy := p.loadConfig()
+	ok, needsRehash, err := policy.Verify(pwd, encoded)
+	if err != nil {
+		p.Warn("校验密码失败！", zap.Error(err), zap.String("uid", uid))
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if needsRehash && uid != "" {
+		newHash, err := policy.Hash(pwd)
+		if err != nil {
+			p.Error("生成密码hash失败！", zap.Error(err))
+			return true
+		}
+		if err = p.db.UpdateUsersWithField("password", newHash, uid); err != nil {
+			p.Error("升级密码hash失败！", zap.Error(err), zap.String("uid", uid))
+		}
+	}
+	return true
+}
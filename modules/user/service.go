@@ -3,10 +3,12 @@ package user
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/source"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
@@ -78,6 +80,8 @@ type IService interface {
 	UpdateUserMsgExpireSecond(uid string, msgExpireSecond int64) error
 	// 搜索好友
 	SearchFriendsWithKeyword(uid string, keyword string) ([]*FriendResp, error)
+	// 封禁或解禁用户 封禁后下线用户所有设备
+	UpdateUserStatus(uid string, status common.UserStatus) error
 }
 
 // Service Service
@@ -90,6 +94,7 @@ type Service struct {
 	settingDB        *SettingDB
 	onetimePrekeysDB *onetimePrekeysDB
 	onlineService    *OnlineService
+	passwordService  *passwordService
 }
 
 // NewService NewService
@@ -103,6 +108,7 @@ func NewService(ctx *config.Context) IService {
 		onlineDB:         newOnlineDB(ctx),
 		Log:              log.NewTLog("userService"),
 		onlineService:    NewOnlineService(ctx),
+		passwordService:  newPasswordService(ctx),
 	}
 }
 
@@ -406,7 +412,12 @@ func (s *Service) AddUser(user *AddUserReq) error {
 		Status:   1,
 	}
 	if user.Password != "" {
-		userM.Password = util.MD5(util.MD5(user.Password))
+		pwdHash, err := s.passwordService.hash(user.Password)
+		if err != nil {
+			s.Error("生成密码hash失败！", zap.Error(err))
+			return err
+		}
+		userM.Password = pwdHash
 	}
 
 	err := s.db.Insert(userM)
@@ -658,11 +669,14 @@ func (s *Service) UpdateLoginPassword(req UpdateLoginPasswordReq) error {
 	if userM == nil {
 		return errors.New("用户不存在！")
 	}
-	if util.MD5(util.MD5(req.Password)) != userM.Password {
+	if !s.passwordService.verify("", req.Password, userM.Password) {
 		return errors.New("原密码不正确！")
 	}
-
-	err = s.db.updatePassword(util.MD5(util.MD5(req.NewPassword)), req.UID)
+	pwdHash, err := s.passwordService.checkAndHash(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	err = s.db.updatePassword(pwdHash, req.UID)
 	if err != nil {
 		return errors.New("更新密码失败！")
 	}
@@ -726,6 +740,43 @@ func (s *Service) UpdateUserMsgExpireSecond(uid string, msgExpireSecond int64) e
 	return s.db.updateUserMsgExpireSecond(uid, msgExpireSecond)
 }
 
+// UpdateUserStatus 封禁或解禁用户
+func (s *Service) UpdateUserStatus(uid string, status common.UserStatus) error {
+	if status != common.UserAvailable && status != common.UserDisable {
+		return errors.New("修改状态类型不匹配")
+	}
+	userInfo, err := s.db.QueryByUID(uid)
+	if err != nil {
+		return err
+	}
+	if userInfo == nil {
+		return errors.New("操作用户不存在")
+	}
+	if userInfo.Status == int(status) {
+		return nil
+	}
+	err = s.db.UpdateUsersWithField("status", strconv.Itoa(int(status)), uid)
+	if err != nil {
+		return err
+	}
+	ban := 0
+	if status == common.UserDisable {
+		ban = 1
+	}
+	err = s.ctx.IMCreateOrUpdateChannelInfo(&config.ChannelInfoCreateReq{
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Ban:         ban,
+	})
+	if err != nil {
+		return err
+	}
+	if status == common.UserDisable {
+		return s.ctx.QuitUserDevice(uid, -1)
+	}
+	return nil
+}
+
 // 搜索好友
 func (s *Service) SearchFriendsWithKeyword(uid string, keyword string) ([]*FriendResp, error) {
 	friends, err := s.friendDB.QueryFriendsWithKeyword(uid, keyword)
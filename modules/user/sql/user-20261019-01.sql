@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `user` MODIFY COLUMN password VARCHAR(255) not null default '' COMMENT '密码hash（自描述格式，兼容旧版md5）';
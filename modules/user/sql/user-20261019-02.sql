@@ -0,0 +1,28 @@
+-- +migrate Up
+
+-- 两步验证（TOTP）
+create table `user_totp`
+(
+  id         bigint         not null primary key AUTO_INCREMENT,
+  uid        VARCHAR(40)    not null default '',                -- 用户uid
+  secret     VARCHAR(64)    not null default '',                -- base32密钥
+  status     smallint       not null default 0,                 -- 状态 0.待确认 1.已开启
+  last_step  bigint         not null default 0,                 -- 最后一次使用的时间步（防重放）
+  enabled_at bigint         not null default 0,                 -- 开启时间
+  created_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `user_totp_uidx` on `user_totp` (`uid`);
+
+-- 两步验证恢复码
+create table `user_totp_recovery`
+(
+  id         bigint         not null primary key AUTO_INCREMENT,
+  uid        VARCHAR(40)    not null default '',                -- 用户uid
+  code_hash  VARCHAR(64)    not null default '',                -- 恢复码sha256
+  used       smallint       not null default 0,                 -- 是否已使用
+  used_at    bigint         not null default 0,                 -- 使用时间
+  created_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE INDEX `user_totp_recovery_uidx` on `user_totp_recovery` (`uid`);
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE `login_log`
+    ADD COLUMN `type` smallint not null default 0 COMMENT '类型 0.登录 1.锁定 2.解除锁定',
+    ADD COLUMN `action` VARCHAR(20) not null default '' COMMENT '触发锁定的行为 pwd.密码错误 totp.两步验证码错误 sms_send.发送短信 sms_verify.短信验证码错误',
+    ADD COLUMN `account` VARCHAR(100) not null default '' COMMENT '被锁定的账号/IP/设备',
+    ADD COLUMN `device_id` VARCHAR(100) not null default '' COMMENT '设备ID',
+    ADD COLUMN `reason` VARCHAR(255) not null default '' COMMENT '原因',
+    ADD COLUMN `expire_at` bigint not null default 0 COMMENT '锁定到期时间';
+
+CREATE INDEX `login_log_typex` on `login_log` (`type`);
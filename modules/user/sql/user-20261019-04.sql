@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- 登录会话（每个签发的token一条）
+create table `user_session`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  session_id   VARCHAR(40)    not null default '',                -- 会话ID
+  uid          VARCHAR(40)    not null default '',                -- 用户uid
+  token_hash   VARCHAR(64)    not null default '',                -- token的sha256
+  device_flag  smallint       not null default 0,                 -- 设备标记 0.APP 1.WEB 2.PC
+  device_id    VARCHAR(100)   not null default '',                -- 设备ID
+  device_name  VARCHAR(100)   not null default '',                -- 设备名称
+  device_model VARCHAR(100)   not null default '',                -- 设备型号
+  login_ip     VARCHAR(100)   not null default '',                -- 登录IP
+  user_agent   VARCHAR(500)   not null default '',                -- 登录时的User-Agent
+  login_at     bigint         not null default 0,                 -- 签发时间
+  last_seen_at bigint         not null default 0,                 -- 最后活跃时间
+  last_seen_ip VARCHAR(100)   not null default '',                -- 最后活跃IP
+  revoked      smallint       not null default 0,                 -- 是否已注销
+  revoked_at   bigint         not null default 0,                 -- 注销时间
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `user_session_sidx` on `user_session` (`session_id`);
+CREATE UNIQUE INDEX `user_session_tokenx` on `user_session` (`token_hash`);
+CREATE INDEX `user_session_uidx` on `user_session` (`uid`);
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+-- 会话族（同一次登录后续刷新产生的会话属于同一族）
+ALTER TABLE `user_session` ADD COLUMN `family_id` VARCHAR(40) not null default '' COMMENT '会话族ID';
+ALTER TABLE `user_session` ADD COLUMN `im_sync` smallint not null default 0 COMMENT 'token是否同步到IM 1.是';
+UPDATE `user_session` SET `family_id`=`session_id` WHERE `family_id`='';
+CREATE INDEX `user_session_familyx` on `user_session` (`family_id`);
+
+-- 刷新令牌
+create table `user_refresh_token`
+(
+  id         bigint         not null primary key AUTO_INCREMENT,
+  token_hash VARCHAR(64)    not null default '',                -- 刷新令牌的sha256
+  family_id  VARCHAR(40)    not null default '',                -- 会话族ID
+  uid        VARCHAR(40)    not null default '',                -- 用户uid
+  status     smallint       not null default 0,                 -- 状态 0.可用 1.已使用 2.已注销
+  expire_at  bigint         not null default 0,                 -- 过期时间
+  used_at    bigint         not null default 0,                 -- 使用时间
+  created_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `user_refresh_token_hashx` on `user_refresh_token` (`token_hash`);
+CREATE INDEX `user_refresh_token_familyx` on `user_refresh_token` (`family_id`);
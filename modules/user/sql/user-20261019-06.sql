@@ -0,0 +1,4 @@
+-- +migrate Up
+
+ALTER TABLE `user` ADD COLUMN email_verified smallint NOT NULL DEFAULT 0 COMMENT 'email是否已验证 1.是';
+CREATE INDEX `user_emailx` on `user` (`email`);
@@ -0,0 +1,50 @@
+-- +migrate Up
+
+-- 第三方登录身份（一个用户在同一个身份提供方只能绑定一个账号）
+create table `user_identity`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  provider     VARCHAR(40)    not null default '',                -- 身份提供方 例如 github gitee google
+  subject      VARCHAR(200)   not null default '',                -- 提供方的用户唯一标识
+  uid          VARCHAR(40)    not null default '',                -- 用户uid
+  name         VARCHAR(100)   not null default '',                -- 提供方的用户名称
+  avatar       VARCHAR(1000)  not null default '',                -- 提供方的用户头像
+  email        VARCHAR(255)   not null default '',                -- 提供方的用户邮箱
+  last_login_at bigint         not null default 0,                 -- 最后一次通过此身份登录的时间
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `user_identity_subjectx` on `user_identity` (`provider`, `subject`);
+CREATE UNIQUE INDEX `user_identity_uidx` on `user_identity` (`uid`, `provider`);
+
+-- 身份提供方配置（OIDC填写issuer即可自动发现，普通OAuth2需填写各个端点）
+create table `user_oidc_provider`
+(
+  id                   bigint         not null primary key AUTO_INCREMENT,
+  provider             VARCHAR(40)    not null default '',                -- 提供方标识（用于回调地址 /v1/user/oauth/{provider}）
+  name                 VARCHAR(100)   not null default '',                -- 显示名称
+  issuer               VARCHAR(255)   not null default '',                -- OIDC issuer
+  auth_url             VARCHAR(255)   not null default '',                -- 授权端点
+  token_url            VARCHAR(255)   not null default '',                -- token端点
+  userinfo_url         VARCHAR(255)   not null default '',                -- 用户信息端点
+  client_id            VARCHAR(255)   not null default '',                -- client id
+  client_secret        VARCHAR(255)   not null default '',                -- client secret
+  scopes               VARCHAR(255)   not null default '',                -- 申请的scope 空格分隔
+  pkce                 smallint       not null default 1,                 -- 是否使用PKCE
+  userinfo_token_query smallint       not null default 0,                 -- 获取用户信息时通过query参数传递access_token
+  subject_claim        VARCHAR(100)   not null default '',                -- 用户唯一标识字段 默认sub
+  name_claim           VARCHAR(100)   not null default '',                -- 名称字段 多个用英文逗号分隔依次尝试
+  avatar_claim         VARCHAR(100)   not null default '',                -- 头像字段
+  email_claim          VARCHAR(100)   not null default '',                -- 邮箱字段
+  trust_email          smallint       not null default 0,                 -- 是否信任提供方已验证的邮箱（可按邮箱关联已有账号）
+  status               smallint       not null default 1,                 -- 状态 0.禁用 1.启用
+  created_at           timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at           timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `user_oidc_provider_providerx` on `user_oidc_provider` (`provider`);
+
+-- 迁移github和gitee的绑定关系（以提供方的数字ID作为唯一标识）
+INSERT IGNORE INTO `user_identity` (provider, subject, uid, name, avatar, email)
+SELECT 'github', CAST(g.id AS CHAR), u.uid, g.name, g.avatar_url, g.email FROM `user` u INNER JOIN `github_user` g ON g.login=u.github_uid WHERE u.github_uid<>'';
+INSERT IGNORE INTO `user_identity` (provider, subject, uid, name, avatar, email)
+SELECT 'gitee', CAST(g.id AS CHAR), u.uid, g.name, g.avatar_url, g.email FROM `user` u INNER JOIN `gitee_user` g ON g.login=u.gitee_uid WHERE u.gitee_uid<>'';
@@ -0,0 +1,35 @@
+-- +migrate Up
+
+-- LDAP/AD目录配置（只有一条记录）
+create table `user_ldap_config`
+(
+  id                 bigint         not null primary key AUTO_INCREMENT,
+  url                VARCHAR(255)   not null default '',                    -- 目录地址 例如 ldap://ldap.example.com:389 ldaps://ad.example.com:636
+  start_tls          smallint       not null default 0,                     -- ldap://连接是否升级为TLS
+  skip_verify        smallint       not null default 0,                     -- 是否跳过证书校验（仅用于自签名证书的测试环境）
+  bind_dn            VARCHAR(255)   not null default '',                    -- 用于查询的服务账号DN
+  bind_password      VARCHAR(255)   not null default '',                    -- 服务账号密码
+  base_dn            VARCHAR(255)   not null default '',                    -- 用户的查询根
+  user_filter        VARCHAR(255)   not null default '(uid=%s)',            -- 用户过滤条件 %s为用户名 AD一般为(sAMAccountName=%s)
+  username_attr      VARCHAR(40)    not null default 'uid',                 -- 用户名属性
+  name_attr          VARCHAR(100)   not null default 'displayName,cn',      -- 名称属性（逗号分隔依次尝试）
+  email_attr         VARCHAR(40)    not null default 'mail',                -- 邮箱属性
+  group_attr         VARCHAR(40)    not null default 'memberOf',            -- 用户所属组属性
+  sync_on            smallint       not null default 0,                     -- 是否开启定时同步
+  sync_interval      integer        not null default 60,                    -- 同步间隔（分钟）
+  last_sync_at       bigint         not null default 0,                     -- 最后一次同步时间
+  status             smallint       not null default 0,                     -- 是否启用LDAP登录 0.否 1.是
+  created_at         timeStamp      not null DEFAULT CURRENT_TIMESTAMP,     -- 创建时间
+  updated_at         timeStamp      not null DEFAULT CURRENT_TIMESTAMP      -- 更新时间
+);
+
+-- 目录组与群的映射（同步时目录组成员会加入对应的群）
+create table `user_ldap_group`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  group_dn     VARCHAR(255)   not null default '',                -- 目录组DN（小写）
+  group_no     VARCHAR(40)    not null default '',                -- 群编号
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX `user_ldap_group_dn_groupx` on `user_ldap_group` (`group_dn`, `group_no`);
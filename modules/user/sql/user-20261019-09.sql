@@ -0,0 +1,7 @@
+-- +migrate Up
+
+-- 之前邮箱可以直接登录，唯一的邮箱视为已验证，保证这些账号升级后仍可用邮箱登录（重复的邮箱无法确定归属，需要重新绑定）
+UPDATE `user` u JOIN (SELECT LOWER(email) email FROM `user` WHERE email<>'' AND is_destroy=0 GROUP BY LOWER(email) HAVING count(*)=1) t ON LOWER(u.email)=t.email SET u.email=t.email,u.email_verified=1 WHERE u.is_destroy=0 AND u.email_verified=0;
+-- 已验证的邮箱唯一
+ALTER TABLE `user` ADD COLUMN verified_email VARCHAR(100) GENERATED ALWAYS AS (IF(email_verified=1, email, NULL)) STORED COMMENT '已验证的email';
+CREATE UNIQUE INDEX `user_verified_emailx` on `user` (`verified_email`);
@@ -199,6 +199,14 @@ func (w *Webhook) handleMessageNotify(messages []MsgResp) ([]string, error) {
 			w.Error("插入消息失败！", zap.Error(err))
 			return nil, err
 		}
+		for _, mediaM := range getMediaModels(messageM) {
+			err = w.messageDB.insertMediaTx(mediaM, tx)
+			if err != nil {
+				_ = tx.Rollback()
+				w.Error("添加频道媒体索引失败！", zap.Error(err))
+				return nil, err
+			}
+		}
 		confMessages = append(confMessages, message.toConfigMessageResp())
 
 	}
@@ -379,6 +387,11 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 		return nil
 	}
 
+	if !isVideoCall && w.newcomerRestricted(msgResp) {
+		w.Debug("不推送：观察期成员发送的受限消息！", zap.String("fromUID", msgResp.FromUID), zap.String("groupNo", msgResp.ChannelID))
+		return nil
+	}
+
 	var err error
 	// var users []*user.Resp
 	userSettings := make([]*user.SettingResp, 0)
@@ -414,9 +427,14 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 		}
 	}
 
+	mentionAll, mentionUIDs := false, map[string]bool{}
+	if !isVideoCall && msgResp.ChannelType == common.ChannelTypeGroup.Uint8() {
+		mentionAll, mentionUIDs = w.getMentioned(msgResp)
+	}
+
 	for _, toUID := range toUids {
 		if !isVideoCall {
-			if !w.allowPush(users, userSettings, groupSettings, toUID, fromUID) {
+			if !w.allowPush(users, userSettings, groupSettings, toUID, fromUID, mentionAll || mentionUIDs[toUID]) {
 				continue
 			}
 		} else {
@@ -458,8 +476,69 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 	return nil
 }
 
-// 是否允许推送
-func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp, groupSettings []*group.SettingResp, toUID string, fromUID string) bool {
+// newcomerRestricted 是否是观察期成员发送的受限消息（这类消息会被系统撤回，不进行推送）
+func (w *Webhook) newcomerRestricted(msgResp msgOfflineNotify) bool {
+	if msgResp.ChannelType != common.ChannelTypeGroup.Uint8() || msgResp.FromUID == "" || msgResp.FromUID == w.ctx.GetConfig().Account.SystemUID {
+		return false
+	}
+	if !group.NewcomerRestricted(msgResp.PayloadMap) {
+		return false
+	}
+	inProbation, err := w.groupService.InProbation(msgResp.ChannelID, msgResp.FromUID)
+	if err != nil {
+		w.Warn("查询成员是否处于观察期失败！", zap.Error(err), zap.String("groupNo", msgResp.ChannelID), zap.String("uid", msgResp.FromUID))
+		return false
+	}
+	return inProbation
+}
+
+// getMentioned 获取群消息@的成员（包含@的标签下的成员）
+func (w *Webhook) getMentioned(msgResp msgOfflineNotify) (all bool, uids map[string]bool) {
+	uids = map[string]bool{}
+	if msgResp.PayloadMap == nil {
+		return
+	}
+	mentionMap, _ := msgResp.PayloadMap["mention"].(map[string]interface{})
+	if mentionMap == nil {
+		return
+	}
+	if allNum, ok := mentionMap["all"].(json.Number); ok {
+		allI, _ := allNum.Int64()
+		if allI == 1 {
+			all = true
+			return
+		}
+	}
+	uidObjs, _ := mentionMap["uids"].([]interface{})
+	for _, uidObj := range uidObjs {
+		if uid, ok := uidObj.(string); ok {
+			uids[uid] = true
+		}
+	}
+	tagObjs, _ := mentionMap["tags"].([]interface{})
+	tagNos := make([]string, 0, len(tagObjs))
+	for _, tagObj := range tagObjs {
+		if tagNo, ok := tagObj.(string); ok && tagNo != "" {
+			tagNos = append(tagNos, tagNo)
+		}
+	}
+	if len(tagNos) > 0 {
+		tagUIDs, err := w.groupService.GetTagMemberUIDs(msgResp.ChannelID, tagNos)
+		if err != nil {
+			w.Warn("查询标签成员失败！", zap.Error(err), zap.String("groupNo", msgResp.ChannelID))
+			return
+		}
+		for _, uid := range tagUIDs {
+			if uid != msgResp.FromUID {
+				uids[uid] = true
+			}
+		}
+	}
+	return
+}
+
+// 是否允许推送 mentioned: 群消息是否@了toUID（群设置为仅@我时通知的成员只推送@了自己的消息）
+func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp, groupSettings []*group.SettingResp, toUID string, fromUID string, mentioned bool) bool {
 	isPush := true
 	if len(users) > 0 {
 		for _, user := range users {
@@ -485,7 +564,7 @@ func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp
 	if isPush && groupSettings != nil && len(groupSettings) > 0 {
 		for _, groupSetting := range groupSettings {
 			if groupSetting.UID == toUID {
-				if groupSetting.Mute == 1 {
+				if groupSetting.Mute == group.MuteOn || (groupSetting.Mute == group.MuteMentionOnly && !mentioned) {
 					isPush = false
 				}
 				break
@@ -0,0 +1,30 @@
+package webhook
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// insertMediaTx 添加频道媒体索引，重复推送的消息忽略
+func (m *messageDB) insertMediaTx(model *mediaModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("insert into channel_media(message_id,item_index,message_seq,channel_id,channel_type,from_uid,media_type,content_type,name,size,url,cover,timestamp,expire_at) values(?,?,?,?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE message_seq=VALUES(message_seq)", model.MessageID, model.ItemIndex, model.MessageSeq, model.ChannelID, model.ChannelType, model.FromUID, model.MediaType, model.ContentType, model.Name, model.Size, model.URL, model.Cover, model.Timestamp, model.ExpireAt).Exec()
+	return err
+}
+
+type mediaModel struct {
+	MessageID   string
+	ItemIndex   int
+	MessageSeq  int64
+	ChannelID   string
+	ChannelType uint8
+	FromUID     string
+	MediaType   int
+	ContentType int
+	Name        string
+	Size        int64
+	URL         string
+	Cover       string
+	Timestamp   int32
+	ExpireAt    uint32
+	db.BaseModel
+}
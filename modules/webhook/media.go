@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+)
+
+const (
+	mediaTypePhoto = 1 // 图片/视频
+	mediaTypeFile  = 2 // 文件
+	mediaTypeLink  = 3 // 链接
+
+	mediaMaxLinks = 5 // 每条消息最多索引的链接数量
+)
+
+var mediaLinkRegexp = regexp.MustCompile(`(?i)(https?://|www\.)[^\s<>"'，。、；！？]+`)
+
+// getMediaModels 从消息中解析出需要索引的图片、视频、文件及链接
+func getMediaModels(message *messageModel) []*mediaModel {
+	if message.Signal == 1 || message.Payload == "" {
+		return nil
+	}
+	var payloadMap map[string]interface{}
+	if err := util.ReadJsonByByte([]byte(message.Payload), &payloadMap); err != nil || payloadMap == nil {
+		return nil
+	}
+	newModel := func(mediaType int, contentType common.ContentType) *mediaModel {
+		return &mediaModel{
+			MessageID:   message.MessageID,
+			MessageSeq:  message.MessageSeq,
+			ChannelID:   message.ChannelID,
+			ChannelType: message.ChannelType,
+			FromUID:     message.FromUID,
+			MediaType:   mediaType,
+			ContentType: contentType.Int(),
+			Timestamp:   message.Timestamp,
+			ExpireAt:    message.ExpireAt,
+		}
+	}
+	contentType := common.ContentType(payloadInt(payloadMap["type"]))
+	switch contentType {
+	case common.Image, common.GIF, common.Video:
+		url := payloadString(payloadMap["url"])
+		if url == "" {
+			return nil
+		}
+		model := newModel(mediaTypePhoto, contentType)
+		model.URL = url
+		model.Name = truncateMediaName(path.Base(url))
+		model.Size = payloadInt(payloadMap["size"])
+		model.Cover = payloadString(payloadMap["cover"])
+		return []*mediaModel{model}
+	case common.File:
+		url := payloadString(payloadMap["url"])
+		if url == "" {
+			return nil
+		}
+		model := newModel(mediaTypeFile, contentType)
+		model.URL = url
+		model.Name = truncateMediaName(payloadString(payloadMap["name"]))
+		if model.Name == "" {
+			model.Name = truncateMediaName(path.Base(url))
+		}
+		model.Size = payloadInt(payloadMap["size"])
+		return []*mediaModel{model}
+	case common.Text:
+		links := mediaLinkRegexp.FindAllString(payloadString(payloadMap["content"]), -1)
+		models := make([]*mediaModel, 0, len(links))
+		exists := map[string]bool{}
+		for _, link := range links {
+			if exists[link] || len(link) > 1000 {
+				continue
+			}
+			exists[link] = true
+			model := newModel(mediaTypeLink, contentType)
+			model.ItemIndex = len(models)
+			model.URL = link
+			model.Name = truncateMediaName(link)
+			models = append(models, model)
+			if len(models) >= mediaMaxLinks {
+				break
+			}
+		}
+		return models
+	}
+	return nil
+}
+
+func truncateMediaName(name string) string {
+	runes := []rune(name)
+	if len(runes) > 255 {
+		return string(runes[:255])
+	}
+	return name
+}
+
+func payloadString(v interface{}) string {
+	str, _ := v.(string)
+	return strings.TrimSpace(str)
+}
+
+func payloadInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			f, _ := n.Float64()
+			return int64(f)
+		}
+		return i
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMediaModels(t *testing.T) {
+	message := &messageModel{
+		MessageID:   "100",
+		MessageSeq:  10,
+		FromUID:     "u1",
+		ChannelID:   "g1",
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+	}
+
+	message.Payload = `{"type":8,"name":"报告.pdf","size":1024,"url":"file/preview/chat/1/报告.pdf"}`
+	models := getMediaModels(message)
+	assert.Len(t, models, 1)
+	assert.Equal(t, mediaTypeFile, models[0].MediaType)
+	assert.Equal(t, "报告.pdf", models[0].Name)
+	assert.Equal(t, int64(1024), models[0].Size)
+	assert.Equal(t, int64(10), models[0].MessageSeq)
+
+	message.Payload = `{"type":2,"url":"file/preview/chat/1/a.png","width":100,"height":100}`
+	models = getMediaModels(message)
+	assert.Len(t, models, 1)
+	assert.Equal(t, mediaTypePhoto, models[0].MediaType)
+	assert.Equal(t, "a.png", models[0].Name)
+
+	message.Payload = `{"type":1,"content":"看看 https://a.com/x 和 www.b.com，再看 https://a.com/x"}`
+	models = getMediaModels(message)
+	assert.Len(t, models, 2)
+	assert.Equal(t, mediaTypeLink, models[0].MediaType)
+	assert.Equal(t, "https://a.com/x", models[0].URL)
+	assert.Equal(t, "www.b.com", models[1].URL)
+	assert.Equal(t, 1, models[1].ItemIndex)
+
+	message.Payload = `{"type":1,"content":"没有链接"}`
+	assert.Len(t, getMediaModels(message), 0)
+
+	message.Signal = 1
+	message.Payload = `{"type":8,"url":"file/a.pdf"}`
+	assert.Len(t, getMediaModels(message), 0)
+}
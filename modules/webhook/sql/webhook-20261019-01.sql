@@ -0,0 +1,25 @@
+-- +migrate Up
+
+-- 频道媒体及文件索引
+create table `channel_media`
+(
+  id           bigint        not null primary key AUTO_INCREMENT,
+  message_id   VARCHAR(20)   not null default '',                -- 消息ID
+  item_index   smallint      not null default 0,                 -- 同一条消息内的序号（一条消息可能包含多个链接）
+  message_seq  bigint        not null default 0,                 -- 消息序列号
+  channel_id   VARCHAR(100)  not null default '',                -- 频道ID（个人频道为fakeChannelID）
+  channel_type smallint      not null default 0,                 -- 频道类型
+  from_uid     VARCHAR(40)   not null default '',                -- 发送者uid
+  media_type   smallint      not null default 0,                 -- 媒体类型 1.图片/视频 2.文件 3.链接
+  content_type integer       not null default 0,                 -- 消息正文类型
+  name         VARCHAR(255)  not null default '',                -- 文件名或链接
+  size         bigint        not null default 0,                 -- 文件大小（字节）
+  url          VARCHAR(1000) not null default '',                -- 文件或链接地址
+  cover        VARCHAR(1000) not null default '',                -- 视频封面
+  timestamp    integer       not null default 0,                 -- 消息时间戳
+  expire_at    bigint        not null default 0,                 -- 消息过期时间 0.不过期
+  created_at   timeStamp     not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp     not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX channel_media_message_item on `channel_media` (message_id, item_index);
+CREATE INDEX channel_media_channel on `channel_media` (channel_id, channel_type, media_type, message_seq);
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/audit"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/log"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/common"
@@ -31,7 +32,7 @@ func NewManager(ctx *config.Context) *manager {
 
 // Route 路由配置
 func (m *manager) Route(r *wkhttp.WKHttp) {
-	auth := r.Group("/v1/manager/workplace", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r))
+	auth := r.Group("/v1/manager/workplace", m.ctx.BasicAuthMiddleware(r), m.ctx.AuthMiddleware(r), audit.Middleware(m.ctx))
 	{
 		auth.POST("/category", m.addCategory)                                    // 添加分类
 		auth.GET("/category", m.getCategory)                                     // 获取分类
@@ -129,6 +130,7 @@ func (m *manager) updateCategory(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该分类不存在"))
 		return
 	}
+	oldName := category.Name
 	category.Name = req.Name
 	err = m.db.updateCategory(category)
 	if err != nil {
@@ -136,6 +138,7 @@ func (m *manager) updateCategory(c *wkhttp.Context) {
 		c.ResponseError(errors.New("修改分类错误"))
 		return
 	}
+	audit.Record(c, "workplace.category.update", categoryNo, map[string]interface{}{"name": oldName}, map[string]interface{}{"name": category.Name})
 	c.ResponseOK()
 }
 
@@ -483,6 +486,7 @@ func (m *manager) updateBanner(c *wkhttp.Context) {
 		c.ResponseError(errors.New("修改横幅错误"))
 		return
 	}
+	audit.Record(c, "workplace.banner.update", bannerNo, nil, req)
 	c.ResponseOK()
 }
 
@@ -627,6 +631,7 @@ func (m *manager) updateApp(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该应用不存在"))
 		return
 	}
+	before := *app
 	app.AppCategory = req.AppCategory
 	app.Icon = req.Icon
 	app.Name = req.Name
@@ -642,6 +647,7 @@ func (m *manager) updateApp(c *wkhttp.Context) {
 		c.ResponseError(errors.New("修改应用信息错误"))
 		return
 	}
+	audit.Record(c, "workplace.app.update", appId, before, app)
 	c.ResponseOK()
 }
 
@@ -712,6 +718,7 @@ func (m *manager) deleteApp(c *wkhttp.Context) {
 		tx.Rollback()
 		return
 	}
+	audit.Record(c, "workplace.app.delete", appId, app, nil)
 	c.ResponseOK()
 }
 
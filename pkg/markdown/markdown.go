@@ -11,10 +11,18 @@ import (
 )
 
 func ToHtml(v string) string {
+	return toHtml(v, html.CommonFlags|html.HrefTargetBlank)
+}
+
+// ToSafeHtml 转换用户提交的内容，忽略其中的原始html
+func ToSafeHtml(v string) string {
+	return toHtml(v, html.CommonFlags|html.HrefTargetBlank|html.SkipHTML|html.Safelink)
+}
+
+func toHtml(v string, htmlFlags html.Flags) string {
 	if v == "" {
 		return ""
 	}
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank
 	opts := html.RendererOptions{
 		Flags:          htmlFlags,
 		RenderNodeHook: renderHookCodeBlock,
@@ -28,8 +36,9 @@ func renderHookCodeBlock(w io.Writer, node ast.Node, entering bool) (ast.WalkSta
 
 	_, ok := node.(*ast.Code)
 	if ok {
-		fmt.Println("code-------------->")
-		w.Write([]byte(fmt.Sprintf("<pre class=\"notranslate\">%s</pre>", string(node.AsLeaf().Literal))))
+		w.Write([]byte("<pre class=\"notranslate\">"))
+		html.EscapeHTML(w, node.AsLeaf().Literal)
+		w.Write([]byte("</pre>"))
 		return ast.GoToNext, true
 	}
 
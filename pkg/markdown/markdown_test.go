@@ -2,6 +2,7 @@ package markdown
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -12,3 +13,13 @@ func TestToHtml(t *testing.T) {
 	fmt.Println("htm--->", htm)
 
 }
+
+func TestToSafeHtml(t *testing.T) {
+	htm := ToSafeHtml("**公告**<script>alert(1)</script>\n\n[link](javascript:alert(1)) `<script>`")
+	if !strings.Contains(htm, "<strong>公告</strong>") {
+		t.Fatalf("markdown not rendered: %s", htm)
+	}
+	if strings.Contains(htm, "<script>") || strings.Contains(htm, "javascript:") {
+		t.Fatalf("unsafe html rendered: %s", htm)
+	}
+}
@@ -0,0 +1,295 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Argon2id argon2id算法（默认）
+	Argon2id = "argon2id"
+	// Bcrypt bcrypt算法
+	Bcrypt = "bcrypt"
+	// Legacy 旧版的双重md5（只用于校验，不再生成）
+	Legacy = "md5"
+)
+
+var (
+	// ErrInvalidHash 无法识别的密码hash
+	ErrInvalidHash = errors.New("无法识别的密码hash")
+	// ErrIncompatibleVersion 不支持的argon2版本
+	ErrIncompatibleVersion = errors.New("不支持的argon2版本")
+)
+
+// Hasher 密码hash算法
+type Hasher interface {
+	// ID 算法标识
+	ID() string
+	// Hash 生成自描述的hash字符串
+	Hash(pwd string) (string, error)
+	// Verify 校验密码
+	Verify(pwd string, encoded string) (bool, error)
+	// NeedsRehash 参数是否已过期（例如调高了成本参数）
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher argon2id
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// NewArgon2idHasher 按OWASP推荐参数创建
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (a *Argon2idHasher) ID() string {
+	return Argon2id
+}
+
+// Hash 格式：$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func (a *Argon2idHasher) Hash(pwd string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pwd), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2idHasher) Verify(pwd string, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	otherKey := argon2.IDKey([]byte(pwd), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func (a *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != a.Memory || params.Iterations != a.Iterations || params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength || uint32(len(key)) != a.KeyLength
+}
+
+func decodeArgon2id(encoded string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, ErrIncompatibleVersion
+	}
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
+
+// BcryptHasher bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+func (b *BcryptHasher) ID() string {
+	return Bcrypt
+}
+
+// Hash 格式：$2a$10$...
+func (b *BcryptHasher) Hash(pwd string) (string, error) {
+	data, err := bcrypt.GenerateFromPassword([]byte(pwd), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (b *BcryptHasher) Verify(pwd string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(pwd))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, ErrInvalidHash
+}
+
+func (b *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+	return cost != b.Cost
+}
+
+// 旧版 md5(md5(pwd))
+type legacyHasher struct {
+}
+
+func (l *legacyHasher) ID() string {
+	return Legacy
+}
+
+func (l *legacyHasher) Hash(pwd string) (string, error) {
+	return legacyMD5(legacyMD5(pwd)), nil
+}
+
+func (l *legacyHasher) Verify(pwd string, encoded string) (bool, error) {
+	hashed, _ := l.Hash(pwd)
+	return subtle.ConstantTimeCompare([]byte(hashed), []byte(strings.ToLower(encoded))) == 1, nil
+}
+
+func (l *legacyHasher) NeedsRehash(encoded string) bool {
+	return true
+}
+
+func legacyMD5(str string) string {
+	sum := md5.Sum([]byte(str))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	hashers = map[string]Hasher{
+		Argon2id: NewArgon2idHasher(),
+		Bcrypt:   NewBcryptHasher(),
+	}
+	defaultHasherID = Argon2id
+	hashersLock     sync.RWMutex
+)
+
+// Register 注册（或替换）一个hash算法
+func Register(h Hasher) {
+	hashersLock.Lock()
+	defer hashersLock.Unlock()
+	hashers[h.ID()] = h
+}
+
+// SetDefault 设置生成新hash时使用的算法
+func SetDefault(id string) error {
+	hashersLock.Lock()
+	defer hashersLock.Unlock()
+	if _, ok := hashers[id]; !ok {
+		return fmt.Errorf("不支持的密码算法[%s]", id)
+	}
+	defaultHasherID = id
+	return nil
+}
+
+// Default 当前默认算法
+func Default() Hasher {
+	hashersLock.RLock()
+	defer hashersLock.RUnlock()
+	return hashers[defaultHasherID]
+}
+
+// Get 获取已注册的算法 id为空时返回默认算法
+func Get(id string) (Hasher, error) {
+	if id == "" {
+		return Default(), nil
+	}
+	hashersLock.RLock()
+	defer hashersLock.RUnlock()
+	h, ok := hashers[id]
+	if !ok {
+		return nil, fmt.Errorf("不支持的密码算法[%s]", id)
+	}
+	return h, nil
+}
+
+// Identify 根据hash字符串识别算法
+func Identify(encoded string) (Hasher, error) {
+	hashersLock.RLock()
+	defer hashersLock.RUnlock()
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return hashers[Argon2id], nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return hashers[Bcrypt], nil
+	case len(encoded) == 32 && isHex(encoded):
+		return &legacyHasher{}, nil
+	}
+	if strings.HasPrefix(encoded, "$") {
+		parts := strings.SplitN(encoded[1:], "$", 2)
+		if h, ok := hashers[parts[0]]; ok {
+			return h, nil
+		}
+	}
+	return nil, ErrInvalidHash
+}
+
+// Hash 使用默认算法生成hash
+func Hash(pwd string) (string, error) {
+	return Default().Hash(pwd)
+}
+
+// Verify 校验密码 needsRehash为true时表示应该用默认算法重新生成hash（旧版md5或参数已变更）
+func Verify(pwd string, encoded string) (ok bool, needsRehash bool, err error) {
+	return VerifyWith(Default(), pwd, encoded)
+}
+
+// VerifyWith 校验密码 def为当前生成新hash使用的算法，hash不是由def按当前参数生成时needsRehash为true
+func VerifyWith(def Hasher, pwd string, encoded string) (ok bool, needsRehash bool, err error) {
+	if encoded == "" {
+		return false, false, nil
+	}
+	h, err := Identify(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	ok, err = h.Verify(pwd, encoded)
+	if err != nil || !ok {
+		return false, false, err
+	}
+	return true, h.ID() != def.ID() || def.NeedsRehash(encoded), nil
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
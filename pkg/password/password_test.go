@@ -0,0 +1,91 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgon2idHashAndVerify(t *testing.T) {
+	encoded, err := Hash("123456")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=3,p=2$"))
+
+	ok, needsRehash, err := Verify("123456", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _, err = Verify("1234567", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestBcryptVerifyNeedsRehash(t *testing.T) {
+	h := &BcryptHasher{Cost: 4}
+	encoded, err := h.Hash("123456")
+	assert.NoError(t, err)
+
+	ok, needsRehash, err := Verify("123456", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash) // 默认算法是argon2id
+}
+
+func TestPolicyHasher(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Hasher = Bcrypt
+	encoded, err := policy.Hash("123456")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$2a$"))
+
+	ok, needsRehash, err := policy.Verify("123456", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	// 不修改包内的默认算法
+	ok, needsRehash, err = Verify("123456", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	policy.Hasher = "unknown"
+	_, err = policy.Hash("123456")
+	assert.Error(t, err)
+}
+
+func TestLegacyVerify(t *testing.T) {
+	encoded := "238675f80d58e96aeb8c49edce8663f6" // md5(md5("a1234567"))
+	ok, needsRehash, err := Verify("a1234567", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	ok, _, err = Verify("a12345678", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = Verify("a1234567", "not a hash")
+	assert.Equal(t, ErrInvalidHash, err)
+}
+
+func TestPolicyCheck(t *testing.T) {
+	dir := t.TempDir()
+	breachedFile := filepath.Join(dir, "breached.txt")
+	err := os.WriteFile(breachedFile, []byte("password123\n7C4A8D09CA3762AF61E59520943DC26494F8941B:24230577\n"), 0644)
+	assert.NoError(t, err)
+
+	p := &Policy{MinLength: 8, MinClasses: 3, BreachedFile: breachedFile}
+	assert.Error(t, p.Check("Ab1!"))
+	assert.Error(t, p.Check("abcdefgh1"))
+	assert.NoError(t, p.Check("Abcdefgh1"))
+
+	p.MinClasses = 0
+	p.MinLength = 6
+	assert.Equal(t, ErrBreached, p.Check("password123"))
+	assert.Equal(t, ErrBreached, p.Check("123456")) // sha1
+}
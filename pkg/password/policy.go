@@ -0,0 +1,162 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrBreached 密码出现在泄露密码库中
+	ErrBreached = errors.New("该密码已出现在泄露密码库中，请更换密码")
+)
+
+// Policy 密码策略
+type Policy struct {
+	MinLength    int    // 最小长度
+	MaxLength    int    // 最大长度 0为不限制
+	MinClasses   int    // 至少包含几类字符（大写字母、小写字母、数字、符号）
+	BreachedFile string // 泄露密码库文件（每行一个明文密码或sha1值，兼容 HASH:次数 格式） 为空不检查
+	Hasher       string // 生成新hash使用的算法 为空使用默认算法
+}
+
+// DefaultPolicy 默认策略
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength: 6,
+		MaxLength: 64,
+	}
+}
+
+// Check 检查密码是否符合策略
+func (p *Policy) Check(pwd string) error {
+	length := len([]rune(pwd))
+	if p.MinLength > 0 && length < p.MinLength {
+		return fmt.Errorf("密码长度不能小于%d位", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("密码长度不能大于%d位", p.MaxLength)
+	}
+	if p.MinClasses > 0 && charClasses(pwd) < p.MinClasses {
+		return fmt.Errorf("密码需至少包含大写字母、小写字母、数字、符号中的%d种", p.MinClasses)
+	}
+	if p.BreachedFile != "" {
+		breached, err := defaultBreachedList.contains(p.BreachedFile, pwd)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrBreached
+		}
+	}
+	return nil
+}
+
+// Hash 使用策略指定的算法生成hash
+func (p *Policy) Hash(pwd string) (string, error) {
+	h, err := Get(p.Hasher)
+	if err != nil {
+		return "", err
+	}
+	return h.Hash(pwd)
+}
+
+// Verify 校验密码 needsRehash为true时表示应该用策略指定的算法重新生成hash
+func (p *Policy) Verify(pwd string, encoded string) (ok bool, needsRehash bool, err error) {
+	h, err := Get(p.Hasher)
+	if err != nil {
+		return false, false, err
+	}
+	return VerifyWith(h, pwd, encoded)
+}
+
+func charClasses(pwd string) int {
+	var upper, lower, digit, symbol int
+	for _, c := range pwd {
+		switch {
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		case !unicode.IsSpace(c):
+			symbol = 1
+		}
+	}
+	return upper + lower + digit + symbol
+}
+
+var defaultBreachedList = &breachedList{}
+
+// 泄露密码库 文件变化后自动重新加载
+type breachedList struct {
+	sync.RWMutex
+	path    string
+	modTime time.Time
+	set     map[string]struct{}
+}
+
+func (b *breachedList) contains(path string, pwd string) (bool, error) {
+	set, err := b.load(path)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := set[pwd]; ok {
+		return true, nil
+	}
+	sum := sha1.Sum([]byte(pwd))
+	_, ok := set[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return ok, nil
+}
+
+func (b *breachedList) load(path string) (map[string]struct{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取泄露密码库失败：%w", err)
+	}
+	b.RLock()
+	if b.path == path && b.modTime.Equal(info.ModTime()) {
+		set := b.set
+		b.RUnlock()
+		return set, nil
+	}
+	b.RUnlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取泄露密码库失败：%w", err)
+	}
+	defer f.Close()
+	set := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if idx := strings.Index(line, ":"); idx == 40 && isHex(line[:idx]) { // HASH:次数
+			line = line[:idx]
+		}
+		if len(line) == 40 && isHex(line) {
+			line = strings.ToUpper(line)
+		}
+		set[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取泄露密码库失败：%w", err)
+	}
+	b.Lock()
+	b.path = path
+	b.modTime = info.ModTime()
+	b.set = set
+	b.Unlock()
+	return set, nil
+}